@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Jaywalker/iemitm/ie"
+)
+
+// Where to write the characters we see, or "" to not write them
+var characterDumpDir string
+
+// dumpCharacter writes the CRE a PLAYERCHAR or OBJECT_ADD message carries to characterDumpDir. The file name has
+// the time, message, slot and owner, so backups sort in the order they were sent and can be diffed against
+// each other.
+func dumpCharacter(name string, msg ie.CharacterMsg) {
+	if characterDumpDir == "" {
+		return
+	}
+	character := msg.Character()
+	if len(character.CRE) == 0 {
+		return
+	}
+	slot := "noslot"
+	if character.Slot >= 0 {
+		slot = fmt.Sprintf("slot%d", character.Slot)
+	}
+	fileName := fmt.Sprintf("%s-%s-%s-player%x.cre", time.Now().Format("20060102-150405.000"), strings.ToLower(name), slot, character.OwnerID)
+	path := filepath.Join(characterDumpDir, fileName)
+	if err := os.WriteFile(path, character.CRE, 0644); err != nil {
+		fmt.Fprintln(rl, "ERROR: Failed to dump character:", err)
+		return
+	}
+	fmt.Fprintln(rl, "Dumped character to", path)
+}
+
+func init() {
+	for _, subType := range []uint8{ie.IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_UPDATE_DEMAND, ie.IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_UPDATE_REPLY, ie.IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_DEMAND_REPLY} {
+		handleSpecMsg(ie.IE_SPEC_MSG_TYPE_PLAYERCHAR, subType, printCharacter)
+	}
+	handleSpecMsg(ie.IE_SPEC_MSG_TYPE_OBJECT, ie.IE_SPEC_MSG_SUBTYPE_OBJECT_ADD, printCharacter)
+}
+
+func printCharacter(event specMsgEvent) {
+	printSpecMsg(event)
+	if msg, ok := event.msg.(ie.CharacterMsg); ok {
+		dumpCharacter(event.name, msg)
+	}
+}
+
+func setCharacterDumpDir(dir string) {
+	if dir == "off" {
+		characterDumpDir = ""
+		fmt.Fprintln(rl, "Character dumps disabled.")
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintln(rl, "ERROR:", err)
+		return
+	}
+	characterDumpDir = dir
+	fmt.Fprintln(rl, "Dumping characters to", dir)
+	needGuesses("PLAYERCHAR and OBJECT_ADD")
+}
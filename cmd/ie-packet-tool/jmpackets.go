@@ -2,14 +2,57 @@ package main
 
 import (
 	"bytes"
-	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 
 	"github.com/Jaywalker/iemitm/ie"
 	"github.com/Jaywalker/iemitm/interprocess"
 )
 
+// specMsgEvent is a spec message we decoded, with the packet it came in
+type specMsgEvent struct {
+	packet   interprocess.PacketData
+	jmPacket ie.JMPacket
+	name     string
+	msg      ie.SpecMsg
+	guessed  bool // msg was decoded with a layout no capture has checked
+}
+
+// What to do with a spec message, by type and subtype. Features register their handlers in init; anything without
+// one is just printed.
+var specMsgHandlers = make(map[[2]uint8]func(specMsgEvent))
+
+// Things that want to see every spec message we decode, before its handler runs
+var specMsgObservers []func(specMsgEvent)
+
+func handleSpecMsg(msgType, msgSubType uint8, handler func(specMsgEvent)) {
+	specMsgHandlers[[2]uint8{msgType, msgSubType}] = handler
+}
+
+func observeSpecMsgs(observer func(specMsgEvent)) {
+	specMsgObservers = append(specMsgObservers, observer)
+}
+
+// Decode the spec messages we only have guessed layouts for. Their field names haven't been checked against a capture,
+// so it's off until asked for.
+var showGuesses bool
+
+// needGuesses is for the commands that show what we've tracked from messages we only have guessed layouts for
+func needGuesses(messages string) {
+	if !showGuesses {
+		fmt.Fprintln(rl, messages, "layouts are only guesses and aren't tracked until guesses are enabled")
+	}
+}
+
+func printSpecMsg(event specMsgEvent) {
+	name := event.name
+	if event.guessed {
+		name += " (guessed layout)"
+	}
+	fmt.Fprintln(rl, event.packet.Source, " => ", event.packet.Dest, ": ", name+" "+event.msg.String())
+}
+
 func processJMPacket(packet interprocess.PacketData, header ie.IEHeader) (forward bool) {
 	defer fmt.Fprintln(rl, "--------------------------")
 	printDebug("FULL: " + packet.Source + " => " + packet.Dest + header.String() + " - " + hex.EncodeToString(packet.Data[:packet.Size]))
@@ -21,72 +64,75 @@ func processJMPacket(packet interprocess.PacketData, header ie.IEHeader) (forwar
 		return
 	}
 
-	var decompressed []byte
-	if jmPacket.IsCompressed() {
-		if jmPacket.PacketLength() > 0 {
-			decompressed, err = decompress(jmPacket.PacketData())
-			if err != nil {
-				fmt.Fprintln(rl, "ERROR: Failed to decompress data:", err)
-				return
-			}
-		}
-	} else {
-		decompressed = jmPacket.PacketData()
+	decompressed, err := ie.DecompressPayload(jmPacket)
+	if err != nil {
+		fmt.Fprintln(rl, "ERROR: Failed to decompress data:", err)
+		return
 	}
 
 	if jmPacket.IsSpecMsg() {
-		printDebug("Spec Message! 0x%x", packet.Data[ie.JMHeaderSize:ie.JMHeaderSize+1])
-		switch jmPacket.SpecType() {
-		case ie.IE_SPEC_MSG_TYPE_MPSETTINGS:
-			switch jmPacket.SpecSubType() {
-			case ie.IE_SPEC_MSG_SUBTYPE_UPDATE_SERVER_ARBITRATION_INFO:
-				var servStatus ie.IEMPSettingsFullSet
-				if err := binary.Read(bytes.NewReader(decompressed), binary.BigEndian, &servStatus); err != nil {
-					fmt.Fprintln(rl, "binary.Read failed:", err)
-					fmt.Fprintln(rl, packet.Source, " => ", packet.Dest, ": ", jmPacket.String()+" - ", hex.EncodeToString(decompressed))
-				} else {
-					fmt.Fprintln(rl, servStatus.String())
-				}
-			case ie.IE_SPEC_MSG_SUBTYPE_TOGGLE_CHAR_READY:
-				var charReady ie.IEMPSettingsToggleCharReady
-				if err := binary.Read(bytes.NewReader(decompressed), binary.BigEndian, &charReady); err != nil {
-					fmt.Fprintln(rl, "binary.Read failed:", err)
-					fmt.Fprintln(rl, packet.Source, " => ", packet.Dest, ": ", jmPacket.String(), " - ", hex.EncodeToString(decompressed))
-				} else {
-					fmt.Fprintf(rl, "Player 0x%x Indicates %s\n", jmPacket.FromPlayerID(), charReady.String())
-				}
-			default:
-				fmt.Fprintln(rl, "Unknown JM Spec Msg Type: ", packet.Source, " => ", packet.Dest, ": ", jmPacket.String(), " - ", hex.EncodeToString(decompressed))
-			}
-		case ie.IE_SPEC_MSG_TYPE_VERSION:
-			switch jmPacket.SpecSubType() {
-			case ie.IE_SPEC_MSG_SUBTYPE_VERSION_SERVER:
-				var introHeader ie.IEVersionHeader
-				if err := binary.Read(bytes.NewReader(decompressed[:ie.IEVersionHeaderSize]), binary.BigEndian, &introHeader); err != nil {
-					fmt.Fprintln(rl, "binary.Read header failed:", err)
-					fmt.Fprintln(rl, packet.Source, " => ", packet.Dest, ": ", jmPacket.String(), " - ", hex.EncodeToString(decompressed))
-					return
-				}
-				var introFooter ie.IEVersionFooter
-				if err := binary.Read(bytes.NewReader(decompressed[(ie.IEVersionHeaderSize+int(introHeader.VersionStringLen)):]), binary.BigEndian, &introFooter); err != nil {
-					fmt.Fprintln(rl, "binary.Read footer failed:", err)
-					fmt.Fprintln(rl, packet.Source, " => ", packet.Dest, ": ", jmPacket.String(), " - ", hex.EncodeToString(decompressed))
-					return
-				}
-				intro := ie.IEVersion{introHeader, string(decompressed[ie.IEVersionHeaderSize:(ie.IEVersionHeaderSize + int(introHeader.VersionStringLen))]), introFooter}
-				fmt.Fprintln(rl, packet.Source, " => ", packet.Dest, ": ", intro.String())
-
-			default:
-				fmt.Fprintln(rl, "Unknown JM Spec Msg Type: ", packet.Source, " => ", packet.Dest, ": ", jmPacket.String(), " - ", hex.EncodeToString(decompressed))
-			}
-		default:
-			fmt.Fprintln(rl, "Unknown JM Spec Msg Type: ", packet.Source, " => ", packet.Dest, ": ", jmPacket.String()+" - ", hex.EncodeToString(decompressed))
+		printDebug("Spec Message! 0x%x", jmPacket.SpecType())
+		msg, err := gameProfile.DecodeSpecMsg(jmPacket.SpecType(), jmPacket.SpecSubType(), decompressed)
+		guessed := false
+		if errors.Is(err, ie.ErrNoSpecDecoder) && showGuesses {
+			msg, err = gameProfile.GuessSpecMsg(jmPacket.SpecType(), jmPacket.SpecSubType(), decompressed)
+			guessed = err == nil
+		}
+		if errors.Is(err, ie.ErrNoSpecDecoder) {
+			fmt.Fprintln(rl, "Unknown JM Spec Msg Type: ", packet.Source, " => ", packet.Dest, ": ", jmPacket.String(), " - ", hex.EncodeToString(decompressed))
+			return
+		} else if err != nil {
+			fmt.Fprintln(rl, err.Error())
+			fmt.Fprintln(rl, packet.Source, " => ", packet.Dest, ": ", jmPacket.String(), " - ", hex.EncodeToString(decompressed))
+			return
+		}
+		warnUnverified(jmPacket.SpecType(), jmPacket.SpecSubType())
+		_, name := ie.SpecMsgNames(jmPacket.SpecType(), jmPacket.SpecSubType())
+		event := specMsgEvent{packet: packet, jmPacket: jmPacket, name: name, msg: msg, guessed: guessed}
+		for _, observer := range specMsgObservers {
+			observer(event)
+		}
+		if handler, ok := specMsgHandlers[[2]uint8{jmPacket.SpecType(), jmPacket.SpecSubType()}]; ok {
+			handler(event)
+		} else {
+			printSpecMsg(event)
 		}
 	} else {
-		printDebug("Not a Spec Message! 0x%x", packet.Data[ie.JMHeaderSize:ie.JMHeaderSize+1])
+		printDebug("Not a Spec Message!")
 		// Non-Spec messages are just messages from players
-		ieMsg := ie.IEMsg{decompressed[0], string(decompressed[1:jmPacket.DataLength()])}
+		ieMsg, err := ie.ParseIEMsg(decompressed)
+		if err != nil {
+			fmt.Fprintln(rl, err.Error())
+			fmt.Fprintln(rl, packet.Source, " => ", packet.Dest, ": ", jmPacket.String(), " - ", hex.EncodeToString(decompressed))
+			return
+		}
 		fmt.Fprintln(rl, "Got Message: "+ieMsg.String())
 	}
 	return
 }
+
+// processJMFragment holds on to the fragments of a message and decodes it once the last one arrives. The fragments
+// are forwarded as they come, so dropping the message only drops its last fragment, and a handler can't rewrite it:
+// the rewrite is reported and skipped.
+func processJMFragment(packet interprocess.PacketData, header ie.IEHeader) (forward bool) {
+	forward = true
+	message, complete, err := reassembler.Add(packet.Data[:packet.Size])
+	if err != nil {
+		fmt.Fprintln(rl, "ERROR:", err)
+	}
+	if !complete {
+		index, count, _ := ie.JMFragment(packet.Data[:packet.Size])
+		printDebug("%s => %s: Fragment %d of %d", packet.Source, packet.Dest, index+1, count)
+		return
+	}
+	// Anything processJMPacket wants to replace is the whole message, not the fragment we're about to forward
+	saved := replaceData
+	packet.Data = message
+	packet.Size = len(message)
+	forward = processJMPacket(packet, header)
+	if !bytes.Equal(replaceData, saved) {
+		fmt.Fprintln(rl, "WARNING:", packet.Source, "=>", packet.Dest, "message came in fragments that have already been forwarded, not rewriting it")
+		replaceData = saved
+	}
+	return
+}
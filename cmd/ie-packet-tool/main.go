@@ -2,18 +2,18 @@ package main
 
 import (
 	"bytes"
-	"compress/zlib"
 	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/Jaywalker/iemitm/crc"
 	"github.com/Jaywalker/iemitm/ie"
 	"github.com/Jaywalker/iemitm/interprocess"
 	"github.com/chzyer/readline"
@@ -21,24 +21,50 @@ import (
 
 var rl *readline.Instance
 
-var crcDecoder *crc.CRC
-
 var debug bool
 
 var clientID uint32
 var serverID uint32
 var forwardPings bool
 var forwardDplayPings bool
-var clientFrameNumber uint16
-var serverFrameNumber uint16
-var clientExpectedFrameNumber uint16
-var serverExpectedFrameNumber uint16
 
-var crcChecker *crc.CRC
+// sequence renumbers the frames going through us around the ones we inject or drop
+var sequence = ie.NewSequenceTracker()
+
+// How long the host gets to answer a DIALOG, SWAPITEM or PAUSING request before we report it
+const arbitrationTimeout = 5 * time.Second
+
+var arbitration = ie.NewArbitrationTracker(arbitrationTimeout)
+
+var partyJournal = ie.NewPartyJournal()
+
+func init() {
+	observeSpecMsgs(func(event specMsgEvent) {
+		jmPacket := event.jmPacket
+		if result := arbitration.Observe(jmPacket.FromPlayerID(), jmPacket.ToPlayerID(), jmPacket.SpecType(), jmPacket.SpecSubType(), event.msg, time.Now()); result != nil {
+			fmt.Fprintln(rl, "Arbitration:", result.String())
+		}
+		partyJournal.Apply(jmPacket.FromPlayerID(), jmPacket.SpecType(), jmPacket.SpecSubType(), event.msg)
+	})
+}
+
+// identCounter counts frames by their two letter ident, so we can see how much we can't decode yet
+var identCounter = ie.NewIdentCounter()
+
+// reassembler holds on to the fragments of messages too big for one frame
+var reassembler = ie.NewReassembler()
+
+type queuedPacket struct {
+	to   string
+	data []byte
+}
+
+// Packets we're injecting, one goes out with each response to iemitm
+var sendQueue []queuedPacket
+var sendQueueLock sync.Mutex
 
-var sendBuf []byte
-var sendBufTo string
-var sendBufWaiting bool
+// replaceData is forwarded by iemitm instead of the packet we're processing
+var replaceData []byte
 
 func printDebug(str string, args ...any) {
 	if debug {
@@ -49,24 +75,20 @@ func printDebug(str string, args ...any) {
 	}
 }
 
-func decompress(data []byte) ([]byte, error) {
-	b := bytes.NewReader(data)
-	z, err := zlib.NewReader(b)
-	if err != nil {
-		return nil, err
-	}
-	defer z.Close()
-	p, err := ioutil.ReadAll(z)
-	if err != nil {
-		return nil, err
-	}
-	return p, nil
-}
-
 func processPacket(packet interprocess.PacketData) (forward bool) {
 	forward = true
+	if packet.Size < 0 || packet.Size > len(packet.Data) {
+		fmt.Fprintln(rl, "ERROR: Packet size", packet.Size, "doesn't fit in", len(packet.Data), "bytes of data")
+		return
+	}
+	followProfile(packet.Profile)
+	if packet.BadCRC {
+		// The game drops it, so it's no frame of the sequence to renumber or record. It goes through as it came.
+		fmt.Fprintln(rl, "WARNING:", packet.Source, "=>", packet.Dest, "frame has a bad CRC, the game will drop it - forwarding it untouched")
+		return
+	}
 	var header ie.IEHeader
-	if err := binary.Read(bytes.NewReader(packet.Data), binary.BigEndian, &header); err != nil {
+	if err := binary.Read(bytes.NewReader(packet.Data[:packet.Size]), binary.BigEndian, &header); err != nil {
 		fmt.Fprintln(rl, "binary.Read failed:", err)
 		return
 	}
@@ -79,28 +101,33 @@ func processPacket(packet interprocess.PacketData) (forward bool) {
 		}
 	}
 
-	if header.PlayerIDFrom != serverID {
-		if clientFrameNumber < header.FrameNum {
-			clientFrameNumber = header.FrameNum
-			printDebug("Client frame number updated to %x", clientFrameNumber)
-		} else if clientExpectedFrameNumber < header.FrameExpected {
-			clientExpectedFrameNumber = header.FrameExpected
-			printDebug("Client expected frame number updated to %x", clientExpectedFrameNumber)
-		}
-	} else if header.PlayerIDFrom == serverID {
-		if serverFrameNumber < header.FrameNum {
-			serverFrameNumber = header.FrameNum
-			printDebug("Server frame number updated to %x", serverFrameNumber)
-		} else if serverExpectedFrameNumber < header.FrameExpected {
-			serverExpectedFrameNumber = header.FrameExpected
-			printDebug("Server expected frame number updated to %x", serverExpectedFrameNumber)
-		}
+	for _, result := range arbitration.Expire(time.Now()) {
+		fmt.Fprintln(rl, "Arbitration:", result.String())
 	}
+	resendInjected()
 
 	if packet.Size == 36 { // Pre-Name, Post-Auth Ping
 		fmt.Fprintln(rl, "DPlay Ping/Pong")
 		return forwardDplayPings
-	} else if packet.Size == ie.IEHeaderSize && (header.FrameKind_ == 1 || header.FrameKind_ == 2) { // Ping! Apparently pings can be frameKind 1 or 2?
+	}
+
+	info, err := sequence.Forward(packet.Data[:packet.Size])
+	if err != nil {
+		fmt.Fprintln(rl, "ERROR:", err)
+		return
+	}
+	if info.Drop {
+		printDebug("Dropping a retransmit of frame 0x%x, which was dropped or already acked", info.FrameNum)
+		return false
+	}
+	if info.Rewritten {
+		printDebug("Frame 0x%x renumbered", info.FrameNum)
+		replaceData = append([]byte{}, packet.Data[:packet.Size]...)
+		// The header was rewritten in place
+		binary.Read(bytes.NewReader(packet.Data[:packet.Size]), binary.BigEndian, &header)
+	}
+
+	if packet.Size == ie.IEHeaderSize && (header.FrameKind_ == 1 || header.FrameKind_ == 2) { // Ping! Apparently pings can be frameKind 1 or 2?
 		/*
 			DEBUG: FULL: Server => ClientIEHead PlayerFrom: 0x1000000 PlayerTo: 0xad4f6f00 FrameKind: 0x2 FrameNumber: 0x0 FrameExpected: 0xc88 Compressed?: 0x0 CRC32: 0x31b62cfc - 01000000ad4f6f000200000c880031b62cfc
 			ERROR: JMSpecHeaderSize > size
@@ -109,18 +136,106 @@ func processPacket(packet interprocess.PacketData) (forward bool) {
 		// fmt.Fprintln(rl, "")
 		// fmt.Fprintln(rl, "Ping!")
 		return forwardPings
+	} else if packet.Size < ie.IEHeaderSize+2 {
+		fmt.Fprintln(rl, "Packet too short for a Two Letter Ident")
+		fmt.Fprintln(rl, packet.Source, " => ", packet.Dest, ": ", header.String(), " - ", hex.EncodeToString(packet.Data[ie.IEHeaderSize:packet.Size]))
 	} else {
-		twoLetterIdent := string(packet.Data[ie.IEHeaderSize : ie.IEHeaderSize+2])
-		if twoLetterIdent == "JM" {
+		frame := packet.Data[:packet.Size]
+		msg, err := ie.DecodeFrame(frame)
+		identCounter.Observe(frame, err)
+		twoLetterIdent, _ := ie.FrameIdent(frame)
+		switch {
+		case twoLetterIdent == "JM":
+			if ie.IsJMFragment(frame) {
+				return processJMFragment(packet, header)
+			}
 			return processJMPacket(packet, header)
-		} else {
-			fmt.Fprintln(rl, "Unhandled Two Letter Ident")
+		case errors.Is(err, ie.ErrNoIdentDecoder):
+			fmt.Fprintf(rl, "Unhandled Two Letter Ident %q, only JM is decoded\n", twoLetterIdent)
+			if raw, err := ie.DecodeRawFrame(frame); err == nil {
+				fmt.Fprintln(rl, packet.Source, " => ", packet.Dest, ": ", raw.String())
+			}
+		case err != nil:
+			fmt.Fprintln(rl, err.Error())
 			fmt.Fprintln(rl, packet.Source, " => ", packet.Dest, ": ", header.String(), " - ", hex.EncodeToString(packet.Data[ie.IEHeaderSize:packet.Size]))
+		default:
+			fmt.Fprintln(rl, packet.Source, " => ", packet.Dest, ": ", msg.String())
 		}
 	}
 	return
 }
 
+// nextFrameHeader takes the next frame number in the target's direction for a packet we're injecting. Packets to
+// the server come from the client and packets to the client come from the server. It returns false until the sender
+// has sent a frame of its own.
+func nextFrameHeader(target string) (ie.IEHeader, bool) {
+	if target == "server" {
+		return sequence.Next(clientID, serverID)
+	}
+	return sequence.Next(serverID, clientID)
+}
+
+// queueJMPacket leaves a packet to go out with our responses to the next packets from iemitm. Its headers come from
+// nextFrameHeader, and a packet too big for one frame is split into fragments.
+func queueJMPacket(to string, packet ie.JMPacket) {
+	data, err := packet.Marshal()
+	if err != nil {
+		fmt.Fprintln(rl, "Error: failed to serialize ", err)
+		return
+	}
+	fragments, err := ie.Split(data, ie.MaxFrameData, func() (ie.IEHeader, bool) { return nextFrameHeader(to) })
+	if errors.Is(err, ie.ErrNoFrameHeader) {
+		fmt.Fprintln(rl, "Error: no frames have gone to the", to, "yet, so there's no FrameNum to give this one")
+		return
+	} else if err != nil {
+		fmt.Fprintln(rl, "Error: failed to split ", err)
+		return
+	}
+	now := time.Now()
+	sendQueueLock.Lock()
+	for _, fragment := range fragments {
+		sequence.Injected(fragment, now)
+		sendQueue = append(sendQueue, queuedPacket{to, fragment})
+	}
+	sendQueueLock.Unlock()
+	for _, fragment := range fragments {
+		fmt.Fprintln(rl, "Serialized: ", hex.EncodeToString(fragment))
+	}
+}
+
+// How long a frame we injected waits for an ack before we send it again. The game only retransmits its own frames.
+const injectedResendInterval = time.Second
+
+// resendInjected queues the frames we injected that the other side hasn't acked yet
+func resendInjected() {
+	frames := sequence.Unacked(time.Now(), injectedResendInterval)
+	if len(frames) == 0 {
+		return
+	}
+	sendQueueLock.Lock()
+	defer sendQueueLock.Unlock()
+	for _, frame := range frames {
+		to := "client"
+		if frame.To == serverID {
+			to = "server"
+		}
+		printDebug("Resending unacked frame to %s: %s", to, hex.EncodeToString(frame.Data))
+		sendQueue = append(sendQueue, queuedPacket{to, frame.Data})
+	}
+}
+
+// nextQueuedPacket takes the next packet we're injecting off the queue
+func nextQueuedPacket() (queuedPacket, bool) {
+	sendQueueLock.Lock()
+	defer sendQueueLock.Unlock()
+	if len(sendQueue) == 0 {
+		return queuedPacket{}, false
+	}
+	queued := sendQueue[0]
+	sendQueue = sendQueue[1:]
+	return queued, true
+}
+
 var completer = readline.NewPrefixCompleter(
 	readline.PcItem("sendraw",
 		readline.PcItem("client"),
@@ -130,6 +245,18 @@ var completer = readline.NewPrefixCompleter(
 		readline.PcItem("client"),
 		readline.PcItem("server"),
 	),
+	readline.PcItem("set",
+		readline.PcItem("client", settingCompleters()...),
+		readline.PcItem("server", settingCompleters()...),
+	),
+	readline.PcItem("kick"),
+	readline.PcItem("version",
+		readline.PcItem("string"),
+		readline.PcItem("expansion"),
+		readline.PcItem("timer"),
+		readline.PcItem("off"),
+	),
+	readline.PcItem("profile", profileCompleters()...),
 	readline.PcItem("dplay",
 		readline.PcItem("pings",
 			readline.PcItem("enable"),
@@ -140,6 +267,22 @@ var completer = readline.NewPrefixCompleter(
 		readline.PcItem("enable"),
 		readline.PcItem("disable"),
 	),
+	readline.PcItem("guesses",
+		readline.PcItem("enable"),
+		readline.PcItem("disable"),
+	),
+	readline.PcItem("arbitration"),
+	readline.PcItem("frames"),
+	readline.PcItem("fragments"),
+	readline.PcItem("idents"),
+	readline.PcItem("journal"),
+	readline.PcItem("bio"),
+	readline.PcItem("timeline",
+		readline.PcItem("clear"),
+	),
+	readline.PcItem("dumpchars",
+		readline.PcItem("off"),
+	),
 	readline.PcItem("debug"),
 	readline.PcItem("exit"),
 	readline.PcItem("quit"),
@@ -156,17 +299,10 @@ func filterInput(r rune) (rune, bool) {
 }
 
 func main() {
-	crcChecker = crc.New()
-
-	sendBufWaiting = false
 	debug = false
 	forwardPings = true
 	clientID = 0
 	serverID = 0x1000000
-	clientFrameNumber = 0
-	serverFrameNumber = 0
-	clientExpectedFrameNumber = 0
-	serverExpectedFrameNumber = 0
 
 	var err error
 	rl, err = readline.NewEx(&readline.Config{
@@ -189,8 +325,6 @@ func main() {
 
 	// =================================================================================================
 
-	crcDecoder = crc.New()
-
 	tcpRemoteAddr, err := net.ResolveTCPAddr("tcp", "192.168.122.1:9988")
 	if err != nil {
 		panic(err)
@@ -216,16 +350,18 @@ func main() {
 				break
 			} else {
 				forward := processPacket(packet)
+				if !forward {
+					sequence.Drop(packet.Data[:packet.Size])
+				}
 
 				encoder := gob.NewEncoder(conn)
 				resp := &interprocess.RespPacketData{}
 				resp.Forward = forward
-				if sendBufWaiting {
-					sendBufWaiting = false
-					resp.Dest = sendBufTo
-					resp.Data = append([]byte{}, sendBuf...)
-					sendBuf = []byte{}
-					sendBufTo = ""
+				resp.ReplaceData = replaceData
+				replaceData = nil
+				if queued, ok := nextQueuedPacket(); ok {
+					resp.Dest = queued.to
+					resp.Data = queued.data
 				}
 				encoder.Encode(resp)
 				if err != nil {
@@ -262,85 +398,23 @@ func main() {
 				fmt.Fprintln(rl, "Invalid target. Valid targets are: client server")
 			}
 		case strings.HasPrefix(line, "sendmsg "):
-			if strings.HasPrefix(line[8:], "server") {
-				fmt.Fprintln(rl, "Sending to server")
-
-				serverFrameNumber += 1 // TODO: Do I need to add 1 to this before?
-
-				msgPacket := ie.IEMsgPacket{}
-				msgPacket.PlayerIDFrom = serverID
-				msgPacket.PlayerIDTo = clientID
-				msgPacket.FrameKind_ = 0
-				msgPacket.FrameNum = serverFrameNumber
-				msgPacket.FrameExpected = serverExpectedFrameNumber
-				msgPacket.Compressed = 0
-				msgPacket.CRC32 = 0
-				msgPacket.JM[0] = 'J'
-				msgPacket.JM[1] = 'M'
-				msgPacket.Unknown1 = 0
-				msgPacket.Unknown2 = 1
-				msgPacket.Message = strings.Replace(line, "sendmsg server ", "", 1)
-				msgPacket.MessageLength = byte(len(msgPacket.Message))
-				msgPacket.PacketLen = uint16(msgPacket.MessageLength) + 1
-
-				serialbuf, err := msgPacket.Serialize()
-				if err != nil {
-					fmt.Fprintln(rl, "Error: failed to serialize ", err)
-				} else {
-					size := len(serialbuf)
-					validatedCrc := crcChecker.Calculate(serialbuf[8:], uint32(size-8))
-					msgPacket.CRC32 = validatedCrc
-					serialbuf, err := msgPacket.Serialize()
-					if err != nil {
-						fmt.Fprintln(rl, "Error: failed to serialize ", err)
-					} else {
-						sendBuf = append([]byte{}, serialbuf...)
-						sendBufTo = "server"
-						sendBufWaiting = true
-						fmt.Fprintln(rl, "Serialized: ", hex.EncodeToString(serialbuf))
-					}
-				}
-			} else if strings.HasPrefix(line[8:], "client") {
-				fmt.Fprintln(rl, "Sending to client")
-
-				clientFrameNumber += 1 // TODO: Do I need to add 1 to this before?
-
-				msgPacket := ie.IEMsgPacket{}
-				msgPacket.PlayerIDFrom = serverID
-				msgPacket.PlayerIDTo = clientID
-				msgPacket.FrameKind_ = 0
-				msgPacket.FrameNum = clientFrameNumber
-				msgPacket.FrameExpected = clientExpectedFrameNumber
-				msgPacket.Compressed = 0
-				msgPacket.CRC32 = 0
-				msgPacket.JM[0] = 'J'
-				msgPacket.JM[1] = 'M'
-				msgPacket.Unknown1 = 0
-				msgPacket.Unknown2 = 1
-				msgPacket.Message = strings.Replace(line, "sendmsg client ", "", 1)
-				msgPacket.MessageLength = byte(len(msgPacket.Message))
-				msgPacket.PacketLen = uint16(msgPacket.MessageLength) + 1
-
-				serialbuf, err := msgPacket.Serialize()
-				if err != nil {
-					fmt.Fprintln(rl, "Error: failed to serialize ", err)
-				} else {
-					size := len(serialbuf)
-					validatedCrc := crcChecker.Calculate(serialbuf[8:], uint32(size-8))
-					msgPacket.CRC32 = validatedCrc
-					serialbuf, err := msgPacket.Serialize()
-					if err != nil {
-						fmt.Fprintln(rl, "Error: failed to serialize ", err)
-					} else {
-						sendBuf = append([]byte{}, serialbuf...)
-						sendBufTo = "client"
-						sendBufWaiting = true
-						fmt.Fprintln(rl, "Serialized: ", hex.EncodeToString(serialbuf))
-					}
-				}
-			} else {
+			target, message, _ := strings.Cut(line[8:], " ")
+			if target != "server" && target != "client" {
 				fmt.Fprintln(rl, "Invalid target. Valid targets are: client server")
+				break
+			}
+			fmt.Fprintln(rl, "Sending to", target)
+			if len(message) > ie.MaxIEMsgLength {
+				fmt.Fprintln(rl, "Error: messages can be at most", ie.MaxIEMsgLength, "bytes")
+				break
+			}
+
+			packet, err := ie.NewJMMessage(ie.IEHeader{}, false, 0, 0, append([]byte{byte(len(message))}, message...))
+			if err != nil {
+				fmt.Fprintln(rl, "Error: failed to build message ", err)
+				break
 			}
+			queueJMPacket(target, packet)
 		case line == "pings disable":
 			forwardPings = false
 			fmt.Fprintln(rl, "Pings disabled.")
@@ -353,6 +427,65 @@ func main() {
 		case line == "dplay pings enable":
 			forwardDplayPings = true
 			fmt.Fprintln(rl, "Dplay pings enabled.")
+		case line == "guesses enable":
+			showGuesses = true
+			fmt.Fprintln(rl, "Guessed layouts enabled. Their field names haven't been checked against a capture.")
+		case line == "guesses disable":
+			showGuesses = false
+			fmt.Fprintln(rl, "Guessed layouts disabled.")
+		case line == "frames":
+			for direction, stats := range sequence.Stats() {
+				fmt.Fprintf(rl, "0x%x => 0x%x: %s\n", direction.From, direction.To, stats.String())
+			}
+		case line == "fragments":
+			for _, pending := range reassembler.Pending() {
+				fmt.Fprintln(rl, pending)
+			}
+		case line == "idents":
+			for _, stats := range identCounter.Stats() {
+				fmt.Fprintln(rl, stats.String())
+			}
+			frames, totalFrames, undecodedBytes, totalBytes := identCounter.Undecoded()
+			if totalFrames > 0 {
+				fmt.Fprintf(rl, "Undecoded: %d of %d frames (%.1f%%), %d of %d bytes (%.1f%%)\n", frames, totalFrames, 100*float64(frames)/float64(totalFrames), undecodedBytes, totalBytes, 100*float64(undecodedBytes)/float64(totalBytes))
+			}
+			if frames > 0 {
+				fmt.Fprintln(rl, "Only JM has a decoder. Frames with other idents are dumped as they arrive.")
+			}
+		case line == "arbitration":
+			needGuesses("DIALOG, SWAPITEM and PAUSING")
+			stats := arbitration.Stats()
+			flows := make([]string, 0, len(stats))
+			for flow := range stats {
+				flows = append(flows, flow)
+			}
+			sort.Strings(flows)
+			for _, flow := range flows {
+				fmt.Fprintln(rl, flow+":", stats[flow].String())
+			}
+		case line == "journal":
+			needGuesses("JOURNAL and BIOGRAPHY")
+			fmt.Fprint(rl, partyJournal.String())
+			for _, pending := range partyJournal.Pending() {
+				fmt.Fprintln(rl, "Not announced:", pending)
+			}
+		case line == "bio":
+			needGuesses("JOURNAL and BIOGRAPHY")
+			biographies := partyJournal.Biographies()
+			characters := make([]int, 0, len(biographies))
+			for characterNum := range biographies {
+				characters = append(characters, int(characterNum))
+			}
+			sort.Ints(characters)
+			for _, characterNum := range characters {
+				fmt.Fprintf(rl, "Character %d: %s\n", characterNum, biographies[uint8(characterNum)])
+			}
+		case line == "timeline":
+			printTimeline()
+		case line == "timeline clear":
+			clearTimeline()
+		case strings.HasPrefix(line, "dumpchars "):
+			setCharacterDumpDir(strings.TrimSpace(line[10:]))
 		case line == "debug":
 			if !debug {
 				fmt.Fprintln(rl, "Debug Enabled")
@@ -360,7 +493,14 @@ func main() {
 				fmt.Fprintln(rl, "Debug Disabled")
 			}
 			debug = !debug
-		// case line == "set char ready 0":
+		case line == "profile" || strings.HasPrefix(line, "profile "):
+			setProfile(strings.TrimSpace(strings.TrimPrefix(line, "profile")))
+		case line == "version" || strings.HasPrefix(line, "version "):
+			setVersionRewrite(strings.TrimSpace(strings.TrimPrefix(line, "version")))
+		case strings.HasPrefix(line, "kick "):
+			sendKick(strings.Fields(line[5:]))
+		case strings.HasPrefix(line, "set "):
+			sendSetting(strings.Fields(line[4:]))
 		case line == "exit":
 			fallthrough
 		case line == "quit":
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Jaywalker/iemitm/ie"
+	"github.com/chzyer/readline"
+)
+
+// The game we're decoding. Unless it's picked with the profile command we follow what iemitm detected, or what the
+// VERSION_SERVER string tells us.
+var gameProfile = ie.DefaultProfile()
+var autoProfile = true
+
+// The VERSION_SERVER strings we've already said we don't know
+var unknownVersions = make(map[string]bool)
+
+// The spec messages we've already warned are decoded with unchecked layouts
+var unverifiedWarned = make(map[[2]uint8]bool)
+
+func useProfile(profile *ie.GameProfile, why string) {
+	if profile == gameProfile {
+		return
+	}
+	gameProfile = profile
+	unverifiedWarned = make(map[[2]uint8]bool)
+	fmt.Fprintln(rl, "Profile:", profile.String(), why)
+}
+
+// followProfile switches to the profile iemitm detected
+func followProfile(name string) {
+	if !autoProfile || name == "" {
+		return
+	}
+	if profile, ok := ie.LookupProfile(name); ok {
+		useProfile(profile, "(from iemitm)")
+	}
+}
+
+// detectVersionProfile switches to the profile with a VERSION_SERVER string, if we know it. No version strings are
+// built in and they're taught to iemitm, which does its own detecting, so mostly this only says how to pick the game.
+func detectVersionProfile(versionString string) {
+	if !autoProfile {
+		return
+	}
+	if profile, ok := ie.ProfileForVersion(versionString); ok {
+		useProfile(profile, fmt.Sprintf("(from version %q)", versionString))
+		return
+	}
+	if !unknownVersions[versionString] {
+		unknownVersions[versionString] = true
+		fmt.Fprintf(rl, "Unknown version %q, still decoding as %s. Pick the game with profile <name>, or run iemitm with -version-string <name>=%s, if it's another one\n", versionString, gameProfile.Name, versionString)
+	}
+}
+
+// warnUnverified says once per spec message when it was decoded with a layout nobody has checked for this game
+func warnUnverified(msgType, msgSubType uint8) {
+	if gameProfile.Captured || unverifiedWarned[[2]uint8{msgType, msgSubType}] {
+		return
+	}
+	unverifiedWarned[[2]uint8{msgType, msgSubType}] = true
+	typeName, name := ie.SpecMsgNames(msgType, msgSubType)
+	fmt.Fprintf(rl, "WARNING: %s %s is decoded with the BG1 layout, which hasn't been checked against %s\n", typeName, name, gameProfile.Title)
+}
+
+func setProfile(name string) {
+	switch name {
+	case "":
+		mode := "picked"
+		if autoProfile {
+			mode = "auto"
+		}
+		fmt.Fprintln(rl, "Profile:", gameProfile.String(), "-", mode)
+		for _, profile := range ie.Profiles() {
+			fmt.Fprintln(rl, "  "+profile.String())
+		}
+	case "auto":
+		autoProfile = true
+		fmt.Fprintln(rl, "Following the profile iemitm detects")
+	default:
+		profile, ok := ie.LookupProfile(name)
+		if !ok {
+			fmt.Fprintln(rl, "Unknown profile:", name)
+			return
+		}
+		autoProfile = false
+		useProfile(profile, "")
+	}
+}
+
+func profileCompleters() []readline.PrefixCompleterInterface {
+	ret := []readline.PrefixCompleterInterface{readline.PcItem("auto")}
+	for _, profile := range ie.Profiles() {
+		ret = append(ret, readline.PcItem(profile.Name))
+	}
+	return ret
+}
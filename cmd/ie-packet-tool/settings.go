@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Jaywalker/iemitm/ie"
+	"github.com/chzyer/readline"
+)
+
+// The last FULLSET we saw, for fullsetperm to change and send again
+var lastFullSet *ie.IEMPSettingsFullSet
+
+// A lobby setting we can forge from the command line. build gets the arguments already parsed.
+type setting struct {
+	subType uint8
+	args    []string
+	build   func(args []uint32) (ie.SpecMsg, error)
+}
+
+// Only charready and fullsetperm have captured layouts so far. The rest are refused by sendSetting until a capture
+// confirms them.
+var settings = map[string]setting{
+	"charready": {ie.IE_SPEC_MSG_SUBTYPE_TOGGLE_CHAR_READY, []string{"slot", "status"}, func(args []uint32) (ie.SpecMsg, error) {
+		return &ie.IEMPSettingsToggleCharReady{CharacterNum: uint8(args[0]), ReadyStatus: args[1]}, nil
+	}},
+	"charcontrol": {ie.IE_SPEC_MSG_SUBTYPE_MPSETTINGS_CHAR_CONTROL, []string{"slot", "playerid"}, func(args []uint32) (ie.SpecMsg, error) {
+		return &ie.IEMPSettingsCharControl{CharacterNum: uint8(args[0]), PlayerID: args[1]}, nil
+	}},
+	"slotstatus": {ie.IE_SPEC_MSG_SUBTYPE_MPSETTINGS_SLOT_STATUS, []string{"slot", "status"}, func(args []uint32) (ie.SpecMsg, error) {
+		return &ie.IEMPSettingsSlotStatus{CharacterNum: uint8(args[0]), Status: args[1]}, nil
+	}},
+	"playerready": {ie.IE_SPEC_MSG_SUBTYPE_MPSETTINGS_PLAYER_READY, []string{"playerid", "status"}, func(args []uint32) (ie.SpecMsg, error) {
+		return &ie.IEMPSettingsPlayerReady{PlayerID: args[0], ReadyStatus: args[1]}, nil
+	}},
+	"permission": {ie.IE_SPEC_MSG_SUBTYPE_MPSETTINGS_PERMISSION, []string{"playerid", "permission", "value"}, func(args []uint32) (ie.SpecMsg, error) {
+		return &ie.IEMPSettingsPermission{PlayerID: args[0], Permission: uint8(args[1]), Value: args[2]}, nil
+	}},
+	"fullsetperm": {ie.IE_SPEC_MSG_SUBTYPE_UPDATE_SERVER_ARBITRATION_INFO, []string{"playerid", "permission", "value"}, func(args []uint32) (ie.SpecMsg, error) {
+		if lastFullSet == nil {
+			return nil, errors.New("no FULLSET seen yet")
+		}
+		fullSet := *lastFullSet
+		player := fullSet.Player(args[0])
+		if player == nil {
+			return nil, fmt.Errorf("player 0x%x isn't in the last FULLSET", args[0])
+		}
+		if !player.Set(int(args[1]), uint8(args[2])) {
+			return nil, fmt.Errorf("there are only %d permissions", ie.PermissionsSize)
+		}
+		return &fullSet, nil
+	}},
+	"importing":       flagSetting(ie.IE_SPEC_MSG_SUBTYPE_MPSETTINGS_IMPORTING),
+	"listenjoin":      flagSetting(ie.IE_SPEC_MSG_SUBTYPE_MPSETTINGS_LISTEN_JOIN),
+	"restrictstore":   flagSetting(ie.IE_SPEC_MSG_SUBTYPE_MPSETTINGS_RESTRICT_STORE),
+	"nightmare":       boolSetting(ie.IE_SPEC_MSG_SUBTYPE_MPSETTINGS_NIGHTMAREMODE),
+	"gore":            boolSetting(ie.IE_SPEC_MSG_SUBTYPE_MPSETTINGS_GORE_LEVEL),
+	"lock":            boolSetting(ie.IE_SPEC_MSG_SUBTYPE_MPSETTINGS_LOCK_STATUS),
+	"lockinput":       boolSetting(ie.IE_SPEC_MSG_SUBTYPE_MPSETTINGS_LOCK_ALLOW_INPUT),
+	"fulldemand":      demandSetting(ie.IE_SPEC_MSG_SUBTYPE_MPSETTINGS_FULLDEMAND),
+	"lockrequest":     demandSetting(ie.IE_SPEC_MSG_SUBTYPE_MPSETTINGS_LOCK_REQUEST),
+	"nightmaredemand": demandSetting(ie.IE_SPEC_MSG_SUBTYPE_MPSETTINGS_DEMAND_NIGHTMAREMODE),
+}
+
+func init() {
+	handleSpecMsg(ie.IE_SPEC_MSG_TYPE_MPSETTINGS, ie.IE_SPEC_MSG_SUBTYPE_UPDATE_SERVER_ARBITRATION_INFO, func(event specMsgEvent) {
+		if msg, ok := event.msg.(*ie.IEMPSettingsFullSet); ok {
+			lastFullSet = msg
+		}
+		fmt.Fprintln(rl, event.msg.String())
+	})
+	handleSpecMsg(ie.IE_SPEC_MSG_TYPE_MPSETTINGS, ie.IE_SPEC_MSG_SUBTYPE_TOGGLE_CHAR_READY, func(event specMsgEvent) {
+		fmt.Fprintf(rl, "Player 0x%x Indicates %s\n", event.jmPacket.FromPlayerID(), event.msg.String())
+	})
+}
+
+func flagSetting(subType uint8) setting {
+	return setting{subType, []string{"value"}, func(args []uint32) (ie.SpecMsg, error) {
+		return &ie.IEMPSettingsFlag{Value: uint8(args[0])}, nil
+	}}
+}
+
+func boolSetting(subType uint8) setting {
+	return setting{subType, []string{"value"}, func(args []uint32) (ie.SpecMsg, error) {
+		return &ie.IEMPSettingsBool{Value: args[0]}, nil
+	}}
+}
+
+func demandSetting(subType uint8) setting {
+	return setting{subType, nil, func(args []uint32) (ie.SpecMsg, error) {
+		return &ie.IEMPSettingsDemand{}, nil
+	}}
+}
+
+func settingNames() []string {
+	var names []string
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func settingCompleters() []readline.PrefixCompleterInterface {
+	var ret []readline.PrefixCompleterInterface
+	for _, name := range settingNames() {
+		ret = append(ret, readline.PcItem(name))
+	}
+	return ret
+}
+
+func settingUsage(name string) string {
+	usage := "set <client|server> " + name
+	for _, arg := range settings[name].args {
+		usage += " <" + arg + ">"
+	}
+	return usage
+}
+
+// sendSetting forges an MPSETTINGS change: set <client|server> <setting> <args...>
+// Sent to the server it comes from the client, sent to the client it comes from the server. Settings whose layout
+// we've only guessed are refused.
+func sendSetting(fields []string) {
+	if len(fields) < 2 || (fields[0] != "server" && fields[0] != "client") {
+		fmt.Fprintln(rl, "Usage: set <client|server> <setting> <args...>")
+		return
+	}
+	target := fields[0]
+	setting, ok := settings[fields[1]]
+	if !ok {
+		fmt.Fprintln(rl, "Invalid setting. Valid settings are:", strings.Join(settingNames(), " "))
+		return
+	}
+	// A guessed layout could be read as something else entirely by a live game, so only send what's been captured
+	if info, _ := gameProfile.LookupSpecMsg(ie.IE_SPEC_MSG_TYPE_MPSETTINGS, setting.subType); info.New == nil {
+		fmt.Fprintln(rl, "Error:", info.Name, "hasn't been checked against a capture, not sending a guessed layout")
+		return
+	}
+	if len(fields)-2 != len(setting.args) {
+		fmt.Fprintln(rl, "Usage:", settingUsage(fields[1]))
+		return
+	}
+	args := make([]uint32, len(setting.args))
+	for i, field := range fields[2:] {
+		arg, err := strconv.ParseUint(field, 0, 32)
+		if err != nil {
+			fmt.Fprintln(rl, "Invalid", setting.args[i]+":", strconv.Quote(field))
+			return
+		}
+		args[i] = uint32(arg)
+	}
+
+	msg, err := setting.build(args)
+	if err != nil {
+		fmt.Fprintln(rl, "Error:", err)
+		return
+	}
+	fmt.Fprintln(rl, "Sending to", target+":", msg.String())
+	packet, err := ie.NewSpecMsgPacket(ie.IEHeader{}, ie.IE_SPEC_MSG_TYPE_MPSETTINGS, setting.subType, msg)
+	if err != nil {
+		fmt.Fprintln(rl, "Error: failed to build message ", err)
+		return
+	}
+	queueJMPacket(target, packet)
+}
+
+// sendKick tells the client it's been kicked, as if the host had done it: kick <playerid>
+// The HOOFED_OUT layout is only a guess, so it isn't sent unless guesses are enabled.
+func sendKick(fields []string) {
+	if len(fields) != 1 {
+		fmt.Fprintln(rl, "Usage: kick <playerid>")
+		return
+	}
+	info, _ := gameProfile.LookupSpecMsg(ie.IE_SPEC_MSG_TYPE_KICK_PLAYER, ie.IE_SPEC_MSG_SUBTYPE_KICK_PLAYER_HOOFED_OUT)
+	newMsg := info.New
+	if newMsg == nil {
+		if !showGuesses {
+			fmt.Fprintln(rl, "Error:", info.Name, "hasn't been checked against a capture, enable guesses to send the guessed layout")
+			return
+		}
+		newMsg = info.Guess
+	}
+	playerID, err := strconv.ParseUint(fields[0], 0, 32)
+	if err != nil {
+		fmt.Fprintln(rl, "Invalid playerid:", strconv.Quote(fields[0]))
+		return
+	}
+	msg, ok := newMsg().(*ie.IEKickPlayer)
+	if !ok {
+		fmt.Fprintln(rl, "Error: the", gameProfile.Name, "profile doesn't lay", info.Name, "out as a player ID")
+		return
+	}
+	msg.PlayerID = uint32(playerID)
+	fmt.Fprintln(rl, "Sending to client:", info.Name, msg.String())
+	packet, err := ie.NewSpecMsgPacket(ie.IEHeader{}, ie.IE_SPEC_MSG_TYPE_KICK_PLAYER, ie.IE_SPEC_MSG_SUBTYPE_KICK_PLAYER_HOOFED_OUT, msg)
+	if err != nil {
+		fmt.Fprintln(rl, "Error: failed to build kick ", err)
+		return
+	}
+	queueJMPacket("client", packet)
+}
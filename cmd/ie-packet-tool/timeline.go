@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Jaywalker/iemitm/ie"
+)
+
+// The most area transfer messages we keep. Older ones are dropped.
+const timelineLength = 1000
+
+type timelineEntry struct {
+	at   time.Time
+	from string
+	to   string
+	name string
+	msg  string
+}
+
+// timeline keeps the area transfer messages in the order we saw them, so a hung load can be read back step by step
+var timeline struct {
+	lock    sync.Mutex
+	entries []timelineEntry
+}
+
+func addToTimeline(from, to, name, msg string) {
+	timeline.lock.Lock()
+	defer timeline.lock.Unlock()
+	if len(timeline.entries) == timelineLength {
+		timeline.entries = timeline.entries[1:]
+	}
+	timeline.entries = append(timeline.entries, timelineEntry{time.Now(), from, to, name, msg})
+}
+
+// printTimeline prints each message with the time since the first one and since the one before it
+func printTimeline() {
+	needGuesses("RESOURCE_DEMAND, MPSYNCH and LEAVEAREA")
+	timeline.lock.Lock()
+	defer timeline.lock.Unlock()
+	if len(timeline.entries) == 0 {
+		fmt.Fprintln(rl, "No area transfer messages yet.")
+		return
+	}
+	start := timeline.entries[0].at
+	last := start
+	for _, entry := range timeline.entries {
+		fmt.Fprintf(rl, "%s +%8.3fs (+%7.3fs) %s => %s: %s %s\n", entry.at.Format("15:04:05.000"), entry.at.Sub(start).Seconds(), entry.at.Sub(last).Seconds(), entry.from, entry.to, entry.name, entry.msg)
+		last = entry.at
+	}
+}
+
+func clearTimeline() {
+	timeline.lock.Lock()
+	defer timeline.lock.Unlock()
+	timeline.entries = nil
+	fmt.Fprintln(rl, "Timeline cleared.")
+}
+
+func init() {
+	observeSpecMsgs(func(event specMsgEvent) {
+		if ie.IsAreaTransfer(event.jmPacket.SpecType()) {
+			addToTimeline(event.packet.Source, event.packet.Dest, event.name, event.msg.String())
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Jaywalker/iemitm/ie"
+)
+
+// What to change in the VERSION_SERVER messages going through us
+var versionRewrite ie.VersionRewrite
+
+// The last version each side sent, before we rewrote it
+var seenVersions = make(map[string]ie.IEVersion)
+
+// checkVersion compares the version source sent with the other side's, if we've seen it
+func checkVersion(source string, ieVersion ie.IEVersion) {
+	seenVersions[source] = ieVersion
+	for other, otherVersion := range seenVersions {
+		if other == source {
+			continue
+		}
+		for _, mismatch := range ieVersion.Mismatches(otherVersion) {
+			fmt.Fprintln(rl, "Version mismatch:", source, "vs", other+":", mismatch)
+		}
+	}
+}
+
+// rewriteVersion has iemitm forward a rewritten copy of the packet if there's anything to rewrite
+func rewriteVersion(jmPacket ie.JMPacket, ieVersion *ie.IEVersion) {
+	if !versionRewrite.Apply(ieVersion) {
+		return
+	}
+	packet, err := ie.ReplaceSpecMsg(jmPacket, ieVersion)
+	if err != nil {
+		fmt.Fprintln(rl, "ERROR: Failed to rewrite version:", err)
+		return
+	}
+	data, err := packet.Marshal()
+	if err != nil {
+		fmt.Fprintln(rl, "ERROR: Failed to rewrite version:", err)
+		return
+	}
+	replaceData = data
+	fmt.Fprintln(rl, "Rewrote version:", ieVersion.String())
+}
+
+func init() {
+	handleSpecMsg(ie.IE_SPEC_MSG_TYPE_VERSION, ie.IE_SPEC_MSG_SUBTYPE_VERSION_SERVER, func(event specMsgEvent) {
+		msg, ok := event.msg.(*ie.IEVersion)
+		if !ok {
+			// A profile can decode it its own way
+			printSpecMsg(event)
+			return
+		}
+		fmt.Fprintln(rl, event.packet.Source, " => ", event.packet.Dest, ": ", msg.String())
+		detectVersionProfile(msg.VersionString)
+		checkVersion(event.packet.Source, *msg)
+		rewriteVersion(event.jmPacket, msg)
+	})
+}
+
+func setVersionRewrite(args string) {
+	field, value, _ := strings.Cut(args, " ")
+	switch field {
+	case "":
+		fmt.Fprintln(rl, "Rewriting:", versionRewrite.String())
+		for source, ieVersion := range seenVersions {
+			fmt.Fprintln(rl, source+":", ieVersion.String())
+		}
+		return
+	case "off":
+		versionRewrite = ie.VersionRewrite{}
+	case "string":
+		versionRewrite.VersionString = &value
+	case "expansion":
+		expansionPack, err := strconv.ParseUint(value, 0, 8)
+		if err != nil {
+			fmt.Fprintln(rl, "Invalid expansion:", strconv.Quote(value))
+			return
+		}
+		versionRewrite.ExpansionPack = new(uint8)
+		*versionRewrite.ExpansionPack = uint8(expansionPack)
+	case "timer":
+		timerUpdatesPerSecond, err := strconv.ParseUint(value, 0, 32)
+		if err != nil {
+			fmt.Fprintln(rl, "Invalid timer:", strconv.Quote(value))
+			return
+		}
+		versionRewrite.TimerUpdatesPerSecond = new(uint32)
+		*versionRewrite.TimerUpdatesPerSecond = uint32(timerUpdatesPerSecond)
+	default:
+		fmt.Fprintln(rl, "Usage: version [string <version>|expansion <byte>|timer <updates per second>|off]")
+		return
+	}
+	fmt.Fprintln(rl, "Rewriting:", versionRewrite.String())
+}
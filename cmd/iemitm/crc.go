@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Jaywalker/iemitm/crc"
+)
+
+// The DPlay pings that come over the game port before the game starts are 36 bytes and aren't IE frames
+const dplayPingSize = 36
+
+// What we've made of the CRCs of frames on the game port
+var crcLock sync.Mutex
+var crcFrames, crcCorrupt, crcRepaired int
+
+// checkFrameCRC verifies the CRC of a frame that came in on the game port, and counts and logs it if it's wrong.
+// The game drops frames with a bad CRC, so we still forward them and let it.
+func checkFrameCRC(frame []byte, from string) bool {
+	if !crc.Verify(frame) && len(frame) == dplayPingSize {
+		return true
+	}
+	crcLock.Lock()
+	defer crcLock.Unlock()
+	crcFrames++
+	if crc.Verify(frame) {
+		return true
+	}
+	crcCorrupt++
+	if len(frame) < crc.MinFrameSize {
+		fmt.Printf("Bad frame from %s: %d bytes is too short for a CRC (%d of %d frames bad)\n", from, len(frame), crcCorrupt, crcFrames)
+	} else {
+		fmt.Printf("Bad CRC from %s: 0x%x, should be 0x%x (%d of %d frames bad)\n", from, crc.Stored(frame), crc.Checksum(frame), crcCorrupt, crcFrames)
+	}
+	return false
+}
+
+// repairFrameCRC recomputes the CRC of a frame the decoder tool or the script handed back, since it may have edited
+// it, so the game doesn't drop it
+func repairFrameCRC(frame []byte, what string) {
+	fixed, err := crc.Fix(frame)
+	if err != nil {
+		fmt.Println("Can't fix the CRC of the", what+":", err)
+		return
+	}
+	if fixed {
+		crcLock.Lock()
+		crcRepaired++
+		repaired := crcRepaired
+		crcLock.Unlock()
+		fmt.Printf("Recomputed the CRC of the %s (%d repaired)\n", what, repaired)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jaywalker/iemitm/impair"
+)
+
+// impairer makes the links we forward behave like bad connections. It's always there, with no profiles unless we were
+// given some, so profiles turning up later in the impairment file apply to links that are already open.
+var impairer *impair.Impairer
+
+// udpSender sends the impaired UDP packets. TCP relays have their own, so a slow stream doesn't hold up the game.
+var udpSender *impair.Sender
+
+// impairFlags collects the -impair flags
+type impairFlags []impair.Profile
+
+func (profiles *impairFlags) String() string {
+	var settings []string
+	for _, profile := range *profiles {
+		settings = append(settings, profile.String())
+	}
+	return strings.Join(settings, "; ")
+}
+
+func (profiles *impairFlags) Set(value string) error {
+	profile, err := impair.ParseProfile(value)
+	if err != nil {
+		return err
+	}
+	*profiles = append(*profiles, profile)
+	return nil
+}
+
+// startImpairment sets up the impairment from the flags and the file, and keeps reloading the file when it changes
+func startImpairment(profiles impairFlags, path string) error {
+	var err error
+	impairer, err = impair.New(profiles, path, time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	udpSender = impair.NewSender()
+	if len(profiles) > 0 || path != "" {
+		fmt.Println("Impairment:")
+		fmt.Println(impairer)
+	}
+	if path != "" {
+		go impairer.Watch(time.Second, func(format string, args ...any) {
+			fmt.Printf(format+"\n", args...)
+		})
+	}
+	return nil
+}
+
+func portNumber(port string) int {
+	portNum, _ := strconv.Atoi(strings.TrimPrefix(port, ":"))
+	return portNum
+}
+
+// writeUDP sends a packet that came from one side, after the impairment for its direction and port. Everything goes
+// through udpSender, even with nothing to impair, so packets can't overtake each other when a profile starts or ends.
+func writeUDP(sock *net.UDPConn, data []byte, from string, port string) {
+	times := impairer.Schedule(from, portNumber(port), len(data), false, time.Now())
+	if len(times) == 0 {
+		return
+	}
+	// It goes out after our buffer has been reused
+	data = append([]byte{}, data...)
+	for _, at := range times {
+		udpSender.At(at, func() {
+			sock.Write(data)
+		})
+	}
+}
+
+// The most a TCP relay holds back for the impairment. Past that Write waits for it to go out, so a slow link slows
+// the relay's reads down instead of buffering whatever the sender has.
+const maxTCPQueued = 1 << 20
+
+// tcpWriter is one direction of a TCP relay with the impairment for it
+type tcpWriter struct {
+	dst    *net.TCPConn
+	from   string
+	port   string
+	sender *impair.Sender
+
+	lock   sync.Mutex
+	sent   *sync.Cond // Signalled when queued goes down
+	queued int        // Bytes waiting in sender
+}
+
+func newTCPWriter(dst *net.TCPConn, from string, port string) *tcpWriter {
+	writer := &tcpWriter{dst: dst, from: from, port: port, sender: impair.NewSender()}
+	writer.sent = sync.NewCond(&writer.lock)
+	return writer
+}
+
+// Write sends data on now, or later if it's impaired. It waits while maxTCPQueued is already queued. A failed later
+// write closes the connection, which ends the relays both ways.
+func (writer *tcpWriter) Write(data []byte) (int, error) {
+	writer.lock.Lock()
+	// Something bigger than the limit still goes, once everything before it has
+	for writer.queued > 0 && writer.queued+len(data) > maxTCPQueued {
+		writer.sent.Wait()
+	}
+	writer.queued += len(data)
+	writer.lock.Unlock()
+
+	at := impairer.Schedule(writer.from, portNumber(writer.port), len(data), true, time.Now())[0]
+	data = append([]byte{}, data...)
+	writer.sender.At(at, func() {
+		if _, err := writer.dst.Write(data); err != nil {
+			fmt.Printf("	Delayed write failed '%s'\n", err)
+			writer.dst.Close()
+		}
+		writer.lock.Lock()
+		writer.queued -= len(data)
+		writer.sent.Broadcast()
+		writer.lock.Unlock()
+	})
+	return len(data), nil
+}
+
+// Close waits for what's still queued to be sent
+func (writer *tcpWriter) Close() {
+	writer.sender.Close()
+}
@@ -3,13 +3,16 @@ package main
 import (
 	"bytes"
 	"encoding/gob"
+	"flag"
 	"fmt"
 	"net"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/Jaywalker/iemitm/dplay"
+	"github.com/Jaywalker/iemitm/ie"
 	"github.com/Jaywalker/iemitm/interprocess"
 )
 
@@ -19,6 +22,93 @@ var clientStrAddr string
 
 var decoderSock *net.TCPConn
 
+// srvStrAddr moves when the game host migrates, so it's guarded by hostLock. clientHosting is set when the host
+// migrated to the client we're in front of, which leaves nothing on the server side to forward to.
+var hostLock sync.RWMutex
+var clientHosting bool
+var session *dplay.Session
+
+func serverAddr() string {
+	hostLock.RLock()
+	defer hostLock.RUnlock()
+	return srvStrAddr
+}
+
+func isClientHosting() bool {
+	hostLock.RLock()
+	defer hostLock.RUnlock()
+	return clientHosting
+}
+
+// tcpRelay is a TCP connection we're relaying, with the host it was set up for
+type tcpRelay struct {
+	src, dst *net.TCPConn
+	host     string
+}
+
+// The TCP relays that are open, so they can be closed when the host moves
+var relays = make(map[*tcpRelay]bool)
+var relayLock sync.Mutex
+
+func addRelay(relay *tcpRelay) {
+	relayLock.Lock()
+	defer relayLock.Unlock()
+	relays[relay] = true
+}
+
+func removeRelay(relay *tcpRelay) {
+	relayLock.Lock()
+	defer relayLock.Unlock()
+	delete(relays, relay)
+}
+
+// closeRelays closes the TCP relays that were set up for any host but this one, which ends both directions of them.
+// They'd only be forwarding to a host that's gone, new connections go to the new one.
+func closeRelays(host string) {
+	relayLock.Lock()
+	defer relayLock.Unlock()
+	for relay := range relays {
+		if relay.host == host {
+			continue
+		}
+		fmt.Println("TCP", relay.src.RemoteAddr(), "<=>", relay.dst.RemoteAddr(), "was for the old host", relay.host, "- Closing it")
+		relay.src.Close()
+		relay.dst.Close()
+		delete(relays, relay)
+	}
+}
+
+// trackSession feeds a DPlay packet into our session and re-points the server address when the host moves
+func trackSession(packet dplay.DPlayPacket, from net.IP) {
+	detectProfile(packet)
+	switch session.Update(packet, from) {
+	case dplay.SessionEventHostLost:
+		fmt.Println("Host player deleted. Migrate host:", session.MigrateHost(), "- Waiting for a new name server...")
+	case dplay.SessionEventDeclaredDead:
+		fmt.Println("YOUAREDEAD sent by", from)
+	case dplay.SessionEventGroupsChanged:
+		fmt.Println(session)
+	case dplay.SessionEventHostMigrated:
+		newHost := session.HostAddr().String()
+		if newHost == clientStrAddr {
+			// The old host was all there was on the other side of us, so there's nothing left to forward the client's
+			// packets to. What the client sends the old host is dropped until another host takes over.
+			hostLock.Lock()
+			fmt.Println("Host migrated from", srvStrAddr, "to the client", clientStrAddr, "- Dropping what the client sends to the old host")
+			clientHosting = true
+			hostLock.Unlock()
+			closeRelays(clientStrAddr)
+			return
+		}
+		hostLock.Lock()
+		fmt.Println("Host migrated from", srvStrAddr, "to", newHost, "- Forwarding to the new host")
+		srvStrAddr = newHost
+		clientHosting = false
+		hostLock.Unlock()
+		closeRelays(newHost)
+	}
+}
+
 func UDPProxyListener(port string) {
 	udpListenAddr, err := net.ResolveUDPAddr("udp", listenerAddr+port)
 	if err != nil {
@@ -45,7 +135,8 @@ func UDPProxyListener(port string) {
 	}
 	defer clientOutSock.Close()
 
-	srvAddr, err := net.ResolveUDPAddr("udp", srvStrAddr+port)
+	srvDialed := serverAddr()
+	srvAddr, err := net.ResolveUDPAddr("udp", srvDialed+port)
 	if err != nil {
 		panic(err)
 	}
@@ -54,7 +145,9 @@ func UDPProxyListener(port string) {
 		fmt.Println(err)
 		return
 	}
-	defer srvOutSock.Close()
+	defer func() {
+		srvOutSock.Close()
+	}()
 
 	buf := make([]byte, 0xffff)
 	for {
@@ -68,13 +161,15 @@ func UDPProxyListener(port string) {
 
 		forwardPacket := true
 		forwardRespBuf := false
+		badCRC := false
 		var respPacket interprocess.RespPacketData
-		if port != ":2350" { // DPlay ports. 2350 seems to be BG (or maybe IE) specific
+		if !isGamePort(port) { // DPlay ports. The game port comes from the profile
 			packet := dplay.NewDPlayPacket(b)
 			if packet == nil {
 				return
 			}
 			fmt.Println(packet)
+			trackSession(packet, addr.IP)
 			/*
 				var header DPSP_MSG_HEADER
 				if err := binary.Read(bytes.NewReader(buf), binary.LittleEndian, &header); err != nil {
@@ -98,20 +193,24 @@ func UDPProxyListener(port string) {
 				go TCPProxyListener(":" + strconv.Itoa(packet.Port()))
 				go UDPProxyListener(":" + strconv.Itoa(packet.Port()))
 			}
-		} else { // BG Port
+		} else { // Game Port
+			badCRC = !checkFrameCRC(b, addr.String())
+			if !badCRC {
+				detectVersionProfile(b)
+			}
 			if decoderSock != nil {
 				var networkBytes bytes.Buffer
 				enc := gob.NewEncoder(&networkBytes)
 				source := ""
 				dest := ""
-				if addr.IP.String() == srvStrAddr {
+				if addr.IP.String() == serverAddr() {
 					source = "Client"
 					dest = "Server"
 				} else {
 					source = "Server"
 					dest = "Client"
 				}
-				data := &interprocess.PacketData{Source: source, Dest: dest, Port: port, Size: n, Data: buf}
+				data := &interprocess.PacketData{Source: source, Dest: dest, Port: port, Size: n, Data: b, Profile: profileName(), BadCRC: badCRC}
 				err := enc.Encode(data)
 				if err != nil {
 					fmt.Println("encode error:", err)
@@ -142,18 +241,59 @@ func UDPProxyListener(port string) {
 			}
 		}
 
-		if forwardPacket {
-			if addr.IP.String() == srvStrAddr {
-				clientOutSock.Write(buf[:n])
-				// fmt.Println("UDP", srvStrAddr+port, " => "+listenerAddr+port, " Sent", n, " bytes: ", hex.EncodeToString(buf[:n]))
+		// Redial if the host migrated since the last packet
+		if host := serverAddr(); host != srvDialed {
+			newSrvAddr, err := net.ResolveUDPAddr("udp", host+port)
+			if err == nil {
+				newSrvOutSock, err := net.DialUDP("udp", nil, newSrvAddr)
+				if err == nil {
+					srvOutSock.Close()
+					srvOutSock = newSrvOutSock
+					srvDialed = host
+				} else {
+					fmt.Println(err)
+				}
 			} else {
-				srvOutSock.Write(buf[:n])
-				// fmt.Println("UDP "+listenerAddr+port, " => ", srvStrAddr+port, " Sent", n, " bytes: ", hex.EncodeToString(buf[:n]))
+				fmt.Println(err)
+			}
+		}
+
+		if forwardPacket && isClientHosting() && addr.IP.String() != srvDialed {
+			fmt.Println("The client is the host now, dropping its packet to the old host")
+			forwardPacket = false
+		}
+
+		if forwardPacket {
+			out := buf[:n]
+			if len(respPacket.ReplaceData) > 0 {
+				fmt.Println("Forwarding the decoder's replacement packet")
+				out = respPacket.ReplaceData
+				// A frame that came in corrupt stays corrupt, fixing its CRC would pass the corruption on to the game
+				if !badCRC {
+					repairFrameCRC(out, "decoder's replacement packet")
+				}
+			}
+			from, outSock := "client", srvOutSock
+			if addr.IP.String() == srvDialed {
+				from, outSock = "server", clientOutSock
+			}
+			out, injections := hookUDP(out, from, port, badCRC)
+			if out != nil {
+				sendUDP(outSock, out, from, port)
+				// fmt.Println("UDP", listenerAddr+port, " => ", outSock.RemoteAddr(), " Sent", len(out), " bytes: ", hex.EncodeToString(out))
+			}
+			for _, injection := range injections {
+				if injection.To == "client" {
+					clientOutSock.Write(injection.Data)
+				} else {
+					srvOutSock.Write(injection.Data)
+				}
 			}
 		}
 
 		if forwardRespBuf {
 			fmt.Println("ForwardBuf Found")
+			repairFrameCRC(respPacket.Data, "decoder's injected packet")
 			if respPacket.Dest == "client" {
 				clientOutSock.Write(respPacket.Data)
 			} else {
@@ -165,6 +305,13 @@ func UDPProxyListener(port string) {
 
 func TCPSocketRelay(src, dst *net.TCPConn, port string) {
 	fmt.Println("TCP", src.RemoteAddr().String(), " => ", src.LocalAddr().String(), " - ", dst.LocalAddr().String(), " => ", dst.RemoteAddr().String(), " Relay Started")
+	from := "client"
+	if strings.Split(src.RemoteAddr().String(), ":")[0] == serverAddr() {
+		from = "server"
+	}
+	writer := newTCPWriter(dst, from, port)
+	defer writer.Close()
+
 	buf := make([]byte, 0xffff)
 	for {
 		n, err := src.Read(buf)
@@ -179,6 +326,9 @@ func TCPSocketRelay(src, dst *net.TCPConn, port string) {
 		//All TCP packets we've seen so far have been DPlay only
 		packet := dplay.NewDPlayPacket(b)
 		fmt.Println(packet)
+		if packet != nil {
+			trackSession(packet, src.RemoteAddr().(*net.TCPAddr).IP)
+		}
 
 		/*
 			var header DPSP_MSG_HEADER
@@ -218,12 +368,10 @@ func TCPSocketRelay(src, dst *net.TCPConn, port string) {
 		*/
 
 		//write out result
-		n, err = dst.Write(b)
-		if err != nil {
+		if err := sendTCP(writer, b); err != nil {
 			fmt.Printf("	Write failed '%s'\n", err)
 			return
 		}
-		fmt.Println("TCP", dst.LocalAddr().String(), " => ", dst.RemoteAddr().String(), " Sent", n, " bytes")
 	}
 }
 
@@ -231,7 +379,8 @@ var haxCounter int
 
 func TCPConnHandler(src *net.TCPConn, port string) {
 	fmt.Println("TCP", src.RemoteAddr().String(), " Handler Started")
-	tcpRemoteAddr, err := net.ResolveTCPAddr("tcp", srvStrAddr+port)
+	host := serverAddr()
+	tcpRemoteAddr, err := net.ResolveTCPAddr("tcp", host+port)
 	if err != nil {
 		panic(err)
 	}
@@ -243,7 +392,13 @@ func TCPConnHandler(src *net.TCPConn, port string) {
 		return
 	}
 
-	if strings.Split(src.RemoteAddr().String(), ":")[0] == srvStrAddr {
+	if isClientHosting() {
+		fmt.Println("The client is the host now, there's nothing to relay", src.RemoteAddr().String(), "to")
+		src.Close()
+		return
+	}
+
+	if strings.Split(src.RemoteAddr().String(), ":")[0] == host {
 		//If the connection is from the server, we connect to the client
 		tcpRemoteAddr, err = net.ResolveTCPAddr("tcp", clientStrAddr+port)
 		if err != nil {
@@ -271,6 +426,10 @@ func TCPConnHandler(src *net.TCPConn, port string) {
 		panic(err)
 	}
 
+	relay := &tcpRelay{src: src, dst: dst, host: host}
+	addRelay(relay)
+	defer removeRelay(relay)
+
 	// Relay between src<->dst
 	go TCPSocketRelay(src, dst, port)
 	TCPSocketRelay(dst, src, port)
@@ -306,17 +465,88 @@ func main() {
 	//	usingBackChannel = false
 	//	gotEnumSessionReply = false
 	//	clientBackChannel2300 = nil
-	if len(os.Args) != 4 {
-		os.Exit(0)
+	profileFlag := flag.String("profile", "auto", "game profile, or auto to detect it from an application GUID given with -guid or a version string given with -version-string. None are built in")
+	portFlag := flag.Int("port", 0, "UDP port the game frames use, instead of the profile's")
+	rulesFlag := flag.String("rules", "", "JSON file of rules for the UDP packets and TCP messages we forward, reloaded when it changes")
+	impairFileFlag := flag.String("impair-file", "", "file of impairment profiles, one per line, reloaded when it changes")
+	scriptFlag := flag.String("script", "", "Lua script with on_dplay and on_frame hooks for the UDP packets we forward")
+	var guids, versions profileFlags
+	var impairments impairFlags
+	flag.Var(&impairments, "impair", "impairment profile like \"from=server delay=150ms jitter=40ms loss=2% rate=56kbit\". Can be repeated")
+	flag.Var(&guids, "guid", "teach a profile a DPlay application GUID, as profile={GUID}. Can be repeated")
+	flag.Var(&versions, "version-string", "teach a profile a VERSION_SERVER version string, as profile=string. Can be repeated")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: iemitm [flags] <listen addr> <client addr> <server addr>")
+		flag.PrintDefaults()
+		var names []string
+		for _, gameProfile := range ie.Profiles() {
+			names = append(names, gameProfile.Name)
+		}
+		fmt.Fprintln(flag.CommandLine.Output(), "Profiles:", strings.Join(names, ", "))
+	}
+	flag.Parse()
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	listenerAddr = flag.Arg(0)
+	srvStrAddr = flag.Arg(2)
+	clientStrAddr = flag.Arg(1)
+
+	if err := addAppGUIDs(guids); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if err := addVersionStrings(versions); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if *rulesFlag != "" {
+		if err := loadRules(*rulesFlag); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+	if err := startImpairment(impairments, *impairFileFlag); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
 	}
-	listenerAddr = os.Args[1]
-	srvStrAddr = os.Args[3]
-	clientStrAddr = os.Args[2]
+	if *scriptFlag != "" {
+		if err := loadScript(*scriptFlag); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+	gamePort := *portFlag
+	if *profileFlag == "auto" {
+		autoProfile = true
+		if len(guids) == 0 && len(versions) == 0 {
+			fmt.Println("No application GUIDs or version strings are built in, so without -guid or -version-string the game can't be detected and is decoded as", ie.DefaultProfile().Name)
+		} else {
+			fmt.Println("Detecting the game from its DPlay application GUID or version string")
+		}
+	} else {
+		gameProfile, ok := ie.LookupProfile(*profileFlag)
+		if !ok {
+			flag.Usage()
+			os.Exit(2)
+		}
+		profile = gameProfile
+		fmt.Println("Profile:", gameProfile)
+		if gamePort == 0 {
+			gamePort = gameProfile.GamePort
+		}
+	}
+	if gamePort == 0 {
+		gamePort = ie.DefaultGamePort
+	}
+
 	fmt.Println("DPlay MitM Activating...")
 	fmt.Println("Fowarding", clientStrAddr, "to", srvStrAddr)
+	session = dplay.NewSession(net.ParseIP(srvStrAddr))
 	go TCPProxyListener(":47624")
 	go TCPProxyListener(":9988")
-	go UDPProxyListener(":2350")
+	startGamePort(gamePort)
 	UDPProxyListener(":47624")
 	//go TCPProxyListener(":2300")
 	//for {
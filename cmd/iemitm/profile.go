@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Jaywalker/iemitm/dplay"
+	"github.com/Jaywalker/iemitm/ie"
+)
+
+// The game we're proxying. It's picked with -profile, or from the DPlay application GUID or VERSION_SERVER string
+// when that's auto.
+var profileLock sync.RWMutex
+var profile *ie.GameProfile
+var autoProfile bool
+var gamePorts = make(map[string]bool)
+var seenAppGUIDs = make(map[dplay.GUID]bool)
+var seenVersions = make(map[string]bool)
+
+// profileFlags collects profile=value arguments, for -guid and -version-string
+type profileFlags []string
+
+func (args *profileFlags) String() string {
+	return strings.Join(*args, ",")
+}
+
+func (args *profileFlags) Set(value string) error {
+	*args = append(*args, value)
+	return nil
+}
+
+// each calls add with the profile and value of each argument
+func (args profileFlags) each(flagName string, add func(gameProfile *ie.GameProfile, value string) error) error {
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return errors.New("-" + flagName + " wants profile=value, got " + arg)
+		}
+		gameProfile, ok := ie.LookupProfile(name)
+		if !ok {
+			return errors.New("unknown profile " + name)
+		}
+		if err := add(gameProfile, value); err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		}
+	}
+	return nil
+}
+
+// addAppGUIDs teaches the profiles the GUIDs given with -guid
+func addAppGUIDs(guids profileFlags) error {
+	return guids.each("guid", func(gameProfile *ie.GameProfile, value string) error {
+		guid, err := dplay.ParseGUID(value)
+		if err != nil {
+			return err
+		}
+		gameProfile.AddAppGUID(guid)
+		return nil
+	})
+}
+
+// addVersionStrings teaches the profiles the VERSION_SERVER strings given with -version-string
+func addVersionStrings(versions profileFlags) error {
+	return versions.each("version-string", func(gameProfile *ie.GameProfile, value string) error {
+		gameProfile.AddVersionString(value)
+		return nil
+	})
+}
+
+// currentProfile returns the profile in use, and nil if we're waiting to detect it
+func currentProfile() *ie.GameProfile {
+	profileLock.RLock()
+	defer profileLock.RUnlock()
+	return profile
+}
+
+// profileName is what we tell the decoder tool about the game, empty if we don't know it
+func profileName() string {
+	if gameProfile := currentProfile(); gameProfile != nil {
+		return gameProfile.Name
+	}
+	return ""
+}
+
+func isGamePort(port string) bool {
+	profileLock.RLock()
+	defer profileLock.RUnlock()
+	return gamePorts[port]
+}
+
+// startGamePort starts proxying a port as IE frames rather than DPlay, unless we already are
+func startGamePort(port int) {
+	if port == 0 {
+		return
+	}
+	portStr := ":" + strconv.Itoa(port)
+	profileLock.Lock()
+	started := gamePorts[portStr]
+	gamePorts[portStr] = true
+	profileLock.Unlock()
+	if !started {
+		go UDPProxyListener(portStr)
+	}
+}
+
+// detectProfile picks the profile from the application GUID of DPlay packets that carry one
+func detectProfile(packet dplay.DPlayPacket) {
+	appPacket, ok := packet.(dplay.AppGUIDPacket)
+	if !ok {
+		return
+	}
+	guid := appPacket.AppGUID()
+	profileLock.Lock()
+	if !autoProfile || seenAppGUIDs[guid] {
+		profileLock.Unlock()
+		return
+	}
+	seenAppGUIDs[guid] = true
+	gameProfile, ok := ie.ProfileForAppGUID(guid)
+	if !ok {
+		profileLock.Unlock()
+		fmt.Println("Unknown application GUID", guid, "- Pass -profile, or -guid <profile>="+guid.String(), "if you know the game")
+		return
+	}
+	profile = gameProfile
+	profileLock.Unlock()
+	fmt.Println("Detected", gameProfile, "from application GUID", guid)
+	startGamePort(gameProfile.GamePort)
+}
+
+// detectVersionProfile picks the profile from the VersionString of a VERSION_SERVER frame. The game port has to be
+// known already to see one, so this only tells the decoder tool and scripts which game it is.
+func detectVersionProfile(frame []byte) {
+	packet, err := ie.NewJMPacket(frame, len(frame))
+	if err != nil || !packet.IsSpecMsg() || packet.SpecType() != ie.IE_SPEC_MSG_TYPE_VERSION || packet.SpecSubType() != ie.IE_SPEC_MSG_SUBTYPE_VERSION_SERVER {
+		return
+	}
+	payload, err := ie.DecompressPayload(packet)
+	if err != nil {
+		return
+	}
+	// Whatever the game, the version string is what tells us which it is, so it's read with the shared layout
+	msg, err := ie.DecodeSpecMsg(packet.SpecType(), packet.SpecSubType(), payload)
+	if err != nil {
+		return
+	}
+	version, ok := msg.(*ie.IEVersion)
+	if !ok {
+		return
+	}
+	profileLock.Lock()
+	if !autoProfile || seenVersions[version.VersionString] {
+		profileLock.Unlock()
+		return
+	}
+	seenVersions[version.VersionString] = true
+	gameProfile, ok := ie.ProfileForVersion(version.VersionString)
+	if !ok {
+		profileLock.Unlock()
+		fmt.Printf("Unknown version %q - Pass -profile, or -version-string <profile>=%s if you know the game\n", version.VersionString, version.VersionString)
+		return
+	}
+	profile = gameProfile
+	profileLock.Unlock()
+	fmt.Printf("Detected %s from version %q\n", gameProfile, version.VersionString)
+}
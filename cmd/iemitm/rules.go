@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Jaywalker/iemitm/rules"
+)
+
+// ruleEngine decides what happens to the packets we forward, if we were given a rules file
+var ruleEngine *rules.Engine
+
+// loadRules reads the rules file and keeps reloading it when it changes
+func loadRules(path string) error {
+	engine, err := rules.Load(path, time.Now())
+	if err != nil {
+		return err
+	}
+	ruleEngine = engine
+	fmt.Println("Rules loaded from", path+":")
+	fmt.Println(engine)
+	go engine.Watch(time.Second, func(format string, args ...any) {
+		fmt.Printf(format+"\n", args...)
+	})
+	return nil
+}
+
+// applyRules runs a packet that came from one side through the rules and logs what they did. It returns a copy of
+// data, which the rules can change and which might go out after our buffer has been reused.
+func applyRules(data []byte, from string, port string, dplayMsg bool) ([]byte, rules.Verdict) {
+	if ruleEngine == nil {
+		return data, rules.Verdict{}
+	}
+	data = append([]byte{}, data...)
+	verdict := ruleEngine.Apply(rules.Packet{From: from, Port: portNumber(port), DPlay: dplayMsg, Data: data}, time.Now())
+	for _, log := range verdict.Logs {
+		fmt.Println("Rule:", log)
+	}
+	return data, verdict
+}
+
+// sendUDP forwards a packet that came from one side, after running it through the rules and the impairment
+func sendUDP(sock *net.UDPConn, data []byte, from string, port string) {
+	data, verdict := applyRules(data, from, port, !isGamePort(port))
+	if verdict.Drop {
+		return
+	}
+	send := func() {
+		for i := 0; i <= verdict.Copies; i++ {
+			writeUDP(sock, data, from, port)
+		}
+	}
+	if verdict.Delay > 0 {
+		time.AfterFunc(verdict.Delay, send)
+		return
+	}
+	send()
+}
+
+// sendTCP forwards a DPlay message from one side of a TCP relay, after running it through the rules and the
+// impairment. A delay holds the relay up, since what comes after it can't go first.
+func sendTCP(writer *tcpWriter, data []byte) error {
+	data, verdict := applyRules(data, writer.from, writer.port, true)
+	if verdict.Drop {
+		return nil
+	}
+	if verdict.Delay > 0 {
+		time.Sleep(verdict.Delay)
+	}
+	for i := 0; i <= verdict.Copies; i++ {
+		n, err := writer.Write(data)
+		if err != nil {
+			return err
+		}
+		fmt.Println("TCP", writer.dst.LocalAddr().String(), " => ", writer.dst.RemoteAddr().String(), " Sent", n, " bytes")
+	}
+	return nil
+}
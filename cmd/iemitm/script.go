@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Jaywalker/iemitm/ie"
+	"github.com/Jaywalker/iemitm/script"
+)
+
+// scriptEngine runs the Lua hooks for the UDP packets we forward, if we were given a script
+var scriptEngine *script.Engine
+
+// scriptSequence keeps the game's frame numbering in step with the frames the script injects and drops. The decoder
+// tool numbers the frames itself while it's connected and the two can't be stacked, so then the script can't inject
+// or drop game port frames.
+var scriptSequence = ie.NewSequenceTracker()
+
+// Who each direction's injected frames went to, for sending them again
+var scriptInjectedTo = make(map[ie.FrameDirection]string)
+var scriptInjectedLock sync.Mutex
+
+// How long a frame the script injected waits for an ack before we send it again. The game only retransmits its own
+// frames.
+const injectedResendInterval = time.Second
+
+func loadScript(path string) error {
+	engine, err := script.Load(path)
+	if err != nil {
+		return err
+	}
+	scriptEngine = engine
+	fmt.Println("Script loaded from", engine)
+	return nil
+}
+
+// hookUDP runs the script's hook on a packet. It gives back the packet to forward, or nil to drop it, and the
+// packets the script wants injected. A hook that fails leaves the packet alone.
+func hookUDP(data []byte, from string, port string, badCRC bool) ([]byte, []script.Injection) {
+	if scriptEngine == nil {
+		return data, nil
+	}
+	gamePort := isGamePort(port)
+	numbered := gamePort && decoderSock == nil
+	if numbered && !badCRC && len(data) != dplayPingSize {
+		if info, err := scriptSequence.Forward(data); err == nil && info.Drop {
+			// A retransmit of a frame that was dropped or already acked
+			return nil, numberInjections(nil)
+		}
+	}
+
+	result, err := scriptEngine.Hook(script.Packet{From: from, Port: portNumber(port), DPlay: !gamePort, Data: data, Profile: currentProfile()})
+	for _, log := range result.Logs {
+		fmt.Println("Script:", log)
+	}
+	injections := result.Inject
+	if gamePort {
+		if !numbered && len(injections) > 0 {
+			fmt.Println("Not injecting the script's", len(injections), "frames, the decoder is connected and numbers the frames")
+			injections = nil
+		} else if numbered {
+			injections = numberInjections(injections)
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+		return data, injections
+	}
+	if result.Drop {
+		if gamePort && !numbered {
+			fmt.Println("Not dropping the frame for the script, the decoder is connected and numbers the frames")
+			return data, injections
+		}
+		if numbered {
+			scriptSequence.Drop(data)
+		}
+		return nil, injections
+	}
+	if result.Modified {
+		return result.Data, injections
+	}
+	return data, injections
+}
+
+// numberInjections gives the frames the script injected on the game port the next FrameNums in their direction, and
+// adds the ones it injected before that still haven't been acked to be sent again
+func numberInjections(injections []script.Injection) []script.Injection {
+	scriptInjectedLock.Lock()
+	defer scriptInjectedLock.Unlock()
+
+	var ret []script.Injection
+	for _, injection := range injections {
+		frame := injection.Data
+		if len(frame) <= ie.IEHeaderSize || frame[8] != ie.IE_FRAME_KIND_DATA {
+			// Pings and frames too short to be frames don't take up a FrameNum
+			repairFrameCRC(frame, "script's injected packet")
+			ret = append(ret, injection)
+			continue
+		}
+		header, ok := scriptSequence.Next(binary.BigEndian.Uint32(frame[0:]), binary.BigEndian.Uint32(frame[4:]))
+		if !ok {
+			fmt.Println("Script: not injecting a frame from a player we haven't seen a frame from yet")
+			continue
+		}
+		binary.BigEndian.PutUint16(frame[9:], header.FrameNum)
+		binary.BigEndian.PutUint16(frame[11:], header.FrameExpected)
+		repairFrameCRC(frame, "script's injected packet")
+		scriptSequence.Injected(frame, time.Now())
+		scriptInjectedTo[ie.FrameDirection{From: header.PlayerIDFrom, To: header.PlayerIDTo}] = injection.To
+		ret = append(ret, injection)
+	}
+	for _, frame := range scriptSequence.Unacked(time.Now(), injectedResendInterval) {
+		ret = append(ret, script.Injection{To: scriptInjectedTo[frame.FrameDirection], Data: frame.Data})
+	}
+	return ret
+}
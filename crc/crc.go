@@ -1,51 +1,117 @@
 package crc
 
-type CRC struct {
-	m_dwCRC32 [256]uint32
+import (
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+)
+
+// The game's checksum is CRC32 with the usual IEEE polynomial, but it starts from 0 and isn't inverted at the end.
+// hash/crc32 starts from and finishes with an inversion, so undoing both gives us the game's, table driven.
+//
+// In a frame it covers everything from FrameKind to the end, with the CRC field itself counted as zeros, and the
+// result is stored big endian in the CRC field.
+
+const (
+	FrameOffset  = 8  // Where the checksum starts in a frame
+	CRCOffset    = 14 // Where the CRC field is in a frame
+	MinFrameSize = 18 // A frame is at least an IEHeader
+)
+
+var ErrShortFrame = errors.New("frame too short for a CRC")
+
+var zeros [4]byte
+
+// Update adds p to a running checksum, starting from 0
+func Update(crc uint32, p []byte) uint32 {
+	return ^crc32.Update(^crc, crc32.IEEETable, p)
 }
 
-func (this *CRC) Calculate(data []byte, size uint32) uint32 {
-	var dwSize uint32
-	dwSize = size
-	pData := make([]byte, len(data))
-	copy(pData, data)
-	var dwCrc uint32
-	dwCrc = 0
-	var k uint32
-	k = 0
-
-	// This is where the CRC lives. Null it out before we calculate it
-	pData[6] = 0x00
-	pData[7] = 0x00
-	pData[8] = 0x00
-	pData[9] = 0x00
-
-	for k = 0; k < dwSize; k++ {
-		dataByteAsUint := uint32(pData[k])
-		dwCrc = this.m_dwCRC32[(dwCrc&0xFF)^dataByteAsUint] ^ (dwCrc >> 8)
+// Checksum is the CRC the frame should have. frame has to be at least MinFrameSize bytes.
+func Checksum(frame []byte) uint32 {
+	crc := Update(0, frame[FrameOffset:CRCOffset])
+	crc = Update(crc, zeros[:])
+	return Update(crc, frame[CRCOffset+4:])
+}
+
+// Stored is the CRC in the frame's CRC field
+func Stored(frame []byte) uint32 {
+	return binary.BigEndian.Uint32(frame[CRCOffset:])
+}
+
+// Verify reports whether the frame's CRC field is right
+func Verify(frame []byte) bool {
+	return len(frame) >= MinFrameSize && Stored(frame) == Checksum(frame)
+}
+
+// Fix rewrites the frame's CRC field in place and reports whether it was wrong
+func Fix(frame []byte) (bool, error) {
+	if len(frame) < MinFrameSize {
+		return false, ErrShortFrame
 	}
-	return dwCrc
-}
-
-func New() (ret *CRC) {
-	var m_dwCRC32 [256]uint32
-	// Init our CRC values
-	var m uint32
-	m = 0
-	for m = 0; m <= 255; m++ {
-		v1 := m
-		var bit uint32
-		bit = 0
-		for bit = 8; bit > 0; bit-- {
-			if v1&1 != 0 {
-				v1 >>= 1
-				v1 ^= 0xEDB88320
-			} else {
-				v1 >>= 1
-			}
-		}
-		m_dwCRC32[m] = v1
+	crc := Checksum(frame)
+	if Stored(frame) == crc {
+		return false, nil
+	}
+	binary.BigEndian.PutUint32(frame[CRCOffset:], crc)
+	return true, nil
+}
+
+type digest struct {
+	crc uint32
+}
+
+// NewHash returns the game's checksum as a hash.Hash32. It covers exactly what's written, so for a frame write
+// frame[FrameOffset:] with the CRC field zeroed. Sum appends it big endian, the way frames store it.
+func NewHash() hash.Hash32 {
+	return &digest{}
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	d.crc = Update(d.crc, p)
+	return len(p), nil
+}
+
+func (d *digest) Sum(b []byte) []byte {
+	return append(b, byte(d.crc>>24), byte(d.crc>>16), byte(d.crc>>8), byte(d.crc))
+}
+
+func (d *digest) Sum32() uint32 {
+	return d.crc
+}
+
+func (d *digest) Reset() {
+	d.crc = 0
+}
+
+func (d *digest) Size() int {
+	return 4
+}
+
+func (d *digest) BlockSize() int {
+	return 1
+}
+
+// CRC is what callers used before there was Checksum. The table lives in hash/crc32 now.
+type CRC struct{}
+
+func New() *CRC {
+	return &CRC{}
+}
+
+// Calculate is the checksum of the first size bytes of data, which is a frame from FrameOffset on, so the CRC
+// field is at data[6:10]. Use Checksum with the whole frame instead.
+func (this *CRC) Calculate(data []byte, size uint32) uint32 {
+	data = data[:size]
+	field := CRCOffset - FrameOffset
+	if len(data) < field+4 {
+		var buf [MinFrameSize - FrameOffset]byte
+		copy(buf[:], data)
+		copy(buf[field:], zeros[:])
+		return Update(0, buf[:len(data)])
 	}
-	ret = &CRC{m_dwCRC32}
-	return
+	crc := Update(0, data[:field])
+	crc = Update(crc, zeros[:])
+	return Update(crc, data[field+4:])
 }
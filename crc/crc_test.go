@@ -0,0 +1,124 @@
+package crc
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// A ping captured from BG1
+const testPing = "01000000ad4f6f000200000c880031b62cfc"
+
+// reference is the byte at a time version we started with
+func reference(frame []byte) uint32 {
+	var table [256]uint32
+	for m := uint32(0); m <= 255; m++ {
+		v := m
+		for bit := 0; bit < 8; bit++ {
+			if v&1 != 0 {
+				v = v>>1 ^ 0xEDB88320
+			} else {
+				v >>= 1
+			}
+		}
+		table[m] = v
+	}
+	data := append([]byte{}, frame[FrameOffset:]...)
+	copy(data[CRCOffset-FrameOffset:], zeros[:])
+	var crc uint32
+	for _, b := range data {
+		crc = table[(crc&0xff)^uint32(b)] ^ crc>>8
+	}
+	return crc
+}
+
+func testFrame(size int) []byte {
+	frame := make([]byte, size)
+	for i := range frame {
+		frame[i] = byte(i * 7)
+	}
+	return frame
+}
+
+func TestChecksum(t *testing.T) {
+	ping, _ := hex.DecodeString(testPing)
+	if crc := Checksum(ping); crc != 0x31b62cfc {
+		t.Errorf("CRC of the captured ping is 0x%x, expected 0x31b62cfc", crc)
+	}
+	if !Verify(ping) {
+		t.Error("captured ping didn't verify")
+	}
+	for _, size := range []int{MinFrameSize, 19, 100, 1500} {
+		frame := testFrame(size)
+		if Checksum(frame) != reference(frame) {
+			t.Errorf("size %d: 0x%x, expected 0x%x", size, Checksum(frame), reference(frame))
+		}
+	}
+}
+
+func TestFix(t *testing.T) {
+	frame := testFrame(64)
+	if Verify(frame) {
+		t.Fatal("made up frame verified")
+	}
+	if fixed, err := Fix(frame); !fixed || err != nil {
+		t.Fatalf("Fix: %t %v", fixed, err)
+	}
+	if !Verify(frame) || Stored(frame) != reference(frame) {
+		t.Error("fixed frame didn't verify")
+	}
+	if fixed, err := Fix(frame); fixed || err != nil {
+		t.Errorf("fixing a good frame: %t %v", fixed, err)
+	}
+	if _, err := Fix(frame[:MinFrameSize-1]); err != ErrShortFrame {
+		t.Errorf("expected ErrShortFrame, got %v", err)
+	}
+	if Verify(frame[:MinFrameSize-1]) {
+		t.Error("short frame verified")
+	}
+}
+
+func TestHash(t *testing.T) {
+	frame := testFrame(200)
+	data := append([]byte{}, frame[FrameOffset:]...)
+	copy(data[CRCOffset-FrameOffset:], zeros[:])
+
+	h := NewHash()
+	h.Write(data[:50])
+	h.Write(data[50:])
+	if h.Sum32() != Checksum(frame) {
+		t.Errorf("hash is 0x%x, expected 0x%x", h.Sum32(), Checksum(frame))
+	}
+	Fix(frame)
+	if sum := h.Sum([]byte{0xaa}); string(sum) != string(append([]byte{0xaa}, frame[CRCOffset:CRCOffset+4]...)) {
+		t.Errorf("Sum appended %x", sum)
+	}
+	h.Reset()
+	if h.Sum32() != 0 || h.Size() != 4 || h.BlockSize() != 1 {
+		t.Error("reset hash isn't empty")
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	frame := testFrame(100)
+	if crc := New().Calculate(frame[FrameOffset:], uint32(len(frame)-FrameOffset)); crc != Checksum(frame) {
+		t.Errorf("Calculate is 0x%x, expected 0x%x", crc, Checksum(frame))
+	}
+}
+
+func BenchmarkChecksum(b *testing.B) {
+	frame := testFrame(1500)
+	b.SetBytes(int64(len(frame)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Checksum(frame)
+	}
+}
+
+func BenchmarkReference(b *testing.B) {
+	frame := testFrame(1500)
+	b.SetBytes(int64(len(frame)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		reference(frame)
+	}
+}
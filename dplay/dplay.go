@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"net"
 	"strconv"
+	"strings"
 	"unicode/utf16"
 	"unicode/utf8"
 )
@@ -201,6 +203,38 @@ type DPlayPacket interface {
 	Token() int
 }
 
+// PeekCommand reads the command of a DPlay message without decoding the rest, for callers that only need to know
+// what kind of message it is
+func PeekCommand(data []byte) (DPPacketType, bool) {
+	if len(data) < dpsp_MSG_HEADER_SIZE || string(data[20:24]) != "play" {
+		return 0, false
+	}
+	return DPPacketType(binary.LittleEndian.Uint16(data[24:])), true
+}
+
+// RewriteHeader writes a command, size, token, port and version over the header of a DPlay message in place. The
+// address and signature are kept. It reports false if data doesn't start with a header.
+func RewriteHeader(data []byte, command DPPacketType, size, token, port, version int) bool {
+	if _, ok := PeekCommand(data); !ok {
+		return false
+	}
+	raw := new(dpsp_MSG_HEADER)
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, raw); err != nil {
+		return false
+	}
+	header := newPktHeader(*raw)
+	header.command = command
+	header.sizeAndToken = uint32(token) << 20
+	header.sockAddr.Port = uint16(port)
+	header.version = uint16(version)
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, binary.LittleEndian, header.rawHeader(size)); err != nil {
+		return false
+	}
+	copy(data, buf.Bytes())
+	return true
+}
+
 func NewDPlayPacket(data []byte) DPlayPacket {
 	header := new(dpsp_MSG_HEADER)
 	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, header); err != nil {
@@ -216,10 +250,15 @@ func NewDPlayPacket(data []byte) DPlayPacket {
 	//This function will get big real fast...
 	switch DPPacketType(packet.Command()) {
 	case DPSP_MSG_TYPE_ENUMSESSIONS:
-		packet := NewEnumSessionsPacket(data)
+		// Don't hand back a nil pointer wrapped in a non-nil interface
+		if enumPacket := NewEnumSessionsPacket(data); enumPacket != nil {
+			return enumPacket
+		}
 		return packet
 	case DPSP_MSG_TYPE_ENUMSESSIONSREPLY:
-		packet := NewEnumSessionsReplyPacket(data)
+		if enumReplyPacket := NewEnumSessionsReplyPacket(data); enumReplyPacket != nil {
+			return enumReplyPacket
+		}
 		return packet
 	case DPSP_MSG_TYPE_REQUESTPLAYERID:
 		return packet
@@ -230,16 +269,36 @@ func NewDPlayPacket(data []byte) DPlayPacket {
 	case DPSP_MSG_TYPE_SUPERENUMPLAYERSREPLY:
 		return packet
 	case DPSP_MSG_TYPE_CREATEPLAYER:
+		if createPacket := NewCreatePlayerPacket(data); createPacket != nil {
+			return createPacket
+		}
 		return packet
 	case DPSP_MSG_TYPE_SESSIONDESCCHANGED:
 		return packet
 	case DPSP_MSG_TYPE_DELETEPLAYER:
+		if deletePacket := NewDeletePlayerPacket(data); deletePacket != nil {
+			return deletePacket
+		}
+		return packet
+	case DPSP_MSG_TYPE_CREATEGROUP:
+		if createPacket := NewCreatePlayerPacket(data); createPacket != nil {
+			return createPacket
+		}
+		return packet
+	case DPSP_MSG_TYPE_DELETEGROUP, DPSP_MSG_TYPE_ADDPLAYERTOGROUP, DPSP_MSG_TYPE_DELETEPLAYERFROMGROUP, DPSP_MSG_TYPE_ADDSHORTCUTTOGROUP, DPSP_MSG_TYPE_DELETEGROUPFROMGROUP:
+		if groupPacket := NewGroupPacket(data); groupPacket != nil {
+			return groupPacket
+		}
+		return packet
+	case DPSP_MSG_TYPE_IAMNAMESERVER:
+		if nameServerPacket := NewIAmNameServerPacket(data); nameServerPacket != nil {
+			return nameServerPacket
+		}
 		return packet
 	default:
+		// YOUAREDEAD is just the header, so it lands here as well
 		return packet
 	}
-
-	return packet
 }
 
 //The SOCKADDR_IN structure is built as if it were on a little-endian machine and is treated as a byte array.
@@ -250,6 +309,14 @@ type SOCKADDR_IN struct {
 	Padding       uint64 //Docs Say: MUST be 0 and MUST be ignored
 }
 
+const SOCKADDR_IN_SIZE int = 16
+
+// IP returns the address as a net.IP. The address is stored in network byte order, which
+// binary.Read has already flipped for us since we read it as little endian.
+func (this SOCKADDR_IN) IP() net.IP {
+	return net.IPv4(byte(this.Address), byte(this.Address>>8), byte(this.Address>>16), byte(this.Address>>24))
+}
+
 type dpsp_MSG_HEADER struct {
 	SizeAndToken uint32
 	SockAddr     SOCKADDR_IN
@@ -716,7 +783,10 @@ func NewEnumSessionsReplyPacket(data []byte) *DPSP_PKT_ENUMSESSIONSREPLY {
 
 	header := DPSP_PKT_HEADER{rawpkt.SizeAndToken, rawpkt.SockAddr, rawpkt.Signature, rawpkt.Command, rawpkt.Version}
 	n := int(rawpkt.NameOffset) + 20 //Not sure why, but this number is 20 less than the offset from 0
-	ret := &DPSP_PKT_ENUMSESSIONSREPLY{header, rawpkt.SessionDescription, rawpkt.NameOffset, UTF16BytesToString(data[n:], binary.LittleEndian)}
+	ret := &DPSP_PKT_ENUMSESSIONSREPLY{header, rawpkt.SessionDescription, rawpkt.NameOffset, ""}
+	if n < len(data) {
+		ret.sessionName = UTF16BytesToString(data[n:], binary.LittleEndian)
+	}
 	return ret
 }
 
@@ -823,3 +893,454 @@ type dpsp_MSG_DELETEPLAYER struct {
 	CreateOffset   uint32
 	PasswordOffset uint32
 }
+
+// The player and group management messages all start with the same five fields
+type dpsp_MSG_PLAYERMGMT struct {
+	dpsp_MSG_HEADER
+	IDTo           uint32
+	PlayerID       uint32
+	GroupID        uint32
+	CreateOffset   uint32 //DS: Offset of the PlayerInfo field from the beginning of the Signature field
+	PasswordOffset uint32
+}
+
+const dpsp_MSG_PLAYERMGMT_SIZE int = dpsp_MSG_HEADER_SIZE + 20
+
+const dpsp_MSG_HEADER_SIZE int = 28
+
+// The Signature field sits after SizeAndToken and the SOCKADDR_IN. All the offsets in the spec are relative to it
+const dpsp_SIGNATURE_OFFSET int = 20
+
+func newPktHeader(rawHeader dpsp_MSG_HEADER) DPSP_PKT_HEADER {
+	//Fix the Port, which for some reason is BigEndian
+	rawHeader.SockAddr.Port = (rawHeader.SockAddr.Port >> 8) | (rawHeader.SockAddr.Port << 8)
+	return DPSP_PKT_HEADER{rawHeader.SizeAndToken, rawHeader.SockAddr, rawHeader.Signature, rawHeader.Command, rawHeader.Version}
+}
+
+// NewPktHeader builds a header for a packet we want to send ourselves. Size is filled in when the packet is marshaled.
+func NewPktHeader(command DPPacketType, token int, sockAddr SOCKADDR_IN, version int) DPSP_PKT_HEADER {
+	return DPSP_PKT_HEADER{uint32(token) << 20, sockAddr, [4]byte{'p', 'l', 'a', 'y'}, command, uint16(version)}
+}
+
+// rawHeader turns the header back into its wire form for a packet of the given total size
+func (this *DPSP_PKT_HEADER) rawHeader(size int) dpsp_MSG_HEADER {
+	sockAddr := this.sockAddr
+	sockAddr.Port = (sockAddr.Port >> 8) | (sockAddr.Port << 8)
+	sizeAndToken := (this.sizeAndToken >> 20 << 20) | (uint32(size) & 0xFFFFF)
+	return dpsp_MSG_HEADER{sizeAndToken, sockAddr, this.signature, this.command, this.version}
+}
+
+// StringToUTF16Bytes is the reverse of UTF16BytesToString, including the NULL terminator DPlay expects
+func StringToUTF16Bytes(str string, o binary.ByteOrder) []byte {
+	utf := utf16.Encode([]rune(str))
+	ret := make([]byte, (len(utf)+1)*2)
+	for i, c := range utf {
+		o.PutUint16(ret[i*2:], c)
+	}
+	return ret
+}
+
+// The fixed size portion of a DPLAYI_PACKEDPLAYER, everything before ShortName
+type dplayi_PACKEDPLAYER_FIXED struct {
+	Size                    uint32
+	Flags                   uint32
+	PlayerID                uint32
+	ShortNameLength         uint32
+	LongNameLength          uint32
+	ServiceProviderDataSize uint32
+	PlayerDataSize          uint32
+	NumberOfPlayers         uint32
+	SystemPlayerID          uint32
+	FixedSize               uint32
+	PlayerVersion           uint32
+	ParentID                uint32
+}
+
+const dplayi_PACKEDPLAYER_FIXED_SIZE int = 48
+
+func NewPackedPlayer(data []byte) *DPLAYI_PACKEDPLAYER {
+	fixed := new(dplayi_PACKEDPLAYER_FIXED)
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, fixed); err != nil {
+		fmt.Println("binary.Read failed:", err)
+		return nil
+	}
+
+	ret := &DPLAYI_PACKEDPLAYER{
+		Size:                    fixed.Size,
+		Flags:                   fixed.Flags,
+		PlayerID:                fixed.PlayerID,
+		ShortNameLength:         fixed.ShortNameLength,
+		LongNameLength:          fixed.LongNameLength,
+		ServiceProviderDataSize: fixed.ServiceProviderDataSize,
+		PlayerDataSize:          fixed.PlayerDataSize,
+		NumberOfPlayers:         fixed.NumberOfPlayers,
+		SystemPlayerID:          fixed.SystemPlayerID,
+		FixedSize:               fixed.FixedSize,
+		PlayerVersion:           fixed.PlayerVersion,
+		ParentID:                fixed.ParentID,
+	}
+
+	// Everything after the fixed portion is optional and sized by the fields above, so stop at the first one that doesn't fit
+	rest := data[dplayi_PACKEDPLAYER_FIXED_SIZE:]
+	if uint64(fixed.ShortNameLength) > uint64(len(rest)) {
+		return ret
+	}
+	ret.ShortName = strings.TrimRight(UTF16BytesToString(rest[:fixed.ShortNameLength], binary.LittleEndian), "\x00")
+	rest = rest[fixed.ShortNameLength:]
+	if uint64(fixed.LongNameLength) > uint64(len(rest)) {
+		return ret
+	}
+	ret.LongName = strings.TrimRight(UTF16BytesToString(rest[:fixed.LongNameLength], binary.LittleEndian), "\x00")
+	rest = rest[fixed.LongNameLength:]
+	if uint64(fixed.ServiceProviderDataSize) > uint64(len(rest)) {
+		return ret
+	}
+	ret.ServiceProviderData = append([]byte{}, rest[:fixed.ServiceProviderDataSize]...)
+	rest = rest[fixed.ServiceProviderDataSize:]
+	if uint64(fixed.PlayerDataSize) > uint64(len(rest)) {
+		return ret
+	}
+	ret.PlayerData = append([]byte{}, rest[:fixed.PlayerDataSize]...)
+	rest = rest[fixed.PlayerDataSize:]
+	if uint64(fixed.NumberOfPlayers)*4 > uint64(len(rest)) {
+		return ret
+	}
+	ret.PlayerIDs = make([]uint32, fixed.NumberOfPlayers)
+	for i := range ret.PlayerIDs {
+		ret.PlayerIDs[i] = binary.LittleEndian.Uint32(rest[i*4:])
+	}
+	return ret
+}
+
+func (this *DPLAYI_PACKEDPLAYER) Marshal() ([]byte, error) {
+	var shortName, longName []byte
+	if this.ShortName != "" {
+		shortName = StringToUTF16Bytes(this.ShortName, binary.LittleEndian)
+	}
+	if this.LongName != "" {
+		longName = StringToUTF16Bytes(this.LongName, binary.LittleEndian)
+	}
+	size := dplayi_PACKEDPLAYER_FIXED_SIZE + len(shortName) + len(longName) + len(this.ServiceProviderData) + len(this.PlayerData) + len(this.PlayerIDs)*4
+	fixed := dplayi_PACKEDPLAYER_FIXED{
+		Size:                    uint32(size),
+		Flags:                   this.Flags,
+		PlayerID:                this.PlayerID,
+		ShortNameLength:         uint32(len(shortName)),
+		LongNameLength:          uint32(len(longName)),
+		ServiceProviderDataSize: uint32(len(this.ServiceProviderData)),
+		PlayerDataSize:          uint32(len(this.PlayerData)),
+		NumberOfPlayers:         uint32(len(this.PlayerIDs)),
+		SystemPlayerID:          this.SystemPlayerID,
+		FixedSize:               uint32(dplayi_PACKEDPLAYER_FIXED_SIZE),
+		PlayerVersion:           this.PlayerVersion,
+		ParentID:                this.ParentID,
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	if err := binary.Write(buf, binary.LittleEndian, fixed); err != nil {
+		return nil, err
+	}
+	buf.Write(shortName)
+	buf.Write(longName)
+	buf.Write(this.ServiceProviderData)
+	buf.Write(this.PlayerData)
+	if err := binary.Write(buf, binary.LittleEndian, this.PlayerIDs); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (this *DPLAYI_PACKEDPLAYER) FlagsSystemPlayer() bool {
+	s := ((this.Flags << 31) >> 31) //S (1 bit): The player is the system player
+	if s == 1 {
+		return true
+	}
+	return false
+}
+
+func (this *DPLAYI_PACKEDPLAYER) FlagsNameServer() bool {
+	n := ((this.Flags << 30) >> 31) //N (1 bit): The player is the name server (host). MUST be combined with S
+	if n == 1 {
+		return true
+	}
+	return false
+}
+
+func (this *DPLAYI_PACKEDPLAYER) FlagsPlayerInGroup() bool {
+	g := ((this.Flags << 29) >> 31) //G (1 bit): The player belongs to a group
+	if g == 1 {
+		return true
+	}
+	return false
+}
+
+func (this *DPLAYI_PACKEDPLAYER) FlagsPlayerIsLocal() bool {
+	l := ((this.Flags << 28) >> 31) //L (1 bit): The player is on the machine that sent the message
+	if l == 1 {
+		return true
+	}
+	return false
+}
+
+func (this *DPLAYI_PACKEDPLAYER) String() string {
+	ret := "PlayerID: " + fmt.Sprintf("0x%X", this.PlayerID)
+	ret += "\n\t\tSystemPlayerID: " + fmt.Sprintf("0x%X", this.SystemPlayerID)
+	ret += "\n\t\tShortName: '" + this.ShortName + "'"
+	ret += "\n\t\tLongName: '" + this.LongName + "'"
+	ret += "\n\t\tSystemPlayer: " + strconv.FormatBool(this.FlagsSystemPlayer())
+	ret += "\n\t\tNameServer: " + strconv.FormatBool(this.FlagsNameServer())
+	ret += "\n\t\tPlayerInGroup: " + strconv.FormatBool(this.FlagsPlayerInGroup())
+	ret += "\n\t\tPlayerIsLocal: " + strconv.FormatBool(this.FlagsPlayerIsLocal())
+	if this.ParentID != 0 {
+		ret += "\n\t\tParentID: " + fmt.Sprintf("0x%X", this.ParentID)
+	}
+	return ret
+}
+
+// Used for both CREATEPLAYER and CREATEGROUP, which share a layout. For a group, PlayerID is the new group's ID
+// and PlayerInfo describes the group, with ParentID set if it's nested in another group.
+type DPSP_PKT_CREATEPLAYER struct {
+	DPSP_PKT_HEADER
+	idTo       uint32
+	playerID   uint32
+	groupID    uint32
+	playerInfo *DPLAYI_PACKEDPLAYER
+}
+
+func NewCreatePlayerPacket(data []byte) *DPSP_PKT_CREATEPLAYER {
+	rawpkt := new(dpsp_MSG_PLAYERMGMT)
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, rawpkt); err != nil {
+		fmt.Println("binary.Read failed:", err)
+		return nil
+	}
+
+	ret := &DPSP_PKT_CREATEPLAYER{newPktHeader(rawpkt.dpsp_MSG_HEADER), rawpkt.IDTo, rawpkt.PlayerID, rawpkt.GroupID, nil}
+	n := dpsp_SIGNATURE_OFFSET + int(rawpkt.CreateOffset)
+	if rawpkt.CreateOffset != 0 && n < len(data) {
+		ret.playerInfo = NewPackedPlayer(data[n:])
+	}
+	return ret
+}
+
+func (this *DPSP_PKT_CREATEPLAYER) IDTo() uint32 {
+	return this.idTo
+}
+
+func (this *DPSP_PKT_CREATEPLAYER) PlayerID() uint32 {
+	return this.playerID
+}
+
+func (this *DPSP_PKT_CREATEPLAYER) GroupID() uint32 {
+	return this.groupID
+}
+
+// PlayerInfo may be nil if the packet was too short to hold it
+func (this *DPSP_PKT_CREATEPLAYER) PlayerInfo() *DPLAYI_PACKEDPLAYER {
+	return this.playerInfo
+}
+
+func (this *DPSP_PKT_CREATEPLAYER) Marshal() ([]byte, error) {
+	var playerInfo []byte
+	if this.playerInfo != nil {
+		var err error
+		playerInfo, err = this.playerInfo.Marshal()
+		if err != nil {
+			return nil, err
+		}
+	}
+	// PlayerInfo is followed by Reserved1 (uint16) and Reserved2 (uint32)
+	size := dpsp_MSG_PLAYERMGMT_SIZE + len(playerInfo) + 6
+	raw := dpsp_MSG_PLAYERMGMT{this.rawHeader(size), this.idTo, this.playerID, this.groupID, uint32(dpsp_MSG_PLAYERMGMT_SIZE - dpsp_SIGNATURE_OFFSET), 0}
+	if playerInfo == nil {
+		raw.CreateOffset = 0
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	if err := binary.Write(buf, binary.LittleEndian, raw); err != nil {
+		return nil, err
+	}
+	buf.Write(playerInfo)
+	buf.Write(make([]byte, 6))
+	return buf.Bytes(), nil
+}
+
+func (this *DPSP_PKT_CREATEPLAYER) String() string {
+	ret := this.DPSP_PKT_HEADER.String()
+	ret += "\n\t---"
+	ret += "\n\tIDTo: " + fmt.Sprintf("0x%X", this.idTo)
+	ret += "\n\tPlayerID: " + fmt.Sprintf("0x%X", this.playerID)
+	ret += "\n\tGroupID: " + fmt.Sprintf("0x%X", this.groupID)
+	if this.playerInfo != nil {
+		ret += "\n\tPlayerInfo: " + this.playerInfo.String()
+	}
+	return ret
+}
+
+type DPSP_PKT_DELETEPLAYER struct {
+	DPSP_PKT_HEADER
+	idTo     uint32
+	playerID uint32
+	groupID  uint32
+}
+
+func NewDeletePlayerPacket(data []byte) *DPSP_PKT_DELETEPLAYER {
+	rawpkt := new(dpsp_MSG_DELETEPLAYER)
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, rawpkt); err != nil {
+		fmt.Println("binary.Read failed:", err)
+		return nil
+	}
+
+	ret := &DPSP_PKT_DELETEPLAYER{newPktHeader(rawpkt.dpsp_MSG_HEADER), rawpkt.IDTo, rawpkt.PlayerID, rawpkt.GroupID}
+	return ret
+}
+
+func (this *DPSP_PKT_DELETEPLAYER) IDTo() uint32 {
+	return this.idTo
+}
+
+func (this *DPSP_PKT_DELETEPLAYER) PlayerID() uint32 {
+	return this.playerID
+}
+
+func (this *DPSP_PKT_DELETEPLAYER) String() string {
+	ret := this.DPSP_PKT_HEADER.String()
+	ret += "\n\t---"
+	ret += "\n\tIDTo: " + fmt.Sprintf("0x%X", this.idTo)
+	ret += "\n\tPlayerID: " + fmt.Sprintf("0x%X", this.playerID)
+	return ret
+}
+
+// Sent by the new game host once host migration has finished
+type dpsp_MSG_IAMNAMESERVER struct {
+	dpsp_MSG_HEADER
+	IDTo       uint32 //DS: ID of the player to whom this message is being sent
+	ID         uint32 //DS: ID of the system player on the new host
+	Flags      uint32 //DS: Player flags of the new host's system player
+	SPDataSize uint32 //DS: Size of the SPData field
+	//SPData     []byte
+}
+
+const dpsp_MSG_IAMNAMESERVER_SIZE int = dpsp_MSG_HEADER_SIZE + 16
+
+type DPSP_PKT_IAMNAMESERVER struct {
+	DPSP_PKT_HEADER
+	idTo   uint32
+	id     uint32
+	flags  uint32
+	spData []byte
+}
+
+func NewIAmNameServerPacket(data []byte) *DPSP_PKT_IAMNAMESERVER {
+	rawpkt := new(dpsp_MSG_IAMNAMESERVER)
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, rawpkt); err != nil {
+		fmt.Println("binary.Read failed:", err)
+		return nil
+	}
+
+	ret := &DPSP_PKT_IAMNAMESERVER{newPktHeader(rawpkt.dpsp_MSG_HEADER), rawpkt.IDTo, rawpkt.ID, rawpkt.Flags, nil}
+	spData := data[dpsp_MSG_IAMNAMESERVER_SIZE:]
+	if uint64(rawpkt.SPDataSize) < uint64(len(spData)) {
+		spData = spData[:rawpkt.SPDataSize]
+	}
+	ret.spData = append([]byte{}, spData...)
+	return ret
+}
+
+func (this *DPSP_PKT_IAMNAMESERVER) IDTo() uint32 {
+	return this.idTo
+}
+
+// NameServerID is the system player ID of the machine that took over as host
+func (this *DPSP_PKT_IAMNAMESERVER) NameServerID() uint32 {
+	return this.id
+}
+
+// HostAddr returns the stream address the Winsock service provider put in SPData. The
+// address is zero when the sender left it for us to fill in from the socket, in which case
+// ok is false.
+func (this *DPSP_PKT_IAMNAMESERVER) HostAddr() (addr net.IP, ok bool) {
+	var sockAddr SOCKADDR_IN
+	if err := binary.Read(bytes.NewReader(this.spData), binary.LittleEndian, &sockAddr); err != nil {
+		return nil, false
+	}
+	if sockAddr.Address == 0 {
+		return nil, false
+	}
+	return sockAddr.IP(), true
+}
+
+func (this *DPSP_PKT_IAMNAMESERVER) String() string {
+	ret := this.DPSP_PKT_HEADER.String()
+	ret += "\n\t---"
+	ret += "\n\tIDTo: " + fmt.Sprintf("0x%X", this.idTo)
+	ret += "\n\tNameServerID: " + fmt.Sprintf("0x%X", this.id)
+	ret += "\n\tFlags: " + fmt.Sprintf("0x%X", this.flags)
+	if addr, ok := this.HostAddr(); ok {
+		ret += "\n\tHost Address: " + addr.String()
+	}
+	return ret
+}
+
+// DELETEGROUP, ADDPLAYERTOGROUP, DELETEPLAYERFROMGROUP, ADDSHORTCUTTOGROUP and DELETEGROUPFROMGROUP are all
+// just the five player management fields. For the shortcut messages PlayerID is the child group being added to
+// or removed from GroupID. For DELETEGROUP, only GroupID is used.
+type DPSP_PKT_GROUP struct {
+	DPSP_PKT_HEADER
+	idTo     uint32
+	playerID uint32
+	groupID  uint32
+}
+
+func NewGroupPacket(data []byte) *DPSP_PKT_GROUP {
+	rawpkt := new(dpsp_MSG_PLAYERMGMT)
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, rawpkt); err != nil {
+		fmt.Println("binary.Read failed:", err)
+		return nil
+	}
+
+	ret := &DPSP_PKT_GROUP{newPktHeader(rawpkt.dpsp_MSG_HEADER), rawpkt.IDTo, rawpkt.PlayerID, rawpkt.GroupID}
+	return ret
+}
+
+// BuildGroupPacket creates one of the group management messages from scratch, ready to be marshaled
+func BuildGroupPacket(header DPSP_PKT_HEADER, idTo, playerID, groupID uint32) *DPSP_PKT_GROUP {
+	return &DPSP_PKT_GROUP{header, idTo, playerID, groupID}
+}
+
+func (this *DPSP_PKT_GROUP) IDTo() uint32 {
+	return this.idTo
+}
+
+func (this *DPSP_PKT_GROUP) PlayerID() uint32 {
+	return this.playerID
+}
+
+func (this *DPSP_PKT_GROUP) GroupID() uint32 {
+	return this.groupID
+}
+
+func (this *DPSP_PKT_GROUP) Marshal() ([]byte, error) {
+	raw := dpsp_MSG_PLAYERMGMT{this.rawHeader(dpsp_MSG_PLAYERMGMT_SIZE), this.idTo, this.playerID, this.groupID, 0, 0}
+	buf := bytes.NewBuffer(make([]byte, 0, dpsp_MSG_PLAYERMGMT_SIZE))
+	if err := binary.Write(buf, binary.LittleEndian, raw); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (this *DPSP_PKT_GROUP) String() string {
+	ret := this.DPSP_PKT_HEADER.String()
+	ret += "\n\t---"
+	ret += "\n\tIDTo: " + fmt.Sprintf("0x%X", this.idTo)
+	switch this.command {
+	case DPSP_MSG_TYPE_ADDSHORTCUTTOGROUP, DPSP_MSG_TYPE_DELETEGROUPFROMGROUP:
+		ret += "\n\tChild GroupID: " + fmt.Sprintf("0x%X", this.playerID)
+		ret += "\n\tParent GroupID: " + fmt.Sprintf("0x%X", this.groupID)
+	case DPSP_MSG_TYPE_DELETEGROUP:
+		ret += "\n\tGroupID: " + fmt.Sprintf("0x%X", this.groupID)
+	default:
+		ret += "\n\tPlayerID: " + fmt.Sprintf("0x%X", this.playerID)
+		ret += "\n\tGroupID: " + fmt.Sprintf("0x%X", this.groupID)
+	}
+	return ret
+}
@@ -0,0 +1,255 @@
+package dplay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func marshalRaw(t testing.TB, raw any, tail ...[]byte) []byte {
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, binary.LittleEndian, raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range tail {
+		buf.Write(b)
+	}
+	return buf.Bytes()
+}
+
+func testHeader(command DPPacketType) DPSP_PKT_HEADER {
+	return NewPktHeader(command, 0xFAB, SOCKADDR_IN{2, 2300, 0, 0}, 14)
+}
+
+func enumSessionsPacket(t testing.TB) []byte {
+	header := testHeader(DPSP_MSG_TYPE_ENUMSESSIONS)
+	raw := dpsp_MSG_ENUMSESSIONS{header.rawHeader(52), [16]byte{0xD4, 0x0E, 0x7A, 0xAB}, 0, 1}
+	return marshalRaw(t, raw)
+}
+
+func enumSessionsReplyPacket(t testing.TB, sessionName string) []byte {
+	header := testHeader(DPSP_MSG_TYPE_ENUMSESSIONSREPLY)
+	name := StringToUTF16Bytes(sessionName, binary.LittleEndian)
+	raw := dpsp_MSG_ENUMSESSIONSREPLY{}
+	raw.dpsp_MSG_HEADER = header.rawHeader(112 + len(name))
+	raw.SessionDescription = dpSESSIONDESC2{Size: 80, Flags: 0x4, MaxPlayers: 6, CurrentPlayerCount: 1}
+	raw.NameOffset = 112 - 20
+	return marshalRaw(t, raw, name)
+}
+
+func createPlayerPacket(t testing.TB, command DPPacketType, player *DPLAYI_PACKEDPLAYER) []byte {
+	packet := &DPSP_PKT_CREATEPLAYER{testHeader(command), 0, player.PlayerID, 0, player}
+	data, err := packet.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func groupPacket(t testing.TB, command DPPacketType, playerID, groupID uint32) []byte {
+	data, err := BuildGroupPacket(testHeader(command), 0, playerID, groupID).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func iAmNameServerPacket(t testing.TB, id uint32, hostAddr [4]byte) []byte {
+	header := testHeader(DPSP_MSG_TYPE_IAMNAMESERVER)
+	spData := marshalRaw(t, [2]SOCKADDR_IN{
+		{2, 0xFC08, binary.LittleEndian.Uint32(hostAddr[:]), 0},
+		{2, 0xFC08, binary.LittleEndian.Uint32(hostAddr[:]), 0},
+	})
+	raw := dpsp_MSG_IAMNAMESERVER{header.rawHeader(dpsp_MSG_IAMNAMESERVER_SIZE + len(spData)), 0, id, 0x3, uint32(len(spData))}
+	return marshalRaw(t, raw, spData)
+}
+
+func youAreDeadPacket(t testing.TB) []byte {
+	header := testHeader(DPSP_MSG_TYPE_YOUAREDEAD)
+	return marshalRaw(t, header.rawHeader(dpsp_MSG_HEADER_SIZE))
+}
+
+var testPlayer = &DPLAYI_PACKEDPLAYER{
+	Flags:               0x3,
+	PlayerID:            0x0199,
+	SystemPlayerID:      0x0199,
+	PlayerVersion:       0xE,
+	ShortName:           "Jaywalker",
+	LongName:            "Jaywalker's Party",
+	ServiceProviderData: make([]byte, 32),
+	PlayerData:          []byte{1, 2, 3, 4},
+}
+
+var testGroup = &DPLAYI_PACKEDPLAYER{
+	PlayerID:  0x0455,
+	ParentID:  0x0456,
+	ShortName: "System Group",
+	PlayerIDs: []uint32{0x0199, 0x019A},
+}
+
+// seedPackets is packets built by our own encoders. We haven't got any DPlay captures to seed from.
+func seedPackets(t testing.TB) map[string][]byte {
+	seeds := map[string][]byte{
+		"enumsessions":         enumSessionsPacket(t),
+		"enumsessionsreply":    enumSessionsReplyPacket(t, "BG Session"),
+		"createplayer":         createPlayerPacket(t, DPSP_MSG_TYPE_CREATEPLAYER, testPlayer),
+		"creategroup":          createPlayerPacket(t, DPSP_MSG_TYPE_CREATEGROUP, testGroup),
+		"deleteplayer":         groupPacket(t, DPSP_MSG_TYPE_DELETEPLAYER, 0x0199, 0),
+		"addplayertogroup":     groupPacket(t, DPSP_MSG_TYPE_ADDPLAYERTOGROUP, 0x0199, 0x0455),
+		"addshortcuttogroup":   groupPacket(t, DPSP_MSG_TYPE_ADDSHORTCUTTOGROUP, 0x0457, 0x0455),
+		"deletegroupfromgroup": groupPacket(t, DPSP_MSG_TYPE_DELETEGROUPFROMGROUP, 0x0457, 0x0455),
+		"iamnameserver":        iAmNameServerPacket(t, 0x019A, [4]byte{192, 168, 122, 7}),
+		"youaredead":           youAreDeadPacket(t),
+	}
+	return seeds
+}
+
+func FuzzNewDPlayPacket(f *testing.F) {
+	for _, seed := range seedPackets(f) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packet := NewDPlayPacket(data)
+		if packet != nil {
+			_ = packet.String()
+		}
+	})
+}
+
+func FuzzNewEnumSessionsReplyPacket(f *testing.F) {
+	f.Add(enumSessionsReplyPacket(f, "BG Session"))
+	f.Add(enumSessionsReplyPacket(f, ""))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packet := NewEnumSessionsReplyPacket(data)
+		if packet != nil {
+			_ = packet.String()
+		}
+	})
+}
+
+func FuzzNewPackedPlayer(f *testing.F) {
+	for _, player := range []*DPLAYI_PACKEDPLAYER{testPlayer, testGroup} {
+		data, err := player.Marshal()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		player := NewPackedPlayer(data)
+		if player == nil {
+			return
+		}
+		_ = player.String()
+
+		// Whatever we managed to decode has to survive being encoded and decoded again
+		encoded, err := player.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		reencoded, err := NewPackedPlayer(encoded).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, reencoded) {
+			t.Fatalf("round trip mismatch:\n%x\n%x", encoded, reencoded)
+		}
+	})
+}
+
+func FuzzUTF16BytesToString(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{'B', 0})
+	f.Add(StringToUTF16Bytes("BG Session", binary.LittleEndian))
+	f.Add([]byte{0x00, 0xD8, 0x41}) // Unpaired surrogate with an odd byte left over
+	f.Fuzz(func(t *testing.T, data []byte) {
+		str := UTF16BytesToString(data, binary.LittleEndian)
+		if back := UTF16BytesToString(StringToUTF16Bytes(str, binary.LittleEndian), binary.LittleEndian); back != str+"\x00" {
+			t.Fatalf("round trip mismatch: %q != %q", back, str+"\x00")
+		}
+	})
+}
+
+func TestGroupPacketRoundTrip(t *testing.T) {
+	commands := []DPPacketType{DPSP_MSG_TYPE_DELETEGROUP, DPSP_MSG_TYPE_ADDPLAYERTOGROUP, DPSP_MSG_TYPE_DELETEPLAYERFROMGROUP, DPSP_MSG_TYPE_ADDSHORTCUTTOGROUP, DPSP_MSG_TYPE_DELETEGROUPFROMGROUP}
+	for _, command := range commands {
+		data := groupPacket(t, command, 0x0199, 0x0455)
+		packet, ok := NewDPlayPacket(data).(*DPSP_PKT_GROUP)
+		if !ok {
+			t.Fatalf("%s: decoded to the wrong type", commandToString(command))
+		}
+		if packet.Command() != int(command) || packet.PlayerID() != 0x0199 || packet.GroupID() != 0x0455 || packet.Size() != len(data) || packet.Token() != 0xFAB || packet.Port() != 2300 {
+			t.Errorf("%s: decoded fields don't match: %s", commandToString(command), packet)
+		}
+		encoded, err := packet.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, data) {
+			t.Errorf("%s: round trip mismatch:\n%x\n%x", commandToString(command), data, encoded)
+		}
+	}
+}
+
+func TestCreatePlayerRoundTrip(t *testing.T) {
+	for _, player := range []*DPLAYI_PACKEDPLAYER{testPlayer, testGroup} {
+		data := createPlayerPacket(t, DPSP_MSG_TYPE_CREATEPLAYER, player)
+		packet, ok := NewDPlayPacket(data).(*DPSP_PKT_CREATEPLAYER)
+		if !ok {
+			t.Fatal("decoded to the wrong type")
+		}
+		info := packet.PlayerInfo()
+		if info == nil {
+			t.Fatal("no PlayerInfo")
+		}
+		if info.ShortName != player.ShortName || info.LongName != player.LongName || info.PlayerID != player.PlayerID || info.ParentID != player.ParentID || len(info.PlayerIDs) != len(player.PlayerIDs) {
+			t.Errorf("decoded player doesn't match: %s", info)
+		}
+		encoded, err := packet.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, data) {
+			t.Errorf("round trip mismatch:\n%x\n%x", data, encoded)
+		}
+	}
+}
+
+func TestEnumSessionsReplyNameOffsetOutOfRange(t *testing.T) {
+	data := enumSessionsReplyPacket(t, "BG Session")
+	binary.LittleEndian.PutUint32(data[108:], 0xFFFFFFF0)
+	packet := NewEnumSessionsReplyPacket(data)
+	if packet == nil || packet.sessionName != "" {
+		t.Fatalf("expected a packet with no session name, got %v", packet)
+	}
+}
+
+func TestRewriteHeader(t *testing.T) {
+	data := groupPacket(t, DPSP_MSG_TYPE_DELETEGROUP, 1, 2)
+	if !RewriteHeader(data, DPSP_MSG_TYPE_ADDPLAYERTOGROUP, 100, 0xABC, 2301, 9) {
+		t.Fatal("header wasn't rewritten")
+	}
+	packet := NewDPlayPacket(data)
+	if packet.Command() != int(DPSP_MSG_TYPE_ADDPLAYERTOGROUP) || packet.Size() != 100 || packet.Token() != 0xABC || packet.Port() != 2301 || packet.Version() != 9 || packet.Signature() != "play" {
+		t.Errorf("unexpected header: %s", packet)
+	}
+	if group, ok := packet.(*DPSP_PKT_GROUP); !ok || group.PlayerID() != 1 || group.GroupID() != 2 {
+		t.Errorf("the rest of the message changed: %s", packet)
+	}
+	if RewriteHeader(make([]byte, 40), DPSP_MSG_TYPE_DELETEGROUP, 40, 0, 0, 0) {
+		t.Error("rewrote a header without the play signature")
+	}
+}
+
+func TestPeekCommand(t *testing.T) {
+	data := groupPacket(t, DPSP_MSG_TYPE_DELETEGROUP, 1, 2)
+	if command, ok := PeekCommand(data); !ok || command != DPSP_MSG_TYPE_DELETEGROUP {
+		t.Errorf("peeked %s", commandToString(command))
+	}
+	if _, ok := PeekCommand(data[:dpsp_MSG_HEADER_SIZE-1]); ok {
+		t.Error("peeked a command from a short message")
+	}
+	if _, ok := PeekCommand(make([]byte, 40)); ok {
+		t.Error("peeked a command without the play signature")
+	}
+}
@@ -0,0 +1,77 @@
+package dplay
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrBadGUID = errors.New("GUID must look like {XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX}")
+
+// GUID is a Windows GUID as it's sent on the wire: Data1, Data2 and Data3 little endian, then Data4's 8 bytes
+type GUID [16]byte
+
+// String gives the GUID in the usual registry form, which is how games document them
+func (guid GUID) String() string {
+	return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}", binary.LittleEndian.Uint32(guid[0:]), binary.LittleEndian.Uint16(guid[4:]), binary.LittleEndian.Uint16(guid[6:]), guid[8:10], guid[10:])
+}
+
+// ParseGUID reads a GUID in the registry form, with or without the braces
+func ParseGUID(s string) (GUID, error) {
+	var guid GUID
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+	parts := strings.Split(s, "-")
+	if len(parts) != 5 || len(parts[0]) != 8 || len(parts[1]) != 4 || len(parts[2]) != 4 || len(parts[3]) != 4 || len(parts[4]) != 12 {
+		return guid, ErrBadGUID
+	}
+	raw, err := hex.DecodeString(strings.Join(parts, ""))
+	if err != nil {
+		return guid, ErrBadGUID
+	}
+	binary.LittleEndian.PutUint32(guid[0:], binary.BigEndian.Uint32(raw[0:]))
+	binary.LittleEndian.PutUint16(guid[4:], binary.BigEndian.Uint16(raw[4:]))
+	binary.LittleEndian.PutUint16(guid[6:], binary.BigEndian.Uint16(raw[6:]))
+	copy(guid[8:], raw[8:])
+	return guid, nil
+}
+
+// AppGUIDPacket is a packet that names the application the session is for. The application GUID is how DirectPlay
+// tells games apart.
+type AppGUIDPacket interface {
+	DPlayPacket
+	AppGUID() GUID
+}
+
+func (this *DPSP_PKT_ENUMSESSIONS) AppGUID() GUID {
+	return GUID(this.applicationGUID)
+}
+
+func (this *DPSP_PKT_ENUMSESSIONSREPLY) AppGUID() GUID {
+	return GUID(this.sessionDesc.AppGUID)
+}
+
+// SetAppGUID writes the application GUID of a message that carries one in place. It reports false for messages
+// that don't.
+func SetAppGUID(data []byte, guid GUID) bool {
+	command, ok := PeekCommand(data)
+	if !ok {
+		return false
+	}
+	var offset int
+	switch command {
+	case DPSP_MSG_TYPE_ENUMSESSIONS:
+		offset = dpsp_MSG_HEADER_SIZE
+	case DPSP_MSG_TYPE_ENUMSESSIONSREPLY:
+		// After the session description's Size, Flags and InstGUID
+		offset = dpsp_MSG_HEADER_SIZE + 24
+	default:
+		return false
+	}
+	if len(data) < offset+len(guid) {
+		return false
+	}
+	copy(data[offset:], guid[:])
+	return true
+}
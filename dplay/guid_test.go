@@ -0,0 +1,50 @@
+package dplay
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseGUID(t *testing.T) {
+	guid, err := ParseGUID("{12345678-9ABC-DEF0-1122-334455667788}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wire := GUID{0x78, 0x56, 0x34, 0x12, 0xbc, 0x9a, 0xf0, 0xde, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88}
+	if guid != wire {
+		t.Errorf("unexpected wire bytes: %x", guid[:])
+	}
+	if guid.String() != "{12345678-9ABC-DEF0-1122-334455667788}" {
+		t.Errorf("unexpected string: %s", guid)
+	}
+	if braceless, _ := ParseGUID("12345678-9abc-def0-1122-334455667788"); braceless != guid {
+		t.Errorf("braces or case changed the GUID: %s", braceless)
+	}
+	for _, bad := range []string{"", "{12345678-9ABC-DEF0-1122}", "{1234567G-9ABC-DEF0-1122-334455667788}", "{123456789-ABC-DEF0-1122-334455667788}"} {
+		if _, err := ParseGUID(bad); !errors.Is(err, ErrBadGUID) {
+			t.Errorf("%q: expected ErrBadGUID, got %v", bad, err)
+		}
+	}
+}
+
+func TestSetAppGUID(t *testing.T) {
+	guid, _ := ParseGUID("{12345678-9ABC-DEF0-1122-334455667788}")
+	for name, data := range map[string][]byte{
+		"enumsessions":      enumSessionsPacket(t),
+		"enumsessionsreply": enumSessionsReplyPacket(t, "BG Session"),
+	} {
+		if !SetAppGUID(data, guid) {
+			t.Fatalf("%s: GUID wasn't set", name)
+		}
+		packet, ok := NewDPlayPacket(data).(AppGUIDPacket)
+		if !ok || packet.AppGUID() != guid {
+			t.Errorf("%s: GUID didn't come back: %v", name, packet)
+		}
+	}
+	if SetAppGUID(groupPacket(t, DPSP_MSG_TYPE_DELETEGROUP, 1, 2), guid) {
+		t.Error("set a GUID in a message without one")
+	}
+	if SetAppGUID(enumSessionsPacket(t)[:40], guid) {
+		t.Error("set a GUID past the end of the message")
+	}
+}
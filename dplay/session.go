@@ -0,0 +1,264 @@
+package dplay
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+)
+
+type SessionEvent int
+
+const (
+	SessionEventNone          SessionEvent = iota
+	SessionEventHostLost                   // The name server's player was deleted
+	SessionEventHostMigrated               // A new name server announced itself from another machine
+	SessionEventDeclaredDead               // YOUAREDEAD: the sender has dropped the receiver from the session
+	SessionEventGroupsChanged              // A group was created or deleted, or its members or shortcuts changed
+)
+
+func (event SessionEvent) String() string {
+	switch event {
+	case SessionEventHostLost:
+		return "Host Lost"
+	case SessionEventHostMigrated:
+		return "Host Migrated"
+	case SessionEventDeclaredDead:
+		return "Declared Dead"
+	case SessionEventGroupsChanged:
+		return "Groups Changed"
+	}
+	return "None"
+}
+
+// Session follows the DirectPlay traffic passing through the proxy so we always know which
+// machine is acting as the game host (name server). DirectPlay calls the host the name server
+// since it hands out player IDs.
+type Session struct {
+	lock         sync.Mutex
+	migrateHost  bool
+	hostLost     bool
+	nameServerID uint32
+	hostAddr     net.IP
+	players      map[uint32]*DPLAYI_PACKEDPLAYER
+	groups       map[uint32]*SessionGroup
+}
+
+// SessionGroup is a DPlay group. Groups can be nested in another group (Parent) and can also be added to other
+// groups as shortcuts, which makes every player in them a member of the other group as well.
+type SessionGroup struct {
+	Info      *DPLAYI_PACKEDPLAYER
+	Parent    uint32
+	Players   map[uint32]bool
+	Shortcuts map[uint32]bool // Groups that were added to this one with ADDSHORTCUTTOGROUP
+}
+
+func NewSession(hostAddr net.IP) *Session {
+	return &Session{hostAddr: hostAddr, players: make(map[uint32]*DPLAYI_PACKEDPLAYER), groups: make(map[uint32]*SessionGroup)}
+}
+
+// group returns the group with the given ID, creating a placeholder if we never saw its CREATEGROUP
+func (this *Session) group(id uint32) *SessionGroup {
+	group, ok := this.groups[id]
+	if !ok {
+		group = &SessionGroup{Players: make(map[uint32]bool), Shortcuts: make(map[uint32]bool)}
+		this.groups[id] = group
+	}
+	return group
+}
+
+// deleteGroup removes a group and the groups nested in it, which DirectPlay destroys along with their parent, and
+// every shortcut to them
+func (this *Session) deleteGroup(id uint32) {
+	if _, ok := this.groups[id]; !ok {
+		return
+	}
+	delete(this.groups, id)
+	for otherID, group := range this.groups {
+		delete(group.Shortcuts, id)
+		if group.Parent == id {
+			this.deleteGroup(otherID)
+		}
+	}
+}
+
+// HostAddr is the address of the current name server
+func (this *Session) HostAddr() net.IP {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.hostAddr
+}
+
+// NameServerID is the system player ID of the current name server, or 0 if we haven't seen it yet
+func (this *Session) NameServerID() uint32 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.nameServerID
+}
+
+// HostLost is true between the name server's player being deleted and a new name server announcing itself
+func (this *Session) HostLost() bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.hostLost
+}
+
+// Update feeds a packet received from the given address into the session. When it returns
+// SessionEventHostMigrated, HostAddr has the address of the new host.
+func (this *Session) Update(packet DPlayPacket, from net.IP) SessionEvent {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	switch packet := packet.(type) {
+	case *DPSP_PKT_ENUMSESSIONSREPLY:
+		this.migrateHost = packet.sessionDesc.FlagsMigrateHost()
+	case *DPSP_PKT_CREATEPLAYER:
+		if packet.playerInfo == nil {
+			return SessionEventNone
+		}
+		if packet.command == DPSP_MSG_TYPE_CREATEGROUP {
+			group := this.group(packet.playerID)
+			group.Info = packet.playerInfo
+			group.Parent = packet.playerInfo.ParentID
+			// A group's packed info lists the players already in it
+			for _, id := range packet.playerInfo.PlayerIDs {
+				group.Players[id] = true
+			}
+			return SessionEventGroupsChanged
+		}
+		this.players[packet.playerInfo.PlayerID] = packet.playerInfo
+		if packet.playerInfo.FlagsNameServer() {
+			this.nameServerID = packet.playerInfo.PlayerID
+		}
+	case *DPSP_PKT_GROUP:
+		switch packet.command {
+		case DPSP_MSG_TYPE_DELETEGROUP:
+			this.deleteGroup(packet.groupID)
+		case DPSP_MSG_TYPE_ADDPLAYERTOGROUP:
+			this.group(packet.groupID).Players[packet.playerID] = true
+		case DPSP_MSG_TYPE_DELETEPLAYERFROMGROUP:
+			delete(this.group(packet.groupID).Players, packet.playerID)
+		case DPSP_MSG_TYPE_ADDSHORTCUTTOGROUP:
+			this.group(packet.groupID).Shortcuts[packet.playerID] = true
+		case DPSP_MSG_TYPE_DELETEGROUPFROMGROUP:
+			delete(this.group(packet.groupID).Shortcuts, packet.playerID)
+		}
+		return SessionEventGroupsChanged
+	case *DPSP_PKT_DELETEPLAYER:
+		player, ok := this.players[packet.playerID]
+		delete(this.players, packet.playerID)
+		for _, group := range this.groups {
+			delete(group.Players, packet.playerID)
+		}
+		// Until we know the name server, 0 would match any player nobody has told us about
+		if this.nameServerID != 0 && (packet.playerID == this.nameServerID || (ok && player.SystemPlayerID == this.nameServerID)) {
+			// The host is gone. If the session allows it, someone should send IAMNAMESERVER shortly
+			this.hostLost = true
+			return SessionEventHostLost
+		}
+	case *DPSP_PKT_HEADER:
+		if DPPacketType(packet.Command()) == DPSP_MSG_TYPE_YOUAREDEAD {
+			return SessionEventDeclaredDead
+		}
+	case *DPSP_PKT_IAMNAMESERVER:
+		this.nameServerID = packet.NameServerID()
+		this.hostLost = false
+		addr, ok := packet.HostAddr()
+		if !ok {
+			addr = from
+		}
+		if addr == nil || addr.Equal(this.hostAddr) {
+			return SessionEventNone
+		}
+		this.hostAddr = addr
+		return SessionEventHostMigrated
+	}
+	return SessionEventNone
+}
+
+// MigrateHost reports whether the session description we saw allows host migration
+func (this *Session) MigrateHost() bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.migrateHost
+}
+
+// GroupMembers returns every player in the group, following shortcuts and nested groups. Sorted by ID.
+func (this *Session) GroupMembers(id uint32) []uint32 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	members := make(map[uint32]bool)
+	this.collectMembers(id, members, make(map[uint32]bool))
+	ret := make([]uint32, 0, len(members))
+	for member := range members {
+		ret = append(ret, member)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
+
+func (this *Session) collectMembers(id uint32, members, visited map[uint32]bool) {
+	// Shortcuts can make loops, so only visit each group once
+	if visited[id] {
+		return
+	}
+	visited[id] = true
+	group, ok := this.groups[id]
+	if !ok {
+		return
+	}
+	for player := range group.Players {
+		members[player] = true
+	}
+	for shortcut := range group.Shortcuts {
+		this.collectMembers(shortcut, members, visited)
+	}
+	for childID, child := range this.groups {
+		if child.Parent == id {
+			this.collectMembers(childID, members, visited)
+		}
+	}
+}
+
+func sortedIDs(ids map[uint32]bool) []uint32 {
+	ret := make([]uint32, 0, len(ids))
+	for id := range ids {
+		ret = append(ret, id)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
+
+func (this *Session) String() string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	ret := "Session Host: " + this.hostAddr.String() + fmt.Sprintf(" NameServer: 0x%X", this.nameServerID)
+	playerIDs := make(map[uint32]bool)
+	for id := range this.players {
+		playerIDs[id] = true
+	}
+	ret += "\n\tPlayers:"
+	for _, id := range sortedIDs(playerIDs) {
+		player := this.players[id]
+		ret += fmt.Sprintf("\n\t\t0x%X '%s' System: %t NameServer: %t", id, player.ShortName, player.FlagsSystemPlayer(), player.FlagsNameServer())
+	}
+	groupIDs := make(map[uint32]bool)
+	for id := range this.groups {
+		groupIDs[id] = true
+	}
+	ret += "\n\tGroups:"
+	for _, id := range sortedIDs(groupIDs) {
+		group := this.groups[id]
+		name := ""
+		if group.Info != nil {
+			name = group.Info.ShortName
+		}
+		ret += fmt.Sprintf("\n\t\t0x%X '%s'", id, name)
+		if group.Parent != 0 {
+			ret += fmt.Sprintf(" Parent: 0x%X", group.Parent)
+		}
+		ret += fmt.Sprintf(" Players: %X Shortcuts: %X", sortedIDs(group.Players), sortedIDs(group.Shortcuts))
+	}
+	return ret
+}
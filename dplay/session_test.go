@@ -0,0 +1,143 @@
+package dplay
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSessionHostMigration(t *testing.T) {
+	session := NewSession(net.ParseIP("192.168.122.2"))
+	packets := seedPackets(t)
+
+	session.Update(NewDPlayPacket(packets["enumsessionsreply"]), nil)
+	if !session.MigrateHost() {
+		t.Error("expected the session to allow host migration")
+	}
+
+	session.Update(NewDPlayPacket(packets["createplayer"]), nil)
+	if session.NameServerID() != testPlayer.PlayerID {
+		t.Errorf("name server is 0x%X, expected 0x%X", session.NameServerID(), testPlayer.PlayerID)
+	}
+
+	if event := session.Update(NewDPlayPacket(packets["deleteplayer"]), nil); event != SessionEventHostLost || !session.HostLost() {
+		t.Errorf("expected the host to be lost, got %s", event)
+	}
+
+	if event := session.Update(NewDPlayPacket(packets["youaredead"]), nil); event != SessionEventDeclaredDead {
+		t.Errorf("expected YOUAREDEAD to be reported, got %s", event)
+	}
+
+	if event := session.Update(NewDPlayPacket(packets["iamnameserver"]), net.ParseIP("10.0.0.1")); event != SessionEventHostMigrated {
+		t.Fatalf("expected the host to migrate, got %s", event)
+	}
+	if !session.HostAddr().Equal(net.ParseIP("192.168.122.7")) || session.NameServerID() != 0x019A || session.HostLost() {
+		t.Errorf("host not updated from IAMNAMESERVER: %s", session)
+	}
+
+	// Hearing it again from the same host isn't another migration
+	if event := session.Update(NewDPlayPacket(packets["iamnameserver"]), nil); event != SessionEventNone {
+		t.Errorf("expected no event, got %s", event)
+	}
+}
+
+func TestSessionHostMigrationFromSocketAddress(t *testing.T) {
+	session := NewSession(net.ParseIP("192.168.122.2"))
+	packet := NewDPlayPacket(iAmNameServerPacket(t, 0x019A, [4]byte{}))
+	if event := session.Update(packet, net.ParseIP("192.168.122.9")); event != SessionEventHostMigrated {
+		t.Fatalf("expected the host to migrate, got %s", event)
+	}
+	if !session.HostAddr().Equal(net.ParseIP("192.168.122.9")) {
+		t.Errorf("expected the sender's address to be used, got %s", session.HostAddr())
+	}
+}
+
+func TestSessionGroups(t *testing.T) {
+	session := NewSession(nil)
+	packets := seedPackets(t)
+
+	for _, name := range []string{"creategroup", "addshortcuttogroup"} {
+		if event := session.Update(NewDPlayPacket(packets[name]), nil); event != SessionEventGroupsChanged {
+			t.Fatalf("%s: expected groups to change, got %s", name, event)
+		}
+	}
+	session.Update(NewDPlayPacket(groupPacket(t, DPSP_MSG_TYPE_ADDPLAYERTOGROUP, 0x0200, 0x0457)), nil)
+	session.Update(NewDPlayPacket(groupPacket(t, DPSP_MSG_TYPE_ADDSHORTCUTTOGROUP, 0x0455, 0x0457)), nil) // A loop back to the first group
+
+	members := session.GroupMembers(0x0455)
+	if len(members) != 3 || members[0] != 0x0199 || members[1] != 0x019A || members[2] != 0x0200 {
+		t.Errorf("unexpected members through the shortcut: %X", members)
+	}
+
+	session.Update(NewDPlayPacket(packets["deletegroupfromgroup"]), nil)
+	if members := session.GroupMembers(0x0455); len(members) != 2 {
+		t.Errorf("shortcut wasn't removed: %X", members)
+	}
+
+	session.Update(NewDPlayPacket(groupPacket(t, DPSP_MSG_TYPE_DELETEGROUP, 0, 0x0455)), nil)
+	if members := session.GroupMembers(0x0455); len(members) != 0 {
+		t.Errorf("group wasn't deleted: %X", members)
+	}
+}
+
+func TestSessionDeletePlayerBeforeNameServer(t *testing.T) {
+	session := NewSession(net.ParseIP("192.168.122.2"))
+	for _, id := range []uint32{0, 0x0199} {
+		if event := session.Update(NewDPlayPacket(groupPacket(t, DPSP_MSG_TYPE_DELETEPLAYER, id, 0)), nil); event != SessionEventNone || session.HostLost() {
+			t.Errorf("deleting 0x%X before the name server is known: got %s", id, event)
+		}
+	}
+}
+
+func TestSessionDeleteOtherPlayer(t *testing.T) {
+	session := NewSession(net.ParseIP("192.168.122.2"))
+	session.Update(NewDPlayPacket(createPlayerPacket(t, DPSP_MSG_TYPE_CREATEPLAYER, testPlayer)), nil)
+	other := *testPlayer
+	other.Flags = 0
+	other.PlayerID, other.SystemPlayerID = 0x0200, 0x0200
+	session.Update(NewDPlayPacket(createPlayerPacket(t, DPSP_MSG_TYPE_CREATEPLAYER, &other)), nil)
+	if event := session.Update(NewDPlayPacket(groupPacket(t, DPSP_MSG_TYPE_DELETEPLAYER, 0x0200, 0)), nil); event != SessionEventNone || session.HostLost() {
+		t.Errorf("deleting a player that isn't the host: got %s", event)
+	}
+	if session.NameServerID() != testPlayer.PlayerID {
+		t.Errorf("name server is 0x%X, expected 0x%X", session.NameServerID(), testPlayer.PlayerID)
+	}
+}
+
+func TestSessionHostMigratesBack(t *testing.T) {
+	session := NewSession(net.ParseIP("192.168.122.2"))
+	session.Update(NewDPlayPacket(createPlayerPacket(t, DPSP_MSG_TYPE_CREATEPLAYER, testPlayer)), nil)
+	session.Update(NewDPlayPacket(groupPacket(t, DPSP_MSG_TYPE_DELETEPLAYER, testPlayer.PlayerID, 0)), nil)
+	for _, host := range [][4]byte{{192, 168, 122, 7}, {192, 168, 122, 2}} {
+		event := session.Update(NewDPlayPacket(iAmNameServerPacket(t, 0x019A, host)), nil)
+		if event != SessionEventHostMigrated || !session.HostAddr().Equal(net.IP(host[:])) {
+			t.Errorf("expected the host to migrate to %v, got %s to %s", net.IP(host[:]), event, session.HostAddr())
+		}
+	}
+}
+
+func TestSessionDeleteNestedGroups(t *testing.T) {
+	session := NewSession(nil)
+	for _, group := range []DPLAYI_PACKEDPLAYER{
+		{PlayerID: 0x0500, ShortName: "Parent"},
+		{PlayerID: 0x0501, ParentID: 0x0500, ShortName: "Child", PlayerIDs: []uint32{0x0199}},
+		{PlayerID: 0x0502, ParentID: 0x0501, ShortName: "Grandchild", PlayerIDs: []uint32{0x019A}},
+		{PlayerID: 0x0600, ShortName: "Elsewhere", PlayerIDs: []uint32{0x0200}},
+	} {
+		group := group
+		session.Update(NewDPlayPacket(createPlayerPacket(t, DPSP_MSG_TYPE_CREATEGROUP, &group)), nil)
+	}
+	session.Update(NewDPlayPacket(groupPacket(t, DPSP_MSG_TYPE_ADDSHORTCUTTOGROUP, 0x0502, 0x0600)), nil)
+	if members := session.GroupMembers(0x0600); len(members) != 2 {
+		t.Fatalf("unexpected members through the shortcut: %X", members)
+	}
+
+	session.Update(NewDPlayPacket(groupPacket(t, DPSP_MSG_TYPE_DELETEGROUP, 0, 0x0500)), nil)
+	for _, id := range []uint32{0x0500, 0x0501, 0x0502} {
+		if _, ok := session.groups[id]; ok {
+			t.Errorf("group 0x%X outlived its parent", id)
+		}
+	}
+	if members := session.GroupMembers(0x0600); len(members) != 1 || members[0] != 0x0200 {
+		t.Errorf("shortcut to a deleted group kept its members: %X", members)
+	}
+}
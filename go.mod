@@ -2,6 +2,9 @@ module github.com/Jaywalker/iemitm
 
 go 1.18
 
-require github.com/chzyer/readline v1.5.1
+require (
+	github.com/chzyer/readline v1.5.1
+	github.com/yuin/gopher-lua v1.1.1
+)
 
 require golang.org/x/sys v0.0.0-20220310020820-b874c991c1a5 // indirect
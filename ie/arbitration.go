@@ -0,0 +1,372 @@
+package ie
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DIALOG, SWAPITEM and PAUSING are the host arbitrating between players: a client asks for permission and the
+// host replies. The layouts are guesses following CHAR_READY's BOOLs, with the object IDs first, and aren't decoded
+// unless a guess is asked for.
+
+const IE_SPEC_MSG_TYPE_DIALOG uint8 = 68
+const IE_SPEC_MSG_SUBTYPE_DIALOG_PERMIT_REQUEST uint8 = 82
+const IE_SPEC_MSG_SUBTYPE_DIALOG_PERMIT_REPLY uint8 = 114
+const IE_SPEC_MSG_SUBTYPE_DIALOG_CANCEL_REQUEST uint8 = 67
+const IE_SPEC_MSG_SUBTYPE_DIALOG_KILL_OR_USE uint8 = 75
+
+const IE_SPEC_MSG_TYPE_SWAPITEM uint8 = 73
+const IE_SPEC_MSG_SUBTYPE_SWAPITEM_REQUEST uint8 = 82
+const IE_SPEC_MSG_SUBTYPE_SWAPITEM_REPLY uint8 = 114
+
+const IE_SPEC_MSG_TYPE_PAUSING uint8 = 81
+const IE_SPEC_MSG_SUBTYPE_PAUSING_PERMIT_REQUEST uint8 = 82
+const IE_SPEC_MSG_SUBTYPE_PAUSING_ANNOUNCE uint8 = 65
+
+// IEDialogRequest asks to start a conversation between two objects. Cancelling one and KILL_OR_USE look the same.
+type IEDialogRequest struct {
+	SpeakerID uint32
+	TargetID  uint32
+	Rest      []byte
+}
+
+func (request *IEDialogRequest) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEDialogRequest", data)
+	reader.read("SpeakerID", &request.SpeakerID)
+	reader.read("TargetID", &request.TargetID)
+	request.Rest = reader.rest()
+	return reader.err
+}
+
+func (request IEDialogRequest) Marshal() ([]byte, error) {
+	return marshalSpecFields(request.SpeakerID, request.TargetID, request.Rest)
+}
+
+func (request IEDialogRequest) String() string {
+	return fmt.Sprintf("Speaker: 0x%x Target: 0x%x", request.SpeakerID, request.TargetID) + restString(request.Rest)
+}
+
+func (request IEDialogRequest) arbitrationKey() uint64 {
+	return uint64(request.SpeakerID)<<32 | uint64(request.TargetID)
+}
+
+type IEDialogReply struct {
+	SpeakerID uint32
+	TargetID  uint32
+	Permitted uint32
+	Rest      []byte
+}
+
+func (reply *IEDialogReply) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEDialogReply", data)
+	reader.read("SpeakerID", &reply.SpeakerID)
+	reader.read("TargetID", &reply.TargetID)
+	reader.read("Permitted", &reply.Permitted)
+	reply.Rest = reader.rest()
+	return reader.err
+}
+
+func (reply IEDialogReply) Marshal() ([]byte, error) {
+	return marshalSpecFields(reply.SpeakerID, reply.TargetID, reply.Permitted, reply.Rest)
+}
+
+func (reply IEDialogReply) String() string {
+	return fmt.Sprintf("Speaker: 0x%x Target: 0x%x Permitted: %d", reply.SpeakerID, reply.TargetID, reply.Permitted) + restString(reply.Rest)
+}
+
+func (reply IEDialogReply) arbitrationKey() uint64 {
+	return uint64(reply.SpeakerID)<<32 | uint64(reply.TargetID)
+}
+
+func (reply IEDialogReply) permitted() bool {
+	return reply.Permitted != 0
+}
+
+// IESwapItemRequest asks to move an item between two of an object's inventory slots
+type IESwapItemRequest struct {
+	ObjectID uint32
+	FromSlot uint16
+	ToSlot   uint16
+	Rest     []byte
+}
+
+func (request *IESwapItemRequest) Unmarshal(data []byte) error {
+	reader := newSpecReader("IESwapItemRequest", data)
+	reader.read("ObjectID", &request.ObjectID)
+	reader.read("FromSlot", &request.FromSlot)
+	reader.read("ToSlot", &request.ToSlot)
+	request.Rest = reader.rest()
+	return reader.err
+}
+
+func (request IESwapItemRequest) Marshal() ([]byte, error) {
+	return marshalSpecFields(request.ObjectID, request.FromSlot, request.ToSlot, request.Rest)
+}
+
+func (request IESwapItemRequest) String() string {
+	return fmt.Sprintf("Object: 0x%x Slot %d => %d", request.ObjectID, request.FromSlot, request.ToSlot) + restString(request.Rest)
+}
+
+func (request IESwapItemRequest) arbitrationKey() uint64 {
+	return uint64(request.ObjectID)<<32 | uint64(request.FromSlot)<<16 | uint64(request.ToSlot)
+}
+
+type IESwapItemReply struct {
+	ObjectID  uint32
+	FromSlot  uint16
+	ToSlot    uint16
+	Permitted uint32
+	Rest      []byte
+}
+
+func (reply *IESwapItemReply) Unmarshal(data []byte) error {
+	reader := newSpecReader("IESwapItemReply", data)
+	reader.read("ObjectID", &reply.ObjectID)
+	reader.read("FromSlot", &reply.FromSlot)
+	reader.read("ToSlot", &reply.ToSlot)
+	reader.read("Permitted", &reply.Permitted)
+	reply.Rest = reader.rest()
+	return reader.err
+}
+
+func (reply IESwapItemReply) Marshal() ([]byte, error) {
+	return marshalSpecFields(reply.ObjectID, reply.FromSlot, reply.ToSlot, reply.Permitted, reply.Rest)
+}
+
+func (reply IESwapItemReply) String() string {
+	return fmt.Sprintf("Object: 0x%x Slot %d => %d Permitted: %d", reply.ObjectID, reply.FromSlot, reply.ToSlot, reply.Permitted) + restString(reply.Rest)
+}
+
+func (reply IESwapItemReply) arbitrationKey() uint64 {
+	return uint64(reply.ObjectID)<<32 | uint64(reply.FromSlot)<<16 | uint64(reply.ToSlot)
+}
+
+func (reply IESwapItemReply) permitted() bool {
+	return reply.Permitted != 0
+}
+
+// IEPausingRequest asks the host to pause or unpause the game
+type IEPausingRequest struct {
+	Pause uint32
+	Rest  []byte
+}
+
+func (request *IEPausingRequest) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEPausingRequest", data)
+	reader.read("Pause", &request.Pause)
+	request.Rest = reader.rest()
+	return reader.err
+}
+
+func (request IEPausingRequest) Marshal() ([]byte, error) {
+	return marshalSpecFields(request.Pause, request.Rest)
+}
+
+func (request IEPausingRequest) String() string {
+	return fmt.Sprintf("Pause: %d", request.Pause) + restString(request.Rest)
+}
+
+// IEPausingAnnounce is the host telling everyone who paused or unpaused the game. There's no denial in it, so a
+// request the host turns down probably just never gets announced and shows up as a timeout.
+type IEPausingAnnounce struct {
+	PlayerID uint32
+	Paused   uint32
+	Rest     []byte
+}
+
+func (announce *IEPausingAnnounce) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEPausingAnnounce", data)
+	reader.read("PlayerID", &announce.PlayerID)
+	reader.read("Paused", &announce.Paused)
+	announce.Rest = reader.rest()
+	return reader.err
+}
+
+func (announce IEPausingAnnounce) Marshal() ([]byte, error) {
+	return marshalSpecFields(announce.PlayerID, announce.Paused, announce.Rest)
+}
+
+func (announce IEPausingAnnounce) String() string {
+	return fmt.Sprintf("Player 0x%x Paused: %d", announce.PlayerID, announce.Paused) + restString(announce.Rest)
+}
+
+func newIEDialogRequest() SpecMsg   { return &IEDialogRequest{} }
+func newIEDialogReply() SpecMsg     { return &IEDialogReply{} }
+func newIESwapItemRequest() SpecMsg { return &IESwapItemRequest{} }
+func newIESwapItemReply() SpecMsg   { return &IESwapItemReply{} }
+func newIEPausingRequest() SpecMsg  { return &IEPausingRequest{} }
+func newIEPausingAnnounce() SpecMsg { return &IEPausingAnnounce{} }
+
+// The request and reply subtypes of each flow we pair up
+var arbitrationFlows = map[uint8][2]uint8{
+	IE_SPEC_MSG_TYPE_DIALOG:   {IE_SPEC_MSG_SUBTYPE_DIALOG_PERMIT_REQUEST, IE_SPEC_MSG_SUBTYPE_DIALOG_PERMIT_REPLY},
+	IE_SPEC_MSG_TYPE_SWAPITEM: {IE_SPEC_MSG_SUBTYPE_SWAPITEM_REQUEST, IE_SPEC_MSG_SUBTYPE_SWAPITEM_REPLY},
+	IE_SPEC_MSG_TYPE_PAUSING:  {IE_SPEC_MSG_SUBTYPE_PAUSING_PERMIT_REQUEST, IE_SPEC_MSG_SUBTYPE_PAUSING_ANNOUNCE},
+}
+
+type ArbitrationResult struct {
+	Flow      string
+	PlayerID  uint32 // Who asked
+	Request   SpecMsg
+	Reply     SpecMsg // nil if the request timed out
+	Latency   time.Duration
+	Denied    bool
+	TimedOut  bool
+	Requested time.Time
+}
+
+func (result ArbitrationResult) String() string {
+	if result.TimedOut {
+		return fmt.Sprintf("%s from Player 0x%x got no reply after %s: %s", result.Flow, result.PlayerID, result.Latency, result.Request)
+	}
+	outcome := "permitted"
+	if result.Denied {
+		outcome = "DENIED"
+	}
+	return fmt.Sprintf("%s from Player 0x%x %s after %s: %s", result.Flow, result.PlayerID, outcome, result.Latency, result.Reply)
+}
+
+type ArbitrationStats struct {
+	Requests     int
+	Permitted    int
+	Denied       int
+	TimedOut     int
+	TotalLatency time.Duration // Of the requests that got a reply
+	MaxLatency   time.Duration
+}
+
+func (stats ArbitrationStats) String() string {
+	var average time.Duration
+	if replies := stats.Permitted + stats.Denied; replies > 0 {
+		average = stats.TotalLatency / time.Duration(replies)
+	}
+	return fmt.Sprintf("Requests: %d Permitted: %d Denied: %d Timed Out: %d Latency avg: %s max: %s", stats.Requests, stats.Permitted, stats.Denied, stats.TimedOut, average, stats.MaxLatency)
+}
+
+type pendingArbitration struct {
+	key       uint64
+	hasKey    bool
+	request   SpecMsg
+	requested time.Time
+}
+
+type arbitrationRequester struct {
+	msgType  uint8
+	playerID uint32
+}
+
+// ArbitrationTracker pairs each DIALOG, SWAPITEM and PAUSING request with the host's reply. A reply goes with the
+// oldest request from the player it's sent to that has the same objects in it, or failing that just the oldest
+// request from that player, so a wrong guess at a layout doesn't stop the flows being paired.
+type ArbitrationTracker struct {
+	lock    sync.Mutex
+	timeout time.Duration
+	pending map[arbitrationRequester][]pendingArbitration
+	stats   map[string]*ArbitrationStats
+}
+
+func NewArbitrationTracker(timeout time.Duration) *ArbitrationTracker {
+	return &ArbitrationTracker{timeout: timeout, pending: make(map[arbitrationRequester][]pendingArbitration), stats: make(map[string]*ArbitrationStats)}
+}
+
+func (tracker *ArbitrationTracker) flowStats(msgType uint8) (string, *ArbitrationStats) {
+	flow, _ := SpecMsgNames(msgType, 0)
+	stats, ok := tracker.stats[flow]
+	if !ok {
+		stats = &ArbitrationStats{}
+		tracker.stats[flow] = stats
+	}
+	return flow, stats
+}
+
+// Observe feeds a decoded spec message into the tracker. It returns the result when msg is a reply that completes
+// a request, and nil otherwise.
+func (tracker *ArbitrationTracker) Observe(from, to uint32, msgType, msgSubType uint8, msg SpecMsg, at time.Time) *ArbitrationResult {
+	flow, ok := arbitrationFlows[msgType]
+	if !ok {
+		return nil
+	}
+	key, hasKey := uint64(0), false
+	if keyed, ok := msg.(interface{ arbitrationKey() uint64 }); ok {
+		key, hasKey = keyed.arbitrationKey(), true
+	}
+
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	switch msgSubType {
+	case flow[0]:
+		requester := arbitrationRequester{msgType, from}
+		tracker.pending[requester] = append(tracker.pending[requester], pendingArbitration{key, hasKey, msg, at})
+		_, stats := tracker.flowStats(msgType)
+		stats.Requests++
+	case flow[1]:
+		requester := arbitrationRequester{msgType, to}
+		pending := tracker.pending[requester]
+		if len(pending) == 0 {
+			return nil
+		}
+		match := 0
+		for i, request := range pending {
+			if hasKey && request.hasKey && request.key == key {
+				match = i
+				break
+			}
+		}
+		request := pending[match]
+		tracker.pending[requester] = append(pending[:match:match], pending[match+1:]...)
+
+		name, stats := tracker.flowStats(msgType)
+		result := &ArbitrationResult{Flow: name, PlayerID: to, Request: request.request, Reply: msg, Latency: at.Sub(request.requested), Requested: request.requested}
+		if reply, ok := msg.(interface{ permitted() bool }); ok && !reply.permitted() {
+			result.Denied = true
+			stats.Denied++
+		} else {
+			stats.Permitted++
+		}
+		stats.TotalLatency += result.Latency
+		if result.Latency > stats.MaxLatency {
+			stats.MaxLatency = result.Latency
+		}
+		return result
+	}
+	return nil
+}
+
+// Expire drops requests that have waited longer than the timeout and returns them, oldest first
+func (tracker *ArbitrationTracker) Expire(now time.Time) []ArbitrationResult {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	var ret []ArbitrationResult
+	for requester, pending := range tracker.pending {
+		kept := pending[:0]
+		for _, request := range pending {
+			if now.Sub(request.requested) < tracker.timeout {
+				kept = append(kept, request)
+				continue
+			}
+			name, stats := tracker.flowStats(requester.msgType)
+			stats.TimedOut++
+			ret = append(ret, ArbitrationResult{Flow: name, PlayerID: requester.playerID, Request: request.request, Latency: now.Sub(request.requested), TimedOut: true, Requested: request.requested})
+		}
+		if len(kept) == 0 {
+			delete(tracker.pending, requester)
+		} else {
+			tracker.pending[requester] = kept
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Requested.Before(ret[j].Requested) })
+	return ret
+}
+
+// Stats returns a copy of the counters for each flow, by type name
+func (tracker *ArbitrationTracker) Stats() map[string]ArbitrationStats {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	ret := make(map[string]ArbitrationStats, len(tracker.stats))
+	for flow, stats := range tracker.stats {
+		ret[flow] = *stats
+	}
+	return ret
+}
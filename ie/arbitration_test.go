@@ -0,0 +1,68 @@
+package ie
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArbitrationGuesses(t *testing.T) {
+	testGuesses(t, []guessFixture{
+		{IE_SPEC_MSG_TYPE_DIALOG, IE_SPEC_MSG_SUBTYPE_DIALOG_PERMIT_REQUEST, "00000001" + "00000002", "Speaker: 0x1 Target: 0x2"},
+		{IE_SPEC_MSG_TYPE_DIALOG, IE_SPEC_MSG_SUBTYPE_DIALOG_PERMIT_REPLY, "00000001" + "00000002" + "00000001", "Speaker: 0x1 Target: 0x2 Permitted: 1"},
+		{IE_SPEC_MSG_TYPE_DIALOG, IE_SPEC_MSG_SUBTYPE_DIALOG_CANCEL_REQUEST, "00000001" + "00000002" + "09", "Speaker: 0x1 Target: 0x2 Rest: 09"},
+		{IE_SPEC_MSG_TYPE_DIALOG, IE_SPEC_MSG_SUBTYPE_DIALOG_KILL_OR_USE, "00000003" + "00000000", "Speaker: 0x3 Target: 0x0"},
+		{IE_SPEC_MSG_TYPE_SWAPITEM, IE_SPEC_MSG_SUBTYPE_SWAPITEM_REQUEST, "00000001" + "0012" + "0002", "Object: 0x1 Slot 18 => 2"},
+		{IE_SPEC_MSG_TYPE_SWAPITEM, IE_SPEC_MSG_SUBTYPE_SWAPITEM_REPLY, "00000001" + "0012" + "0002" + "00000000", "Object: 0x1 Slot 18 => 2 Permitted: 0"},
+		{IE_SPEC_MSG_TYPE_PAUSING, IE_SPEC_MSG_SUBTYPE_PAUSING_PERMIT_REQUEST, "00000001", "Pause: 1"},
+		{IE_SPEC_MSG_TYPE_PAUSING, IE_SPEC_MSG_SUBTYPE_PAUSING_ANNOUNCE, "ad4f6f00" + "00000001", "Player 0xad4f6f00 Paused: 1"},
+	})
+}
+
+func TestArbitrationTracker(t *testing.T) {
+	const client, server = 0xad4f6f00, 0x1000000
+	start := time.Unix(1000, 0)
+	tracker := NewArbitrationTracker(5 * time.Second)
+
+	// Two dialogs in flight, answered out of order
+	tracker.Observe(client, server, IE_SPEC_MSG_TYPE_DIALOG, IE_SPEC_MSG_SUBTYPE_DIALOG_PERMIT_REQUEST, &IEDialogRequest{SpeakerID: 1, TargetID: 2}, start)
+	tracker.Observe(client, server, IE_SPEC_MSG_TYPE_DIALOG, IE_SPEC_MSG_SUBTYPE_DIALOG_PERMIT_REQUEST, &IEDialogRequest{SpeakerID: 1, TargetID: 3}, start.Add(time.Second))
+	result := tracker.Observe(server, client, IE_SPEC_MSG_TYPE_DIALOG, IE_SPEC_MSG_SUBTYPE_DIALOG_PERMIT_REPLY, &IEDialogReply{SpeakerID: 1, TargetID: 3}, start.Add(1500*time.Millisecond))
+	if result == nil || !result.Denied || result.Latency != 500*time.Millisecond || result.Request.(*IEDialogRequest).TargetID != 3 || result.PlayerID != client {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	result = tracker.Observe(server, client, IE_SPEC_MSG_TYPE_DIALOG, IE_SPEC_MSG_SUBTYPE_DIALOG_PERMIT_REPLY, &IEDialogReply{SpeakerID: 1, TargetID: 2, Permitted: 1}, start.Add(2*time.Second))
+	if result == nil || result.Denied || result.Latency != 2*time.Second {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	// A reply nobody asked for, and one for a different player, don't match anything
+	if result := tracker.Observe(server, client, IE_SPEC_MSG_TYPE_DIALOG, IE_SPEC_MSG_SUBTYPE_DIALOG_PERMIT_REPLY, &IEDialogReply{}, start); result != nil {
+		t.Errorf("unrequested reply matched: %+v", result)
+	}
+	tracker.Observe(client, server, IE_SPEC_MSG_TYPE_SWAPITEM, IE_SPEC_MSG_SUBTYPE_SWAPITEM_REQUEST, &IESwapItemRequest{ObjectID: 1}, start)
+	if result := tracker.Observe(server, 0x2000000, IE_SPEC_MSG_TYPE_SWAPITEM, IE_SPEC_MSG_SUBTYPE_SWAPITEM_REPLY, &IESwapItemReply{ObjectID: 1, Permitted: 1}, start); result != nil {
+		t.Errorf("reply to another player matched: %+v", result)
+	}
+
+	// Pausing has no objects to match on, the announce just answers the oldest request
+	tracker.Observe(client, server, IE_SPEC_MSG_TYPE_PAUSING, IE_SPEC_MSG_SUBTYPE_PAUSING_PERMIT_REQUEST, &IEPausingRequest{Pause: 1}, start.Add(3*time.Second))
+	if result := tracker.Observe(server, client, IE_SPEC_MSG_TYPE_PAUSING, IE_SPEC_MSG_SUBTYPE_PAUSING_ANNOUNCE, &IEPausingAnnounce{PlayerID: client, Paused: 1}, start.Add(3100*time.Millisecond)); result == nil || result.Denied {
+		t.Errorf("pause wasn't announced: %+v", result)
+	}
+
+	expired := tracker.Expire(start.Add(10 * time.Second))
+	if len(expired) != 1 || !expired[0].TimedOut || expired[0].Flow != "SWAPITEM" {
+		t.Fatalf("unexpected expired requests: %+v", expired)
+	}
+	if expired := tracker.Expire(start.Add(20 * time.Second)); len(expired) != 0 {
+		t.Errorf("requests expired twice: %+v", expired)
+	}
+
+	stats := tracker.Stats()
+	if dialog := stats["DIALOG"]; dialog.Requests != 2 || dialog.Permitted != 1 || dialog.Denied != 1 || dialog.MaxLatency != 2*time.Second {
+		t.Errorf("unexpected DIALOG stats: %s", dialog)
+	}
+	if swap := stats["SWAPITEM"]; swap.Requests != 1 || swap.TimedOut != 1 {
+		t.Errorf("unexpected SWAPITEM stats: %s", swap)
+	}
+}
@@ -0,0 +1,167 @@
+package ie
+
+import "fmt"
+
+// RESOURCE_DEMAND, MPSYNCH and the LEAVEAREA permit requests are what goes back and forth while the party moves to
+// another area. None of them have been captured, so they're only decoded when a guess is asked for. The LEAVEAREA
+// payloads follow the arguments of the LeaveAreaLUA and LeaveAreaName script actions that start the move, the others
+// are a resref and whatever comes after it.
+
+const IE_SPEC_MSG_TYPE_RESOURCE uint8 = 82
+const IE_SPEC_MSG_SUBTYPE_RESOURCE_DEMAND uint8 = 68
+
+const IE_SPEC_MSG_TYPE_MPSYNCH uint8 = 115
+const IE_SPEC_MSG_SUBTYPE_MPSYNCH_REQUEST uint8 = 82
+const IE_SPEC_MSG_SUBTYPE_MPSYNCH_REPLY uint8 = 80
+
+const IE_SPEC_MSG_TYPE_LEAVEAREALUA uint8 = 88
+const IE_SPEC_MSG_SUBTYPE_LEAVEAREALUA_PERMIT_REQUEST uint8 = 82
+
+const IE_SPEC_MSG_TYPE_LEAVEAREANAME uint8 = 120
+const IE_SPEC_MSG_SUBTYPE_LEAVEAREANAME_PERMIT_REQUEST uint8 = 82
+
+// IEResourceType is a resource type as it's numbered in CHITIN.KEY
+type IEResourceType uint16
+
+var resourceTypeNames = map[IEResourceType]string{
+	0x001: "BMP",
+	0x002: "MVE",
+	0x004: "WAV",
+	0x3e8: "BAM",
+	0x3e9: "WED",
+	0x3ea: "CHU",
+	0x3eb: "TIS",
+	0x3ec: "MOS",
+	0x3ed: "ITM",
+	0x3ee: "SPL",
+	0x3ef: "BCS",
+	0x3f0: "IDS",
+	0x3f1: "CRE",
+	0x3f2: "ARE",
+	0x3f3: "DLG",
+	0x3f4: "2DA",
+	0x3f5: "GAM",
+	0x3f6: "STO",
+	0x3f7: "WMP",
+}
+
+func (resType IEResourceType) String() string {
+	if name, ok := resourceTypeNames[resType]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", uint16(resType))
+}
+
+// IEResourceDemand asks the host for a resource the client doesn't have, like an area's saved state
+type IEResourceDemand struct {
+	ResRef  IEResRef
+	ResType IEResourceType
+	Rest    []byte
+}
+
+func (demand *IEResourceDemand) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEResourceDemand", data)
+	reader.read("ResRef", &demand.ResRef)
+	reader.read("ResType", &demand.ResType)
+	demand.Rest = reader.rest()
+	return reader.err
+}
+
+func (demand IEResourceDemand) Marshal() ([]byte, error) {
+	return marshalSpecFields(demand.ResRef, demand.ResType, demand.Rest)
+}
+
+func (demand IEResourceDemand) String() string {
+	return fmt.Sprintf("Resource: %s.%s", demand.ResRef, demand.ResType) + restString(demand.Rest)
+}
+
+// IEMPSynch is the wait for every player to finish loading an area
+type IEMPSynch struct {
+	Area IEResRef
+	Rest []byte
+}
+
+func (synch *IEMPSynch) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEMPSynch", data)
+	reader.read("Area", &synch.Area)
+	synch.Rest = reader.rest()
+	return reader.err
+}
+
+func (synch IEMPSynch) Marshal() ([]byte, error) {
+	return marshalSpecFields(synch.Area, synch.Rest)
+}
+
+func (synch IEMPSynch) String() string {
+	return fmt.Sprintf("Area: %s", synch.Area) + restString(synch.Rest)
+}
+
+// IELeaveAreaLUA asks to move the party to another area, showing Parchment while it loads
+type IELeaveAreaLUA struct {
+	ObjectID  uint32
+	Area      IEResRef
+	Parchment IEResRef
+	Position  IEPoint
+	Face      uint32
+	Rest      []byte
+}
+
+func (leaveArea *IELeaveAreaLUA) Unmarshal(data []byte) error {
+	reader := newSpecReader("IELeaveAreaLUA", data)
+	reader.read("ObjectID", &leaveArea.ObjectID)
+	reader.read("Area", &leaveArea.Area)
+	reader.read("Parchment", &leaveArea.Parchment)
+	reader.read("Position", &leaveArea.Position)
+	reader.read("Face", &leaveArea.Face)
+	leaveArea.Rest = reader.rest()
+	return reader.err
+}
+
+func (leaveArea IELeaveAreaLUA) Marshal() ([]byte, error) {
+	return marshalSpecFields(leaveArea.ObjectID, leaveArea.Area, leaveArea.Parchment, leaveArea.Position, leaveArea.Face, leaveArea.Rest)
+}
+
+func (leaveArea IELeaveAreaLUA) String() string {
+	return fmt.Sprintf("Object: 0x%x Area: %s Parchment: %s Position: %s Face: %d", leaveArea.ObjectID, leaveArea.Area, leaveArea.Parchment, leaveArea.Position, leaveArea.Face) + restString(leaveArea.Rest)
+}
+
+// IELeaveAreaName asks to move an object to another area
+type IELeaveAreaName struct {
+	ObjectID uint32
+	Area     IEResRef
+	Position IEPoint
+	Face     uint32
+	Rest     []byte
+}
+
+func (leaveArea *IELeaveAreaName) Unmarshal(data []byte) error {
+	reader := newSpecReader("IELeaveAreaName", data)
+	reader.read("ObjectID", &leaveArea.ObjectID)
+	reader.read("Area", &leaveArea.Area)
+	reader.read("Position", &leaveArea.Position)
+	reader.read("Face", &leaveArea.Face)
+	leaveArea.Rest = reader.rest()
+	return reader.err
+}
+
+func (leaveArea IELeaveAreaName) Marshal() ([]byte, error) {
+	return marshalSpecFields(leaveArea.ObjectID, leaveArea.Area, leaveArea.Position, leaveArea.Face, leaveArea.Rest)
+}
+
+func (leaveArea IELeaveAreaName) String() string {
+	return fmt.Sprintf("Object: 0x%x Area: %s Position: %s Face: %d", leaveArea.ObjectID, leaveArea.Area, leaveArea.Position, leaveArea.Face) + restString(leaveArea.Rest)
+}
+
+func newIEResourceDemand() SpecMsg { return &IEResourceDemand{} }
+func newIEMPSynch() SpecMsg        { return &IEMPSynch{} }
+func newIELeaveAreaLUA() SpecMsg   { return &IELeaveAreaLUA{} }
+func newIELeaveAreaName() SpecMsg  { return &IELeaveAreaName{} }
+
+// IsAreaTransfer reports whether a spec message is part of moving between areas
+func IsAreaTransfer(msgType uint8) bool {
+	switch msgType {
+	case IE_SPEC_MSG_TYPE_RESOURCE, IE_SPEC_MSG_TYPE_MPSYNCH, IE_SPEC_MSG_TYPE_LEAVEAREALUA, IE_SPEC_MSG_TYPE_LEAVEAREANAME:
+		return true
+	}
+	return false
+}
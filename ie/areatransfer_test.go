@@ -0,0 +1,32 @@
+package ie
+
+import "testing"
+
+func TestAreaTransferGuesses(t *testing.T) {
+	fixtures := []guessFixture{
+		{IE_SPEC_MSG_TYPE_RESOURCE, IE_SPEC_MSG_SUBTYPE_RESOURCE_DEMAND, "4152323630300000" + "03f2", "Resource: AR2600.ARE"},
+		{IE_SPEC_MSG_TYPE_RESOURCE, IE_SPEC_MSG_SUBTYPE_RESOURCE_DEMAND, "53574f5244303100" + "0999" + "01", "Resource: SWORD01.0x999 Rest: 01"},
+		{IE_SPEC_MSG_TYPE_MPSYNCH, IE_SPEC_MSG_SUBTYPE_MPSYNCH_REQUEST, "4152323630300000", "Area: AR2600"},
+		{IE_SPEC_MSG_TYPE_MPSYNCH, IE_SPEC_MSG_SUBTYPE_MPSYNCH_REPLY, "4152323630300000" + "00000001", "Area: AR2600 Rest: 00000001"},
+		{IE_SPEC_MSG_TYPE_LEAVEAREALUA, IE_SPEC_MSG_SUBTYPE_LEAVEAREALUA_PERMIT_REQUEST, "00000007" + "4152323630300000" + "46414c5345000000" + "000001900000012c" + "00000004",
+			"Object: 0x7 Area: AR2600 Parchment: FALSE Position: (400, 300) Face: 4"},
+		{IE_SPEC_MSG_TYPE_LEAVEAREANAME, IE_SPEC_MSG_SUBTYPE_LEAVEAREANAME_PERMIT_REQUEST, "00000007" + "4152323630300000" + "ffffffffffffffff" + "00000000",
+			"Object: 0x7 Area: AR2600 Position: (-1, -1) Face: 0"},
+	}
+	testGuesses(t, fixtures)
+	for _, fixture := range fixtures {
+		if !IsAreaTransfer(fixture.msgType) {
+			_, name := SpecMsgNames(fixture.msgType, fixture.msgSubType)
+			t.Errorf("%s isn't an area transfer", name)
+		}
+	}
+}
+
+func TestResourceDemandString(t *testing.T) {
+	if s := (IEResourceDemand{ResRef: testResRef("AR2600"), ResType: 0x3f2}).String(); s != "Resource: AR2600.ARE" {
+		t.Errorf("unexpected string %q", s)
+	}
+	if s := IEResourceType(0x999).String(); s != "0x999" {
+		t.Errorf("unexpected string %q", s)
+	}
+}
@@ -0,0 +1,351 @@
+package ie
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// CMESSAGEs are the engine's object messages and carry most of the in-game state sync. None of the layouts below
+// have been checked against a capture, so they're only registered as guesses. Each shape is what the message's name
+// suggests: the object the message is about, then its arguments. Messages whose arguments we can't even guess at
+// from the name, like ADD_EFFECT or DISPLAY_TEXT, only have their names registered.
+
+const IE_SPEC_MSG_TYPE_CMESSAGE uint8 = 67
+
+type IEResRef [8]byte
+
+func (resRef IEResRef) String() string {
+	return strings.TrimRight(string(resRef[:]), "\x00")
+}
+
+// IEPoint is a position in an area. The engine's CPoint is two LONGs.
+type IEPoint struct {
+	X int32
+	Y int32
+}
+
+func (point IEPoint) String() string {
+	return fmt.Sprintf("(%d, %d)", point.X, point.Y)
+}
+
+// IEItem is laid out like an item entry in a CRE file
+type IEItem struct {
+	ResRef   IEResRef
+	Duration uint16
+	Charges  [3]uint16
+	Flags    uint32
+}
+
+const IEItemSize int = 20
+
+func (item IEItem) String() string {
+	return fmt.Sprintf("%s Charges: %d/%d/%d Flags: 0x%x", item.ResRef, item.Charges[0], item.Charges[1], item.Charges[2], item.Flags)
+}
+
+func restString(rest []byte) string {
+	if len(rest) == 0 {
+		return ""
+	}
+	return " Rest: " + hex.EncodeToString(rest)
+}
+
+// CMessageObject is a message about an object with no arguments we understand
+type CMessageObject struct {
+	ObjectID uint32
+	Rest     []byte
+}
+
+func (msg *CMessageObject) Unmarshal(data []byte) error {
+	reader := newSpecReader("CMessageObject", data)
+	reader.read("ObjectID", &msg.ObjectID)
+	msg.Rest = reader.rest()
+	return reader.err
+}
+
+func (msg CMessageObject) Marshal() ([]byte, error) {
+	return marshalSpecFields(msg.ObjectID, msg.Rest)
+}
+
+func (msg CMessageObject) String() string {
+	return fmt.Sprintf("Object: 0x%x", msg.ObjectID) + restString(msg.Rest)
+}
+
+// CMessageValue sets a single value on an object: a direction, a flag, a strref, an amount of gold...
+type CMessageValue struct {
+	ObjectID uint32
+	Value    uint32
+	Rest     []byte
+}
+
+func (msg *CMessageValue) Unmarshal(data []byte) error {
+	reader := newSpecReader("CMessageValue", data)
+	reader.read("ObjectID", &msg.ObjectID)
+	reader.read("Value", &msg.Value)
+	msg.Rest = reader.rest()
+	return reader.err
+}
+
+func (msg CMessageValue) Marshal() ([]byte, error) {
+	return marshalSpecFields(msg.ObjectID, msg.Value, msg.Rest)
+}
+
+func (msg CMessageValue) String() string {
+	return fmt.Sprintf("Object: 0x%x Value: %d (0x%x)", msg.ObjectID, msg.Value, msg.Value) + restString(msg.Rest)
+}
+
+// CMessageResRef points an object at a resource: a sound, a dialog, a store...
+type CMessageResRef struct {
+	ObjectID uint32
+	ResRef   IEResRef
+	Rest     []byte
+}
+
+func (msg *CMessageResRef) Unmarshal(data []byte) error {
+	reader := newSpecReader("CMessageResRef", data)
+	reader.read("ObjectID", &msg.ObjectID)
+	reader.read("ResRef", &msg.ResRef)
+	msg.Rest = reader.rest()
+	return reader.err
+}
+
+func (msg CMessageResRef) Marshal() ([]byte, error) {
+	return marshalSpecFields(msg.ObjectID, msg.ResRef, msg.Rest)
+}
+
+func (msg CMessageResRef) String() string {
+	return fmt.Sprintf("Object: 0x%x ResRef: %s", msg.ObjectID, msg.ResRef) + restString(msg.Rest)
+}
+
+// CMessagePoint moves something to a position in the area
+type CMessagePoint struct {
+	ObjectID uint32
+	Position IEPoint
+	Rest     []byte
+}
+
+func (msg *CMessagePoint) Unmarshal(data []byte) error {
+	reader := newSpecReader("CMessagePoint", data)
+	reader.read("ObjectID", &msg.ObjectID)
+	reader.read("Position", &msg.Position)
+	msg.Rest = reader.rest()
+	return reader.err
+}
+
+func (msg CMessagePoint) Marshal() ([]byte, error) {
+	return marshalSpecFields(msg.ObjectID, msg.Position, msg.Rest)
+}
+
+func (msg CMessagePoint) String() string {
+	return fmt.Sprintf("Object: 0x%x Position: %s", msg.ObjectID, msg.Position) + restString(msg.Rest)
+}
+
+// CMessageMoveGlobal moves an object to a position in another area
+type CMessageMoveGlobal struct {
+	ObjectID uint32
+	Area     IEResRef
+	Position IEPoint
+	Rest     []byte
+}
+
+func (msg *CMessageMoveGlobal) Unmarshal(data []byte) error {
+	reader := newSpecReader("CMessageMoveGlobal", data)
+	reader.read("ObjectID", &msg.ObjectID)
+	reader.read("Area", &msg.Area)
+	reader.read("Position", &msg.Position)
+	msg.Rest = reader.rest()
+	return reader.err
+}
+
+func (msg CMessageMoveGlobal) Marshal() ([]byte, error) {
+	return marshalSpecFields(msg.ObjectID, msg.Area, msg.Position, msg.Rest)
+}
+
+func (msg CMessageMoveGlobal) String() string {
+	return fmt.Sprintf("Object: 0x%x Area: %s Position: %s", msg.ObjectID, msg.Area, msg.Position) + restString(msg.Rest)
+}
+
+// CMessagePath gives an object a list of points to walk
+type CMessagePath struct {
+	ObjectID  uint32
+	NumPoints uint16
+	Points    []IEPoint
+	Rest      []byte
+}
+
+func (msg *CMessagePath) Unmarshal(data []byte) error {
+	reader := newSpecReader("CMessagePath", data)
+	reader.read("ObjectID", &msg.ObjectID)
+	reader.read("NumPoints", &msg.NumPoints)
+	msg.Points = nil
+	for i := 0; i < int(msg.NumPoints) && reader.err == nil; i++ {
+		var point IEPoint
+		reader.read("Points", &point)
+		msg.Points = append(msg.Points, point)
+	}
+	msg.Rest = reader.rest()
+	return reader.err
+}
+
+// Marshal sets NumPoints from Points
+func (msg CMessagePath) Marshal() ([]byte, error) {
+	if len(msg.Points) > 0xffff {
+		return nil, &PacketError{ErrPacketTooLarge, "CMessagePath.Points", 0xffff, len(msg.Points)}
+	}
+	return marshalSpecFields(msg.ObjectID, uint16(len(msg.Points)), msg.Points, msg.Rest)
+}
+
+func (msg CMessagePath) String() string {
+	points := make([]string, len(msg.Points))
+	for i, point := range msg.Points {
+		points[i] = point.String()
+	}
+	return fmt.Sprintf("Object: 0x%x Path: %s", msg.ObjectID, strings.Join(points, " ")) + restString(msg.Rest)
+}
+
+// CMessageItem adds or removes a single item on a container or store
+type CMessageItem struct {
+	ObjectID uint32
+	Item     IEItem
+	Rest     []byte
+}
+
+func (msg *CMessageItem) Unmarshal(data []byte) error {
+	reader := newSpecReader("CMessageItem", data)
+	reader.read("ObjectID", &msg.ObjectID)
+	reader.read("Item", &msg.Item)
+	msg.Rest = reader.rest()
+	return reader.err
+}
+
+func (msg CMessageItem) Marshal() ([]byte, error) {
+	return marshalSpecFields(msg.ObjectID, msg.Item, msg.Rest)
+}
+
+func (msg CMessageItem) String() string {
+	return fmt.Sprintf("Object: 0x%x Item: %s", msg.ObjectID, msg.Item) + restString(msg.Rest)
+}
+
+// CMessageContainerItems is the full contents of a container
+type CMessageContainerItems struct {
+	ObjectID uint32
+	NumItems uint16
+	Items    []IEItem
+	Rest     []byte
+}
+
+func (msg *CMessageContainerItems) Unmarshal(data []byte) error {
+	reader := newSpecReader("CMessageContainerItems", data)
+	reader.read("ObjectID", &msg.ObjectID)
+	reader.read("NumItems", &msg.NumItems)
+	msg.Items = nil
+	for i := 0; i < int(msg.NumItems) && reader.err == nil; i++ {
+		var item IEItem
+		reader.read("Items", &item)
+		msg.Items = append(msg.Items, item)
+	}
+	msg.Rest = reader.rest()
+	return reader.err
+}
+
+// Marshal sets NumItems from Items
+func (msg CMessageContainerItems) Marshal() ([]byte, error) {
+	if len(msg.Items) > 0xffff {
+		return nil, &PacketError{ErrPacketTooLarge, "CMessageContainerItems.Items", 0xffff, len(msg.Items)}
+	}
+	return marshalSpecFields(msg.ObjectID, uint16(len(msg.Items)), msg.Items, msg.Rest)
+}
+
+func (msg CMessageContainerItems) String() string {
+	ret := fmt.Sprintf("Container: 0x%x Items: %d", msg.ObjectID, len(msg.Items))
+	for _, item := range msg.Items {
+		ret += "\n\t" + item.String()
+	}
+	return ret + restString(msg.Rest)
+}
+
+// CMessageChangeStat changes one of an object's stats. The IDs are the ones in STATS.IDS, and Mode is probably
+// the same set/increment/percentage as an effect's Parameter2.
+type CMessageChangeStat struct {
+	ObjectID uint32
+	StatID   uint16
+	Value    int32
+	Mode     uint16
+	Rest     []byte
+}
+
+func (msg *CMessageChangeStat) Unmarshal(data []byte) error {
+	reader := newSpecReader("CMessageChangeStat", data)
+	reader.read("ObjectID", &msg.ObjectID)
+	reader.read("StatID", &msg.StatID)
+	reader.read("Value", &msg.Value)
+	reader.read("Mode", &msg.Mode)
+	msg.Rest = reader.rest()
+	return reader.err
+}
+
+func (msg CMessageChangeStat) Marshal() ([]byte, error) {
+	return marshalSpecFields(msg.ObjectID, msg.StatID, msg.Value, msg.Mode, msg.Rest)
+}
+
+func (msg CMessageChangeStat) String() string {
+	return fmt.Sprintf("Object: 0x%x Stat: %d Value: %d Mode: %d", msg.ObjectID, msg.StatID, msg.Value, msg.Mode) + restString(msg.Rest)
+}
+
+// CMessageSpriteUpdate is a creature's periodic update. Its position is the only part we've picked out.
+type CMessageSpriteUpdate struct {
+	ObjectID uint32
+	Position IEPoint
+	Rest     []byte
+}
+
+func (msg *CMessageSpriteUpdate) Unmarshal(data []byte) error {
+	reader := newSpecReader("CMessageSpriteUpdate", data)
+	reader.read("ObjectID", &msg.ObjectID)
+	reader.read("Position", &msg.Position)
+	msg.Rest = reader.rest()
+	return reader.err
+}
+
+func (msg CMessageSpriteUpdate) Marshal() ([]byte, error) {
+	return marshalSpecFields(msg.ObjectID, msg.Position, msg.Rest)
+}
+
+func (msg CMessageSpriteUpdate) String() string {
+	return fmt.Sprintf("Sprite: 0x%x Position: %s", msg.ObjectID, msg.Position) + restString(msg.Rest)
+}
+
+// CMessageAction queues a script action on an object. ActionID is from ACTION.IDS, the parameters are still in Rest.
+type CMessageAction struct {
+	ObjectID uint32
+	ActionID uint16
+	Rest     []byte
+}
+
+func (msg *CMessageAction) Unmarshal(data []byte) error {
+	reader := newSpecReader("CMessageAction", data)
+	reader.read("ObjectID", &msg.ObjectID)
+	reader.read("ActionID", &msg.ActionID)
+	msg.Rest = reader.rest()
+	return reader.err
+}
+
+func (msg CMessageAction) Marshal() ([]byte, error) {
+	return marshalSpecFields(msg.ObjectID, msg.ActionID, msg.Rest)
+}
+
+func (msg CMessageAction) String() string {
+	return fmt.Sprintf("Object: 0x%x Action: %d", msg.ObjectID, msg.ActionID) + restString(msg.Rest)
+}
+
+func newCMessageObject() SpecMsg         { return &CMessageObject{} }
+func newCMessageValue() SpecMsg          { return &CMessageValue{} }
+func newCMessageResRef() SpecMsg         { return &CMessageResRef{} }
+func newCMessagePoint() SpecMsg          { return &CMessagePoint{} }
+func newCMessageMoveGlobal() SpecMsg     { return &CMessageMoveGlobal{} }
+func newCMessagePath() SpecMsg           { return &CMessagePath{} }
+func newCMessageItem() SpecMsg           { return &CMessageItem{} }
+func newCMessageContainerItems() SpecMsg { return &CMessageContainerItems{} }
+func newCMessageChangeStat() SpecMsg     { return &CMessageChangeStat{} }
+func newCMessageSpriteUpdate() SpecMsg   { return &CMessageSpriteUpdate{} }
+func newCMessageAction() SpecMsg         { return &CMessageAction{} }
@@ -0,0 +1,55 @@
+package ie
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func testResRef(name string) IEResRef {
+	var resRef IEResRef
+	copy(resRef[:], name)
+	return resRef
+}
+
+func TestCMessageGuesses(t *testing.T) {
+	item := "5357314830310000" + "0000" + "000100000000" + "00000001"
+	testGuesses(t, []guessFixture{
+		{IE_SPEC_MSG_TYPE_CMESSAGE, 0, "00001234" + "0003" + "010203", "Object: 0x1234 Action: 3 Rest: 010203"},
+		{IE_SPEC_MSG_TYPE_CMESSAGE, 5, "00001234", "Object: 0x1234"},
+		{IE_SPEC_MSG_TYPE_CMESSAGE, 31, "00001234" + "000001f4", "Object: 0x1234 Value: 500 (0x1f4)"},
+		{IE_SPEC_MSG_TYPE_CMESSAGE, 32, "00001234" + "414d425f44303100", "Object: 0x1234 ResRef: AMB_D01"},
+		{IE_SPEC_MSG_TYPE_CMESSAGE, 49, "00001234" + "0002" + "00000064000000c8" + "0000006e000000d2", "Object: 0x1234 Path: (100, 200) (110, 210)"},
+		{IE_SPEC_MSG_TYPE_CMESSAGE, 57, "00001234" + "00000280000001e0" + "dead", "Sprite: 0x1234 Position: (640, 480) Rest: dead"},
+		{IE_SPEC_MSG_TYPE_CMESSAGE, 66, "00001234" + "ffffffff00000005", "Object: 0x1234 Position: (-1, 5)"},
+		{IE_SPEC_MSG_TYPE_CMESSAGE, 72, "00001234" + "4152323630300000" + "0000012c00000190", "Object: 0x1234 Area: AR2600 Position: (300, 400)"},
+		{IE_SPEC_MSG_TYPE_CMESSAGE, 13, "00001234" + "0001" + item, "Container: 0x1234 Items: 1\n\tSW1H01 Charges: 1/0/0 Flags: 0x1"},
+		{IE_SPEC_MSG_TYPE_CMESSAGE, 78, "00001234" + item, "Object: 0x1234 Item: SW1H01 Charges: 1/0/0 Flags: 0x1"},
+		{IE_SPEC_MSG_TYPE_CMESSAGE, 116, "00001234" + "0022" + "fffffffe" + "0001", "Object: 0x1234 Stat: 34 Value: -2 Mode: 1"},
+	})
+
+	// Names alone don't get a layout
+	for _, subType := range []uint8{1, 16} {
+		if _, err := GuessSpecMsg(IE_SPEC_MSG_TYPE_CMESSAGE, subType, []byte{0, 0, 0x12, 0x34}); !errors.Is(err, ErrNoSpecDecoder) {
+			t.Errorf("%d: expected no guess, got %v", subType, err)
+		}
+	}
+}
+
+func TestCMessageContainerItemsCountPastEnd(t *testing.T) {
+	data := binary.BigEndian.AppendUint32(nil, 0x1234)
+	data = binary.BigEndian.AppendUint16(data, 0xffff)
+	data = append(data, make([]byte, IEItemSize)...)
+	if _, err := GuessSpecMsg(IE_SPEC_MSG_TYPE_CMESSAGE, 13, data); !errors.Is(err, ErrShortPacket) {
+		t.Errorf("expected a short packet, got %v", err)
+	}
+}
+
+func TestIEResRefString(t *testing.T) {
+	if name := testResRef("AR2600").String(); name != "AR2600" {
+		t.Errorf("got %q", name)
+	}
+	if name := testResRef("12345678").String(); name != "12345678" {
+		t.Errorf("got %q", name)
+	}
+}
@@ -0,0 +1,101 @@
+package ie
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"sync"
+)
+
+// The Compressed flag in the IEHeader means the data is a zlib stream. The game compresses at Best Compression.
+// Any level decompresses the same way, so the level only matters for getting byte for byte the frames the game
+// would have sent.
+const GameCompressionLevel int = zlib.BestCompression
+
+var ErrCompressedData = errors.New("bad compressed data")
+
+// zlib writers are big, so we keep one pool of them per level
+var writerPools sync.Map
+
+var readerPool sync.Pool
+
+func writerPool(level int) *sync.Pool {
+	pool, _ := writerPools.LoadOrStore(level, &sync.Pool{})
+	return pool.(*sync.Pool)
+}
+
+// Compress deflates a payload at a zlib level, GameCompressionLevel for frames like the game's
+func Compress(payload []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	pool := writerPool(level)
+	z, ok := pool.Get().(*zlib.Writer)
+	if ok {
+		z.Reset(&buf)
+	} else {
+		var err error
+		if z, err = zlib.NewWriterLevel(&buf, level); err != nil {
+			return nil, err
+		}
+	}
+	defer pool.Put(z)
+	if _, err := z.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := z.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress inflates data that's meant to come out as exactly size bytes. It never produces more than size, and
+// size can't be more than MaxDecompressedSize, so a lying DecompressedSize can't make us allocate much. Anything
+// that doesn't come out at exactly size is an error wrapping ErrDecompressedSize, and a broken stream is an error
+// wrapping ErrCompressedData.
+func Decompress(data []byte, size uint32) ([]byte, error) {
+	if err := checkDecompressedSize(size, len(data)); err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return []byte{}, nil
+	}
+
+	var z io.ReadCloser
+	if pooled, ok := readerPool.Get().(io.ReadCloser); ok {
+		if err := pooled.(zlib.Resetter).Reset(bytes.NewReader(data), nil); err != nil {
+			readerPool.Put(pooled)
+			return nil, &PacketError{ErrCompressedData, "zlib header", 0, len(data)}
+		}
+		z = pooled
+	} else {
+		var err error
+		if z, err = zlib.NewReader(bytes.NewReader(data)); err != nil {
+			return nil, &PacketError{ErrCompressedData, "zlib header", 0, len(data)}
+		}
+	}
+	defer readerPool.Put(z)
+
+	payload := make([]byte, size)
+	n, err := io.ReadFull(z, payload)
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return nil, &PacketError{ErrDecompressedSize, "DecompressedSize", int(size), n}
+	} else if err != nil {
+		return nil, &PacketError{ErrCompressedData, "data", int(size), n}
+	}
+	// The stream has to end here. Reading to the end also checks the checksum.
+	var extra [1]byte
+	if n, err := z.Read(extra[:]); n > 0 {
+		return nil, &PacketError{ErrDecompressedSize, "DecompressedSize", int(size), int(size) + n}
+	} else if err != io.EOF {
+		return nil, &PacketError{ErrCompressedData, "checksum", int(size), int(size)}
+	}
+	return payload, nil
+}
+
+// DecompressPayload returns a packet's data, inflated and checked against its DecompressedSize if it's compressed
+func DecompressPayload(packet JMPacket) ([]byte, error) {
+	if !packet.IsCompressed() {
+		return packet.PacketData(), nil
+	}
+	return Decompress(packet.PacketData(), packet.DecompressedSize())
+}
@@ -0,0 +1,91 @@
+package ie
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte("FULLSET "), 200)
+	for _, level := range []int{GameCompressionLevel, zlib.BestSpeed, zlib.NoCompression} {
+		// Twice, so the second goes through pooled writers and readers
+		for i := 0; i < 2; i++ {
+			data, err := Compress(payload, level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decompressed, err := Decompress(data, uint32(len(payload)))
+			if err != nil {
+				t.Fatalf("level %d: %v", level, err)
+			}
+			if !bytes.Equal(decompressed, payload) {
+				t.Errorf("level %d: round trip mismatch", level)
+			}
+		}
+	}
+	if _, err := Compress(payload, 42); err == nil {
+		t.Error("bad level didn't return an error")
+	}
+}
+
+func TestCompressMatchesZlib(t *testing.T) {
+	payload := []byte("the game compresses at Best Compression")
+	var buf bytes.Buffer
+	z, _ := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	z.Write(payload)
+	z.Close()
+	if data, _ := Compress(payload, GameCompressionLevel); !bytes.Equal(data, buf.Bytes()) {
+		t.Errorf("compressed differently from zlib:\n%x\n%x", buf.Bytes(), data)
+	}
+}
+
+func TestDecompressSize(t *testing.T) {
+	payload := make([]byte, 100)
+	data, _ := Compress(payload, GameCompressionLevel)
+	for _, size := range []uint32{99, 101, 0} {
+		if _, err := Decompress(data, size); !errors.Is(err, ErrDecompressedSize) {
+			t.Errorf("size %d: expected ErrDecompressedSize, got %v", size, err)
+		}
+	}
+	// A zip bomb claiming a sensible size only gets that far
+	bomb, _ := Compress(make([]byte, 4*int(MaxDecompressedSize)), GameCompressionLevel)
+	if _, err := Decompress(bomb, 10); !errors.Is(err, ErrDecompressedSize) {
+		t.Errorf("expected ErrDecompressedSize for a bomb, got %v", err)
+	}
+	if _, err := Decompress(bomb, MaxDecompressedSize+1); !errors.Is(err, ErrDecompressedSize) {
+		t.Errorf("expected ErrDecompressedSize past the limit, got %v", err)
+	}
+	if decompressed, err := Decompress(nil, 0); err != nil || len(decompressed) != 0 {
+		t.Errorf("empty data: %x %v", decompressed, err)
+	}
+}
+
+func TestDecompressCorrupt(t *testing.T) {
+	data, _ := Compress(bytes.Repeat([]byte{1, 2, 3}, 50), GameCompressionLevel)
+	if _, err := Decompress([]byte("not zlib"), 10); !errors.Is(err, ErrCompressedData) {
+		t.Errorf("expected ErrCompressedData for a bad header, got %v", err)
+	}
+	badChecksum := append([]byte{}, data...)
+	badChecksum[len(badChecksum)-1] ^= 0xff
+	if _, err := Decompress(badChecksum, 150); !errors.Is(err, ErrCompressedData) {
+		t.Errorf("expected ErrCompressedData for a bad checksum, got %v", err)
+	}
+}
+
+func TestDecompressPayload(t *testing.T) {
+	payload := bytes.Repeat([]byte{7}, 300)
+	for _, compressed := range []uint8{0, 1} {
+		packet, _ := NewJMMessage(IEHeader{Compressed: compressed}, true, IE_SPEC_MSG_TYPE_VERSION, IE_SPEC_MSG_SUBTYPE_VERSION_SERVER, payload)
+		if decompressed, err := DecompressPayload(packet); err != nil || !bytes.Equal(decompressed, payload) {
+			t.Errorf("compressed %d: %v", compressed, err)
+		}
+	}
+	packet, _ := NewJMMessage(IEHeader{Compressed: 1}, false, 0, 0, payload)
+	lying := packet.(JMCompressed)
+	lying.DecompressedSize_ = 30
+	if _, err := DecompressPayload(lying); !errors.Is(err, ErrDecompressedSize) {
+		t.Errorf("expected ErrDecompressedSize, got %v", err)
+	}
+}
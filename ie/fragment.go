@@ -0,0 +1,171 @@
+package ie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Messages too big for one frame are split across several. We think Unknown1 and Unknown2 in the JMHeader are the
+// fragment's index and the number of fragments. That's an inference: the only frame we have off the wire is a ping,
+// which has no JMHeader at all, and the messages we build ourselves set them to 0 and 1. We take each fragment to be
+// a whole JM frame with its own FrameNum, one after another, and the bytes after their JMHeaders, put back together,
+// to be what would have come after the JMHeader of a single frame: the spec header if there is one, then the data,
+// compressed as a whole if the message is. Split and Reassembler.Add both work to that layout.
+
+var (
+	ErrFragment      = errors.New("frame is one fragment of a bigger message")
+	ErrFragmentOrder = errors.New("fragment doesn't belong to the message being reassembled")
+	ErrNoFrameHeader = errors.New("no header to give the next fragment")
+)
+
+// The most data after the JMHeader we put in a frame we're injecting. The game's own limit isn't known, this keeps
+// every frame well under a typical MTU.
+const MaxFrameData int = 1024
+
+// The most fragments a message can be split into, since the count is a byte
+const MaxFragments int = 0xff
+
+// JMFragment returns a frame's fragment index and count. A count of 0 or 1 means it isn't a fragment.
+func JMFragment(frame []byte) (index, count uint8, ok bool) {
+	if len(frame) < JMHeaderSize || frame[IEHeaderSize] != 'J' || frame[IEHeaderSize+1] != 'M' {
+		return 0, 0, false
+	}
+	return frame[IEHeaderSize+2], frame[IEHeaderSize+3], true
+}
+
+// IsJMFragment reports whether a frame is part of a message split across several frames
+func IsJMFragment(frame []byte) bool {
+	_, count, ok := JMFragment(frame)
+	return ok && count > 1
+}
+
+// Split lays a whole JM frame out as fragments of at most maxData bytes after their JMHeaders, the way
+// Reassembler.Add puts them back together. next gives each fragment its header, in order. Only FrameKind, the player
+// IDs, FrameNum and FrameExpected are taken from it. A message that fits comes back as a single frame. Nothing is
+// asked of next until the message is known to fit in MaxFragments.
+func Split(frame []byte, maxData int, next func() (IEHeader, bool)) ([][]byte, error) {
+	if len(frame) < JMHeaderSize {
+		return nil, &PacketError{ErrShortPacket, "JMHeader", JMHeaderSize, len(frame)}
+	}
+	if _, _, ok := JMFragment(frame); !ok {
+		return nil, &PacketError{ErrNotJM, "JMHeader", int('J')<<8 | int('M'), int(frame[IEHeaderSize])<<8 | int(frame[IEHeaderSize+1])}
+	}
+	data := frame[JMHeaderSize:]
+	count := (len(data) + maxData - 1) / maxData
+	if count == 0 {
+		count = 1
+	}
+	if count > MaxFragments {
+		return nil, &PacketError{ErrPacketTooLarge, "Unknown2", MaxFragments, count}
+	}
+	fragments := make([][]byte, count)
+	for i := range fragments {
+		header, ok := next()
+		if !ok {
+			return nil, ErrNoFrameHeader
+		}
+		chunk := data[i*maxData:]
+		if len(chunk) > maxData {
+			chunk = chunk[:maxData]
+		}
+		fragment := append(append([]byte{}, frame[:JMHeaderSize]...), chunk...)
+		binary.BigEndian.PutUint32(fragment[0:], header.PlayerIDFrom)
+		binary.BigEndian.PutUint32(fragment[4:], header.PlayerIDTo)
+		fragment[8] = header.FrameKind_
+		binary.BigEndian.PutUint16(fragment[9:], header.FrameNum)
+		binary.BigEndian.PutUint16(fragment[11:], header.FrameExpected)
+		fragment[IEHeaderSize+2] = uint8(i)
+		fragment[IEHeaderSize+3] = uint8(count)
+		binary.BigEndian.PutUint16(fragment[JMHeaderSize-2:], uint16(len(chunk)))
+		binary.BigEndian.PutUint32(fragment[IEHeaderSize-4:], FrameCRC(fragment))
+		fragments[i] = fragment
+	}
+	return fragments, nil
+}
+
+type fragmentSet struct {
+	count     uint8
+	fragments [][]byte
+	received  int
+}
+
+// Reassembler puts fragmented messages back together. Each sender's fragments come in order, so there's only ever
+// one message being reassembled per direction.
+type Reassembler struct {
+	lock    sync.Mutex
+	pending map[FrameDirection]*fragmentSet
+}
+
+func NewReassembler() *Reassembler {
+	return &Reassembler{pending: make(map[FrameDirection]*fragmentSet)}
+}
+
+// Add takes a JM frame. Frames that aren't fragments come straight back. Fragments are kept until the last one
+// arrives, then the whole message comes back as a single frame, with the IEHeader of its first fragment, that
+// NewJMPacket can decode. complete is false while fragments are still missing.
+func (reassembler *Reassembler) Add(frame []byte) (message []byte, complete bool, err error) {
+	index, count, ok := JMFragment(frame)
+	if !ok || count <= 1 {
+		return frame, true, nil
+	}
+	if int(binary.BigEndian.Uint16(frame[JMHeaderSize-2:])) != len(frame)-JMHeaderSize {
+		return nil, false, &PacketError{ErrLengthMismatch, "PacketLen", int(binary.BigEndian.Uint16(frame[JMHeaderSize-2:])), len(frame) - JMHeaderSize}
+	}
+	if index >= count {
+		return nil, false, &PacketError{ErrFragmentOrder, "Unknown1", int(count) - 1, int(index)}
+	}
+	direction := FrameDirection{binary.BigEndian.Uint32(frame[0:]), binary.BigEndian.Uint32(frame[4:])}
+
+	reassembler.lock.Lock()
+	defer reassembler.lock.Unlock()
+	set, ok := reassembler.pending[direction]
+	// A new message started before the last one finished, going by a different count or a first fragment we haven't
+	// seen before. What we had of it is gone.
+	if ok && set.count != count {
+		err = &PacketError{ErrFragmentOrder, "Unknown2", int(set.count), int(count)}
+		ok = false
+	} else if ok && index == 0 && set.fragments[0] != nil && !bytes.Equal(set.fragments[0][9:11], frame[9:11]) {
+		err = &PacketError{ErrFragmentOrder, "FrameNum", int(binary.BigEndian.Uint16(set.fragments[0][9:])), int(binary.BigEndian.Uint16(frame[9:]))}
+		ok = false
+	}
+	if !ok {
+		set = &fragmentSet{count: count, fragments: make([][]byte, count)}
+		reassembler.pending[direction] = set
+	}
+	if set.fragments[index] == nil {
+		set.received++
+	}
+	// Retransmits just replace what we had
+	set.fragments[index] = append([]byte{}, frame...)
+	if set.received < int(count) {
+		return nil, false, err
+	}
+	delete(reassembler.pending, direction)
+
+	message = append([]byte{}, set.fragments[0][:JMHeaderSize]...)
+	for _, fragment := range set.fragments {
+		message = append(message, fragment[JMHeaderSize:]...)
+	}
+	if len(message)-JMHeaderSize > 0xffff {
+		return nil, false, &PacketError{ErrPacketTooLarge, "PacketLen", 0xffff, len(message) - JMHeaderSize}
+	}
+	message[IEHeaderSize+2] = 0
+	message[IEHeaderSize+3] = 1
+	binary.BigEndian.PutUint16(message[JMHeaderSize-2:], uint16(len(message)-JMHeaderSize))
+	binary.BigEndian.PutUint32(message[IEHeaderSize-4:], FrameCRC(message))
+	return message, true, nil
+}
+
+// Pending describes the messages still waiting on fragments
+func (reassembler *Reassembler) Pending() []string {
+	reassembler.lock.Lock()
+	defer reassembler.lock.Unlock()
+	var pending []string
+	for direction, set := range reassembler.pending {
+		pending = append(pending, fmt.Sprintf("0x%x => 0x%x: %d of %d fragments", direction.From, direction.To, set.received, set.count))
+	}
+	return pending
+}
@@ -0,0 +1,168 @@
+package ie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// testSplit splits a message with FrameNums from a SequenceTracker that has seen the host's frame 0x1f
+func testSplit(t *testing.T, packet JMPacket, maxData int) [][]byte {
+	t.Helper()
+	frame, err := packet.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := NewSequenceTracker()
+	if _, err := tracker.Forward(testFrame(testHost, testClient, 0x1f, 9, []byte{1})); err != nil {
+		t.Fatal(err)
+	}
+	fragments, err := Split(frame, maxData, func() (IEHeader, bool) { return tracker.Next(testHost, testClient) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fragments
+}
+
+func TestSplitAndReassemble(t *testing.T) {
+	payload := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(payload)
+	for _, compressed := range []uint8{0, 1} {
+		header := IEHeader{PlayerIDFrom: testHost, PlayerIDTo: testClient, FrameNum: 0x20, FrameExpected: 9, Compressed: compressed}
+		packet, err := NewJMMessage(header, true, IE_SPEC_MSG_TYPE_VERSION, IE_SPEC_MSG_SUBTYPE_VERSION_SERVER, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		whole, _ := packet.Marshal()
+		fragments := testSplit(t, packet, 1000)
+		if len(fragments) < 2 {
+			t.Fatalf("compressed %d: expected fragments, got %d", compressed, len(fragments))
+		}
+
+		reassembler := NewReassembler()
+		for i, fragment := range fragments {
+			index, count, _ := JMFragment(fragment)
+			header, _ := readFrameHeader(fragment)
+			if int(index) != i || int(count) != len(fragments) || header.FrameNum != 0x20+uint16(i) || header.FrameExpected != 9 || header.CRC32 != FrameCRC(fragment) {
+				t.Errorf("compressed %d: unexpected fragment %d: %s", compressed, i, header)
+			}
+			if _, err := NewJMPacket(fragment, len(fragment)); !errors.Is(err, ErrFragment) {
+				t.Errorf("compressed %d: expected ErrFragment, got %v", compressed, err)
+			}
+			message, complete, err := reassembler.Add(fragment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if complete != (i == len(fragments)-1) {
+				t.Fatalf("compressed %d: complete was %t after fragment %d", compressed, complete, i)
+			}
+			if complete && !bytes.Equal(message, whole) {
+				t.Errorf("compressed %d: reassembled message doesn't match:\n%x\n%x", compressed, whole, message)
+			}
+		}
+		if pending := reassembler.Pending(); len(pending) != 0 {
+			t.Errorf("compressed %d: still pending: %q", compressed, pending)
+		}
+	}
+}
+
+func TestSplitFits(t *testing.T) {
+	packet, _ := NewJMMessage(IEHeader{PlayerIDFrom: testHost, PlayerIDTo: testClient, FrameExpected: 9}, false, 0, 0, []byte("hi"))
+	whole, _ := packet.Marshal()
+	fragments := testSplit(t, packet, MaxFrameData)
+	whole[10] = 0x20
+	binary.BigEndian.PutUint32(whole[IEHeaderSize-4:], FrameCRC(whole))
+	if len(fragments) != 1 || !bytes.Equal(fragments[0], whole) {
+		t.Errorf("a message that fits wasn't sent whole:\n%x\n%x", whole, fragments)
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	packet, _ := NewJMMessage(IEHeader{}, false, 0, 0, make([]byte, 300))
+	frame, _ := packet.Marshal()
+	asked := 0
+	next := func() (IEHeader, bool) {
+		asked++
+		return IEHeader{}, false
+	}
+	if _, err := Split(frame, 1, next); !errors.Is(err, ErrPacketTooLarge) || asked != 0 {
+		t.Errorf("expected ErrPacketTooLarge before any headers were asked for, got %v after %d", err, asked)
+	}
+	if _, err := Split(frame, MaxFrameData, next); !errors.Is(err, ErrNoFrameHeader) {
+		t.Errorf("expected ErrNoFrameHeader, got %v", err)
+	}
+	if _, err := Split(mustDecodeHex(t, testPingFrame), MaxFrameData, next); !errors.Is(err, ErrShortPacket) {
+		t.Errorf("expected ErrShortPacket for a ping, got %v", err)
+	}
+}
+
+// Nothing we build is a fragment
+func TestSeedsArentFragments(t *testing.T) {
+	for name, frame := range seedJMPackets(t) {
+		if index, count, ok := JMFragment(frame); ok && (index != 0 || count > 1) {
+			t.Errorf("%s: fragment %d of %d", name, index, count)
+		}
+	}
+}
+
+func TestReassembleWhole(t *testing.T) {
+	packet, _ := NewJMMessage(IEHeader{}, false, 0, 0, []byte("hi"))
+	whole, _ := packet.Marshal()
+	if message, complete, err := NewReassembler().Add(whole); !complete || err != nil || !bytes.Equal(message, whole) {
+		t.Errorf("a whole message didn't come straight back: %t %v", complete, err)
+	}
+}
+
+func TestReassemblerOrder(t *testing.T) {
+	packet, _ := NewJMMessage(IEHeader{PlayerIDFrom: testHost, PlayerIDTo: testClient}, false, 0, 0, make([]byte, 30))
+	fragments := testSplit(t, packet, 10)
+
+	reassembler := NewReassembler()
+	// Retransmits of a fragment only count once
+	for i := 0; i < 2; i++ {
+		if _, complete, err := reassembler.Add(fragments[0]); complete || err != nil {
+			t.Fatalf("retransmit completed the message: %t %v", complete, err)
+		}
+	}
+	if pending := reassembler.Pending(); len(pending) != 1 {
+		t.Errorf("expected one pending message, got %q", pending)
+	}
+
+	// A message with a different count starts over
+	other, _ := NewJMMessage(IEHeader{PlayerIDFrom: testHost, PlayerIDTo: testClient}, false, 0, 0, make([]byte, 20))
+	if _, _, err := reassembler.Add(testSplit(t, other, 10)[0]); !errors.Is(err, ErrFragmentOrder) {
+		t.Errorf("expected ErrFragmentOrder, got %v", err)
+	}
+
+	// So does one with the same count but a first fragment with another FrameNum
+	reassembler = NewReassembler()
+	reassembler.Add(fragments[0])
+	reassembler.Add(fragments[1])
+	again, _ := NewJMMessage(IEHeader{PlayerIDFrom: testHost, PlayerIDTo: testClient}, false, 0, 0, bytes.Repeat([]byte{1}, 30))
+	againFragments := testSplit(t, again, 10)
+	for i := range againFragments {
+		binary.BigEndian.PutUint16(againFragments[i][9:], 0x30+uint16(i))
+		binary.BigEndian.PutUint32(againFragments[i][IEHeaderSize-4:], FrameCRC(againFragments[i]))
+	}
+	if _, _, err := reassembler.Add(againFragments[0]); !errors.Is(err, ErrFragmentOrder) {
+		t.Errorf("expected ErrFragmentOrder for a new first fragment, got %v", err)
+	}
+	var message []byte
+	for _, fragment := range againFragments[1:] {
+		var err error
+		if message, _, err = reassembler.Add(fragment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if packet, err := NewJMPacket(message, len(message)); err != nil || !bytes.Equal(packet.PacketData(), again.PacketData()) {
+		t.Errorf("the new message was mixed with the old one: %v", err)
+	}
+
+	bad := append([]byte{}, fragments[1]...)
+	bad[IEHeaderSize+2] = bad[IEHeaderSize+3]
+	if _, _, err := reassembler.Add(bad); !errors.Is(err, ErrFragmentOrder) {
+		t.Errorf("expected ErrFragmentOrder for an index past the count, got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package ie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Every frame with data has a two letter ident after the IEHeader saying what kind of message follows. This is only
+// the dispatcher and the counts, and it's partial: JM is the only ident with a decoder for what comes after the
+// ident, and that was worked out from the decoder tool's traffic rather than captures we have. We don't know which
+// other idents the engine uses, so we don't ship decoders for them. DecodeRawFrame gets the IEHeader and ident out of
+// any frame, IdentCounter shows what's turning up and how much of the traffic it is, and a decoder can be registered
+// once an ident has been worked out.
+
+var ErrNoIdentDecoder = errors.New("no decoder for this two letter ident")
+
+// FrameMsg is a whole frame decoded by the decoder for its ident
+type FrameMsg interface {
+	String() string
+	Marshal() ([]byte, error)
+}
+
+// IdentInfo describes one two letter ident. Decode gets the whole frame, IEHeader included.
+type IdentInfo struct {
+	Ident  string
+	Name   string
+	Decode func(frame []byte) (FrameMsg, error)
+}
+
+var idents = make(map[string]*IdentInfo)
+
+// RegisterIdent adds a decoder for a two letter ident. Registering an ident that's already there replaces it. Only
+// call it from init, the registry isn't locked.
+func RegisterIdent(info IdentInfo) {
+	idents[info.Ident] = &info
+}
+
+// LookupIdent returns the registry entry for a two letter ident
+func LookupIdent(ident string) (IdentInfo, bool) {
+	info, ok := idents[ident]
+	if !ok {
+		return IdentInfo{}, false
+	}
+	return *info, true
+}
+
+// FrameIdent returns the two letter ident of a frame, if it's long enough to have one
+func FrameIdent(frame []byte) (string, bool) {
+	if len(frame) < IEHeaderSize+2 {
+		return "", false
+	}
+	return string(frame[IEHeaderSize : IEHeaderSize+2]), true
+}
+
+// DecodeFrame decodes a frame with the decoder registered for its ident. Idents we don't have a decoder for return an
+// error wrapping ErrNoIdentDecoder.
+func DecodeFrame(frame []byte) (FrameMsg, error) {
+	ident, ok := FrameIdent(frame)
+	if !ok {
+		return nil, &PacketError{ErrShortPacket, "ident", IEHeaderSize + 2, len(frame)}
+	}
+	info, ok := idents[ident]
+	if !ok || info.Decode == nil {
+		return nil, fmt.Errorf("ERROR: ident %q: %w", ident, ErrNoIdentDecoder)
+	}
+	return info.Decode(frame)
+}
+
+// RawFrame is a frame decoded only as far as its ident, for idents we have no decoder for
+type RawFrame struct {
+	IEHeader
+	Ident string
+	Data  []byte // Everything after the ident
+}
+
+// DecodeRawFrame splits any frame with an ident into its IEHeader, ident and the bytes after them
+func DecodeRawFrame(frame []byte) (RawFrame, error) {
+	ident, ok := FrameIdent(frame)
+	if !ok {
+		return RawFrame{}, &PacketError{ErrShortPacket, "ident", IEHeaderSize + 2, len(frame)}
+	}
+	header, err := readFrameHeader(frame)
+	if err != nil {
+		return RawFrame{}, err
+	}
+	return RawFrame{header, ident, append([]byte{}, frame[IEHeaderSize+2:]...)}, nil
+}
+
+func (frame RawFrame) String() string {
+	return fmt.Sprintf("%s Ident: %q Data: %s", frame.IEHeader.String(), frame.Ident, hex.EncodeToString(frame.Data))
+}
+
+// Marshal encodes the frame as it was, CRC included, since we don't know what the CRC covers for other idents
+func (frame RawFrame) Marshal() ([]byte, error) {
+	if len(frame.Ident) != 2 {
+		return nil, &PacketError{ErrShortPacket, "Ident", 2, len(frame.Ident)}
+	}
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, binary.BigEndian, frame.IEHeader); err != nil {
+		return nil, err
+	}
+	buf.WriteString(frame.Ident)
+	buf.Write(frame.Data)
+	return buf.Bytes(), nil
+}
+
+func init() {
+	RegisterIdent(IdentInfo{Ident: "JM", Name: "JM", Decode: func(frame []byte) (FrameMsg, error) {
+		return NewJMPacket(frame, len(frame))
+	}})
+}
+
+// IdentStats counts the frames seen with one ident. Undecoded frames had no decoder, Failed ones had a decoder that
+// returned an error, and Fragments are parts of bigger messages that get decoded once they're put back together.
+type IdentStats struct {
+	Ident     string
+	Frames    int
+	Bytes     int
+	Undecoded int
+	Failed    int
+	Fragments int
+
+	undecodedBytes int
+}
+
+func (stats IdentStats) String() string {
+	return fmt.Sprintf("%q Frames: %d Bytes: %d Undecoded: %d Failed: %d Fragments: %d", stats.Ident, stats.Frames, stats.Bytes, stats.Undecoded, stats.Failed, stats.Fragments)
+}
+
+// IdentCounter keeps IdentStats for every ident it's shown
+type IdentCounter struct {
+	lock  sync.Mutex
+	stats map[string]*IdentStats
+}
+
+func NewIdentCounter() *IdentCounter {
+	return &IdentCounter{stats: make(map[string]*IdentStats)}
+}
+
+// Observe counts a frame and what DecodeFrame made of it. Frames too short for an ident aren't counted.
+func (counter *IdentCounter) Observe(frame []byte, err error) {
+	ident, ok := FrameIdent(frame)
+	if !ok {
+		return
+	}
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	stats, ok := counter.stats[ident]
+	if !ok {
+		stats = &IdentStats{Ident: ident}
+		counter.stats[ident] = stats
+	}
+	stats.Frames++
+	stats.Bytes += len(frame) - IEHeaderSize
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNoIdentDecoder):
+		stats.Undecoded++
+		stats.undecodedBytes += len(frame) - IEHeaderSize
+	case errors.Is(err, ErrFragment):
+		stats.Fragments++
+	default:
+		stats.Failed++
+	}
+}
+
+// Stats returns the counts for each ident, most frames first
+func (counter *IdentCounter) Stats() []IdentStats {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	stats := make([]IdentStats, 0, len(counter.stats))
+	for _, identStats := range counter.stats {
+		stats = append(stats, *identStats)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Frames != stats[j].Frames {
+			return stats[i].Frames > stats[j].Frames
+		}
+		return stats[i].Ident < stats[j].Ident
+	})
+	return stats
+}
+
+// Undecoded returns how many of the frames and bytes counted had no decoder, out of the totals
+func (counter *IdentCounter) Undecoded() (frames, totalFrames, bytes, totalBytes int) {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	for _, stats := range counter.stats {
+		totalFrames += stats.Frames
+		totalBytes += stats.Bytes
+		frames += stats.Undecoded
+		bytes += stats.undecodedBytes
+	}
+	return
+}
@@ -0,0 +1,103 @@
+package ie
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecodeFrame(t *testing.T) {
+	packet, _ := NewJMMessage(IEHeader{PlayerIDFrom: testHost, PlayerIDTo: testClient}, false, 0, 0, []byte("hi"))
+	frame, _ := packet.Marshal()
+	msg, err := DecodeFrame(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := msg.(JMPacket); !ok {
+		t.Errorf("JM frame decoded as %T", msg)
+	}
+
+	unknown := testFrame(testHost, testClient, 1, 0, []byte("XXhi"))
+	if _, err := DecodeFrame(unknown); !errors.Is(err, ErrNoIdentDecoder) {
+		t.Errorf("expected ErrNoIdentDecoder, got %v", err)
+	}
+	if _, err := DecodeFrame(unknown[:IEHeaderSize+1]); !errors.Is(err, ErrShortPacket) {
+		t.Errorf("expected ErrShortPacket, got %v", err)
+	}
+}
+
+func TestDecodeRawFrame(t *testing.T) {
+	unknown := testFrame(testHost, testClient, 1, 7, []byte("XXhi"))
+	raw, err := DecodeRawFrame(unknown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.Ident != "XX" || string(raw.Data) != "hi" || raw.PlayerIDFrom != testHost || raw.FrameNum != 1 || raw.FrameExpected != 7 {
+		t.Errorf("unexpected raw frame: %s", raw)
+	}
+	if encoded, err := raw.Marshal(); err != nil || !bytes.Equal(encoded, unknown) {
+		t.Errorf("raw frame encoded differently: %v\n%x\n%x", err, unknown, encoded)
+	}
+	if _, err := DecodeRawFrame(unknown[:IEHeaderSize+1]); !errors.Is(err, ErrShortPacket) {
+		t.Errorf("expected ErrShortPacket, got %v", err)
+	}
+}
+
+// Everything we build is JM, and the ping is too short to have an ident
+func TestSeedIdents(t *testing.T) {
+	for name, frame := range seedJMPackets(t) {
+		ident, ok := FrameIdent(frame)
+		if name == "ping" {
+			if ok {
+				t.Errorf("ping has ident %q", ident)
+			}
+		} else if !ok || ident != "JM" {
+			t.Errorf("%s: ident %q", name, ident)
+		}
+	}
+}
+
+func TestRegisterIdent(t *testing.T) {
+	defer delete(idents, "ZZ")
+	RegisterIdent(IdentInfo{Ident: "ZZ", Name: "Test", Decode: func(frame []byte) (FrameMsg, error) {
+		return JM{Data: frame[IEHeaderSize+2:]}, nil
+	}})
+	if info, ok := LookupIdent("ZZ"); !ok || info.Name != "Test" {
+		t.Fatalf("ZZ wasn't registered: %+v", info)
+	}
+	msg, err := DecodeFrame(testFrame(testHost, testClient, 1, 0, []byte("ZZhi")))
+	if err != nil || string(msg.(JM).Data) != "hi" {
+		t.Errorf("ZZ decoder wasn't used: %v %v", msg, err)
+	}
+}
+
+func TestIdentCounter(t *testing.T) {
+	counter := NewIdentCounter()
+	jm, _ := NewJMMessage(IEHeader{}, false, 0, 0, []byte("hi"))
+	frame, _ := jm.Marshal()
+	for i := 0; i < 3; i++ {
+		_, err := DecodeFrame(frame)
+		counter.Observe(frame, err)
+	}
+	unknown := testFrame(testHost, testClient, 1, 0, []byte("XXhi"))
+	_, err := DecodeFrame(unknown)
+	counter.Observe(unknown, err)
+	counter.Observe(frame, &PacketError{ErrFragment, "Unknown2", 1, 2})
+	counter.Observe(frame, &PacketError{ErrLengthMismatch, "PacketLen", 1, 2})
+	counter.Observe(unknown[:IEHeaderSize], nil)
+
+	stats := counter.Stats()
+	if len(stats) != 2 || stats[0].Ident != "JM" || stats[1].Ident != "XX" {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+	if stats[0].Frames != 5 || stats[0].Fragments != 1 || stats[0].Failed != 1 || stats[0].Undecoded != 0 {
+		t.Errorf("unexpected JM stats: %s", stats[0])
+	}
+	if stats[1].Frames != 1 || stats[1].Undecoded != 1 || stats[1].Bytes != 4 {
+		t.Errorf("unexpected XX stats: %s", stats[1])
+	}
+	frames, totalFrames, bytes, totalBytes := counter.Undecoded()
+	if frames != 1 || totalFrames != 6 || bytes != 4 || totalBytes != 4+5*(len(frame)-IEHeaderSize) {
+		t.Errorf("unexpected undecoded share: %d/%d frames %d/%d bytes", frames, totalFrames, bytes, totalBytes)
+	}
+}
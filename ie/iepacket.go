@@ -9,12 +9,6 @@ import (
 	"strconv"
 )
 
-func specMsgSubtypeToString(msgSubType uint8) string {
-	switch msgSubType {
-	}
-	return "UNKNOWN"
-}
-
 type IEHeader struct {
 	PlayerIDFrom  uint32
 	PlayerIDTo    uint32 //Server seems to be 0001 //
@@ -47,59 +41,127 @@ type JMPacket interface {
 	PacketLength() uint16
 	DataLength() int
 	PacketData() []byte
+	Marshal() ([]byte, error)
 }
 
+var (
+	ErrShortPacket      = errors.New("packet too short")
+	ErrNotJM            = errors.New("not a JM packet")
+	ErrLengthMismatch   = errors.New("PacketLen doesn't match the packet size")
+	ErrDecompressedSize = errors.New("bad decompressed size")
+)
+
+// The largest DecompressedSize we'll believe. FULLSET and character data are the biggest things we've seen, and
+// they're nowhere near this.
+const MaxDecompressedSize uint32 = 1 << 20
+
+// PacketError says which part of a packet failed validation. Use errors.Is with the Err* values to check the kind.
+type PacketError struct {
+	Kind  error
+	Field string
+	Want  int
+	Have  int
+}
+
+func (err *PacketError) Error() string {
+	return fmt.Sprintf("ERROR: %s: %s (want %d, have %d)", err.Field, err.Kind.Error(), err.Want, err.Have)
+}
+
+func (err *PacketError) Unwrap() error {
+	return err.Kind
+}
+
+// NewJMPacket decodes the first size bytes of data. Everything is checked before it's read, so a bad packet only
+// ever produces a *PacketError.
 func NewJMPacket(data []byte, size int) (JMPacket, error) {
+	if size < 0 || size > len(data) {
+		return nil, &PacketError{ErrShortPacket, "data", size, len(data)}
+	}
+	data = data[:size]
+	if size < JMHeaderSize {
+		// Pings are just an IEHeader and end up here
+		return nil, &PacketError{ErrShortPacket, "JMHeader", JMHeaderSize, size}
+	}
 	var jmHeader JMHeader
 	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &jmHeader); err != nil {
 		return nil, errors.New("ERROR: JMHeader binary.Read failed: " + err.Error())
 	}
+	if jmHeader.JM != [2]byte{'J', 'M'} {
+		return nil, &PacketError{ErrNotJM, "JMHeader", int('J')<<8 | int('M'), int(jmHeader.JM[0])<<8 | int(jmHeader.JM[1])}
+	}
+	// PacketLen counts everything after the JMHeader
+	if int(jmHeader.PacketLen) != size-JMHeaderSize {
+		return nil, &PacketError{ErrLengthMismatch, "PacketLen", int(jmHeader.PacketLen), size - JMHeaderSize}
+	}
+
+	// A fragment only has part of a message. It has to go through a Reassembler first.
+	if jmHeader.Unknown2 > 1 {
+		return nil, &PacketError{ErrFragment, "Unknown2", 1, int(jmHeader.Unknown2)}
+	}
 
-	if data[JMHeaderSize] == 0xff {
+	isSpec := size > JMHeaderSize && data[JMHeaderSize] == 0xff
+	if isSpec {
 		if jmHeader.Compressed == 1 {
+			if size < JMSpecHeaderCompressedSize {
+				return nil, &PacketError{ErrShortPacket, "JMSpecHeaderCompressed", JMSpecHeaderCompressedSize, size}
+			}
 			var jmSpecHeaderCompressed JMSpecHeaderCompressed
 			if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &jmSpecHeaderCompressed); err != nil {
 				return nil, errors.New("ERROR: JMSpecHeaderCompressed binary.Read failed: " + err.Error())
 			}
-			jmSpecCompressed := JMSpecCompressed{jmSpecHeaderCompressed, []byte{}}
-			jmSpecCompressed.Data = append(data[JMSpecHeaderCompressedSize:size])
+			if err := checkDecompressedSize(jmSpecHeaderCompressed.DecompressedSize_, size-JMSpecHeaderCompressedSize); err != nil {
+				return nil, err
+			}
+			jmSpecCompressed := JMSpecCompressed{jmSpecHeaderCompressed, append([]byte{}, data[JMSpecHeaderCompressedSize:]...)}
 			return jmSpecCompressed, nil
 		} else {
+			if size < JMSpecHeaderSize {
+				return nil, &PacketError{ErrShortPacket, "JMSpecHeader", JMSpecHeaderSize, size}
+			}
 			var jmSpecHeader JMSpecHeader
 			if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &jmSpecHeader); err != nil {
 				return nil, errors.New("ERROR: JMSpecHeader binary.Read failed: " + err.Error())
 			}
-			jmSpec := JMSpec{jmSpecHeader, []byte{}}
-			if JMSpecHeaderSize > size {
-				return nil, errors.New("ERROR: JMSpecHeaderSize > size")
-			}
-			jmSpec.Data = append(data[JMSpecHeaderSize:size])
+			jmSpec := JMSpec{jmSpecHeader, append([]byte{}, data[JMSpecHeaderSize:]...)}
 			return jmSpec, nil
 		}
 	} else {
 		if jmHeader.Compressed == 1 {
+			if size < JMHeaderCompressedSize {
+				return nil, &PacketError{ErrShortPacket, "JMHeaderCompressed", JMHeaderCompressedSize, size}
+			}
 			var jmHeaderCompressed JMHeaderCompressed
 			if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &jmHeaderCompressed); err != nil {
 				return nil, errors.New("ERROR: JMHeaderCompressed binary.Read failed: " + err.Error())
 			}
-			jmCompressed := JMCompressed{jmHeaderCompressed, []byte{}}
-			jmCompressed.Data = append(data[JMHeaderCompressedSize:size])
+			if err := checkDecompressedSize(jmHeaderCompressed.DecompressedSize_, size-JMHeaderCompressedSize); err != nil {
+				return nil, err
+			}
+			jmCompressed := JMCompressed{jmHeaderCompressed, append([]byte{}, data[JMHeaderCompressedSize:]...)}
 			return jmCompressed, nil
 		} else {
-			jm := JM{jmHeader, []byte{}}
-			jm.Data = append(data[JMHeaderSize:size])
+			jm := JM{jmHeader, append([]byte{}, data[JMHeaderSize:]...)}
 			return jm, nil
 		}
 	}
+}
 
-	return nil, errors.New("ERROR: Not a known JM Packet type")
+// Even an empty zlib stream has a header, so there has to be compressed data if anything is meant to come out of it
+func checkDecompressedSize(decompressedSize uint32, compressedSize int) error {
+	if decompressedSize > MaxDecompressedSize {
+		return &PacketError{ErrDecompressedSize, "DecompressedSize", int(MaxDecompressedSize), int(decompressedSize)}
+	}
+	if decompressedSize > 0 && compressedSize == 0 {
+		return &PacketError{ErrDecompressedSize, "DecompressedSize", compressedSize, int(decompressedSize)}
+	}
+	return nil
 }
 
 type JMHeader struct {
 	IEHeader
 	JM        [2]byte
-	Unknown1  uint8 // 00
-	Unknown2  uint8 // 01
+	Unknown1  uint8 // 00, the fragment index if we've got fragments right
+	Unknown2  uint8 // 01, the fragment count if we've got fragments right
 	PacketLen uint16
 }
 
@@ -243,7 +305,7 @@ type JMSpecCompressed struct {
 }
 
 func (jmSpecCompressed JMSpecCompressed) String() string {
-	specType, specSubType := specMsgTypeToString(jmSpecCompressed.SpecMsgType, jmSpecCompressed.SpecMsgSubtype)
+	specType, specSubType := SpecMsgNames(jmSpecCompressed.SpecMsgType, jmSpecCompressed.SpecMsgSubtype)
 	return fmt.Sprintf("IEHead PlayerFrom: 0x%x PlayerTo: 0x%x FrameKind: 0x%x FrameNumber: 0x%x FrameExpected: 0x%x Compressed?: 0x%x CRC32: 0x%x - %c%c Unk1: 0x%x Unk2: 0x%x Len: %d SpecMsgFlag: 0x%x SpecMsgType: %s (%d) SpecMsgSubtype: %s (%d) DecompressedSize: 0x%x", jmSpecCompressed.PlayerIDFrom, jmSpecCompressed.PlayerIDTo, jmSpecCompressed.FrameKind_, jmSpecCompressed.FrameNum, jmSpecCompressed.FrameExpected, jmSpecCompressed.Compressed, jmSpecCompressed.CRC32, jmSpecCompressed.JM[0], jmSpecCompressed.JM[1], jmSpecCompressed.Unknown1, jmSpecCompressed.Unknown2, jmSpecCompressed.PacketLen, jmSpecCompressed.SpecMsgFlag, specType, jmSpecCompressed.SpecMsgType, specSubType, jmSpecCompressed.SpecMsgSubtype, jmSpecCompressed.DecompressedSize_)
 }
 
@@ -312,7 +374,7 @@ type JMSpec struct {
 }
 
 func (jmSpec JMSpec) String() string {
-	specType, specSubType := specMsgTypeToString(jmSpec.SpecMsgType, jmSpec.SpecMsgSubtype)
+	specType, specSubType := SpecMsgNames(jmSpec.SpecMsgType, jmSpec.SpecMsgSubtype)
 	return fmt.Sprintf("IEHead PlayerFrom: 0x%x PlayerTo: 0x%x FrameKind: 0x%x FrameNumber: 0x%x FrameExpected: 0x%x Compressed?: 0x%x CRC32: 0x%x - %c%c Unk1: 0x%x Unk2: 0x%x Len: %d SpecMsgFlag: 0x%x SpecMsgType: %s (%d) SpecMsgSubtype: %s (%d)", jmSpec.PlayerIDFrom, jmSpec.PlayerIDTo, jmSpec.FrameKind_, jmSpec.FrameNum, jmSpec.FrameExpected, jmSpec.Compressed, jmSpec.CRC32, jmSpec.JM[0], jmSpec.JM[1], jmSpec.Unknown1, jmSpec.Unknown2, jmSpec.PacketLen, jmSpec.SpecMsgFlag, specType, jmSpec.SpecMsgType, specSubType, jmSpec.SpecMsgSubtype)
 }
 
@@ -425,6 +487,9 @@ func (jm JM) PacketData() []byte {
 	return jm.Data
 }
 
+// A 255 byte message would start with 0xff and be taken for a spec message
+const MaxIEMsgLength int = 254
+
 type IEMsg struct {
 	MessageLength uint8
 	Message       string
@@ -434,6 +499,17 @@ func (iemsg IEMsg) String() string {
 	return iemsg.Message
 }
 
+// ParseIEMsg decodes the payload of a non-spec JM packet, after decompression
+func ParseIEMsg(data []byte) (IEMsg, error) {
+	if len(data) < 1 {
+		return IEMsg{}, &PacketError{ErrShortPacket, "IEMsg", 1, len(data)}
+	}
+	if int(data[0]) > len(data)-1 {
+		return IEMsg{}, &PacketError{ErrLengthMismatch, "MessageLength", int(data[0]), len(data) - 1}
+	}
+	return IEMsg{MessageLength: data[0], Message: string(data[1 : 1+int(data[0])])}, nil
+}
+
 type IEMsgDecompressed struct {
 	JMHeaderCompressed
 	IEMsg
@@ -448,62 +524,12 @@ func (iemsg IEMsgPacket) String() string {
 	return iemsg.Message
 }
 
+// Serialize encodes the message as a JM packet. PacketLen and the CRC are filled in.
 func (iemsg IEMsgPacket) Serialize() ([]byte, error) {
-	var serialbuf []byte
-	var err error
-	serialbuf, err = binary.Append(serialbuf, binary.BigEndian, iemsg.PlayerIDFrom)
-	if err != nil {
-		return nil, err
-	}
-	serialbuf, err = binary.Append(serialbuf, binary.BigEndian, iemsg.PlayerIDTo)
-	if err != nil {
-		return nil, err
+	if len(iemsg.Message) > MaxIEMsgLength {
+		return nil, &PacketError{ErrPacketTooLarge, "Message", MaxIEMsgLength, len(iemsg.Message)}
 	}
-	serialbuf, err = binary.Append(serialbuf, binary.BigEndian, iemsg.FrameKind)
-	if err != nil {
-		return nil, err
-	}
-	serialbuf, err = binary.Append(serialbuf, binary.BigEndian, iemsg.FrameNumber)
-	if err != nil {
-		return nil, err
-	}
-	serialbuf, err = binary.Append(serialbuf, binary.BigEndian, iemsg.FrameExpected)
-	if err != nil {
-		return nil, err
-	}
-	serialbuf, err = binary.Append(serialbuf, binary.BigEndian, iemsg.Compressed)
-	if err != nil {
-		return nil, err
-	}
-	serialbuf, err = binary.Append(serialbuf, binary.BigEndian, iemsg.CRC32)
-	if err != nil {
-		return nil, err
-	}
-	serialbuf, err = binary.Append(serialbuf, binary.BigEndian, iemsg.JM)
-	if err != nil {
-		return nil, err
-	}
-	serialbuf, err = binary.Append(serialbuf, binary.BigEndian, iemsg.Unknown1)
-	if err != nil {
-		return nil, err
-	}
-	serialbuf, err = binary.Append(serialbuf, binary.BigEndian, iemsg.Unknown2)
-	if err != nil {
-		return nil, err
-	}
-	serialbuf, err = binary.Append(serialbuf, binary.BigEndian, iemsg.PacketLength)
-	if err != nil {
-		return nil, err
-	}
-	serialbuf, err = binary.Append(serialbuf, binary.BigEndian, iemsg.MessageLength)
-	if err != nil {
-		return nil, err
-	}
-	serialbuf, err = binary.Append(serialbuf, binary.BigEndian, []byte(iemsg.Message))
-	if err != nil {
-		return nil, err
-	}
-	return serialbuf, nil
+	return JM{iemsg.JMHeader, append([]byte{iemsg.MessageLength}, iemsg.Message...)}.Marshal()
 }
 
 const IE_SPEC_MSG_TYPE_VERSION uint8 = 86
@@ -521,6 +547,7 @@ type IEVersion struct {
 	IEVersionHeader
 	VersionString string
 	IEVersionFooter
+	Rest []byte
 }
 
 func (ieVersion IEVersion) String() string {
@@ -534,6 +561,24 @@ type IEVersionFooter struct {
 
 const IEVersionFooterSize int = 5
 
+func (ieVersion *IEVersion) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEVersion", data)
+	reader.read("IEVersionHeader", &ieVersion.IEVersionHeader)
+	ieVersion.VersionString = string(reader.take("VersionString", int(ieVersion.VersionStringLen)))
+	reader.read("IEVersionFooter", &ieVersion.IEVersionFooter)
+	ieVersion.Rest = reader.rest()
+	return reader.err
+}
+
+// Marshal sets VersionStringLen from VersionString
+func (ieVersion IEVersion) Marshal() ([]byte, error) {
+	if len(ieVersion.VersionString) > 0xff {
+		return nil, &PacketError{ErrPacketTooLarge, "VersionString", 0xff, len(ieVersion.VersionString)}
+	}
+	ieVersion.VersionStringLen = uint8(len(ieVersion.VersionString))
+	return marshalSpecFields(ieVersion.IEVersionHeader, []byte(ieVersion.VersionString), ieVersion.IEVersionFooter, ieVersion.Rest)
+}
+
 const IE_SPEC_MSG_TYPE_MPSETTINGS uint8 = 77
 const IE_SPEC_MSG_SUBTYPE_TOGGLE_CHAR_READY uint8 = 114
 
@@ -545,6 +590,16 @@ type IEMPSettingsToggleCharReady struct {
 
 const IEMPSettingsToggleCharReadySize int = 5
 
+func (charReady *IEMPSettingsToggleCharReady) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEMPSettingsToggleCharReady", data)
+	reader.read("IEMPSettingsToggleCharReady", charReady)
+	return reader.done()
+}
+
+func (charReady IEMPSettingsToggleCharReady) Marshal() ([]byte, error) {
+	return marshalSpecFields(charReady)
+}
+
 func (charReady IEMPSettingsToggleCharReady) String() string {
 	if charReady.ReadyStatus == 0 {
 		return "Character " + strconv.Itoa(int(charReady.CharacterNum)) + " is not ready."
@@ -556,175 +611,104 @@ func (charReady IEMPSettingsToggleCharReady) String() string {
 
 const IE_SPEC_MSG_SUBTYPE_UPDATE_SERVER_ARBITRATION_INFO uint8 = 83
 
-type IEMPSettingsFullSet struct {
-	Unknown1                    [2]byte
-	DefaultPermBuyAndSell       uint8
-	DefaultPermTravel           uint8
-	DefaultPermDialog           uint8
-	DefaultPermViewCharacters   uint8
-	DefaultPermPause            uint8
-	DefaultPermHasBeenLeaderIsh uint8
-	DefaultPermLeader           uint8
-	DefaultPermModifyCharacters uint8
-	Unknown2                    [20]byte
-	Player1ID                   uint32
-	Player1PermBuyAndSell       uint8
-	Player1PermTravel           uint8
-	Player1PermDialog           uint8
-	Player1PermViewCharacters   uint8
-	Player1PermPause            uint8
-	Player1PermHasBeenLeaderIsh uint8
-	Player1PermLeader           uint8
-	Player1PermModifyCharacters uint8
-	Unknown3                    [89]byte
-	CharIsReady                 [6]uint8
-	Unknown4                    [6]byte
-	CharOwnerPlayerID           [6]uint32
-	ImportCharSettings          uint8
-	RestrictStores              uint8
-	ListenToJoinRequests        uint8
-	Unknown5                    [29]byte
+// Permissions are one byte each, 0 for no and 1 for yes
+type Permissions struct {
+	BuyAndSell       uint8
+	Travel           uint8
+	Dialog           uint8
+	ViewCharacters   uint8
+	Pause            uint8
+	HasBeenLeaderIsh uint8
+	Leader           uint8
+	ModifyCharacters uint8
 }
 
-const IEMPSettingsFullSetSize int = 199
-
-func (charArbServStatus IEMPSettingsFullSet) String() string {
-	ret := "Unk1: " + hex.EncodeToString(charArbServStatus.Unknown1[:])
-
-	ret += "\nDefaultPerms:"
-
-	if charArbServStatus.DefaultPermBuyAndSell == 0 {
-		ret += "\n\tBuyAndSell: no"
-	} else if charArbServStatus.DefaultPermBuyAndSell == 1 {
-		ret += "\n\tBuyAndSell: yes"
-	} else {
-		ret += fmt.Sprintf("\n\tBuyAndSell: yes? 0x%x", charArbServStatus.DefaultPermBuyAndSell)
-	}
-
-	if charArbServStatus.DefaultPermTravel == 0 {
-		ret += "\n\tTravel: no"
-	} else if charArbServStatus.DefaultPermTravel == 1 {
-		ret += "\n\tTravel: yes"
-	} else {
-		ret += fmt.Sprintf("\n\tTravel: yes? 0x%x", charArbServStatus.DefaultPermTravel)
-	}
-
-	if charArbServStatus.DefaultPermDialog == 0 {
-		ret += "\n\tDialog: no"
-	} else if charArbServStatus.DefaultPermDialog == 1 {
-		ret += "\n\tDialog: yes"
-	} else {
-		ret += fmt.Sprintf("\n\tDialog: yes? 0x%x", charArbServStatus.DefaultPermDialog)
-	}
-
-	if charArbServStatus.DefaultPermViewCharacters == 0 {
-		ret += "\n\tView Characters: no"
-	} else if charArbServStatus.DefaultPermViewCharacters == 1 {
-		ret += "\n\tView Characters: yes"
-	} else {
-		ret += fmt.Sprintf("\n\tView Characters: yes? 0x%x", charArbServStatus.DefaultPermViewCharacters)
-	}
+const PermissionsSize int = 8
 
-	if charArbServStatus.DefaultPermPause == 0 {
-		ret += "\n\tPause: no"
-	} else if charArbServStatus.DefaultPermPause == 1 {
-		ret += "\n\tPause: yes"
-	} else {
-		ret += fmt.Sprintf("\n\tPause: yes? 0x%x", charArbServStatus.DefaultPermPause)
-	}
+var permissionNames = [PermissionsSize]string{"BuyAndSell", "Travel", "Dialog", "View Characters", "Pause", "Maybe 'HasBeenLeader'", "Leader", "Modify Characters"}
 
-	if charArbServStatus.DefaultPermHasBeenLeaderIsh == 0 {
-		ret += "\n\tMaybe 'HasBeenLeader': no"
-	} else if charArbServStatus.DefaultPermHasBeenLeaderIsh == 1 {
-		ret += "\n\tMaybe 'HasBeenLeader': yes"
-	} else {
-		ret += fmt.Sprintf("\n\tMaybe 'HasBeenLeader': yes? 0x%x", charArbServStatus.DefaultPermHasBeenLeaderIsh)
-	}
+func (permissions *Permissions) fields() [PermissionsSize]*uint8 {
+	return [PermissionsSize]*uint8{&permissions.BuyAndSell, &permissions.Travel, &permissions.Dialog, &permissions.ViewCharacters, &permissions.Pause, &permissions.HasBeenLeaderIsh, &permissions.Leader, &permissions.ModifyCharacters}
+}
 
-	if charArbServStatus.DefaultPermLeader == 0 {
-		ret += "\n\tLeader: no"
-	} else if charArbServStatus.DefaultPermLeader == 1 {
-		ret += "\n\tLeader: yes"
-	} else {
-		ret += fmt.Sprintf("\n\tLeader: yes? 0x%x", charArbServStatus.DefaultPermLeader)
+// Set changes a permission by its index in the struct, returning false if there's no such permission
+func (permissions *Permissions) Set(permission int, value uint8) bool {
+	if permission < 0 || permission >= PermissionsSize {
+		return false
 	}
+	*permissions.fields()[permission] = value
+	return true
+}
 
-	if charArbServStatus.DefaultPermModifyCharacters == 0 {
-		ret += "\n\tModify Characters: no"
-	} else if charArbServStatus.DefaultPermModifyCharacters == 1 {
-		ret += "\n\tModify Characters: yes"
-	} else {
-		ret += fmt.Sprintf("\n\tModify Characters: yes? 0x%x", charArbServStatus.DefaultPermModifyCharacters)
+func (permissions Permissions) String() string {
+	ret := ""
+	for i, value := range permissions.fields() {
+		if *value == 0 {
+			ret += "\n\t" + permissionNames[i] + ": no"
+		} else if *value == 1 {
+			ret += "\n\t" + permissionNames[i] + ": yes"
+		} else {
+			ret += fmt.Sprintf("\n\t%s: yes? 0x%x", permissionNames[i], *value)
+		}
 	}
+	return ret
+}
 
-	ret += "\nUnk2: " + hex.EncodeToString(charArbServStatus.Unknown2[:])
-
-	ret += fmt.Sprintf("\nPlayer1Perms (0x%x):", charArbServStatus.Player1ID)
-
-	if charArbServStatus.Player1PermBuyAndSell == 0 {
-		ret += "\n\tBuyAndSell: no"
-	} else if charArbServStatus.Player1PermBuyAndSell == 1 {
-		ret += "\n\tBuyAndSell: yes"
-	} else {
-		ret += fmt.Sprintf("\n\tBuyAndSell: yes? 0x%x", charArbServStatus.Player1PermBuyAndSell)
-	}
+type PlayerPermissions struct {
+	PlayerID uint32
+	Permissions
+}
 
-	if charArbServStatus.Player1PermTravel == 0 {
-		ret += "\n\tTravel: no"
-	} else if charArbServStatus.Player1PermTravel == 1 {
-		ret += "\n\tTravel: yes"
-	} else {
-		ret += fmt.Sprintf("\n\tTravel: yes? 0x%x", charArbServStatus.Player1PermTravel)
-	}
+const PlayerPermissionsSize int = 12
 
-	if charArbServStatus.Player1PermDialog == 0 {
-		ret += "\n\tDialog: no"
-	} else if charArbServStatus.Player1PermDialog == 1 {
-		ret += "\n\tDialog: yes"
-	} else {
-		ret += fmt.Sprintf("\n\tDialog: yes? 0x%x", charArbServStatus.Player1PermDialog)
-	}
+// FULLSET has room for six players, the most a session can have. Unused entries are all zeros.
+type IEMPSettingsFullSet struct {
+	Unknown1             [2]byte
+	DefaultPermissions   Permissions
+	Unknown2             [20]byte
+	Players              [6]PlayerPermissions
+	Unknown3             [29]byte
+	CharIsReady          [6]uint8
+	Unknown4             [6]byte
+	CharOwnerPlayerID    [6]uint32
+	ImportCharSettings   uint8
+	RestrictStores       uint8
+	ListenToJoinRequests uint8
+	Unknown5             [29]byte
+}
 
-	if charArbServStatus.Player1PermViewCharacters == 0 {
-		ret += "\n\tView Characters: no"
-	} else if charArbServStatus.Player1PermViewCharacters == 1 {
-		ret += "\n\tView Characters: yes"
-	} else {
-		ret += fmt.Sprintf("\n\tView Characters: yes? 0x%x", charArbServStatus.Player1PermViewCharacters)
-	}
+const IEMPSettingsFullSetSize int = 199
 
-	if charArbServStatus.Player1PermPause == 0 {
-		ret += "\n\tPause: no"
-	} else if charArbServStatus.Player1PermPause == 1 {
-		ret += "\n\tPause: yes"
-	} else {
-		ret += fmt.Sprintf("\n\tPause: yes? 0x%x", charArbServStatus.Player1PermPause)
+// Player returns the permissions for a player so they can be changed, or nil if the player isn't in the set
+func (charArbServStatus *IEMPSettingsFullSet) Player(playerID uint32) *PlayerPermissions {
+	for i := range charArbServStatus.Players {
+		if charArbServStatus.Players[i].PlayerID == playerID {
+			return &charArbServStatus.Players[i]
+		}
 	}
+	return nil
+}
 
-	if charArbServStatus.Player1PermHasBeenLeaderIsh == 0 {
-		ret += "\n\tMaybe 'HasBeenLeader': no"
-	} else if charArbServStatus.Player1PermHasBeenLeaderIsh == 1 {
-		ret += "\n\tMaybe 'HasBeenLeader': yes"
-	} else {
-		ret += fmt.Sprintf("\n\tMaybe 'HasBeenLeader': yes? 0x%x", charArbServStatus.Player1PermHasBeenLeaderIsh)
-	}
+func (charArbServStatus *IEMPSettingsFullSet) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEMPSettingsFullSet", data)
+	reader.read("IEMPSettingsFullSet", charArbServStatus)
+	return reader.done()
+}
 
-	if charArbServStatus.Player1PermLeader == 0 {
-		ret += "\n\tLeader: no"
-	} else if charArbServStatus.Player1PermLeader == 1 {
-		ret += "\n\tLeader: yes"
-	} else {
-		ret += fmt.Sprintf("\n\tLeader: yes? 0x%x", charArbServStatus.Player1PermLeader)
-	}
+func (charArbServStatus IEMPSettingsFullSet) Marshal() ([]byte, error) {
+	return marshalSpecFields(charArbServStatus)
+}
 
-	if charArbServStatus.Player1PermModifyCharacters == 0 {
-		ret += "\n\tModify Characters: no"
-	} else if charArbServStatus.Player1PermModifyCharacters == 1 {
-		ret += "\n\tModify Characters: yes"
-	} else {
-		ret += fmt.Sprintf("\n\tModify Characters: yes? 0x%x", charArbServStatus.Player1PermModifyCharacters)
+func (charArbServStatus IEMPSettingsFullSet) String() string {
+	ret := "Unk1: " + hex.EncodeToString(charArbServStatus.Unknown1[:])
+	ret += "\nDefaultPerms:" + charArbServStatus.DefaultPermissions.String()
+	ret += "\nUnk2: " + hex.EncodeToString(charArbServStatus.Unknown2[:])
+	for k, player := range charArbServStatus.Players {
+		if player == (PlayerPermissions{}) {
+			continue
+		}
+		ret += fmt.Sprintf("\nPlayer%dPerms (0x%x):", k+1, player.PlayerID) + player.Permissions.String()
 	}
-
 	ret += "\nUnk3: " + hex.EncodeToString(charArbServStatus.Unknown3[:])
 
 	for k, v := range charArbServStatus.CharIsReady {
@@ -771,515 +755,3 @@ func (charArbServStatus IEMPSettingsFullSet) String() string {
 	ret += "\nUnk5: " + hex.EncodeToString(charArbServStatus.Unknown5[:])
 	return ret
 }
-
-func specMsgTypeToString(msgType, msgSubType uint8) (string, string) {
-	switch msgType {
-	case 66:
-		msgTypeStr := "PROGRESSBAR"
-		switch msgSubType {
-		case 83:
-			msgSubTypeStr := "PROGRESSBAR_STATUS"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 67:
-		msgTypeStr := "CMESSAGE"
-		switch msgSubType {
-		case 0:
-			msgSubTypeStr := "CMESSAGE_ADD_ACTION"
-			return msgTypeStr, msgSubTypeStr
-		case 1:
-			msgSubTypeStr := "CMESSAGE_ADD_EFFECT"
-			return msgTypeStr, msgSubTypeStr
-		case 3:
-			msgSubTypeStr := "CMESSAGE_ANIMATION_CHANGE"
-			return msgTypeStr, msgSubTypeStr
-		case 4:
-			msgSubTypeStr := "CMESSAGE_CHANGE_DIRECTION"
-			return msgTypeStr, msgSubTypeStr
-		case 5:
-			msgSubTypeStr := "CMESSAGE_CLEAR_ACTIONS"
-			return msgTypeStr, msgSubTypeStr
-		case 6:
-			msgSubTypeStr := "CMESSAGE_CLEAR_DIALOG_ACTIONS"
-			return msgTypeStr, msgSubTypeStr
-		case 7:
-			msgSubTypeStr := "CMESSAGE_CLEAR_GROUP_SLOT"
-			return msgTypeStr, msgSubTypeStr
-		case 8:
-			msgSubTypeStr := "CMESSAGE_CLEAR_TRIGGERS"
-			return msgTypeStr, msgSubTypeStr
-		case 9:
-			msgSubTypeStr := "CMESSAGE_COLOR_CHANGE"
-			return msgTypeStr, msgSubTypeStr
-		case 10:
-			msgSubTypeStr := "CMESSAGE_COLOR_RESET"
-			return msgTypeStr, msgSubTypeStr
-		case 11:
-			msgSubTypeStr := "CMESSAGE_COLOR_UPDATE"
-			return msgTypeStr, msgSubTypeStr
-		case 12:
-			msgSubTypeStr := "CMESSAGE_CONTAINER_ADD_ITEM"
-			return msgTypeStr, msgSubTypeStr
-		case 13:
-			msgSubTypeStr := "CMESSAGE_CONTAINER_ITEMS"
-			return msgTypeStr, msgSubTypeStr
-		case 14:
-			msgSubTypeStr := "CMESSAGE_CONTAINER_STATUS"
-			return msgTypeStr, msgSubTypeStr
-		case 15:
-			msgSubTypeStr := "CMESSAGE_CUT_SCENE_MODE_STATUS"
-			return msgTypeStr, msgSubTypeStr
-		case 16:
-			msgSubTypeStr := "CMESSAGE_DISPLAY_TEXT"
-			return msgTypeStr, msgSubTypeStr
-		case 17:
-			msgSubTypeStr := "CMESSAGE_DISPLAY_TEXTREF"
-			return msgTypeStr, msgSubTypeStr
-		case 19:
-			msgSubTypeStr := "CMESSAGE_DOOR_STATUS"
-			return msgTypeStr, msgSubTypeStr
-		case 20:
-			msgSubTypeStr := "CMESSAGE_DROP_PATH"
-			return msgTypeStr, msgSubTypeStr
-		case 21:
-			msgSubTypeStr := "CMESSAGE_ENTER_DIALOG"
-			return msgTypeStr, msgSubTypeStr
-		case 23:
-			msgSubTypeStr := "CMESSAGE_ENTER_STORE_MODE"
-			return msgTypeStr, msgSubTypeStr
-		case 24:
-			msgSubTypeStr := "CMESSAGE_EXIT_DIALOG_MODE"
-			return msgTypeStr, msgSubTypeStr
-		case 25:
-			msgSubTypeStr := "CMESSAGE_EXIT_STORE_MODE"
-			return msgTypeStr, msgSubTypeStr
-		case 26:
-			msgSubTypeStr := "CMESSAGE_FIRE_PROJECTILE"
-			return msgTypeStr, msgSubTypeStr
-		case 27:
-			msgSubTypeStr := "CMESSAGE_INSERT_ACTION"
-			return msgTypeStr, msgSubTypeStr
-		case 29:
-			msgSubTypeStr := "CMESSAGE_LEAVE_PARTY"
-			return msgTypeStr, msgSubTypeStr
-		case 31:
-			msgSubTypeStr := "CMESSAGE_PARTY_GOLD"
-			return msgTypeStr, msgSubTypeStr
-		case 32:
-			msgSubTypeStr := "CMESSAGE_PLAY_SOUND"
-			return msgTypeStr, msgSubTypeStr
-		case 33:
-			msgSubTypeStr := "CMESSAGE_PLAY_SOUND_REF"
-			return msgTypeStr, msgSubTypeStr
-		case 35:
-			msgSubTypeStr := "CMESSAGE_REMOVE_REPLIES"
-			return msgTypeStr, msgSubTypeStr
-		case 36:
-			msgSubTypeStr := "CMESSAGE_REPUTATION_CHANGE"
-			return msgTypeStr, msgSubTypeStr
-		case 37:
-			msgSubTypeStr := "CMESSAGE_SET_ACTIVE"
-			return msgTypeStr, msgSubTypeStr
-		case 38:
-			msgSubTypeStr := "CMESSAGE_SET_AISPEED"
-			return msgTypeStr, msgSubTypeStr
-		case 39:
-			msgSubTypeStr := "CMESSAGE_SET_COMMAND_PAUSE"
-			return msgTypeStr, msgSubTypeStr
-		case 40:
-			msgSubTypeStr := "CMESSAGE_SET_DIALOG_WAIT"
-			return msgTypeStr, msgSubTypeStr
-		case 41:
-			msgSubTypeStr := "CMESSAGE_SET_DIRECTION"
-			return msgTypeStr, msgSubTypeStr
-		case 42:
-			msgSubTypeStr := "CMESSAGE_SET_DRAW_POLY"
-			return msgTypeStr, msgSubTypeStr
-		case 43:
-			msgSubTypeStr := "CMESSAGE_SET_FORCE_ACTION_PICK"
-			return msgTypeStr, msgSubTypeStr
-		case 44:
-			msgSubTypeStr := "CMESSAGE_SET_HAPPINESS"
-			return msgTypeStr, msgSubTypeStr
-		case 45:
-			msgSubTypeStr := "CMESSAGE_SET_IN_CUT_SCENE"
-			return msgTypeStr, msgSubTypeStr
-		case 46:
-			msgSubTypeStr := "CMESSAGE_SET_LAST_ATTACKER"
-			return msgTypeStr, msgSubTypeStr
-		case 48:
-			msgSubTypeStr := "CMESSAGE_SET_NUM_TIMES_TALKED_TO"
-			return msgTypeStr, msgSubTypeStr
-		case 49:
-			msgSubTypeStr := "CMESSAGE_SET_PATH"
-			return msgTypeStr, msgSubTypeStr
-		case 50:
-			msgSubTypeStr := "CMESSAGE_SET_SEQUENCE"
-			return msgTypeStr, msgSubTypeStr
-		case 52:
-			msgSubTypeStr := "CMESSAGE_SET_TRIGGER"
-			return msgTypeStr, msgSubTypeStr
-		case 47:
-			msgSubTypeStr := "CMESSAGE_SET_LAST_OBJECT"
-			return msgTypeStr, msgSubTypeStr
-		case 54:
-			msgSubTypeStr := "CMESSAGE_SPRITE_DEATH"
-			return msgTypeStr, msgSubTypeStr
-		case 55:
-			msgSubTypeStr := "CMESSAGE_SPRITE_EQUIPMENT"
-			return msgTypeStr, msgSubTypeStr
-		case 56:
-			msgSubTypeStr := "CMESSAGE_SPRITE_PETRIFY"
-			return msgTypeStr, msgSubTypeStr
-		case 57:
-			msgSubTypeStr := "CMESSAGE_SPRITE_UPDATE"
-			return msgTypeStr, msgSubTypeStr
-		case 58:
-			msgSubTypeStr := "CMESSAGE_START_FOLLOW"
-			return msgTypeStr, msgSubTypeStr
-		case 59:
-			msgSubTypeStr := "CMESSAGE_START_SCROLL"
-			return msgTypeStr, msgSubTypeStr
-		case 60:
-			msgSubTypeStr := "CMESSAGE_STOP_ACTIONS"
-			return msgTypeStr, msgSubTypeStr
-		case 61:
-			msgSubTypeStr := "CMESSAGE_STOP_FOLLOW"
-			return msgTypeStr, msgSubTypeStr
-		case 62:
-			msgSubTypeStr := "CMESSAGE_TRIGGER_STATUS"
-			return msgTypeStr, msgSubTypeStr
-		case 63:
-			msgSubTypeStr := "CMESSAGE_UNLOCK"
-			return msgTypeStr, msgSubTypeStr
-		case 64:
-			msgSubTypeStr := "CMESSAGE_UPDATE_REACTION"
-			return msgTypeStr, msgSubTypeStr
-		case 65:
-			msgSubTypeStr := "CMESSAGE_VERBAL_CONSTANT"
-			return msgTypeStr, msgSubTypeStr
-		case 66:
-			msgSubTypeStr := "CMESSAGE_VISIBILITY_MAP_MOVE"
-			return msgTypeStr, msgSubTypeStr
-		case 67:
-			msgSubTypeStr := "CMESSAGE_VISUAL_EFFECT"
-			return msgTypeStr, msgSubTypeStr
-		case 68:
-			msgSubTypeStr := "CMESSAGE_SET_DIALOG_RESREF"
-			return msgTypeStr, msgSubTypeStr
-		case 69:
-			msgSubTypeStr := "CMESSAGE_ESCAPE_AREA"
-			return msgTypeStr, msgSubTypeStr
-		case 70:
-			msgSubTypeStr := "CMESSAGE_DISPLAY_TEXTREF_SEND"
-			return msgTypeStr, msgSubTypeStr
-		case 71:
-			msgSubTypeStr := "CMESSAGE_SET_CURRENT_ACTION_ID"
-			return msgTypeStr, msgSubTypeStr
-		case 72:
-			msgSubTypeStr := "CMESSAGE_MOVE_GLOBAL"
-			return msgTypeStr, msgSubTypeStr
-		case 73:
-			msgSubTypeStr := "CMESSAGE_FADE_COLOR"
-			return msgTypeStr, msgSubTypeStr
-		case 74:
-			msgSubTypeStr := "CMESSAGE_START_TEXT_SCREEN"
-			return msgTypeStr, msgSubTypeStr
-		case 75:
-			msgSubTypeStr := "CMESSAGE_SPAWNPT_ACTIVATE"
-			return msgTypeStr, msgSubTypeStr
-		case 76:
-			msgSubTypeStr := "CMESSAGE_SPAWNPT_SPAWN"
-			return msgTypeStr, msgSubTypeStr
-		case 77:
-			msgSubTypeStr := "CMESSAGE_STATIC_START"
-			return msgTypeStr, msgSubTypeStr
-		case 78:
-			msgSubTypeStr := "CMESSAGE_STORE_ADD_ITEM"
-			return msgTypeStr, msgSubTypeStr
-		case 79:
-			msgSubTypeStr := "CMESSAGE_STORE_REMOVE_ITEM"
-			return msgTypeStr, msgSubTypeStr
-		case 80:
-			msgSubTypeStr := "CMESSAGE_FAMILIAR_ADD"
-			return msgTypeStr, msgSubTypeStr
-		case 81:
-			msgSubTypeStr := "CMESSAGE_FAMILIAR_REMOVE_RESREF"
-			return msgTypeStr, msgSubTypeStr
-		case 82:
-			msgSubTypeStr := "CMESSAGE_STOP_ESCAPE_AREA"
-			return msgTypeStr, msgSubTypeStr
-		case 85:
-			msgSubTypeStr := "CMESSAGE_SET_TIME_STOP"
-			return msgTypeStr, msgSubTypeStr
-		case 87:
-			msgSubTypeStr := "CMESSAGE_STORE_RELEASE"
-			return msgTypeStr, msgSubTypeStr
-		case 90:
-			msgSubTypeStr := "CMESSAGE_90"
-			return msgTypeStr, msgSubTypeStr
-		case 91:
-			msgSubTypeStr := "CMESSAGE_FLOAT_TEXT"
-			return msgTypeStr, msgSubTypeStr
-		case 92:
-			msgSubTypeStr := "CMESSAGE_92"
-			return msgTypeStr, msgSubTypeStr
-		case 93:
-			msgSubTypeStr := "CMESSAGE_SET_PROTAGONIST"
-			return msgTypeStr, msgSubTypeStr
-		case 94:
-			msgSubTypeStr := "CMESSAGE_START_COMBAT_MUSIC"
-			return msgTypeStr, msgSubTypeStr
-		case 99:
-			msgSubTypeStr := "CMESSAGE_SCREENSHAKE"
-			return msgTypeStr, msgSubTypeStr
-		case 100:
-			msgSubTypeStr := "CMESSAGE_STORE_DEMAND"
-			return msgTypeStr, msgSubTypeStr
-		case 101:
-			msgSubTypeStr := "CMESSAGE_101"
-			return msgTypeStr, msgSubTypeStr
-		case 102:
-			msgSubTypeStr := "CMESSAGE_WEAPON_IMMUNITIES_UPDATE"
-			return msgTypeStr, msgSubTypeStr
-		case 103:
-			msgSubTypeStr := "CMESSAGE_103"
-			return msgTypeStr, msgSubTypeStr
-		case 106:
-			msgSubTypeStr := "CMESSAGE_TOGGLE_INTERFACE"
-			return msgTypeStr, msgSubTypeStr
-		case 107:
-			msgSubTypeStr := "CMESSAGE_107"
-			return msgTypeStr, msgSubTypeStr
-		case 109:
-			msgSubTypeStr := "CMESSAGE_SET_AREA_TYPE"
-			return msgTypeStr, msgSubTypeStr
-		case 110:
-			msgSubTypeStr := "CMESSAGE_SET_AREA_REST_ENCOUNTER"
-			return msgTypeStr, msgSubTypeStr
-		case 114:
-			msgSubTypeStr := "CMESSAGE_SET_AREA_EXPLORED"
-			return msgTypeStr, msgSubTypeStr
-		case 116:
-			msgSubTypeStr := "CMESSAGE_CHANGE_STAT"
-			return msgTypeStr, msgSubTypeStr
-		case 120:
-			msgSubTypeStr := "CMESSAGE_120"
-			return msgTypeStr, msgSubTypeStr
-		case 121:
-			msgSubTypeStr := "CMESSAGE_END_GAME"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 68:
-		msgTypeStr := "DIALOG"
-		switch msgSubType {
-		case 82:
-			msgSubTypeStr := "DIALOG_PERMIT_REQUEST"
-			return msgTypeStr, msgSubTypeStr
-		case 114:
-			msgSubTypeStr := "DIALOG_PERMIT_REPLY"
-			return msgTypeStr, msgSubTypeStr
-		case 67:
-			msgSubTypeStr := "DIALOG_CANCEL_REQUEST"
-			return msgTypeStr, msgSubTypeStr
-		case 75:
-			msgSubTypeStr := "DIALOG_KILL_OR_USE"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 73:
-		msgTypeStr := "SWAPITEM"
-		switch msgSubType {
-		case 82:
-			msgSubTypeStr := "SWAPITEM_REQUEST"
-			return msgTypeStr, msgSubTypeStr
-		case 114:
-			msgSubTypeStr := "SWAPITEM_REPLY"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 106:
-		msgTypeStr := "JOURNAL"
-		switch msgSubType {
-		case 69:
-			msgSubTypeStr := "JOURNAL_ADD_ENTRY"
-			return msgTypeStr, msgSubTypeStr
-		case 65:
-			msgSubTypeStr := "JOURNAL_ANNOUNCE"
-			return msgTypeStr, msgSubTypeStr
-		case 117:
-			msgSubTypeStr := "JOURNAL_ADD_USER_ENTRY"
-			return msgTypeStr, msgSubTypeStr
-		case 85:
-			msgSubTypeStr := "JOURNAL_ANNOUNCE_USER_ENTRY"
-			return msgTypeStr, msgSubTypeStr
-		case 99:
-			msgSubTypeStr := "JOURNAL_CHANGE_ENTRY"
-			return msgTypeStr, msgSubTypeStr
-		case 67:
-			msgSubTypeStr := "JOURNAL_ANNOUNCE_CHANGE"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 98:
-		msgTypeStr := "BIOGRAPHY"
-		switch msgSubType {
-		case 99:
-			msgSubTypeStr := "BIOGRAPHY_CHANGE"
-			return msgTypeStr, msgSubTypeStr
-		case 67:
-			msgSubTypeStr := "BIOGRAPHY_CHANGE_ANNOUNCE"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 75:
-		msgTypeStr := "KICK_PLAYER"
-		switch msgSubType {
-		case 82:
-			msgSubTypeStr := "KICK_PLAYER_REQUEST"
-			return msgTypeStr, msgSubTypeStr
-		case 83:
-			msgSubTypeStr := "KICK_PLAYER_SERVER_SUPPORT"
-			return msgTypeStr, msgSubTypeStr
-		case 72:
-			msgSubTypeStr := "KICK_PLAYER_HOOFED_OUT"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 77:
-		msgTypeStr := "MPSETTINGS"
-		switch msgSubType {
-		case 68:
-			msgSubTypeStr := "MPSETTINGS_FULLDEMAND"
-			return msgTypeStr, msgSubTypeStr
-		case 83:
-			msgSubTypeStr := "MPSETTINGS_FULLSET"
-			return msgTypeStr, msgSubTypeStr
-		case 112:
-			msgSubTypeStr := "MPSETTINGS_PERMISSION"
-			return msgTypeStr, msgSubTypeStr
-		case 121:
-			msgSubTypeStr := "MPSETTINGS_PLAYER_READY"
-			return msgTypeStr, msgSubTypeStr
-		case 114:
-			msgSubTypeStr := "MPSETTINGS_CHAR_READY"
-			return msgTypeStr, msgSubTypeStr
-		case 99:
-			msgSubTypeStr := "MPSETTINGS_CHAR_CONTROL"
-			return msgTypeStr, msgSubTypeStr
-		case 105:
-			msgSubTypeStr := "MPSETTINGS_IMPORTING"
-			return msgTypeStr, msgSubTypeStr
-		case 106:
-			msgSubTypeStr := "MPSETTINGS_LISTEN_JOIN"
-			return msgTypeStr, msgSubTypeStr
-		case 115:
-			msgSubTypeStr := "MPSETTINGS_SLOT_STATUS"
-			return msgTypeStr, msgSubTypeStr
-		case 108:
-			msgSubTypeStr := "MPSETTINGS_LOCK_STATUS"
-			return msgTypeStr, msgSubTypeStr
-		case 97:
-			msgSubTypeStr := "MPSETTINGS_LOCK_ALLOW_INPUT"
-			return msgTypeStr, msgSubTypeStr
-		case 76:
-			msgSubTypeStr := "MPSETTINGS_LOCK_REQUEST"
-			return msgTypeStr, msgSubTypeStr
-		case 54:
-			msgSubTypeStr := "MPSETTINGS_GORE_LEVEL"
-			return msgTypeStr, msgSubTypeStr
-		case 57:
-			msgSubTypeStr := "MPSETTINGS_RESTRICT_STORE"
-			return msgTypeStr, msgSubTypeStr
-		case 78:
-			msgSubTypeStr := "MPSETTINGS_NIGHTMAREMODE"
-			return msgTypeStr, msgSubTypeStr
-		case 110:
-			msgSubTypeStr := "MPSETTINGS_DEMAND_NIGHTMAREMODE"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 79:
-		msgTypeStr := "OBJECT"
-		switch msgSubType {
-		case 65:
-			msgSubTypeStr := "OBJECT_ADD"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 80:
-		msgTypeStr := "PLAYERCHAR"
-		switch msgSubType {
-		case 85:
-			msgSubTypeStr := "PLAYERCHAR_UPDATE_DEMAND"
-			return msgTypeStr, msgSubTypeStr
-		case 117:
-			msgSubTypeStr := "PLAYERCHAR_UPDATE_REPLY"
-			return msgTypeStr, msgSubTypeStr
-		case 68:
-			msgSubTypeStr := "PLAYERCHAR_DEMAND_SLOT"
-			return msgTypeStr, msgSubTypeStr
-		case 100:
-			msgSubTypeStr := "PLAYERCHAR_DEMAND_REPLY"
-			return msgTypeStr, msgSubTypeStr
-		case 70:
-			msgSubTypeStr := "PLAYERCHAR_70"
-			return msgTypeStr, msgSubTypeStr
-		case 102:
-			msgSubTypeStr := "PLAYERCHAR_102"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 81:
-		msgTypeStr := "PAUSING"
-		switch msgSubType {
-		case 82:
-			msgSubTypeStr := "PAUSING_PERMIT_REQUEST"
-			return msgTypeStr, msgSubTypeStr
-		case 65:
-			msgSubTypeStr := "PAUSING_ANNOUNCE"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 82:
-		msgTypeStr := "RESOURCE"
-		switch msgSubType {
-		case 68:
-			msgSubTypeStr := "RESOURCE_DEMAND"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 83:
-		msgTypeStr := "SIGNAL"
-		switch msgSubType {
-		case 83:
-			msgSubTypeStr := "SIGNAL"
-			return msgTypeStr, msgSubTypeStr
-		case 82:
-			msgSubTypeStr := "SIGNAL_REQUEST"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 115:
-		msgTypeStr := "MPSYNCH"
-		switch msgSubType {
-		case 82:
-			msgSubTypeStr := "MPSYNCH_REQUEST"
-			return msgTypeStr, msgSubTypeStr
-		case 80:
-			msgSubTypeStr := "MPSYNCH_REPLY"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 86:
-		msgTypeStr := "VERSION"
-		switch msgSubType {
-		case 115:
-			msgSubTypeStr := "VERSION_SERVER"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 88:
-		msgTypeStr := "LEAVEAREALUA"
-		switch msgSubType {
-		case 82:
-			msgSubTypeStr := "LEAVEAREALUA_PERMIT_REQUEST"
-			return msgTypeStr, msgSubTypeStr
-		}
-	case 120:
-		msgTypeStr := "LEAVEAREANAME"
-		switch msgSubType {
-		case 82:
-			msgSubTypeStr := "LEAVEAREANAME_PERMIT_REQUEST"
-			return msgTypeStr, msgSubTypeStr
-		}
-	}
-	return "UNKNOWN", "UNKNOWN"
-}
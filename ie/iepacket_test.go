@@ -0,0 +1,200 @@
+package ie
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func mustDecodeHex(t testing.TB, str string) []byte {
+	data, err := hex.DecodeString(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// The IE header of a server to client packet, ready to have the rest of the packet appended
+func testIEHeader(compressed uint8) []byte {
+	return []byte{0x01, 0x00, 0x00, 0x00, 0xad, 0x4f, 0x6f, 0x00, 0x00, 0x00, 0x0c, 0x00, 0x07, compressed, 0x00, 0x00, 0x00, 0x00}
+}
+
+func testJMPacket(t testing.TB, compressed uint8, spec []byte, payload []byte) []byte {
+	data := testIEHeader(compressed)
+	data = append(data, 'J', 'M', 0x00, 0x01)
+	body := append([]byte{}, spec...)
+	if compressed == 1 {
+		var zbuf bytes.Buffer
+		z := zlib.NewWriter(&zbuf)
+		z.Write(payload)
+		z.Close()
+		body = binary.BigEndian.AppendUint32(body, uint32(len(payload)))
+		body = append(body, zbuf.Bytes()...)
+	} else {
+		body = append(body, payload...)
+	}
+	data = binary.BigEndian.AppendUint16(data, uint16(len(body)))
+	return append(data, body...)
+}
+
+func testMsgPacket(t testing.TB, message string) []byte {
+	msgPacket := IEMsgPacket{}
+	msgPacket.PlayerIDFrom = 0x1000000
+	msgPacket.PlayerIDTo = 0xad4f6f00
+	msgPacket.FrameNum = 0x0c
+	msgPacket.FrameExpected = 0x07
+	msgPacket.JM = [2]byte{'J', 'M'}
+	msgPacket.Unknown2 = 1
+	msgPacket.Message = message
+	msgPacket.MessageLength = byte(len(message))
+	msgPacket.PacketLen = uint16(msgPacket.MessageLength) + 1
+	data, err := msgPacket.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// The only frame we have off the wire: a BG1 ping, from the debug log line quoted in the decoder tool's source
+const testPingFrame = "01000000ad4f6f000200000c880031b62cfc"
+
+// seedJMPackets is packets built by our own encoders, plus the logged ping. We haven't got captures of anything else.
+func seedJMPackets(t testing.TB) map[string][]byte {
+	seeds := map[string][]byte{
+		"message":               testMsgPacket(t, "Hello from the proxy"),
+		"compressed message":    testJMPacket(t, 1, nil, append([]byte{5}, "Hello"...)),
+		"toggle char ready":     testJMPacket(t, 0, []byte{0xff, IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_TOGGLE_CHAR_READY}, []byte{0x02, 0x00, 0x00, 0x00, 0x01}),
+		"compressed full set":   testJMPacket(t, 1, []byte{0xff, IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_UPDATE_SERVER_ARBITRATION_INFO}, make([]byte, IEMPSettingsFullSetSize)),
+		"version server":        testJMPacket(t, 0, []byte{0xff, IE_SPEC_MSG_TYPE_VERSION, IE_SPEC_MSG_SUBTYPE_VERSION_SERVER}, append([]byte{0x03, 0x04}, "v1.3\x00\x00\x00\x00\x1e"...)),
+		"empty spec compressed": testJMPacket(t, 1, []byte{0xff, IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_UPDATE_SERVER_ARBITRATION_INFO}, nil),
+	}
+	seeds["ping"] = mustDecodeHex(t, testPingFrame)
+	return seeds
+}
+
+func FuzzNewJMPacket(f *testing.F) {
+	for _, seed := range seedJMPackets(f) {
+		f.Add(seed, len(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte, size int) {
+		jmPacket, err := NewJMPacket(data, size)
+		if err != nil {
+			return
+		}
+		_ = jmPacket.String()
+		if jmPacket.DataLength() != len(jmPacket.PacketData()) {
+			t.Fatalf("DataLength %d doesn't match the data (%d bytes)", jmPacket.DataLength(), len(jmPacket.PacketData()))
+		}
+
+		// Anything we can decode we have to be able to send again, and it has to decode to the same thing
+		encoded, err := jmPacket.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		redecoded, err := NewJMPacket(encoded, len(encoded))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reencoded, err := redecoded.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, reencoded) {
+			t.Fatalf("round trip mismatch:\n%x\n%x", encoded, reencoded)
+		}
+	})
+}
+
+func TestNewJMPacketSeeds(t *testing.T) {
+	for name, seed := range seedJMPackets(t) {
+		jmPacket, err := NewJMPacket(seed, len(seed))
+		if name == "ping" {
+			if err == nil {
+				t.Errorf("%s: expected an error for a packet with no JM header", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if jmPacket.FromPlayerID() != 0x1000000 || jmPacket.ToPlayerID() != 0xad4f6f00 {
+			t.Errorf("%s: player IDs don't match: %s", name, jmPacket)
+		}
+	}
+}
+
+func TestIEMsgPacketRoundTrip(t *testing.T) {
+	// A 255 byte message would start with 0xff and look like a spec message, so 254 is the longest we can send
+	for _, message := range []string{"", "a", "Hello from the proxy", string(bytes.Repeat([]byte{'x'}, 254))} {
+		data := testMsgPacket(t, message)
+		jmPacket, err := NewJMPacket(data, len(data))
+		if err != nil {
+			t.Fatalf("%q: %s", message, err)
+		}
+		if jmPacket.IsSpecMsg() || jmPacket.IsCompressed() {
+			t.Fatalf("%q: decoded as the wrong JM type: %s", message, jmPacket)
+		}
+		if message == "" {
+			continue
+		}
+		payload := jmPacket.PacketData()
+		if int(payload[0]) != len(message) || string(payload[1:]) != message {
+			t.Errorf("round trip mismatch: %q != %q", payload[1:], message)
+		}
+	}
+}
+
+func TestNewJMPacketErrors(t *testing.T) {
+	seeds := seedJMPackets(t)
+	message := seeds["message"]
+
+	notJM := append([]byte{}, message...)
+	notJM[IEHeaderSize] = 'X'
+
+	longPacketLen := append([]byte{}, message...)
+	binary.BigEndian.PutUint16(longPacketLen[JMHeaderSize-2:], uint16(len(message)))
+
+	shortSpec := testJMPacket(t, 0, []byte{0xff, IE_SPEC_MSG_TYPE_MPSETTINGS}, nil)
+
+	hugeDecompressed := append([]byte{}, seeds["compressed full set"]...)
+	binary.BigEndian.PutUint32(hugeDecompressed[JMSpecHeaderSize:], MaxDecompressedSize+1)
+
+	tests := []struct {
+		name  string
+		data  []byte
+		size  int
+		kind  error
+		field string
+	}{
+		{"ping", seeds["ping"], len(seeds["ping"]), ErrShortPacket, "JMHeader"},
+		{"size past the end", message, len(message) + 1, ErrShortPacket, "data"},
+		{"not JM", notJM, len(notJM), ErrNotJM, "JMHeader"},
+		{"PacketLen too long", longPacketLen, len(longPacketLen), ErrLengthMismatch, "PacketLen"},
+		{"truncated by size", message, len(message) - 1, ErrLengthMismatch, "PacketLen"},
+		{"short spec header", shortSpec, len(shortSpec), ErrShortPacket, "JMSpecHeader"},
+		{"huge decompressed size", hugeDecompressed, len(hugeDecompressed), ErrDecompressedSize, "DecompressedSize"},
+	}
+	for _, test := range tests {
+		_, err := NewJMPacket(test.data, test.size)
+		var packetErr *PacketError
+		if !errors.As(err, &packetErr) || !errors.Is(err, test.kind) || packetErr.Field != test.field {
+			t.Errorf("%s: expected a %q error on %s, got %v", test.name, test.kind, test.field, err)
+		}
+	}
+}
+
+func TestParseIEMsg(t *testing.T) {
+	if msg, err := ParseIEMsg(append([]byte{5}, "Hello, with trailing bytes"...)); err != nil || msg.Message != "Hello" {
+		t.Errorf("unexpected message %q: %v", msg.Message, err)
+	}
+	if _, err := ParseIEMsg([]byte{10, 'H', 'i'}); !errors.Is(err, ErrLengthMismatch) {
+		t.Errorf("expected a length mismatch, got %v", err)
+	}
+	if _, err := ParseIEMsg(nil); !errors.Is(err, ErrShortPacket) {
+		t.Errorf("expected a short packet, got %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+package ie
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// JOURNAL and BIOGRAPHY keep the party's shared journal and each character's biography in step. Clients ask the
+// host to add or change something and the host announces it to everyone, with the same payload as the request.
+// The layouts are guesses, only decoded when asked for: the game's own entries are a strref, players' text is sent
+// with a 2 byte length in front.
+
+const IE_SPEC_MSG_TYPE_JOURNAL uint8 = 106
+const IE_SPEC_MSG_SUBTYPE_JOURNAL_ADD_ENTRY uint8 = 69
+const IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE uint8 = 65
+const IE_SPEC_MSG_SUBTYPE_JOURNAL_ADD_USER_ENTRY uint8 = 117
+const IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE_USER_ENTRY uint8 = 85
+const IE_SPEC_MSG_SUBTYPE_JOURNAL_CHANGE_ENTRY uint8 = 99
+const IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE_CHANGE uint8 = 67
+
+const IE_SPEC_MSG_TYPE_BIOGRAPHY uint8 = 98
+const IE_SPEC_MSG_SUBTYPE_BIOGRAPHY_CHANGE uint8 = 99
+const IE_SPEC_MSG_SUBTYPE_BIOGRAPHY_CHANGE_ANNOUNCE uint8 = 67
+
+// text reads a string with a 2 byte length in front of it
+func (reader *specReader) text(field string, textLen *uint16) string {
+	reader.read(field+"Len", textLen)
+	return string(reader.take(field, int(*textLen)))
+}
+
+func checkTextLen(field, text string) error {
+	if len(text) > 0xffff {
+		return &PacketError{ErrPacketTooLarge, field, 0xffff, len(text)}
+	}
+	return nil
+}
+
+// IEJournalEntry is one of the game's own journal entries, added when a quest moves on
+type IEJournalEntry struct {
+	StrRef  uint32
+	Time    uint32 // Game time, in seconds
+	Chapter uint8
+	Section uint8 // Quests, done quests, info and so on
+	Rest    []byte
+}
+
+func (entry *IEJournalEntry) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEJournalEntry", data)
+	reader.read("StrRef", &entry.StrRef)
+	reader.read("Time", &entry.Time)
+	reader.read("Chapter", &entry.Chapter)
+	reader.read("Section", &entry.Section)
+	entry.Rest = reader.rest()
+	return reader.err
+}
+
+func (entry IEJournalEntry) Marshal() ([]byte, error) {
+	return marshalSpecFields(entry.StrRef, entry.Time, entry.Chapter, entry.Section, entry.Rest)
+}
+
+func (entry IEJournalEntry) String() string {
+	return fmt.Sprintf("StrRef: %d Time: %d Chapter: %d Section: %d", entry.StrRef, entry.Time, entry.Chapter, entry.Section) + restString(entry.Rest)
+}
+
+// IEJournalUserEntry is a note a player wrote in the journal
+type IEJournalUserEntry struct {
+	Time    uint32
+	Chapter uint8
+	TextLen uint16
+	Text    string
+	Rest    []byte
+}
+
+func (entry *IEJournalUserEntry) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEJournalUserEntry", data)
+	reader.read("Time", &entry.Time)
+	reader.read("Chapter", &entry.Chapter)
+	entry.Text = reader.text("Text", &entry.TextLen)
+	entry.Rest = reader.rest()
+	return reader.err
+}
+
+// Marshal sets TextLen from Text
+func (entry IEJournalUserEntry) Marshal() ([]byte, error) {
+	if err := checkTextLen("Text", entry.Text); err != nil {
+		return nil, err
+	}
+	entry.TextLen = uint16(len(entry.Text))
+	return marshalSpecFields(entry.Time, entry.Chapter, entry.TextLen, []byte(entry.Text), entry.Rest)
+}
+
+func (entry IEJournalUserEntry) String() string {
+	return fmt.Sprintf("Time: %d Chapter: %d Text: %q", entry.Time, entry.Chapter, entry.Text) + restString(entry.Rest)
+}
+
+// IEJournalChange replaces the text of an entry. Index counts the entries in the chapter, in the order they
+// were added.
+type IEJournalChange struct {
+	Chapter uint8
+	Index   uint16
+	TextLen uint16
+	Text    string
+	Rest    []byte
+}
+
+func (change *IEJournalChange) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEJournalChange", data)
+	reader.read("Chapter", &change.Chapter)
+	reader.read("Index", &change.Index)
+	change.Text = reader.text("Text", &change.TextLen)
+	change.Rest = reader.rest()
+	return reader.err
+}
+
+// Marshal sets TextLen from Text
+func (change IEJournalChange) Marshal() ([]byte, error) {
+	if err := checkTextLen("Text", change.Text); err != nil {
+		return nil, err
+	}
+	change.TextLen = uint16(len(change.Text))
+	return marshalSpecFields(change.Chapter, change.Index, change.TextLen, []byte(change.Text), change.Rest)
+}
+
+func (change IEJournalChange) String() string {
+	return fmt.Sprintf("Chapter: %d Index: %d Text: %q", change.Chapter, change.Index, change.Text) + restString(change.Rest)
+}
+
+// IEBiography replaces a character's biography
+type IEBiography struct {
+	CharacterNum uint8
+	TextLen      uint16
+	Text         string
+	Rest         []byte
+}
+
+func (biography *IEBiography) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEBiography", data)
+	reader.read("CharacterNum", &biography.CharacterNum)
+	biography.Text = reader.text("Text", &biography.TextLen)
+	biography.Rest = reader.rest()
+	return reader.err
+}
+
+// Marshal sets TextLen from Text
+func (biography IEBiography) Marshal() ([]byte, error) {
+	if err := checkTextLen("Text", biography.Text); err != nil {
+		return nil, err
+	}
+	biography.TextLen = uint16(len(biography.Text))
+	return marshalSpecFields(biography.CharacterNum, biography.TextLen, []byte(biography.Text), biography.Rest)
+}
+
+func (biography IEBiography) String() string {
+	return fmt.Sprintf("Character %d Biography: %q", biography.CharacterNum, biography.Text) + restString(biography.Rest)
+}
+
+func newIEJournalEntry() SpecMsg     { return &IEJournalEntry{} }
+func newIEJournalUserEntry() SpecMsg { return &IEJournalUserEntry{} }
+func newIEJournalChange() SpecMsg    { return &IEJournalChange{} }
+func newIEBiography() SpecMsg        { return &IEBiography{} }
+
+// JournalEntry is an entry in the rebuilt party journal. The game's own entries have a StrRef and no Text until
+// someone changes them.
+type JournalEntry struct {
+	StrRef  uint32
+	User    bool
+	Text    string
+	Time    uint32
+	Chapter uint8
+	Section uint8
+	Changes int
+}
+
+func (entry JournalEntry) String() string {
+	var text string
+	if entry.Text != "" || entry.User {
+		text = fmt.Sprintf("%q", entry.Text)
+	} else {
+		text = fmt.Sprintf("StrRef %d", entry.StrRef)
+	}
+	if entry.User {
+		text = "(user) " + text
+	}
+	if entry.Changes > 0 {
+		text += fmt.Sprintf(" (changed %d times)", entry.Changes)
+	}
+	return fmt.Sprintf("Time %d Section %d: %s", entry.Time, entry.Section, text)
+}
+
+// PartyJournal rebuilds the shared journal and the biographies from what the host announces, which is what every
+// player should end up with. Requests are kept until an announcement with the same payload turns up, so anything
+// left in Pending is a change the host never sent out.
+type PartyJournal struct {
+	lock        sync.Mutex
+	entries     []JournalEntry
+	biographies map[uint8]string
+	pending     []pendingJournal
+}
+
+type pendingJournal struct {
+	from         uint32
+	name         string
+	announcement uint16
+	msg          string
+}
+
+func NewPartyJournal() *PartyJournal {
+	return &PartyJournal{biographies: make(map[uint8]string)}
+}
+
+// The announcement that goes with each request
+var journalAnnouncements = map[uint16]uint8{
+	specMsgKey(IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_ADD_ENTRY):      IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE,
+	specMsgKey(IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_ADD_USER_ENTRY): IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE_USER_ENTRY,
+	specMsgKey(IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_CHANGE_ENTRY):   IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE_CHANGE,
+	specMsgKey(IE_SPEC_MSG_TYPE_BIOGRAPHY, IE_SPEC_MSG_SUBTYPE_BIOGRAPHY_CHANGE):     IE_SPEC_MSG_SUBTYPE_BIOGRAPHY_CHANGE_ANNOUNCE,
+}
+
+// Apply updates the journal from a JOURNAL or BIOGRAPHY message sent by from. It returns false for anything else.
+func (journal *PartyJournal) Apply(from uint32, msgType, msgSubType uint8, msg SpecMsg) bool {
+	if msgType != IE_SPEC_MSG_TYPE_JOURNAL && msgType != IE_SPEC_MSG_TYPE_BIOGRAPHY {
+		return false
+	}
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+
+	key := specMsgKey(msgType, msgSubType)
+	if announcement, ok := journalAnnouncements[key]; ok {
+		_, name := SpecMsgNames(msgType, msgSubType)
+		journal.pending = append(journal.pending, pendingJournal{from, name, specMsgKey(msgType, announcement), msg.String()})
+		return true
+	}
+	for i, pending := range journal.pending {
+		if pending.announcement == key && pending.msg == msg.String() {
+			journal.pending = append(journal.pending[:i], journal.pending[i+1:]...)
+			break
+		}
+	}
+
+	switch msg := msg.(type) {
+	case *IEJournalEntry:
+		journal.entries = append(journal.entries, JournalEntry{StrRef: msg.StrRef, Time: msg.Time, Chapter: msg.Chapter, Section: msg.Section})
+	case *IEJournalUserEntry:
+		journal.entries = append(journal.entries, JournalEntry{User: true, Text: msg.Text, Time: msg.Time, Chapter: msg.Chapter})
+	case *IEJournalChange:
+		index := 0
+		for i := range journal.entries {
+			if journal.entries[i].Chapter != msg.Chapter {
+				continue
+			}
+			if index == int(msg.Index) {
+				journal.entries[i].Text = msg.Text
+				journal.entries[i].Changes++
+				break
+			}
+			index++
+		}
+	case *IEBiography:
+		journal.biographies[msg.CharacterNum] = msg.Text
+	}
+	return true
+}
+
+// Entries returns the journal in the order the entries were announced
+func (journal *PartyJournal) Entries() []JournalEntry {
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+	return append([]JournalEntry{}, journal.entries...)
+}
+
+// Biographies returns each character's latest biography
+func (journal *PartyJournal) Biographies() map[uint8]string {
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+	biographies := make(map[uint8]string, len(journal.biographies))
+	for characterNum, text := range journal.biographies {
+		biographies[characterNum] = text
+	}
+	return biographies
+}
+
+// Pending returns the requests the host hasn't announced
+func (journal *PartyJournal) Pending() []string {
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+	pending := make([]string, len(journal.pending))
+	for i, request := range journal.pending {
+		pending[i] = fmt.Sprintf("Player 0x%x %s %s", request.from, request.name, request.msg)
+	}
+	return pending
+}
+
+// String prints the journal chapter by chapter
+func (journal *PartyJournal) String() string {
+	entries := journal.Entries()
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Chapter < entries[j].Chapter })
+	var sb strings.Builder
+	for i, entry := range entries {
+		if i == 0 || entries[i-1].Chapter != entry.Chapter {
+			fmt.Fprintf(&sb, "Chapter %d:\n", entry.Chapter)
+		}
+		fmt.Fprintf(&sb, "  %s\n", entry.String())
+	}
+	return sb.String()
+}
@@ -0,0 +1,85 @@
+package ie
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestJournalGuesses(t *testing.T) {
+	text := func(text string) string {
+		return fmt.Sprintf("%04x", len(text)) + hex.EncodeToString([]byte(text))
+	}
+	testGuesses(t, []guessFixture{
+		{IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_ADD_ENTRY, "00005c6d" + "00001c20" + "01" + "01", "StrRef: 23661 Time: 7200 Chapter: 1 Section: 1"},
+		{IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE, "00005c6d" + "00001c20" + "01" + "00" + "0102", "StrRef: 23661 Time: 7200 Chapter: 1 Section: 0 Rest: 0102"},
+		{IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_ADD_USER_ENTRY, "00002328" + "02" + text("Buy rope"), `Time: 9000 Chapter: 2 Text: "Buy rope"`},
+		{IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE_USER_ENTRY, "00000000" + "02" + text(""), `Time: 0 Chapter: 2 Text: ""`},
+		{IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_CHANGE_ENTRY, "02" + "0001" + text("Buy bread"), `Chapter: 2 Index: 1 Text: "Buy bread"`},
+		{IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE_CHANGE, "02" + "0001" + text("Done") + "00", `Chapter: 2 Index: 1 Text: "Done" Rest: 00`},
+		{IE_SPEC_MSG_TYPE_BIOGRAPHY, IE_SPEC_MSG_SUBTYPE_BIOGRAPHY_CHANGE, "03" + text("Candlekeep"), `Character 3 Biography: "Candlekeep"`},
+	})
+}
+
+func TestJournalTextLen(t *testing.T) {
+	// TextLen runs past the end of the payload
+	_, err := GuessSpecMsg(IE_SPEC_MSG_TYPE_BIOGRAPHY, IE_SPEC_MSG_SUBTYPE_BIOGRAPHY_CHANGE, []byte{0, 0, 5, 'a'})
+	var packetErr *PacketError
+	if !errors.As(err, &packetErr) || packetErr.Field != "IEBiography.Text" {
+		t.Errorf("expected a short IEBiography.Text, got %v", err)
+	}
+	_, err = IEBiography{Text: strings.Repeat("a", 0x10000)}.Marshal()
+	if !errors.Is(err, ErrPacketTooLarge) {
+		t.Errorf("expected ErrPacketTooLarge, got %v", err)
+	}
+}
+
+func TestPartyJournal(t *testing.T) {
+	const host, client = 0x1000000, 0xad4f6f00
+	journal := NewPartyJournal()
+	apply := func(from uint32, msgType, msgSubType uint8, msg SpecMsg) {
+		if !journal.Apply(from, msgType, msgSubType, msg) {
+			t.Fatalf("%T wasn't applied", msg)
+		}
+	}
+
+	apply(host, IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE, &IEJournalEntry{StrRef: 100, Time: 10, Chapter: 1})
+	apply(client, IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_ADD_USER_ENTRY, &IEJournalUserEntry{Time: 20, Chapter: 1, Text: "Buy rope"})
+	apply(host, IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE_USER_ENTRY, &IEJournalUserEntry{Time: 20, Chapter: 1, Text: "Buy rope"})
+	apply(host, IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE, &IEJournalEntry{StrRef: 200, Time: 30, Chapter: 2})
+	apply(client, IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_CHANGE_ENTRY, &IEJournalChange{Chapter: 1, Index: 1, Text: "Bought rope"})
+	apply(host, IE_SPEC_MSG_TYPE_JOURNAL, IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE_CHANGE, &IEJournalChange{Chapter: 1, Index: 1, Text: "Bought rope"})
+	apply(client, IE_SPEC_MSG_TYPE_BIOGRAPHY, IE_SPEC_MSG_SUBTYPE_BIOGRAPHY_CHANGE, &IEBiography{CharacterNum: 2, Text: "Never announced"})
+	apply(host, IE_SPEC_MSG_TYPE_BIOGRAPHY, IE_SPEC_MSG_SUBTYPE_BIOGRAPHY_CHANGE_ANNOUNCE, &IEBiography{CharacterNum: 1, Text: "Raised in Candlekeep"})
+
+	if journal.Apply(host, IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_MPSETTINGS_FULLDEMAND, &IEMPSettingsDemand{}) {
+		t.Error("applied a message that isn't JOURNAL or BIOGRAPHY")
+	}
+
+	entries := journal.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	if entries[1].Text != "Bought rope" || entries[1].Changes != 1 || !entries[1].User {
+		t.Errorf("change wasn't applied: %+v", entries[1])
+	}
+	if entries[0].Changes != 0 || entries[2].Changes != 0 {
+		t.Errorf("change applied to the wrong entry: %+v", entries)
+	}
+	if biographies := journal.Biographies(); len(biographies) != 1 || biographies[1] != "Raised in Candlekeep" {
+		t.Errorf("unexpected biographies: %v", biographies)
+	}
+	if pending := journal.Pending(); len(pending) != 1 || !strings.Contains(pending[0], "BIOGRAPHY_CHANGE") {
+		t.Errorf("unexpected pending requests: %v", pending)
+	}
+	expected := "Chapter 1:\n" +
+		"  Time 10 Section 0: StrRef 100\n" +
+		"  Time 20 Section 0: (user) \"Bought rope\" (changed 1 times)\n" +
+		"Chapter 2:\n" +
+		"  Time 30 Section 0: StrRef 200\n"
+	if journal.String() != expected {
+		t.Errorf("unexpected journal:\n%s", journal.String())
+	}
+}
@@ -0,0 +1,57 @@
+package ie
+
+import "fmt"
+
+// KICK_PLAYER is a client asking the host to kick someone and the host telling a player they've been kicked. The
+// layouts are guesses, only decoded when asked for: the player being kicked, or for SERVER_SUPPORT a BOOL like the
+// other host settings.
+
+const IE_SPEC_MSG_TYPE_KICK_PLAYER uint8 = 75
+const IE_SPEC_MSG_SUBTYPE_KICK_PLAYER_REQUEST uint8 = 82
+const IE_SPEC_MSG_SUBTYPE_KICK_PLAYER_SERVER_SUPPORT uint8 = 83
+const IE_SPEC_MSG_SUBTYPE_KICK_PLAYER_HOOFED_OUT uint8 = 72
+
+// IEKickPlayer names the player being kicked, for both REQUEST and HOOFED_OUT
+type IEKickPlayer struct {
+	PlayerID uint32
+	Rest     []byte
+}
+
+func (kick *IEKickPlayer) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEKickPlayer", data)
+	reader.read("PlayerID", &kick.PlayerID)
+	kick.Rest = reader.rest()
+	return reader.err
+}
+
+func (kick IEKickPlayer) Marshal() ([]byte, error) {
+	return marshalSpecFields(kick.PlayerID, kick.Rest)
+}
+
+func (kick IEKickPlayer) String() string {
+	return fmt.Sprintf("Player 0x%x", kick.PlayerID) + restString(kick.Rest)
+}
+
+// IEKickPlayerServerSupport says whether the host lets players be kicked
+type IEKickPlayerServerSupport struct {
+	Supported uint32
+	Rest      []byte
+}
+
+func (support *IEKickPlayerServerSupport) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEKickPlayerServerSupport", data)
+	reader.read("Supported", &support.Supported)
+	support.Rest = reader.rest()
+	return reader.err
+}
+
+func (support IEKickPlayerServerSupport) Marshal() ([]byte, error) {
+	return marshalSpecFields(support.Supported, support.Rest)
+}
+
+func (support IEKickPlayerServerSupport) String() string {
+	return fmt.Sprintf("Supported: %d", support.Supported) + restString(support.Rest)
+}
+
+func newIEKickPlayer() SpecMsg              { return &IEKickPlayer{} }
+func newIEKickPlayerServerSupport() SpecMsg { return &IEKickPlayerServerSupport{} }
@@ -0,0 +1,11 @@
+package ie
+
+import "testing"
+
+func TestKickPlayerGuesses(t *testing.T) {
+	testGuesses(t, []guessFixture{
+		{IE_SPEC_MSG_TYPE_KICK_PLAYER, IE_SPEC_MSG_SUBTYPE_KICK_PLAYER_REQUEST, "ad4f6f00", "Player 0xad4f6f00"},
+		{IE_SPEC_MSG_TYPE_KICK_PLAYER, IE_SPEC_MSG_SUBTYPE_KICK_PLAYER_SERVER_SUPPORT, "00000001", "Supported: 1"},
+		{IE_SPEC_MSG_TYPE_KICK_PLAYER, IE_SPEC_MSG_SUBTYPE_KICK_PLAYER_HOOFED_OUT, "ad4f6f00" + "01", "Player 0xad4f6f00 Rest: 01"},
+	})
+}
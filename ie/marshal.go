@@ -0,0 +1,136 @@
+package ie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/Jaywalker/iemitm/crc"
+)
+
+var (
+	ErrPacketTooLarge = errors.New("packet too large for PacketLen")
+	ErrSpecFlag       = errors.New("non-spec data starts with the spec message flag")
+	ErrNotSpecMsg     = errors.New("not a spec message")
+)
+
+// FrameCRC is the CRC32 the game puts in the IEHeader. It covers everything from FrameKind to the end of the frame,
+// with the CRC field itself zeroed. frame has to be at least IEHeaderSize bytes.
+func FrameCRC(frame []byte) uint32 {
+	return crc.Checksum(frame)
+}
+
+// marshalFrame writes one of the JM header structs followed by data, then fills in PacketLen and the CRC
+func marshalFrame(header any, data []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, binary.BigEndian, header); err != nil {
+		return nil, err
+	}
+	buf.Write(data)
+	frame := buf.Bytes()
+	packetLen := len(frame) - JMHeaderSize
+	if packetLen > math.MaxUint16 {
+		return nil, &PacketError{ErrPacketTooLarge, "PacketLen", math.MaxUint16, packetLen}
+	}
+	binary.BigEndian.PutUint16(frame[JMHeaderSize-2:], uint16(packetLen))
+	binary.BigEndian.PutUint32(frame[IEHeaderSize-4:], FrameCRC(frame))
+	return frame, nil
+}
+
+// Every variant sets the fields that decide how it'll be decoded, so what we send always parses back as the same type
+func (jmHeader *JMHeader) prepare(compressed uint8) {
+	jmHeader.JM = [2]byte{'J', 'M'}
+	jmHeader.Compressed = compressed
+}
+
+// Marshal encodes the packet with PacketLen and the CRC filled in
+func (jm JM) Marshal() ([]byte, error) {
+	jm.prepare(0)
+	if len(jm.Data) > 0 && jm.Data[0] == 0xff {
+		// The receiver would take this for a spec message. It's why chat messages can't be 255 bytes long.
+		return nil, &PacketError{ErrSpecFlag, "Data", 0, 0xff}
+	}
+	return marshalFrame(jm.JMHeader, jm.Data)
+}
+
+// Marshal encodes the packet with PacketLen and the CRC filled in. Data has to be compressed already and
+// DecompressedSize_ has to match it. Use NewJMMessage to compress a payload.
+func (jmCompressed JMCompressed) Marshal() ([]byte, error) {
+	jmCompressed.prepare(1)
+	if err := checkDecompressedSize(jmCompressed.DecompressedSize_, len(jmCompressed.Data)); err != nil {
+		return nil, err
+	}
+	return marshalFrame(jmCompressed.JMHeaderCompressed, jmCompressed.Data)
+}
+
+// Marshal encodes the packet with the spec message flag, PacketLen and the CRC filled in
+func (jmSpec JMSpec) Marshal() ([]byte, error) {
+	jmSpec.prepare(0)
+	jmSpec.SpecMsgFlag = 0xff
+	return marshalFrame(jmSpec.JMSpecHeader, jmSpec.Data)
+}
+
+// Marshal encodes the packet with the spec message flag, PacketLen and the CRC filled in. Data has to be compressed
+// already and DecompressedSize_ has to match it. Use NewJMMessage to compress a payload.
+func (jmSpecCompressed JMSpecCompressed) Marshal() ([]byte, error) {
+	jmSpecCompressed.prepare(1)
+	jmSpecCompressed.SpecMsgFlag = 0xff
+	if err := checkDecompressedSize(jmSpecCompressed.DecompressedSize_, len(jmSpecCompressed.Data)); err != nil {
+		return nil, err
+	}
+	return marshalFrame(jmSpecCompressed.JMSpecHeaderCompressed, jmSpecCompressed.Data)
+}
+
+// NewJMMessage builds the right JM variant for an uncompressed payload. Spec messages get the given type and
+// subtype. If header.Compressed is 1 the payload is compressed and DecompressedSize is filled in. Unknown1 and
+// Unknown2 get the 0 and 1 noted on JMHeader. Marshal the result to send it.
+func NewJMMessage(header IEHeader, spec bool, specType, specSubType uint8, payload []byte) (JMPacket, error) {
+	jmHeader := JMHeader{IEHeader: header, Unknown1: 0, Unknown2: 1}
+	if header.Compressed != 1 {
+		jmHeader.prepare(0)
+		data := append([]byte{}, payload...)
+		if spec {
+			return JMSpec{JMSpecHeader{jmHeader, 0xff, specType, specSubType}, data}, nil
+		}
+		return JM{jmHeader, data}, nil
+	}
+	if uint64(len(payload)) > uint64(MaxDecompressedSize) {
+		return nil, &PacketError{ErrDecompressedSize, "DecompressedSize", int(MaxDecompressedSize), len(payload)}
+	}
+	jmHeader.prepare(1)
+	data, err := Compress(payload, GameCompressionLevel)
+	if err != nil {
+		return nil, err
+	}
+	if spec {
+		return JMSpecCompressed{JMSpecHeaderCompressed{jmHeader, 0xff, specType, specSubType, uint32(len(payload))}, data}, nil
+	}
+	return JMCompressed{JMHeaderCompressed{jmHeader, uint32(len(payload))}, data}, nil
+}
+
+// ReplaceSpecMsg gives back packet with its spec message payload swapped for msg, compressed if packet was. Everything
+// else in the headers is kept. Marshal the result to send it.
+func ReplaceSpecMsg(packet JMPacket, msg SpecMsg) (JMPacket, error) {
+	payload, err := msg.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	switch packet := packet.(type) {
+	case JMSpec:
+		packet.Data = payload
+		return packet, nil
+	case JMSpecCompressed:
+		if uint64(len(payload)) > uint64(MaxDecompressedSize) {
+			return nil, &PacketError{ErrDecompressedSize, "DecompressedSize", int(MaxDecompressedSize), len(payload)}
+		}
+		data, err := Compress(payload, GameCompressionLevel)
+		if err != nil {
+			return nil, err
+		}
+		packet.Data = data
+		packet.DecompressedSize_ = uint32(len(payload))
+		return packet, nil
+	}
+	return nil, ErrNotSpecMsg
+}
@@ -0,0 +1,97 @@
+package ie
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestFrameCRC(t *testing.T) {
+	ping := seedJMPackets(t)["ping"]
+	if crc := FrameCRC(ping); crc != 0x31b62cfc {
+		t.Errorf("CRC of the captured ping is 0x%x, expected 0x31b62cfc", crc)
+	}
+}
+
+func TestJMMarshalMatchesSeeds(t *testing.T) {
+	for name, seed := range seedJMPackets(t) {
+		if name == "ping" {
+			continue
+		}
+		jmPacket, err := NewJMPacket(seed, len(seed))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		encoded, err := jmPacket.Marshal()
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		expected := append([]byte{}, seed...)
+		binary.BigEndian.PutUint32(expected[IEHeaderSize-4:], FrameCRC(expected))
+		if !bytes.Equal(encoded, expected) {
+			t.Errorf("%s: marshal mismatch:\n%x\n%x", name, expected, encoded)
+		}
+	}
+}
+
+func TestNewJMMessage(t *testing.T) {
+	payload := bytes.Repeat([]byte{0x02, 0x00, 0x00, 0x00, 0x01}, 40)
+	for _, compressed := range []uint8{0, 1} {
+		for _, spec := range []bool{false, true} {
+			header := IEHeader{PlayerIDFrom: 0x1000000, PlayerIDTo: 0xad4f6f00, FrameNum: 0x0c, FrameExpected: 0x07, Compressed: compressed}
+			built, err := NewJMMessage(header, spec, IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_TOGGLE_CHAR_READY, payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := built.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			jmPacket, err := NewJMPacket(data, len(data))
+			if err != nil {
+				t.Fatalf("compressed %d spec %t: %s", compressed, spec, err)
+			}
+			if jmPacket.IsCompressed() != (compressed == 1) || jmPacket.IsSpecMsg() != spec || jmPacket.CRC() != FrameCRC(data) {
+				t.Fatalf("compressed %d spec %t: decoded as %s", compressed, spec, jmPacket)
+			}
+			if spec && (jmPacket.SpecType() != IE_SPEC_MSG_TYPE_MPSETTINGS || jmPacket.SpecSubType() != IE_SPEC_MSG_SUBTYPE_TOGGLE_CHAR_READY) {
+				t.Errorf("spec type didn't survive: %s", jmPacket)
+			}
+			decoded := jmPacket.PacketData()
+			if jmPacket.IsCompressed() {
+				if jmPacket.DecompressedSize() != uint32(len(payload)) {
+					t.Errorf("DecompressedSize is %d, expected %d", jmPacket.DecompressedSize(), len(payload))
+				}
+				z, err := zlib.NewReader(bytes.NewReader(decoded))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if decoded, err = io.ReadAll(z); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(decoded, payload) {
+				t.Errorf("compressed %d spec %t: payload mismatch: %x", compressed, spec, decoded)
+			}
+		}
+	}
+}
+
+func TestJMMarshalErrors(t *testing.T) {
+	if _, err := (JM{Data: []byte{0xff, 0x01}}).Marshal(); !errors.Is(err, ErrSpecFlag) {
+		t.Errorf("expected a spec flag error, got %v", err)
+	}
+	if _, err := (JMSpec{Data: make([]byte, 0x10000)}).Marshal(); !errors.Is(err, ErrPacketTooLarge) {
+		t.Errorf("expected a too large error, got %v", err)
+	}
+	if _, err := (JMCompressed{JMHeaderCompressed{DecompressedSize_: 10}, nil}).Marshal(); !errors.Is(err, ErrDecompressedSize) {
+		t.Errorf("expected a decompressed size error, got %v", err)
+	}
+	msgPacket := IEMsgPacket{IEMsg: IEMsg{Message: string(bytes.Repeat([]byte{'x'}, MaxIEMsgLength+1))}}
+	if _, err := msgPacket.Serialize(); !errors.Is(err, ErrPacketTooLarge) {
+		t.Errorf("expected a too large error for a %d byte message, got %v", MaxIEMsgLength+1, err)
+	}
+}
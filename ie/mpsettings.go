@@ -0,0 +1,188 @@
+package ie
+
+import "fmt"
+
+// The MPSETTINGS messages change the lobby settings that FULLSET sends all at once. CHAR_READY is the only one
+// we've captured: a character slot and a 4 byte BOOL. The others are guessed on the same pattern, with the settings
+// that FULLSET keeps in a single byte sent as a byte, and are only registered as guesses until a capture confirms them.
+
+const IE_SPEC_MSG_SUBTYPE_MPSETTINGS_FULLDEMAND uint8 = 68
+const IE_SPEC_MSG_SUBTYPE_MPSETTINGS_PERMISSION uint8 = 112
+const IE_SPEC_MSG_SUBTYPE_MPSETTINGS_PLAYER_READY uint8 = 121
+const IE_SPEC_MSG_SUBTYPE_MPSETTINGS_CHAR_CONTROL uint8 = 99
+const IE_SPEC_MSG_SUBTYPE_MPSETTINGS_IMPORTING uint8 = 105
+const IE_SPEC_MSG_SUBTYPE_MPSETTINGS_LISTEN_JOIN uint8 = 106
+const IE_SPEC_MSG_SUBTYPE_MPSETTINGS_SLOT_STATUS uint8 = 115
+const IE_SPEC_MSG_SUBTYPE_MPSETTINGS_LOCK_STATUS uint8 = 108
+const IE_SPEC_MSG_SUBTYPE_MPSETTINGS_LOCK_ALLOW_INPUT uint8 = 97
+const IE_SPEC_MSG_SUBTYPE_MPSETTINGS_LOCK_REQUEST uint8 = 76
+const IE_SPEC_MSG_SUBTYPE_MPSETTINGS_GORE_LEVEL uint8 = 54
+const IE_SPEC_MSG_SUBTYPE_MPSETTINGS_RESTRICT_STORE uint8 = 57
+const IE_SPEC_MSG_SUBTYPE_MPSETTINGS_NIGHTMAREMODE uint8 = 78
+const IE_SPEC_MSG_SUBTYPE_MPSETTINGS_DEMAND_NIGHTMAREMODE uint8 = 110
+
+// IEMPSettingsDemand asks the host to send a setting. There's nothing in it we know of.
+type IEMPSettingsDemand struct {
+	Rest []byte
+}
+
+func (demand *IEMPSettingsDemand) Unmarshal(data []byte) error {
+	demand.Rest = newSpecReader("IEMPSettingsDemand", data).rest()
+	return nil
+}
+
+func (demand IEMPSettingsDemand) Marshal() ([]byte, error) {
+	return append([]byte{}, demand.Rest...), nil
+}
+
+func (demand IEMPSettingsDemand) String() string {
+	return "Demand" + restString(demand.Rest)
+}
+
+// IEMPSettingsFlag is one of the session wide settings FULLSET keeps in a byte: importing, listening to join
+// requests and restricting stores
+type IEMPSettingsFlag struct {
+	Value uint8
+	Rest  []byte
+}
+
+func (flag *IEMPSettingsFlag) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEMPSettingsFlag", data)
+	reader.read("Value", &flag.Value)
+	flag.Rest = reader.rest()
+	return reader.err
+}
+
+func (flag IEMPSettingsFlag) Marshal() ([]byte, error) {
+	return marshalSpecFields(flag.Value, flag.Rest)
+}
+
+func (flag IEMPSettingsFlag) String() string {
+	return fmt.Sprintf("Value: %d", flag.Value) + restString(flag.Rest)
+}
+
+// IEMPSettingsBool is a session wide setting sent as a BOOL: nightmare mode, gore and the lock
+type IEMPSettingsBool struct {
+	Value uint32
+	Rest  []byte
+}
+
+func (setting *IEMPSettingsBool) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEMPSettingsBool", data)
+	reader.read("Value", &setting.Value)
+	setting.Rest = reader.rest()
+	return reader.err
+}
+
+func (setting IEMPSettingsBool) Marshal() ([]byte, error) {
+	return marshalSpecFields(setting.Value, setting.Rest)
+}
+
+func (setting IEMPSettingsBool) String() string {
+	return fmt.Sprintf("Value: %d", setting.Value) + restString(setting.Rest)
+}
+
+// IEMPSettingsSlotStatus sets the status of a character slot
+type IEMPSettingsSlotStatus struct {
+	CharacterNum uint8
+	Status       uint32
+	Rest         []byte
+}
+
+func (slotStatus *IEMPSettingsSlotStatus) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEMPSettingsSlotStatus", data)
+	reader.read("CharacterNum", &slotStatus.CharacterNum)
+	reader.read("Status", &slotStatus.Status)
+	slotStatus.Rest = reader.rest()
+	return reader.err
+}
+
+func (slotStatus IEMPSettingsSlotStatus) Marshal() ([]byte, error) {
+	return marshalSpecFields(slotStatus.CharacterNum, slotStatus.Status, slotStatus.Rest)
+}
+
+func (slotStatus IEMPSettingsSlotStatus) String() string {
+	return fmt.Sprintf("Character %d Status: %d", slotStatus.CharacterNum, slotStatus.Status) + restString(slotStatus.Rest)
+}
+
+// IEMPSettingsCharControl gives a character slot to a player, like CharOwnerPlayerID in FULLSET
+type IEMPSettingsCharControl struct {
+	CharacterNum uint8
+	PlayerID     uint32
+	Rest         []byte
+}
+
+func (charControl *IEMPSettingsCharControl) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEMPSettingsCharControl", data)
+	reader.read("CharacterNum", &charControl.CharacterNum)
+	reader.read("PlayerID", &charControl.PlayerID)
+	charControl.Rest = reader.rest()
+	return reader.err
+}
+
+func (charControl IEMPSettingsCharControl) Marshal() ([]byte, error) {
+	return marshalSpecFields(charControl.CharacterNum, charControl.PlayerID, charControl.Rest)
+}
+
+func (charControl IEMPSettingsCharControl) String() string {
+	return fmt.Sprintf("Character %d is controlled by Player 0x%x", charControl.CharacterNum, charControl.PlayerID) + restString(charControl.Rest)
+}
+
+// IEMPSettingsPlayerReady is the whole player being ready, rather than one of their characters
+type IEMPSettingsPlayerReady struct {
+	PlayerID    uint32
+	ReadyStatus uint32
+	Rest        []byte
+}
+
+func (playerReady *IEMPSettingsPlayerReady) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEMPSettingsPlayerReady", data)
+	reader.read("PlayerID", &playerReady.PlayerID)
+	reader.read("ReadyStatus", &playerReady.ReadyStatus)
+	playerReady.Rest = reader.rest()
+	return reader.err
+}
+
+func (playerReady IEMPSettingsPlayerReady) Marshal() ([]byte, error) {
+	return marshalSpecFields(playerReady.PlayerID, playerReady.ReadyStatus, playerReady.Rest)
+}
+
+func (playerReady IEMPSettingsPlayerReady) String() string {
+	return fmt.Sprintf("Player 0x%x Ready: %d", playerReady.PlayerID, playerReady.ReadyStatus) + restString(playerReady.Rest)
+}
+
+// IEMPSettingsPermission changes one of a player's permissions. Permission is the field's index in Permissions,
+// starting with BuyAndSell.
+type IEMPSettingsPermission struct {
+	PlayerID   uint32
+	Permission uint8
+	Value      uint32
+	Rest       []byte
+}
+
+func (permission *IEMPSettingsPermission) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEMPSettingsPermission", data)
+	reader.read("PlayerID", &permission.PlayerID)
+	reader.read("Permission", &permission.Permission)
+	reader.read("Value", &permission.Value)
+	permission.Rest = reader.rest()
+	return reader.err
+}
+
+func (permission IEMPSettingsPermission) Marshal() ([]byte, error) {
+	return marshalSpecFields(permission.PlayerID, permission.Permission, permission.Value, permission.Rest)
+}
+
+func (permission IEMPSettingsPermission) String() string {
+	return fmt.Sprintf("Player 0x%x Permission %d: %d", permission.PlayerID, permission.Permission, permission.Value) + restString(permission.Rest)
+}
+
+func newIEMPSettingsFullSet() SpecMsg         { return &IEMPSettingsFullSet{} }
+func newIEMPSettingsToggleCharReady() SpecMsg { return &IEMPSettingsToggleCharReady{} }
+func newIEMPSettingsDemand() SpecMsg          { return &IEMPSettingsDemand{} }
+func newIEMPSettingsFlag() SpecMsg            { return &IEMPSettingsFlag{} }
+func newIEMPSettingsBool() SpecMsg            { return &IEMPSettingsBool{} }
+func newIEMPSettingsSlotStatus() SpecMsg      { return &IEMPSettingsSlotStatus{} }
+func newIEMPSettingsCharControl() SpecMsg     { return &IEMPSettingsCharControl{} }
+func newIEMPSettingsPlayerReady() SpecMsg     { return &IEMPSettingsPlayerReady{} }
+func newIEMPSettingsPermission() SpecMsg      { return &IEMPSettingsPermission{} }
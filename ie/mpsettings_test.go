@@ -0,0 +1,108 @@
+package ie
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMPSettingsRoundTrip(t *testing.T) {
+	tests := []struct {
+		subType uint8
+		msg     SpecMsg
+	}{
+		{IE_SPEC_MSG_SUBTYPE_UPDATE_SERVER_ARBITRATION_INFO, &IEMPSettingsFullSet{ImportCharSettings: 1}},
+		{IE_SPEC_MSG_SUBTYPE_TOGGLE_CHAR_READY, &IEMPSettingsToggleCharReady{CharacterNum: 2, ReadyStatus: 1}},
+	}
+	for _, test := range tests {
+		_, name := SpecMsgNames(IE_SPEC_MSG_TYPE_MPSETTINGS, test.subType)
+		packet, err := NewSpecMsgPacket(IEHeader{PlayerIDFrom: 0xad4f6f00, PlayerIDTo: 0x1000000}, IE_SPEC_MSG_TYPE_MPSETTINGS, test.subType, test.msg)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		data, err := packet.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		jmPacket, err := NewJMPacket(data, len(data))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		msg, err := DecodeSpecMsg(jmPacket.SpecType(), jmPacket.SpecSubType(), jmPacket.PacketData())
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if msg.String() != test.msg.String() {
+			t.Errorf("%s: decoded %q, expected %q", name, msg, test.msg)
+		}
+		encoded, err := msg.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, jmPacket.PacketData()) {
+			t.Errorf("%s: round trip mismatch:\n%x\n%x", name, jmPacket.PacketData(), encoded)
+		}
+	}
+}
+
+func TestMPSettingsGuesses(t *testing.T) {
+	testGuesses(t, []guessFixture{
+		{IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_MPSETTINGS_FULLDEMAND, "", "Demand"},
+		{IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_MPSETTINGS_LOCK_REQUEST, "0102", "Demand Rest: 0102"},
+		{IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_MPSETTINGS_PERMISSION, "ad4f6f00" + "01" + "00000001", "Player 0xad4f6f00 Permission 1: 1"},
+		{IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_MPSETTINGS_PLAYER_READY, "ad4f6f00" + "00000001", "Player 0xad4f6f00 Ready: 1"},
+		{IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_MPSETTINGS_CHAR_CONTROL, "03" + "ad4f6f00", "Character 3 is controlled by Player 0xad4f6f00"},
+		{IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_MPSETTINGS_IMPORTING, "02", "Value: 2"},
+		{IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_MPSETTINGS_LISTEN_JOIN, "01" + "aa", "Value: 1 Rest: aa"},
+		{IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_MPSETTINGS_SLOT_STATUS, "05" + "00000003", "Character 5 Status: 3"},
+		{IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_MPSETTINGS_NIGHTMAREMODE, "00000001", "Value: 1"},
+	})
+}
+
+func TestMPSettingsAllRegistered(t *testing.T) {
+	for subType := 0; subType <= 0xff; subType++ {
+		info, ok := LookupSpecMsg(IE_SPEC_MSG_TYPE_MPSETTINGS, uint8(subType))
+		if ok && info.New == nil && info.Guess == nil {
+			t.Errorf("%s has no decoder or guess", info.Name)
+		}
+	}
+}
+
+func TestFullSetPlayers(t *testing.T) {
+	var fullSet IEMPSettingsFullSet
+	for i := range fullSet.Players {
+		fullSet.Players[i].PlayerID = 0x1000000 * uint32(i+1)
+	}
+	fullSet.Players[3].Leader = 1
+	data, err := fullSet.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != IEMPSettingsFullSetSize {
+		t.Fatalf("FULLSET is %d bytes, expected %d", len(data), IEMPSettingsFullSetSize)
+	}
+	// Player 1 has always been at 30, the rest follow on from it
+	for i := range fullSet.Players {
+		offset := 30 + i*PlayerPermissionsSize
+		if data[offset] != byte(i+1) {
+			t.Errorf("player %d isn't at offset %d: %x", i+1, offset, data[offset:offset+PlayerPermissionsSize])
+		}
+	}
+	if data[30+3*PlayerPermissionsSize+4+6] != 1 {
+		t.Error("player 4's Leader permission isn't where it should be")
+	}
+
+	player := fullSet.Player(0x2000000)
+	if player == nil || !player.Set(0, 1) || player.Set(PermissionsSize, 1) {
+		t.Fatal("couldn't set player 2's permission")
+	}
+	if fullSet.Players[1].BuyAndSell != 1 || fullSet.Player(0x7000000) != nil {
+		t.Errorf("unexpected players: %+v", fullSet.Players)
+	}
+
+	fullSet.Players[5] = PlayerPermissions{}
+	str := fullSet.String()
+	if !strings.Contains(str, "Player2Perms (0x2000000):\n\tBuyAndSell: yes") || strings.Contains(str, "Player6Perms") {
+		t.Errorf("unexpected String():\n%s", str)
+	}
+}
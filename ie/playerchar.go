@@ -0,0 +1,152 @@
+package ie
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PLAYERCHAR moves player characters between the host and the clients when they're created or imported, and
+// OBJECT_ADD puts a new creature into an area. Both carry the creature as a CRE file. The CRE itself is the
+// game's own little endian format and is kept byte for byte. What comes before it is a guess, only decoded when
+// asked for: the slot and owner, then the CRE's size.
+
+const IE_SPEC_MSG_TYPE_OBJECT uint8 = 79
+const IE_SPEC_MSG_SUBTYPE_OBJECT_ADD uint8 = 65
+
+const IE_SPEC_MSG_TYPE_PLAYERCHAR uint8 = 80
+const IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_UPDATE_DEMAND uint8 = 85
+const IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_UPDATE_REPLY uint8 = 117
+const IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_DEMAND_SLOT uint8 = 68
+const IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_DEMAND_REPLY uint8 = 100
+
+// IECreature is a CRE file
+type IECreature []byte
+
+// Signature is the file's signature and version, like "CRE V1.0", or "" if it doesn't start with one
+func (cre IECreature) Signature() string {
+	if len(cre) < 8 || string(cre[:4]) != "CRE " {
+		return ""
+	}
+	return string(cre[:8])
+}
+
+func (cre IECreature) String() string {
+	signature := cre.Signature()
+	if signature == "" {
+		signature = "no CRE signature"
+	}
+	return fmt.Sprintf("%d bytes, %s", len(cre), strings.TrimRight(signature, " "))
+}
+
+// creature reads a CRE with a 4 byte length in front of it
+func (reader *specReader) creature(field string, creSize *uint32) IECreature {
+	reader.read(field+"Size", creSize)
+	return IECreature(reader.bytes(field, int(*creSize)))
+}
+
+// IECharacter is a character carried by a PLAYERCHAR or OBJECT_ADD message. Slot is -1 when the message doesn't
+// say which party slot it's for.
+type IECharacter struct {
+	Slot    int
+	OwnerID uint32
+	CRE     IECreature
+}
+
+// CharacterMsg is a spec message that carries a character
+type CharacterMsg interface {
+	SpecMsg
+	Character() IECharacter
+}
+
+// IEPlayerChar is a player character going to or from the host
+type IEPlayerChar struct {
+	CharacterNum uint8
+	PlayerID     uint32
+	CRESize      uint32
+	CRE          IECreature
+	Rest         []byte
+}
+
+func (playerChar *IEPlayerChar) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEPlayerChar", data)
+	reader.read("CharacterNum", &playerChar.CharacterNum)
+	reader.read("PlayerID", &playerChar.PlayerID)
+	playerChar.CRE = reader.creature("CRE", &playerChar.CRESize)
+	playerChar.Rest = reader.rest()
+	return reader.err
+}
+
+// Marshal sets CRESize from CRE
+func (playerChar IEPlayerChar) Marshal() ([]byte, error) {
+	playerChar.CRESize = uint32(len(playerChar.CRE))
+	return marshalSpecFields(playerChar.CharacterNum, playerChar.PlayerID, playerChar.CRESize, []byte(playerChar.CRE), playerChar.Rest)
+}
+
+func (playerChar IEPlayerChar) String() string {
+	return fmt.Sprintf("Character %d Player: 0x%x CRE: %s", playerChar.CharacterNum, playerChar.PlayerID, playerChar.CRE) + restString(playerChar.Rest)
+}
+
+func (playerChar IEPlayerChar) Character() IECharacter {
+	return IECharacter{int(playerChar.CharacterNum), playerChar.PlayerID, playerChar.CRE}
+}
+
+// IEPlayerCharDemand asks the host for the character in a slot
+type IEPlayerCharDemand struct {
+	CharacterNum uint8
+	Rest         []byte
+}
+
+func (demand *IEPlayerCharDemand) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEPlayerCharDemand", data)
+	reader.read("CharacterNum", &demand.CharacterNum)
+	demand.Rest = reader.rest()
+	return reader.err
+}
+
+func (demand IEPlayerCharDemand) Marshal() ([]byte, error) {
+	return marshalSpecFields(demand.CharacterNum, demand.Rest)
+}
+
+func (demand IEPlayerCharDemand) String() string {
+	return fmt.Sprintf("Character %d", demand.CharacterNum) + restString(demand.Rest)
+}
+
+// IEObjectAdd adds a creature to an area
+type IEObjectAdd struct {
+	ObjectID uint32
+	OwnerID  uint32
+	Area     IEResRef
+	Position IEPoint
+	CRESize  uint32
+	CRE      IECreature
+	Rest     []byte
+}
+
+func (objectAdd *IEObjectAdd) Unmarshal(data []byte) error {
+	reader := newSpecReader("IEObjectAdd", data)
+	reader.read("ObjectID", &objectAdd.ObjectID)
+	reader.read("OwnerID", &objectAdd.OwnerID)
+	reader.read("Area", &objectAdd.Area)
+	reader.read("Position", &objectAdd.Position)
+	objectAdd.CRE = reader.creature("CRE", &objectAdd.CRESize)
+	objectAdd.Rest = reader.rest()
+	return reader.err
+}
+
+// Marshal sets CRESize from CRE
+func (objectAdd IEObjectAdd) Marshal() ([]byte, error) {
+	objectAdd.CRESize = uint32(len(objectAdd.CRE))
+	return marshalSpecFields(objectAdd.ObjectID, objectAdd.OwnerID, objectAdd.Area, objectAdd.Position, objectAdd.CRESize, []byte(objectAdd.CRE), objectAdd.Rest)
+}
+
+func (objectAdd IEObjectAdd) String() string {
+	return fmt.Sprintf("Object: 0x%x Owner: 0x%x Area: %s Position: %s CRE: %s", objectAdd.ObjectID, objectAdd.OwnerID, objectAdd.Area, objectAdd.Position, objectAdd.CRE) + restString(objectAdd.Rest)
+}
+
+func (objectAdd IEObjectAdd) Character() IECharacter {
+	return IECharacter{-1, objectAdd.OwnerID, objectAdd.CRE}
+}
+
+func newIEPlayerChar() SpecMsg       { return &IEPlayerChar{} }
+func newIEPlayerCharDemand() SpecMsg { return &IEPlayerCharDemand{} }
+func newIEObjectAdd() SpecMsg        { return &IEObjectAdd{} }
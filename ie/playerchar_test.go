@@ -0,0 +1,52 @@
+package ie
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+var testCRE = IECreature(append([]byte("CRE V1.0"), 0x34, 0x12, 0, 0, 0xff, 0xff, 0xff, 0xff))
+
+func TestPlayerCharGuesses(t *testing.T) {
+	cre := "00000010" + hex.EncodeToString(testCRE)
+	testGuesses(t, []guessFixture{
+		{IE_SPEC_MSG_TYPE_PLAYERCHAR, IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_UPDATE_DEMAND, "01" + "ad4f6f00" + cre, "Character 1 Player: 0xad4f6f00 CRE: 16 bytes, CRE V1.0"},
+		{IE_SPEC_MSG_TYPE_PLAYERCHAR, IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_UPDATE_REPLY, "01" + "ad4f6f00" + cre + "01", "Character 1 Player: 0xad4f6f00 CRE: 16 bytes, CRE V1.0 Rest: 01"},
+		{IE_SPEC_MSG_TYPE_PLAYERCHAR, IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_DEMAND_SLOT, "05", "Character 5"},
+		{IE_SPEC_MSG_TYPE_PLAYERCHAR, IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_DEMAND_REPLY, "05" + "00000000" + "00000000", "Character 5 Player: 0x0 CRE: 0 bytes, no CRE signature"},
+		{IE_SPEC_MSG_TYPE_OBJECT, IE_SPEC_MSG_SUBTYPE_OBJECT_ADD, "00000007" + "01000000" + "4152323630300000" + "00000064000000c8" + cre, "Object: 0x7 Owner: 0x1000000 Area: AR2600 Position: (100, 200) CRE: 16 bytes, CRE V1.0"},
+	})
+
+	payload, _ := hex.DecodeString("02" + "ad4f6f00" + cre)
+	msg, err := GuessSpecMsg(IE_SPEC_MSG_TYPE_PLAYERCHAR, IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_UPDATE_REPLY, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if character := msg.(CharacterMsg).Character(); character.Slot != 2 || !bytes.Equal(character.CRE, testCRE) {
+		t.Errorf("CRE wasn't extracted: %+v", character)
+	}
+}
+
+func TestCharacter(t *testing.T) {
+	playerChar := IEPlayerChar{CharacterNum: 2, PlayerID: 0xad4f6f00, CRE: testCRE}
+	if character := playerChar.Character(); character.Slot != 2 || character.OwnerID != 0xad4f6f00 {
+		t.Errorf("unexpected character: %+v", character)
+	}
+	if character := (IEObjectAdd{OwnerID: 0x1000000, CRE: testCRE}).Character(); character.Slot != -1 || character.OwnerID != 0x1000000 {
+		t.Errorf("unexpected character: %+v", character)
+	}
+	if testCRE.Signature() != "CRE V1.0" || IECreature("CHR V2.0").Signature() != "" || IECreature("CRE").Signature() != "" {
+		t.Error("wrong CRE signatures")
+	}
+}
+
+func TestPlayerCharCRESizePastEnd(t *testing.T) {
+	data := []byte{1, 0xad, 0x4f, 0x6f, 0, 0xff, 0xff, 0xff, 0xff, 'C', 'R', 'E'}
+	_, err := GuessSpecMsg(IE_SPEC_MSG_TYPE_PLAYERCHAR, IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_UPDATE_REPLY, data)
+	var packetErr *PacketError
+	if !errors.As(err, &packetErr) || packetErr.Field != "IEPlayerChar.CRE" {
+		t.Errorf("expected a short IEPlayerChar.CRE, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package ie
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Everything in this package was worked out from BG1. The other games run on the same engine, so most of it probably
+// holds, but until someone captures them we can't say which message IDs or layouts differ. A GameProfile keeps what's
+// known per game: the port, the DPlay application GUIDs and VERSION_SERVER strings that identify it, and any spec
+// messages that differ from the shared registry. Captured says whether the shared layouts have been checked against
+// the game at all. For a game where they haven't, LookupSpecMsg hands the shared layouts back as guesses, so they're
+// only decoded or sent when guesses are asked for, the same as any other layout nobody has checked.
+//
+// We haven't seen the application GUIDs or version strings of any game on the wire and we don't ship data we
+// haven't seen, so none are built in. They're added at runtime, with iemitm's -guid and -version-string flags, and
+// a game's own layouts are added with RegisterSpecMsg. Without them the game has to be picked by name.
+
+type GameProfile struct {
+	Name     string // What it's picked by, e.g. bg1
+	Title    string
+	GamePort int  // The UDP port the IE frames go over. 0 if we don't know.
+	Captured bool // The layouts in this package have been checked against captures of this game
+
+	lock           sync.RWMutex
+	appGUIDs       [][16]byte // As they are on the wire
+	versionStrings []string
+	specMsgs       map[uint16]*SpecMsgInfo
+}
+
+// The game port we've seen BG1 use. The other DPlay games are assumed to use it too.
+const DefaultGamePort int = 2350
+
+var profiles = map[string]*GameProfile{
+	"bg1": {Name: "bg1", Title: "Baldur's Gate", GamePort: DefaultGamePort, Captured: true},
+	"bg2": {Name: "bg2", Title: "Baldur's Gate II", GamePort: DefaultGamePort},
+	"iwd": {Name: "iwd", Title: "Icewind Dale", GamePort: DefaultGamePort},
+	// Planescape: Torment has no multiplayer, the profile is only here so it can be named
+	"pst": {Name: "pst", Title: "Planescape: Torment"},
+	// The Enhanced Editions don't use DirectPlay as far as we know, so nothing here is likely to apply
+	"ee": {Name: "ee", Title: "Enhanced Editions"},
+}
+
+// DefaultProfile is the game everything was worked out from
+func DefaultProfile() *GameProfile {
+	return profiles["bg1"]
+}
+
+// LookupProfile finds a profile by name, ignoring case
+func LookupProfile(name string) (*GameProfile, bool) {
+	profile, ok := profiles[strings.ToLower(name)]
+	return profile, ok
+}
+
+// Profiles returns every profile, sorted by name
+func Profiles() []*GameProfile {
+	ret := make([]*GameProfile, 0, len(profiles))
+	for _, profile := range profiles {
+		ret = append(ret, profile)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// ProfileForAppGUID finds the profile with a DPlay application GUID, as it is on the wire
+func ProfileForAppGUID(guid [16]byte) (*GameProfile, bool) {
+	for _, profile := range Profiles() {
+		profile.lock.RLock()
+		for _, appGUID := range profile.appGUIDs {
+			if appGUID == guid {
+				profile.lock.RUnlock()
+				return profile, true
+			}
+		}
+		profile.lock.RUnlock()
+	}
+	return nil, false
+}
+
+// ProfileForVersion finds the profile with a VERSION_SERVER VersionString
+func ProfileForVersion(versionString string) (*GameProfile, bool) {
+	for _, profile := range Profiles() {
+		profile.lock.RLock()
+		for _, known := range profile.versionStrings {
+			if known == versionString {
+				profile.lock.RUnlock()
+				return profile, true
+			}
+		}
+		profile.lock.RUnlock()
+	}
+	return nil, false
+}
+
+// AddAppGUID teaches the profile a DPlay application GUID, as it is on the wire
+func (profile *GameProfile) AddAppGUID(guid [16]byte) {
+	profile.lock.Lock()
+	defer profile.lock.Unlock()
+	profile.appGUIDs = append(profile.appGUIDs, guid)
+}
+
+// AddVersionString teaches the profile a VERSION_SERVER VersionString
+func (profile *GameProfile) AddVersionString(versionString string) {
+	profile.lock.Lock()
+	defer profile.lock.Unlock()
+	profile.versionStrings = append(profile.versionStrings, versionString)
+}
+
+// RegisterSpecMsg overrides the shared registry entry for a spec message in this game only
+func (profile *GameProfile) RegisterSpecMsg(info SpecMsgInfo) {
+	profile.lock.Lock()
+	defer profile.lock.Unlock()
+	if profile.specMsgs == nil {
+		profile.specMsgs = make(map[uint16]*SpecMsgInfo)
+	}
+	if info.TypeName == "" {
+		info.TypeName = specMsgTypeNames[info.Type]
+	}
+	profile.specMsgs[specMsgKey(info.Type, info.SubType)] = &info
+}
+
+// LookupSpecMsg returns the game's registry entry for a spec message, falling back to the shared one, which is only
+// a guess unless the game is Captured. A nil profile only uses the shared registry.
+func (profile *GameProfile) LookupSpecMsg(msgType, msgSubType uint8) (SpecMsgInfo, bool) {
+	if profile != nil {
+		profile.lock.RLock()
+		info, ok := profile.specMsgs[specMsgKey(msgType, msgSubType)]
+		profile.lock.RUnlock()
+		if ok {
+			return *info, true
+		}
+	}
+	info, ok := LookupSpecMsg(msgType, msgSubType)
+	if profile != nil && !profile.Captured && info.New != nil {
+		// Checked against BG1, not this game
+		info.Guess, info.New = info.New, nil
+	}
+	return info, ok
+}
+
+// DecodeSpecMsg is DecodeSpecMsg with the game's overrides
+func (profile *GameProfile) DecodeSpecMsg(msgType, msgSubType uint8, data []byte) (SpecMsg, error) {
+	info, ok := profile.LookupSpecMsg(msgType, msgSubType)
+	if !ok || info.New == nil {
+		return nil, noSpecDecoder(msgType, msgSubType)
+	}
+	return unmarshalSpecMsg(info.New(), data)
+}
+
+// GuessSpecMsg is GuessSpecMsg with the game's overrides
+func (profile *GameProfile) GuessSpecMsg(msgType, msgSubType uint8, data []byte) (SpecMsg, error) {
+	info, ok := profile.LookupSpecMsg(msgType, msgSubType)
+	if !ok || info.New != nil || info.Guess == nil {
+		return profile.DecodeSpecMsg(msgType, msgSubType, data)
+	}
+	return unmarshalSpecMsg(info.Guess(), data)
+}
+
+func (profile *GameProfile) String() string {
+	ret := fmt.Sprintf("%s (%s)", profile.Name, profile.Title)
+	if profile.GamePort != 0 {
+		ret += fmt.Sprintf(" Port: %d", profile.GamePort)
+	} else {
+		ret += " Port: unknown"
+	}
+	if !profile.Captured {
+		ret += " - layouts not checked against this game"
+	}
+	return ret
+}
@@ -0,0 +1,97 @@
+package ie
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLookupProfile(t *testing.T) {
+	profile, ok := LookupProfile("BG2")
+	if !ok || profile.Name != "bg2" || profile.Captured {
+		t.Errorf("unexpected bg2 profile: %v", profile)
+	}
+	if !DefaultProfile().Captured || DefaultProfile().GamePort != DefaultGamePort {
+		t.Errorf("unexpected default profile: %s", DefaultProfile())
+	}
+	if _, ok := LookupProfile("bg3"); ok {
+		t.Error("found a profile that doesn't exist")
+	}
+	if profiles := Profiles(); len(profiles) != 5 || profiles[0].Name != "bg1" {
+		t.Errorf("unexpected profiles: %v", profiles)
+	}
+}
+
+func TestDetectProfile(t *testing.T) {
+	profile := &GameProfile{Name: "test"}
+	profiles["test"] = profile
+	defer delete(profiles, "test")
+
+	guid := [16]byte{1, 2, 3}
+	if _, ok := ProfileForAppGUID(guid); ok {
+		t.Fatal("detected a GUID nobody added")
+	}
+	profile.AddAppGUID(guid)
+	if detected, ok := ProfileForAppGUID(guid); !ok || detected != profile {
+		t.Errorf("GUID detected as %v", detected)
+	}
+	profile.AddVersionString("test v1")
+	if detected, ok := ProfileForVersion("test v1"); !ok || detected != profile {
+		t.Errorf("version detected as %v", detected)
+	}
+	if _, ok := ProfileForVersion("test v2"); ok {
+		t.Error("detected a version nobody added")
+	}
+}
+
+// testOverride decodes the whole payload as a version string, standing in for a game with a different layout
+type testOverride struct{ Data string }
+
+func (msg *testOverride) Unmarshal(data []byte) error { msg.Data = string(data); return nil }
+func (msg testOverride) Marshal() ([]byte, error)     { return []byte(msg.Data), nil }
+func (msg testOverride) String() string               { return msg.Data }
+
+func TestProfileSpecMsgOverride(t *testing.T) {
+	profile := &GameProfile{Name: "test"}
+	profile.RegisterSpecMsg(SpecMsgInfo{Type: IE_SPEC_MSG_TYPE_VERSION, SubType: IE_SPEC_MSG_SUBTYPE_VERSION_SERVER, Name: "TEST", New: func() SpecMsg { return &testOverride{} }})
+
+	info, ok := profile.LookupSpecMsg(IE_SPEC_MSG_TYPE_VERSION, IE_SPEC_MSG_SUBTYPE_VERSION_SERVER)
+	if !ok || info.Name != "TEST" || info.TypeName != specMsgTypeNames[IE_SPEC_MSG_TYPE_VERSION] {
+		t.Errorf("unexpected override: %+v", info)
+	}
+	msg, err := profile.DecodeSpecMsg(IE_SPEC_MSG_TYPE_VERSION, IE_SPEC_MSG_SUBTYPE_VERSION_SERVER, testVersionPayload)
+	if _, ok := msg.(*testOverride); err != nil || !ok {
+		t.Errorf("override wasn't used: %T %v", msg, err)
+	}
+
+	// Everything else, and a nil profile, uses the shared registry
+	var shared *GameProfile
+	msg, err = shared.DecodeSpecMsg(IE_SPEC_MSG_TYPE_VERSION, IE_SPEC_MSG_SUBTYPE_VERSION_SERVER, testVersionPayload)
+	if _, ok := msg.(*IEVersion); err != nil || !ok {
+		t.Errorf("shared registry wasn't used: %T %v", msg, err)
+	}
+	if _, err := profile.DecodeSpecMsg(0xfe, 0xfe, nil); !errors.Is(err, ErrNoSpecDecoder) {
+		t.Errorf("expected ErrNoSpecDecoder, got %v", err)
+	}
+}
+
+// Layouts only checked against BG1 are guesses for the other games
+func TestProfileUncheckedLayouts(t *testing.T) {
+	bg2, _ := LookupProfile("bg2")
+	info, ok := bg2.LookupSpecMsg(IE_SPEC_MSG_TYPE_VERSION, IE_SPEC_MSG_SUBTYPE_VERSION_SERVER)
+	if !ok || info.New != nil || info.Guess == nil {
+		t.Errorf("VERSION_SERVER isn't a guess for bg2: %+v", info)
+	}
+	if _, err := bg2.DecodeSpecMsg(IE_SPEC_MSG_TYPE_VERSION, IE_SPEC_MSG_SUBTYPE_VERSION_SERVER, testVersionPayload); !errors.Is(err, ErrNoSpecDecoder) {
+		t.Errorf("expected ErrNoSpecDecoder, got %v", err)
+	}
+	if msg, err := bg2.GuessSpecMsg(IE_SPEC_MSG_TYPE_VERSION, IE_SPEC_MSG_SUBTYPE_VERSION_SERVER, testVersionPayload); err != nil {
+		t.Error(err)
+	} else if _, ok := msg.(*IEVersion); !ok {
+		t.Errorf("guessed as %T", msg)
+	}
+	if msg, err := DefaultProfile().DecodeSpecMsg(IE_SPEC_MSG_TYPE_VERSION, IE_SPEC_MSG_SUBTYPE_VERSION_SERVER, testVersionPayload); err != nil {
+		t.Error(err)
+	} else if _, ok := msg.(*IEVersion); !ok {
+		t.Errorf("decoded as %T", msg)
+	}
+}
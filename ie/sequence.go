@@ -0,0 +1,342 @@
+package ie
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The game runs its own reliability layer over UDP. This is our model of it, worked out from captures rather than
+// anything official:
+//
+// Frames carrying data have FrameKind 0 and a FrameNum that goes up by one per frame in each direction, wrapping at
+// 0xffff. FrameExpected is a cumulative ack: the FrameNum the sender wants next from the other side. Frames are sent
+// again with the same FrameNum until they're acked. Header only frames, kind 1 or 2, are pings that just carry
+// FrameExpected. The ping we captured has a FrameNum of 0.
+//
+// Injecting a frame puts a FrameNum on the wire that the sender doesn't know about, so everything the sender sends
+// after it has to be moved up by one, and the receiver's acks moved back down before the sender sees them. Dropping
+// a frame is the other way around. SequenceTracker does that bookkeeping. The sender won't retransmit a frame it
+// doesn't know about either, so the tracker keeps injected frames until they're acked and Unacked hands them back to
+// be sent again.
+
+const IE_FRAME_KIND_DATA uint8 = 0
+const IE_FRAME_KIND_PING_1 uint8 = 1
+const IE_FRAME_KIND_PING_2 uint8 = 2
+
+// seqAfter reports whether a comes after b, allowing for FrameNum wrapping around
+func seqAfter(a, b uint16) bool {
+	return int16(a-b) > 0
+}
+
+// isDataFrame reports whether a frame takes up a FrameNum
+func isDataFrame(header IEHeader, size int) bool {
+	return size > IEHeaderSize && header.FrameKind_ == IE_FRAME_KIND_DATA
+}
+
+// FrameDirection is one side's stream of frames to the other
+type FrameDirection struct {
+	From uint32
+	To   uint32
+}
+
+func (direction FrameDirection) reverse() FrameDirection {
+	return FrameDirection{direction.To, direction.From}
+}
+
+// FrameInfo is what the tracker made of a frame
+type FrameInfo struct {
+	FrameDirection
+	Data       bool   // The frame takes up a FrameNum
+	FrameNum   uint16 // The sender's FrameNum, before any renumbering
+	Retransmit bool   // We've seen this FrameNum before
+	Drop       bool   // This is a retransmit of a frame that was dropped or already acked, so it has to be dropped
+	Rewritten  bool   // FrameNum or FrameExpected was renumbered, and the CRC fixed
+}
+
+// SequenceStats counts what happened to one direction's frames
+type SequenceStats struct {
+	Frames      int
+	Retransmits int
+	Injected    int
+	Resent      int // Injected frames we sent again because they weren't acked
+	Dropped     int
+	LastSent    uint16 // The last FrameNum put on the wire
+	Acked       uint16 // The last FrameExpected the other side sent, as it was on the wire
+}
+
+func (stats SequenceStats) String() string {
+	return fmt.Sprintf("Frames: %d Retransmits: %d Injected: %d Resent: %d Dropped: %d LastSent: 0x%x Acked: 0x%x", stats.Frames, stats.Retransmits, stats.Injected, stats.Resent, stats.Dropped, stats.LastSent, stats.Acked)
+}
+
+type sentFrame struct {
+	original uint16
+	wire     uint16
+	injected bool
+	data     []byte // An injected frame, once we've been given it, to send again until it's acked
+	sentAt   time.Time
+}
+
+// InjectedFrame is an injected frame that hasn't been acked
+type InjectedFrame struct {
+	FrameDirection
+	Data []byte
+}
+
+// How many frames we remember in each direction. The game never has anywhere near this many waiting for an ack.
+const maxSentFrames = 0x1000
+
+type frameStream struct {
+	started    bool
+	renumbered bool   // Once we've injected or dropped something, FrameNums on the wire aren't the sender's any more
+	highest    uint16 // The highest FrameNum the sender has used
+	lastSent   uint16
+	shift      uint16 // What to add to the sender's next new FrameNum
+	expected   uint16 // The last FrameExpected we put on the wire in this direction
+	droppable  bool   // The last data frame was new, so Drop can take it back
+	sent       []sentFrame
+	dropped    map[uint16]bool
+	stats      SequenceStats
+}
+
+// toOriginal turns an ack of this stream, as it was on the wire, into the FrameNum the sender knows it as
+func (stream *frameStream) toOriginal(ack uint16) uint16 {
+	if !stream.renumbered {
+		return ack
+	}
+	for _, frame := range stream.sent {
+		if !seqAfter(ack, frame.wire) {
+			return frame.original
+		}
+	}
+	return stream.highest + 1
+}
+
+// prune forgets the frames the receiver has acked
+func (stream *frameStream) prune(ack uint16) {
+	i := 0
+	for i < len(stream.sent) && seqAfter(ack, stream.sent[i].wire) {
+		i++
+	}
+	stream.sent = stream.sent[i:]
+}
+
+func (stream *frameStream) add(frame sentFrame) {
+	if len(stream.sent) == maxSentFrames {
+		stream.sent = stream.sent[1:]
+	}
+	stream.sent = append(stream.sent, frame)
+}
+
+// SequenceTracker follows FrameNum and FrameExpected in both directions between each pair of players, and renumbers
+// frames around the ones we inject or drop so both sides still agree on what they've received
+type SequenceTracker struct {
+	lock    sync.Mutex
+	streams map[FrameDirection]*frameStream
+}
+
+func NewSequenceTracker() *SequenceTracker {
+	return &SequenceTracker{streams: make(map[FrameDirection]*frameStream)}
+}
+
+func (tracker *SequenceTracker) stream(direction FrameDirection) *frameStream {
+	stream, ok := tracker.streams[direction]
+	if !ok {
+		stream = &frameStream{dropped: make(map[uint16]bool)}
+		tracker.streams[direction] = stream
+	}
+	return stream
+}
+
+func readFrameHeader(frame []byte) (IEHeader, error) {
+	if len(frame) < IEHeaderSize {
+		return IEHeader{}, &PacketError{ErrShortPacket, "IEHeader", IEHeaderSize, len(frame)}
+	}
+	return IEHeader{
+		PlayerIDFrom:  binary.BigEndian.Uint32(frame[0:]),
+		PlayerIDTo:    binary.BigEndian.Uint32(frame[4:]),
+		FrameKind_:    frame[8],
+		FrameNum:      binary.BigEndian.Uint16(frame[9:]),
+		FrameExpected: binary.BigEndian.Uint16(frame[11:]),
+		Compressed:    frame[13],
+		CRC32:         binary.BigEndian.Uint32(frame[14:]),
+	}, nil
+}
+
+// Forward records a frame on its way to the other side. If we've injected or dropped frames the FrameNum and
+// FrameExpected are renumbered in place and the CRC is fixed. Call Drop instead, or afterwards, for a frame that
+// isn't going to be sent on.
+func (tracker *SequenceTracker) Forward(frame []byte) (FrameInfo, error) {
+	header, err := readFrameHeader(frame)
+	if err != nil {
+		return FrameInfo{}, err
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	direction := FrameDirection{header.PlayerIDFrom, header.PlayerIDTo}
+	info := FrameInfo{FrameDirection: direction, Data: isDataFrame(header, len(frame)), FrameNum: header.FrameNum}
+	stream := tracker.stream(direction)
+	frameNum := header.FrameNum
+	if info.Data {
+		stream.stats.Frames++
+		if !stream.started {
+			stream.started = true
+			stream.highest = frameNum - 1
+		}
+		if !seqAfter(frameNum, stream.highest) {
+			info.Retransmit = true
+			stream.stats.Retransmits++
+			stream.droppable = false
+			if stream.dropped[frameNum] {
+				info.Drop = true
+				return info, nil
+			}
+			wire, found := frameNum+stream.shift, false
+			for _, sent := range stream.sent {
+				if sent.original == frameNum && !sent.injected {
+					wire, found = sent.wire, true
+					break
+				}
+			}
+			if !found && stream.renumbered {
+				// We've forgotten it because the receiver acked it. Its number now could belong to a frame we
+				// injected since, and the receiver doesn't need it again.
+				info.Drop = true
+				return info, nil
+			}
+			frameNum = wire
+		} else {
+			stream.highest = frameNum
+			stream.droppable = true
+			frameNum += stream.shift
+			stream.lastSent = frameNum
+			stream.add(sentFrame{original: header.FrameNum, wire: frameNum})
+			for dropped := range stream.dropped {
+				if stream.highest-dropped > maxSentFrames {
+					delete(stream.dropped, dropped)
+				}
+			}
+		}
+	}
+
+	// FrameExpected acks the other direction's frames, as they were on the wire
+	other := tracker.stream(direction.reverse())
+	other.stats.Acked = header.FrameExpected
+	expected := other.toOriginal(header.FrameExpected)
+	other.prune(header.FrameExpected)
+	stream.expected = expected
+
+	if frameNum != header.FrameNum || expected != header.FrameExpected {
+		binary.BigEndian.PutUint16(frame[9:], frameNum)
+		binary.BigEndian.PutUint16(frame[11:], expected)
+		binary.BigEndian.PutUint32(frame[IEHeaderSize-4:], FrameCRC(frame))
+		info.Rewritten = true
+	}
+	return info, nil
+}
+
+// Drop takes back the last frame passed to Forward, which isn't going to be sent on after all. Later frames from
+// the same sender are moved down to close the gap and retransmits of it will come back from Forward with Drop set.
+func (tracker *SequenceTracker) Drop(frame []byte) error {
+	header, err := readFrameHeader(frame)
+	if err != nil {
+		return err
+	}
+	if !isDataFrame(header, len(frame)) {
+		return nil
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	stream := tracker.stream(FrameDirection{header.PlayerIDFrom, header.PlayerIDTo})
+	last := len(stream.sent) - 1
+	if !stream.droppable || last < 0 || stream.sent[last].wire != header.FrameNum {
+		// Only a frame we've just forwarded for the first time can be taken back
+		return nil
+	}
+	stream.droppable = false
+	stream.dropped[stream.highest] = true
+	stream.sent = stream.sent[:last]
+	stream.lastSent--
+	stream.shift--
+	stream.renumbered = true
+	stream.stats.Dropped++
+	return nil
+}
+
+// Next gives the header for a frame we're injecting from one player to another, and moves the sender's later frames
+// up to make room for it. We need to have seen a data frame from the sender first to know where its FrameNums are,
+// so it returns false until we have. The frame has to be sent, or the receiver will wait for it forever, and passed
+// to Injected so it can be sent again if it's lost.
+func (tracker *SequenceTracker) Next(from, to uint32) (IEHeader, bool) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	stream, ok := tracker.streams[FrameDirection{from, to}]
+	if !ok || !stream.started {
+		return IEHeader{}, false
+	}
+	stream.lastSent++
+	stream.shift++
+	stream.renumbered = true
+	stream.stats.Injected++
+	// An injected frame has no original, so acks for it count as acks for whatever the sender sends next
+	stream.add(sentFrame{original: stream.highest + 1, wire: stream.lastSent, injected: true})
+	return IEHeader{PlayerIDFrom: from, PlayerIDTo: to, FrameKind_: IE_FRAME_KIND_DATA, FrameNum: stream.lastSent, FrameExpected: stream.expected}, true
+}
+
+// Injected hands the tracker a frame built with a header from Next, so Unacked can give it back until it's acked
+func (tracker *SequenceTracker) Injected(frame []byte, now time.Time) error {
+	header, err := readFrameHeader(frame)
+	if err != nil {
+		return err
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	stream := tracker.stream(FrameDirection{header.PlayerIDFrom, header.PlayerIDTo})
+	for i := range stream.sent {
+		if sent := &stream.sent[i]; sent.injected && sent.wire == header.FrameNum {
+			sent.data = append([]byte{}, frame...)
+			sent.sentAt = now
+		}
+	}
+	return nil
+}
+
+// Unacked returns the injected frames that were last sent at least interval ago and still haven't been acked, with
+// FrameExpected brought up to date. They count as sent again now.
+func (tracker *SequenceTracker) Unacked(now time.Time, interval time.Duration) []InjectedFrame {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	var ret []InjectedFrame
+	for direction, stream := range tracker.streams {
+		for i := range stream.sent {
+			sent := &stream.sent[i]
+			if sent.data == nil || now.Sub(sent.sentAt) < interval {
+				continue
+			}
+			binary.BigEndian.PutUint16(sent.data[11:], stream.expected)
+			binary.BigEndian.PutUint32(sent.data[IEHeaderSize-4:], FrameCRC(sent.data))
+			sent.sentAt = now
+			stream.stats.Resent++
+			ret = append(ret, InjectedFrame{direction, append([]byte{}, sent.data...)})
+		}
+	}
+	return ret
+}
+
+// Stats returns the counts for each direction we've seen
+func (tracker *SequenceTracker) Stats() map[FrameDirection]SequenceStats {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	stats := make(map[FrameDirection]SequenceStats, len(tracker.streams))
+	for direction, stream := range tracker.streams {
+		stream.stats.LastSent = stream.lastSent
+		stats[direction] = stream.stats
+	}
+	return stats
+}
@@ -0,0 +1,215 @@
+package ie
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+const testHost, testClient uint32 = 0x1000000, 0xad4f6f00
+
+// testFrame builds a data frame, or a ping if data is nil, with a correct CRC
+func testFrame(from, to uint32, frameNum, frameExpected uint16, data []byte) []byte {
+	frame := make([]byte, IEHeaderSize, IEHeaderSize+len(data))
+	binary.BigEndian.PutUint32(frame[0:], from)
+	binary.BigEndian.PutUint32(frame[4:], to)
+	if data == nil {
+		frame[8] = IE_FRAME_KIND_PING_2
+	}
+	binary.BigEndian.PutUint16(frame[9:], frameNum)
+	binary.BigEndian.PutUint16(frame[11:], frameExpected)
+	frame = append(frame, data...)
+	binary.BigEndian.PutUint32(frame[IEHeaderSize-4:], FrameCRC(frame))
+	return frame
+}
+
+func forward(t *testing.T, tracker *SequenceTracker, frame []byte) (FrameInfo, IEHeader) {
+	t.Helper()
+	info, err := tracker.Forward(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, _ := readFrameHeader(frame)
+	if header.CRC32 != FrameCRC(frame) {
+		t.Fatalf("CRC wasn't fixed: %s", header)
+	}
+	return info, header
+}
+
+func TestSeqAfter(t *testing.T) {
+	if !seqAfter(1, 0) || seqAfter(0, 1) || seqAfter(5, 5) {
+		t.Error("seqAfter is wrong without wrapping")
+	}
+	if !seqAfter(0, 0xffff) || !seqAfter(3, 0xfff0) || seqAfter(0xfff0, 3) {
+		t.Error("seqAfter is wrong across the wrap")
+	}
+}
+
+func TestSequenceTrackerPassesThrough(t *testing.T) {
+	tracker := NewSequenceTracker()
+	frames := [][]byte{
+		testFrame(testHost, testClient, 0xfffe, 7, []byte{1}),
+		testFrame(testClient, testHost, 7, 0xffff, []byte{2}),
+		testFrame(testHost, testClient, 0xffff, 8, []byte{3}),
+		testFrame(testHost, testClient, 0xffff, 8, []byte{3}),
+		testFrame(testHost, testClient, 0, 8, []byte{4}),
+		testFrame(testClient, testHost, 0, 1, nil),
+	}
+	for i, frame := range frames {
+		original := append([]byte{}, frame...)
+		info, _ := forward(t, tracker, frame)
+		if info.Rewritten || string(frame) != string(original) {
+			t.Errorf("frame %d was rewritten with nothing injected or dropped", i)
+		}
+		if info.Retransmit != (i == 3) {
+			t.Errorf("frame %d: Retransmit is %t", i, info.Retransmit)
+		}
+	}
+	stats := tracker.Stats()[FrameDirection{testHost, testClient}]
+	if stats.Frames != 4 || stats.Retransmits != 1 || stats.LastSent != 0 || stats.Acked != 1 {
+		t.Errorf("unexpected stats: %s", stats)
+	}
+}
+
+func TestSequenceTrackerInject(t *testing.T) {
+	tracker := NewSequenceTracker()
+	// Nothing from the host yet, so there's nowhere to put a frame
+	if _, ok := tracker.Next(testHost, testClient); ok {
+		t.Fatal("got a header before the host sent anything")
+	}
+	// Pings don't say where the host's FrameNums are either
+	forward(t, tracker, testFrame(testHost, testClient, 0, 5, nil))
+	if _, ok := tracker.Next(testHost, testClient); ok {
+		t.Fatal("got a header with only a ping from the host")
+	}
+	forward(t, tracker, testFrame(testHost, testClient, 10, 5, []byte{1}))
+
+	injected, ok := tracker.Next(testHost, testClient)
+	if !ok || injected.FrameNum != 11 || injected.FrameExpected != 5 || injected.PlayerIDFrom != testHost {
+		t.Fatalf("unexpected injected header: %s", injected)
+	}
+
+	// The host doesn't know about 11, so its 11 goes out as 12
+	_, header := forward(t, tracker, testFrame(testHost, testClient, 11, 5, []byte{2}))
+	if header.FrameNum != 12 {
+		t.Errorf("host's 11 went out as 0x%x", header.FrameNum)
+	}
+	// Retransmits keep the number they went out with
+	info, header := forward(t, tracker, testFrame(testHost, testClient, 11, 5, []byte{2}))
+	if !info.Retransmit || header.FrameNum != 12 {
+		t.Errorf("retransmit of 11 went out as 0x%x", header.FrameNum)
+	}
+
+	// The client's acks are moved back into the host's numbering
+	for _, test := range []struct{ wire, host uint16 }{{11, 11}, {12, 11}, {13, 12}} {
+		_, header := forward(t, tracker, testFrame(testClient, testHost, 5, test.wire, nil))
+		if header.FrameExpected != test.host {
+			t.Errorf("client's ack of 0x%x reached the host as 0x%x, expected 0x%x", test.wire, header.FrameExpected, test.host)
+		}
+	}
+	// The client's frames aren't touched
+	if _, header := forward(t, tracker, testFrame(testClient, testHost, 5, 13, []byte{3})); header.FrameNum != 5 {
+		t.Errorf("client's frame renumbered to 0x%x", header.FrameNum)
+	}
+	if stats := tracker.Stats()[FrameDirection{testHost, testClient}]; stats.Injected != 1 || stats.LastSent != 12 {
+		t.Errorf("unexpected stats: %s", stats)
+	}
+}
+
+func TestSequenceTrackerDrop(t *testing.T) {
+	tracker := NewSequenceTracker()
+	forward(t, tracker, testFrame(testHost, testClient, 0xffff, 0, []byte{1}))
+	dropped := testFrame(testHost, testClient, 0, 0, []byte{2})
+	forward(t, tracker, dropped)
+	if err := tracker.Drop(dropped); err != nil {
+		t.Fatal(err)
+	}
+
+	// Retransmits of the dropped frame are dropped too
+	if info, _ := forward(t, tracker, testFrame(testHost, testClient, 0, 0, []byte{2})); !info.Drop {
+		t.Error("retransmit of a dropped frame wasn't dropped")
+	}
+	// The client acking 0 means it has everything up to the dropped frame, which the host takes as an ack of it
+	if _, header := forward(t, tracker, testFrame(testClient, testHost, 0, 0, nil)); header.FrameExpected != 1 {
+		t.Errorf("client's ack reached the host as 0x%x", header.FrameExpected)
+	}
+	// The host's next frame closes the gap
+	if _, header := forward(t, tracker, testFrame(testHost, testClient, 1, 0, []byte{3})); header.FrameNum != 0 {
+		t.Errorf("host's 1 went out as 0x%x", header.FrameNum)
+	}
+	// Another retransmit of the dropped frame has the number the host's 1 went out as, but it mustn't take that back
+	retransmit := testFrame(testHost, testClient, 0, 0, []byte{2})
+	forward(t, tracker, retransmit)
+	tracker.Drop(retransmit)
+	if _, header := forward(t, tracker, testFrame(testClient, testHost, 0, 1, nil)); header.FrameExpected != 2 {
+		t.Errorf("client's ack reached the host as 0x%x", header.FrameExpected)
+	}
+
+	// Pings and frames we've already moved past can't be dropped
+	if err := tracker.Drop(testFrame(testHost, testClient, 0, 0, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if stats := tracker.Stats()[FrameDirection{testHost, testClient}]; stats.Dropped != 1 {
+		t.Errorf("unexpected stats: %s", stats)
+	}
+}
+
+func TestSequenceTrackerRetransmitAfterAck(t *testing.T) {
+	tracker := NewSequenceTracker()
+	forward(t, tracker, testFrame(testHost, testClient, 10, 5, []byte{1}))
+	forward(t, tracker, testFrame(testClient, testHost, 5, 11, nil))
+	if injected, ok := tracker.Next(testHost, testClient); !ok || injected.FrameNum != 11 {
+		t.Fatalf("unexpected injected header: %s", injected)
+	}
+	// The client already has 10, and going out as 11 would make it the frame we injected
+	if info, _ := forward(t, tracker, testFrame(testHost, testClient, 10, 5, []byte{1})); !info.Retransmit || !info.Drop {
+		t.Errorf("late retransmit of an acked frame wasn't dropped: %+v", info)
+	}
+}
+
+func TestSequenceTrackerResendInjected(t *testing.T) {
+	tracker := NewSequenceTracker()
+	start := time.Unix(1000, 0)
+	forward(t, tracker, testFrame(testHost, testClient, 10, 5, []byte{1}))
+	header, ok := tracker.Next(testHost, testClient)
+	if !ok {
+		t.Fatal("no header for the host")
+	}
+	injected := testFrame(header.PlayerIDFrom, header.PlayerIDTo, header.FrameNum, header.FrameExpected, []byte{2})
+	if err := tracker.Injected(injected, start); err != nil {
+		t.Fatal(err)
+	}
+
+	if frames := tracker.Unacked(start.Add(500*time.Millisecond), time.Second); len(frames) != 0 {
+		t.Errorf("resent before the interval: %x", frames)
+	}
+	// The host has acked another of the client's frames since, which goes in the resent FrameExpected
+	forward(t, tracker, testFrame(testClient, testHost, 5, 11, []byte{3}))
+	forward(t, tracker, testFrame(testHost, testClient, 0, 6, nil))
+	frames := tracker.Unacked(start.Add(time.Second), time.Second)
+	if len(frames) != 1 || frames[0].From != testHost || frames[0].To != testClient {
+		t.Fatalf("unexpected frames to resend: %+v", frames)
+	}
+	resent, _ := readFrameHeader(frames[0].Data)
+	if resent.FrameNum != 11 || resent.FrameExpected != 6 || resent.CRC32 != FrameCRC(frames[0].Data) {
+		t.Errorf("unexpected resent frame: %s", resent)
+	}
+	if frames := tracker.Unacked(start.Add(1500*time.Millisecond), time.Second); len(frames) != 0 {
+		t.Errorf("resent again before the interval: %x", frames)
+	}
+
+	// Once it's acked it's forgotten
+	forward(t, tracker, testFrame(testClient, testHost, 6, 12, nil))
+	if frames := tracker.Unacked(start.Add(time.Minute), time.Second); len(frames) != 0 {
+		t.Errorf("acked frame resent: %x", frames)
+	}
+	if stats := tracker.Stats()[FrameDirection{testHost, testClient}]; stats.Resent != 1 {
+		t.Errorf("unexpected stats: %s", stats)
+	}
+}
+
+func TestSequenceTrackerShortFrame(t *testing.T) {
+	if _, err := NewSequenceTracker().Forward(make([]byte, IEHeaderSize-1)); err == nil {
+		t.Error("short frame didn't return an error")
+	}
+}
@@ -0,0 +1,391 @@
+package ie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var ErrNoSpecDecoder = errors.New("no decoder for this spec message")
+
+// SpecMsg is the payload of a spec message, after the type and subtype and after decompression
+type SpecMsg interface {
+	Unmarshal(data []byte) error
+	Marshal() ([]byte, error)
+	String() string
+}
+
+type SpecMsgDirection uint8
+
+const (
+	SpecMsgDirectionUnknown SpecMsgDirection = iota
+	SpecMsgToServer                          // Requests and demands from a client to the host
+	SpecMsgToClient                          // Replies and announcements from the host
+)
+
+func (direction SpecMsgDirection) String() string {
+	switch direction {
+	case SpecMsgToServer:
+		return "Client => Server"
+	case SpecMsgToClient:
+		return "Server => Client"
+	}
+	return "Unknown"
+}
+
+// SpecMsgInfo describes one spec message subtype. Direction is which way the message normally goes, going by its
+// name, and is Unknown where the name doesn't tell us.
+//
+// New is nil until a capture of the message backs the payload's layout. Guess is a layout we've worked out
+// without one. DecodeSpecMsg never uses it, only GuessSpecMsg does, so nothing decodes or builds a guessed message
+// without asking for it.
+type SpecMsgInfo struct {
+	Type      uint8
+	SubType   uint8
+	TypeName  string
+	Name      string
+	Direction SpecMsgDirection
+	New       func() SpecMsg
+	Guess     func() SpecMsg
+}
+
+var specMsgTypeNames = make(map[uint8]string)
+var specMsgs = make(map[uint16]*SpecMsgInfo)
+
+func specMsgKey(msgType, msgSubType uint8) uint16 {
+	return uint16(msgType)<<8 | uint16(msgSubType)
+}
+
+// RegisterSpecMsg adds a spec message to the registry. Registering a type and subtype that's already there replaces
+// it. Only call it from init, the registry isn't locked.
+func RegisterSpecMsg(info SpecMsgInfo) {
+	if info.TypeName != "" {
+		specMsgTypeNames[info.Type] = info.TypeName
+	} else {
+		info.TypeName = specMsgTypeNames[info.Type]
+	}
+	specMsgs[specMsgKey(info.Type, info.SubType)] = &info
+}
+
+func registerSpecMsgType(msgType uint8, typeName string, subTypes []SpecMsgInfo) {
+	for _, info := range subTypes {
+		info.Type = msgType
+		info.TypeName = typeName
+		RegisterSpecMsg(info)
+	}
+}
+
+// LookupSpecMsg returns the registry entry for a spec message
+func LookupSpecMsg(msgType, msgSubType uint8) (SpecMsgInfo, bool) {
+	info, ok := specMsgs[specMsgKey(msgType, msgSubType)]
+	if !ok {
+		return SpecMsgInfo{}, false
+	}
+	return *info, true
+}
+
+// SpecMsgNames returns the names of a spec message type and subtype, or UNKNOWN for whichever we don't know
+func SpecMsgNames(msgType, msgSubType uint8) (string, string) {
+	typeName, ok := specMsgTypeNames[msgType]
+	if !ok {
+		typeName = "UNKNOWN"
+	}
+	if info, ok := specMsgs[specMsgKey(msgType, msgSubType)]; ok {
+		return typeName, info.Name
+	}
+	return typeName, "UNKNOWN"
+}
+
+// DecodeSpecMsg decodes a spec message payload with its registered decoder. Payloads we don't have a decoder for
+// return an error wrapping ErrNoSpecDecoder.
+func DecodeSpecMsg(msgType, msgSubType uint8, data []byte) (SpecMsg, error) {
+	info, ok := specMsgs[specMsgKey(msgType, msgSubType)]
+	if !ok || info.New == nil {
+		return nil, noSpecDecoder(msgType, msgSubType)
+	}
+	return unmarshalSpecMsg(info.New(), data)
+}
+
+func noSpecDecoder(msgType, msgSubType uint8) error {
+	typeName, name := SpecMsgNames(msgType, msgSubType)
+	return fmt.Errorf("ERROR: %s (%d) %s (%d): %w", typeName, msgType, name, msgSubType, ErrNoSpecDecoder)
+}
+
+// GuessSpecMsg decodes a spec message payload with the layout we've guessed for it, or its decoder if it has one.
+// None of the guessed field names have been checked against a capture. Payloads with neither return an error
+// wrapping ErrNoSpecDecoder.
+func GuessSpecMsg(msgType, msgSubType uint8, data []byte) (SpecMsg, error) {
+	info, ok := specMsgs[specMsgKey(msgType, msgSubType)]
+	if !ok || info.New != nil || info.Guess == nil {
+		return DecodeSpecMsg(msgType, msgSubType, data)
+	}
+	return unmarshalSpecMsg(info.Guess(), data)
+}
+
+func unmarshalSpecMsg(msg SpecMsg, data []byte) (SpecMsg, error) {
+	if err := msg.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// NewSpecMsgPacket builds a JM packet carrying msg. See NewJMMessage for what's filled in.
+func NewSpecMsgPacket(header IEHeader, msgType, msgSubType uint8, msg SpecMsg) (JMPacket, error) {
+	payload, err := msg.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return NewJMMessage(header, true, msgType, msgSubType, payload)
+}
+
+// specReader reads a spec message payload field by field. The first error sticks and makes every later read a no-op,
+// so decoders can read everything and check err once.
+type specReader struct {
+	data []byte
+	msg  string
+	err  error
+}
+
+func newSpecReader(msg string, data []byte) *specReader {
+	return &specReader{data: data, msg: msg}
+}
+
+func (reader *specReader) take(field string, size int) []byte {
+	if reader.err != nil {
+		return nil
+	}
+	if size < 0 || size > len(reader.data) {
+		reader.err = &PacketError{ErrShortPacket, reader.msg + "." + field, size, len(reader.data)}
+		return nil
+	}
+	ret := reader.data[:size]
+	reader.data = reader.data[size:]
+	return ret
+}
+
+// read fills in v, a fixed size value or struct
+func (reader *specReader) read(field string, v any) {
+	data := reader.take(field, binary.Size(v))
+	if data != nil {
+		binary.Read(bytes.NewReader(data), binary.BigEndian, v)
+	}
+}
+
+// bytes returns a copy of the next size bytes
+func (reader *specReader) bytes(field string, size int) []byte {
+	return append([]byte{}, reader.take(field, size)...)
+}
+
+// rest returns a copy of whatever hasn't been read, for payloads that carry more than we understand. Messages keep
+// it in their Rest field and Marshal writes it back after the fields we decode, so a message always encodes to the
+// bytes it came from and a layout that's wrong past the fields we know still forwards intact.
+func (reader *specReader) rest() []byte {
+	if reader.err != nil || len(reader.data) == 0 {
+		return nil
+	}
+	return reader.bytes("Rest", len(reader.data))
+}
+
+// done is for fixed size payloads, where anything left over means we've got the layout wrong
+func (reader *specReader) done() error {
+	if reader.err == nil && len(reader.data) > 0 {
+		reader.err = &PacketError{ErrLengthMismatch, reader.msg, 0, len(reader.data)}
+	}
+	return reader.err
+}
+
+// marshalSpecFields writes each field big endian, one after another. []byte fields are written as is.
+func marshalSpecFields(fields ...any) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for _, field := range fields {
+		if err := binary.Write(buf, binary.BigEndian, field); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// The names are the game's own. Names ending in a number are subtypes we've seen but haven't identified.
+func init() {
+	registerSpecMsgType(66, "PROGRESSBAR", []SpecMsgInfo{
+		{SubType: 83, Name: "PROGRESSBAR_STATUS"},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_CMESSAGE, "CMESSAGE", []SpecMsgInfo{
+		{SubType: 0, Name: "CMESSAGE_ADD_ACTION", Guess: newCMessageAction},
+		{SubType: 1, Name: "CMESSAGE_ADD_EFFECT"},
+		{SubType: 3, Name: "CMESSAGE_ANIMATION_CHANGE", Guess: newCMessageValue},
+		{SubType: 4, Name: "CMESSAGE_CHANGE_DIRECTION", Guess: newCMessageValue},
+		{SubType: 5, Name: "CMESSAGE_CLEAR_ACTIONS", Guess: newCMessageObject},
+		{SubType: 6, Name: "CMESSAGE_CLEAR_DIALOG_ACTIONS", Guess: newCMessageObject},
+		{SubType: 7, Name: "CMESSAGE_CLEAR_GROUP_SLOT", Guess: newCMessageObject},
+		{SubType: 8, Name: "CMESSAGE_CLEAR_TRIGGERS", Guess: newCMessageObject},
+		{SubType: 9, Name: "CMESSAGE_COLOR_CHANGE", Guess: newCMessageValue},
+		{SubType: 10, Name: "CMESSAGE_COLOR_RESET", Guess: newCMessageObject},
+		{SubType: 11, Name: "CMESSAGE_COLOR_UPDATE", Guess: newCMessageObject},
+		{SubType: 12, Name: "CMESSAGE_CONTAINER_ADD_ITEM", Guess: newCMessageItem},
+		{SubType: 13, Name: "CMESSAGE_CONTAINER_ITEMS", Guess: newCMessageContainerItems},
+		{SubType: 14, Name: "CMESSAGE_CONTAINER_STATUS", Guess: newCMessageValue},
+		{SubType: 15, Name: "CMESSAGE_CUT_SCENE_MODE_STATUS", Guess: newCMessageValue},
+		{SubType: 16, Name: "CMESSAGE_DISPLAY_TEXT"},
+		{SubType: 17, Name: "CMESSAGE_DISPLAY_TEXTREF", Guess: newCMessageValue},
+		{SubType: 19, Name: "CMESSAGE_DOOR_STATUS", Guess: newCMessageValue},
+		{SubType: 20, Name: "CMESSAGE_DROP_PATH", Guess: newCMessageObject},
+		{SubType: 21, Name: "CMESSAGE_ENTER_DIALOG"},
+		{SubType: 23, Name: "CMESSAGE_ENTER_STORE_MODE", Guess: newCMessageResRef},
+		{SubType: 24, Name: "CMESSAGE_EXIT_DIALOG_MODE", Guess: newCMessageObject},
+		{SubType: 25, Name: "CMESSAGE_EXIT_STORE_MODE", Guess: newCMessageObject},
+		{SubType: 26, Name: "CMESSAGE_FIRE_PROJECTILE"},
+		{SubType: 27, Name: "CMESSAGE_INSERT_ACTION", Guess: newCMessageAction},
+		{SubType: 29, Name: "CMESSAGE_LEAVE_PARTY", Guess: newCMessageObject},
+		{SubType: 31, Name: "CMESSAGE_PARTY_GOLD", Guess: newCMessageValue},
+		{SubType: 32, Name: "CMESSAGE_PLAY_SOUND", Guess: newCMessageResRef},
+		{SubType: 33, Name: "CMESSAGE_PLAY_SOUND_REF", Guess: newCMessageValue},
+		{SubType: 35, Name: "CMESSAGE_REMOVE_REPLIES", Guess: newCMessageObject},
+		{SubType: 36, Name: "CMESSAGE_REPUTATION_CHANGE", Guess: newCMessageValue},
+		{SubType: 37, Name: "CMESSAGE_SET_ACTIVE", Guess: newCMessageValue},
+		{SubType: 38, Name: "CMESSAGE_SET_AISPEED", Guess: newCMessageValue},
+		{SubType: 39, Name: "CMESSAGE_SET_COMMAND_PAUSE", Guess: newCMessageValue},
+		{SubType: 40, Name: "CMESSAGE_SET_DIALOG_WAIT", Guess: newCMessageValue},
+		{SubType: 41, Name: "CMESSAGE_SET_DIRECTION", Guess: newCMessageValue},
+		{SubType: 42, Name: "CMESSAGE_SET_DRAW_POLY", Guess: newCMessageValue},
+		{SubType: 43, Name: "CMESSAGE_SET_FORCE_ACTION_PICK", Guess: newCMessageValue},
+		{SubType: 44, Name: "CMESSAGE_SET_HAPPINESS", Guess: newCMessageValue},
+		{SubType: 45, Name: "CMESSAGE_SET_IN_CUT_SCENE", Guess: newCMessageValue},
+		{SubType: 46, Name: "CMESSAGE_SET_LAST_ATTACKER", Guess: newCMessageValue},
+		{SubType: 48, Name: "CMESSAGE_SET_NUM_TIMES_TALKED_TO", Guess: newCMessageValue},
+		{SubType: 49, Name: "CMESSAGE_SET_PATH", Guess: newCMessagePath},
+		{SubType: 50, Name: "CMESSAGE_SET_SEQUENCE", Guess: newCMessageValue},
+		{SubType: 52, Name: "CMESSAGE_SET_TRIGGER"},
+		{SubType: 47, Name: "CMESSAGE_SET_LAST_OBJECT", Guess: newCMessageValue},
+		{SubType: 54, Name: "CMESSAGE_SPRITE_DEATH", Guess: newCMessageObject},
+		{SubType: 55, Name: "CMESSAGE_SPRITE_EQUIPMENT"},
+		{SubType: 56, Name: "CMESSAGE_SPRITE_PETRIFY", Guess: newCMessageObject},
+		{SubType: 57, Name: "CMESSAGE_SPRITE_UPDATE", Guess: newCMessageSpriteUpdate},
+		{SubType: 58, Name: "CMESSAGE_START_FOLLOW", Guess: newCMessageValue},
+		{SubType: 59, Name: "CMESSAGE_START_SCROLL", Guess: newCMessagePoint},
+		{SubType: 60, Name: "CMESSAGE_STOP_ACTIONS", Guess: newCMessageObject},
+		{SubType: 61, Name: "CMESSAGE_STOP_FOLLOW", Guess: newCMessageObject},
+		{SubType: 62, Name: "CMESSAGE_TRIGGER_STATUS", Guess: newCMessageValue},
+		{SubType: 63, Name: "CMESSAGE_UNLOCK", Guess: newCMessageObject},
+		{SubType: 64, Name: "CMESSAGE_UPDATE_REACTION", Guess: newCMessageValue},
+		{SubType: 65, Name: "CMESSAGE_VERBAL_CONSTANT", Guess: newCMessageValue},
+		{SubType: 66, Name: "CMESSAGE_VISIBILITY_MAP_MOVE", Guess: newCMessagePoint},
+		{SubType: 67, Name: "CMESSAGE_VISUAL_EFFECT"},
+		{SubType: 68, Name: "CMESSAGE_SET_DIALOG_RESREF", Guess: newCMessageResRef},
+		{SubType: 69, Name: "CMESSAGE_ESCAPE_AREA", Guess: newCMessageObject},
+		{SubType: 70, Name: "CMESSAGE_DISPLAY_TEXTREF_SEND", Guess: newCMessageValue},
+		{SubType: 71, Name: "CMESSAGE_SET_CURRENT_ACTION_ID", Guess: newCMessageValue},
+		{SubType: 72, Name: "CMESSAGE_MOVE_GLOBAL", Guess: newCMessageMoveGlobal},
+		{SubType: 73, Name: "CMESSAGE_FADE_COLOR", Guess: newCMessageValue},
+		{SubType: 74, Name: "CMESSAGE_START_TEXT_SCREEN", Guess: newCMessageResRef},
+		{SubType: 75, Name: "CMESSAGE_SPAWNPT_ACTIVATE", Guess: newCMessageValue},
+		{SubType: 76, Name: "CMESSAGE_SPAWNPT_SPAWN", Guess: newCMessageResRef},
+		{SubType: 77, Name: "CMESSAGE_STATIC_START", Guess: newCMessageResRef},
+		{SubType: 78, Name: "CMESSAGE_STORE_ADD_ITEM", Guess: newCMessageItem},
+		{SubType: 79, Name: "CMESSAGE_STORE_REMOVE_ITEM", Guess: newCMessageItem},
+		{SubType: 80, Name: "CMESSAGE_FAMILIAR_ADD", Guess: newCMessageResRef},
+		{SubType: 81, Name: "CMESSAGE_FAMILIAR_REMOVE_RESREF", Guess: newCMessageResRef},
+		{SubType: 82, Name: "CMESSAGE_STOP_ESCAPE_AREA", Guess: newCMessageObject},
+		{SubType: 85, Name: "CMESSAGE_SET_TIME_STOP", Guess: newCMessageValue},
+		{SubType: 87, Name: "CMESSAGE_STORE_RELEASE", Guess: newCMessageObject},
+		{SubType: 90, Name: "CMESSAGE_90"},
+		{SubType: 91, Name: "CMESSAGE_FLOAT_TEXT"},
+		{SubType: 92, Name: "CMESSAGE_92"},
+		{SubType: 93, Name: "CMESSAGE_SET_PROTAGONIST", Guess: newCMessageObject},
+		{SubType: 94, Name: "CMESSAGE_START_COMBAT_MUSIC", Guess: newCMessageValue},
+		{SubType: 99, Name: "CMESSAGE_SCREENSHAKE", Guess: newCMessageValue},
+		{SubType: 100, Name: "CMESSAGE_STORE_DEMAND", Guess: newCMessageResRef},
+		{SubType: 101, Name: "CMESSAGE_101"},
+		{SubType: 102, Name: "CMESSAGE_WEAPON_IMMUNITIES_UPDATE"},
+		{SubType: 103, Name: "CMESSAGE_103"},
+		{SubType: 106, Name: "CMESSAGE_TOGGLE_INTERFACE", Guess: newCMessageValue},
+		{SubType: 107, Name: "CMESSAGE_107"},
+		{SubType: 109, Name: "CMESSAGE_SET_AREA_TYPE", Guess: newCMessageValue},
+		{SubType: 110, Name: "CMESSAGE_SET_AREA_REST_ENCOUNTER", Guess: newCMessageValue},
+		{SubType: 114, Name: "CMESSAGE_SET_AREA_EXPLORED"},
+		{SubType: 116, Name: "CMESSAGE_CHANGE_STAT", Guess: newCMessageChangeStat},
+		{SubType: 120, Name: "CMESSAGE_120"},
+		{SubType: 121, Name: "CMESSAGE_END_GAME", Guess: newCMessageObject},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_DIALOG, "DIALOG", []SpecMsgInfo{
+		{SubType: IE_SPEC_MSG_SUBTYPE_DIALOG_PERMIT_REQUEST, Name: "DIALOG_PERMIT_REQUEST", Direction: SpecMsgToServer, Guess: newIEDialogRequest},
+		{SubType: IE_SPEC_MSG_SUBTYPE_DIALOG_PERMIT_REPLY, Name: "DIALOG_PERMIT_REPLY", Direction: SpecMsgToClient, Guess: newIEDialogReply},
+		{SubType: IE_SPEC_MSG_SUBTYPE_DIALOG_CANCEL_REQUEST, Name: "DIALOG_CANCEL_REQUEST", Direction: SpecMsgToServer, Guess: newIEDialogRequest},
+		{SubType: IE_SPEC_MSG_SUBTYPE_DIALOG_KILL_OR_USE, Name: "DIALOG_KILL_OR_USE", Guess: newIEDialogRequest},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_SWAPITEM, "SWAPITEM", []SpecMsgInfo{
+		{SubType: IE_SPEC_MSG_SUBTYPE_SWAPITEM_REQUEST, Name: "SWAPITEM_REQUEST", Direction: SpecMsgToServer, Guess: newIESwapItemRequest},
+		{SubType: IE_SPEC_MSG_SUBTYPE_SWAPITEM_REPLY, Name: "SWAPITEM_REPLY", Direction: SpecMsgToClient, Guess: newIESwapItemReply},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_JOURNAL, "JOURNAL", []SpecMsgInfo{
+		{SubType: IE_SPEC_MSG_SUBTYPE_JOURNAL_ADD_ENTRY, Name: "JOURNAL_ADD_ENTRY", Guess: newIEJournalEntry},
+		{SubType: IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE, Name: "JOURNAL_ANNOUNCE", Direction: SpecMsgToClient, Guess: newIEJournalEntry},
+		{SubType: IE_SPEC_MSG_SUBTYPE_JOURNAL_ADD_USER_ENTRY, Name: "JOURNAL_ADD_USER_ENTRY", Guess: newIEJournalUserEntry},
+		{SubType: IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE_USER_ENTRY, Name: "JOURNAL_ANNOUNCE_USER_ENTRY", Direction: SpecMsgToClient, Guess: newIEJournalUserEntry},
+		{SubType: IE_SPEC_MSG_SUBTYPE_JOURNAL_CHANGE_ENTRY, Name: "JOURNAL_CHANGE_ENTRY", Guess: newIEJournalChange},
+		{SubType: IE_SPEC_MSG_SUBTYPE_JOURNAL_ANNOUNCE_CHANGE, Name: "JOURNAL_ANNOUNCE_CHANGE", Direction: SpecMsgToClient, Guess: newIEJournalChange},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_BIOGRAPHY, "BIOGRAPHY", []SpecMsgInfo{
+		{SubType: IE_SPEC_MSG_SUBTYPE_BIOGRAPHY_CHANGE, Name: "BIOGRAPHY_CHANGE", Guess: newIEBiography},
+		{SubType: IE_SPEC_MSG_SUBTYPE_BIOGRAPHY_CHANGE_ANNOUNCE, Name: "BIOGRAPHY_CHANGE_ANNOUNCE", Direction: SpecMsgToClient, Guess: newIEBiography},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_KICK_PLAYER, "KICK_PLAYER", []SpecMsgInfo{
+		{SubType: IE_SPEC_MSG_SUBTYPE_KICK_PLAYER_REQUEST, Name: "KICK_PLAYER_REQUEST", Direction: SpecMsgToServer, Guess: newIEKickPlayer},
+		{SubType: IE_SPEC_MSG_SUBTYPE_KICK_PLAYER_SERVER_SUPPORT, Name: "KICK_PLAYER_SERVER_SUPPORT", Guess: newIEKickPlayerServerSupport},
+		{SubType: IE_SPEC_MSG_SUBTYPE_KICK_PLAYER_HOOFED_OUT, Name: "KICK_PLAYER_HOOFED_OUT", Direction: SpecMsgToClient, Guess: newIEKickPlayer},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_MPSETTINGS, "MPSETTINGS", []SpecMsgInfo{
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSETTINGS_FULLDEMAND, Name: "MPSETTINGS_FULLDEMAND", Direction: SpecMsgToServer, Guess: newIEMPSettingsDemand},
+		{SubType: IE_SPEC_MSG_SUBTYPE_UPDATE_SERVER_ARBITRATION_INFO, Name: "MPSETTINGS_FULLSET", Direction: SpecMsgToClient, New: newIEMPSettingsFullSet},
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSETTINGS_PERMISSION, Name: "MPSETTINGS_PERMISSION", Guess: newIEMPSettingsPermission},
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSETTINGS_PLAYER_READY, Name: "MPSETTINGS_PLAYER_READY", Guess: newIEMPSettingsPlayerReady},
+		{SubType: IE_SPEC_MSG_SUBTYPE_TOGGLE_CHAR_READY, Name: "MPSETTINGS_CHAR_READY", New: newIEMPSettingsToggleCharReady},
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSETTINGS_CHAR_CONTROL, Name: "MPSETTINGS_CHAR_CONTROL", Guess: newIEMPSettingsCharControl},
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSETTINGS_IMPORTING, Name: "MPSETTINGS_IMPORTING", Guess: newIEMPSettingsFlag},
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSETTINGS_LISTEN_JOIN, Name: "MPSETTINGS_LISTEN_JOIN", Guess: newIEMPSettingsFlag},
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSETTINGS_SLOT_STATUS, Name: "MPSETTINGS_SLOT_STATUS", Guess: newIEMPSettingsSlotStatus},
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSETTINGS_LOCK_STATUS, Name: "MPSETTINGS_LOCK_STATUS", Guess: newIEMPSettingsBool},
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSETTINGS_LOCK_ALLOW_INPUT, Name: "MPSETTINGS_LOCK_ALLOW_INPUT", Guess: newIEMPSettingsBool},
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSETTINGS_LOCK_REQUEST, Name: "MPSETTINGS_LOCK_REQUEST", Direction: SpecMsgToServer, Guess: newIEMPSettingsDemand},
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSETTINGS_GORE_LEVEL, Name: "MPSETTINGS_GORE_LEVEL", Guess: newIEMPSettingsBool},
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSETTINGS_RESTRICT_STORE, Name: "MPSETTINGS_RESTRICT_STORE", Guess: newIEMPSettingsFlag},
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSETTINGS_NIGHTMAREMODE, Name: "MPSETTINGS_NIGHTMAREMODE", Guess: newIEMPSettingsBool},
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSETTINGS_DEMAND_NIGHTMAREMODE, Name: "MPSETTINGS_DEMAND_NIGHTMAREMODE", Direction: SpecMsgToServer, Guess: newIEMPSettingsDemand},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_OBJECT, "OBJECT", []SpecMsgInfo{
+		{SubType: IE_SPEC_MSG_SUBTYPE_OBJECT_ADD, Name: "OBJECT_ADD", Guess: newIEObjectAdd},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_PLAYERCHAR, "PLAYERCHAR", []SpecMsgInfo{
+		{SubType: IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_UPDATE_DEMAND, Name: "PLAYERCHAR_UPDATE_DEMAND", Direction: SpecMsgToServer, Guess: newIEPlayerChar},
+		{SubType: IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_UPDATE_REPLY, Name: "PLAYERCHAR_UPDATE_REPLY", Direction: SpecMsgToClient, Guess: newIEPlayerChar},
+		{SubType: IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_DEMAND_SLOT, Name: "PLAYERCHAR_DEMAND_SLOT", Direction: SpecMsgToServer, Guess: newIEPlayerCharDemand},
+		{SubType: IE_SPEC_MSG_SUBTYPE_PLAYERCHAR_DEMAND_REPLY, Name: "PLAYERCHAR_DEMAND_REPLY", Direction: SpecMsgToClient, Guess: newIEPlayerChar},
+		{SubType: 70, Name: "PLAYERCHAR_70"},
+		{SubType: 102, Name: "PLAYERCHAR_102"},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_PAUSING, "PAUSING", []SpecMsgInfo{
+		{SubType: IE_SPEC_MSG_SUBTYPE_PAUSING_PERMIT_REQUEST, Name: "PAUSING_PERMIT_REQUEST", Direction: SpecMsgToServer, Guess: newIEPausingRequest},
+		{SubType: IE_SPEC_MSG_SUBTYPE_PAUSING_ANNOUNCE, Name: "PAUSING_ANNOUNCE", Direction: SpecMsgToClient, Guess: newIEPausingAnnounce},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_RESOURCE, "RESOURCE", []SpecMsgInfo{
+		{SubType: IE_SPEC_MSG_SUBTYPE_RESOURCE_DEMAND, Name: "RESOURCE_DEMAND", Direction: SpecMsgToServer, Guess: newIEResourceDemand},
+	})
+	registerSpecMsgType(83, "SIGNAL", []SpecMsgInfo{
+		{SubType: 83, Name: "SIGNAL"},
+		{SubType: 82, Name: "SIGNAL_REQUEST", Direction: SpecMsgToServer},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_MPSYNCH, "MPSYNCH", []SpecMsgInfo{
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSYNCH_REQUEST, Name: "MPSYNCH_REQUEST", Direction: SpecMsgToServer, Guess: newIEMPSynch},
+		{SubType: IE_SPEC_MSG_SUBTYPE_MPSYNCH_REPLY, Name: "MPSYNCH_REPLY", Direction: SpecMsgToClient, Guess: newIEMPSynch},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_VERSION, "VERSION", []SpecMsgInfo{
+		{SubType: IE_SPEC_MSG_SUBTYPE_VERSION_SERVER, Name: "VERSION_SERVER", New: func() SpecMsg { return &IEVersion{} }},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_LEAVEAREALUA, "LEAVEAREALUA", []SpecMsgInfo{
+		{SubType: IE_SPEC_MSG_SUBTYPE_LEAVEAREALUA_PERMIT_REQUEST, Name: "LEAVEAREALUA_PERMIT_REQUEST", Direction: SpecMsgToServer, Guess: newIELeaveAreaLUA},
+	})
+	registerSpecMsgType(IE_SPEC_MSG_TYPE_LEAVEAREANAME, "LEAVEAREANAME", []SpecMsgInfo{
+		{SubType: IE_SPEC_MSG_SUBTYPE_LEAVEAREANAME_PERMIT_REQUEST, Name: "LEAVEAREANAME_PERMIT_REQUEST", Direction: SpecMsgToServer, Guess: newIELeaveAreaName},
+	})
+}
@@ -0,0 +1,156 @@
+package ie
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// guessFixture is a payload laid out by hand to match a guessed layout, and what it should decode to. Hex is easier to
+// check against the layout than a struct we'd marshal with the same code that decodes it.
+type guessFixture struct {
+	msgType, msgSubType uint8
+	payload             string
+	want                string
+}
+
+// testGuesses checks each fixture is only decoded when we ask for a guess, that its fields land where the layout says,
+// and that it encodes back to the same bytes
+func testGuesses(t *testing.T, fixtures []guessFixture) {
+	t.Helper()
+	for _, fixture := range fixtures {
+		_, name := SpecMsgNames(fixture.msgType, fixture.msgSubType)
+		payload, err := hex.DecodeString(fixture.payload)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := DecodeSpecMsg(fixture.msgType, fixture.msgSubType, payload); !errors.Is(err, ErrNoSpecDecoder) {
+			t.Errorf("%s: decoded without asking for a guess: %v", name, err)
+		}
+		msg, err := GuessSpecMsg(fixture.msgType, fixture.msgSubType, payload)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if msg.String() != fixture.want {
+			t.Errorf("%s: decoded %q, expected %q", name, msg, fixture.want)
+		}
+		encoded, err := msg.Marshal()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !bytes.Equal(encoded, payload) {
+			t.Errorf("%s: encoded differently:\n%x\n%x", name, payload, encoded)
+		}
+	}
+}
+
+func TestSpecMsgNames(t *testing.T) {
+	tests := []struct {
+		msgType, msgSubType uint8
+		typeName, name      string
+	}{
+		{IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_TOGGLE_CHAR_READY, "MPSETTINGS", "MPSETTINGS_CHAR_READY"},
+		{67, 90, "CMESSAGE", "CMESSAGE_90"},
+		{IE_SPEC_MSG_TYPE_MPSETTINGS, 0, "MPSETTINGS", "UNKNOWN"}, // A type we know keeps its name
+		{0, 0, "UNKNOWN", "UNKNOWN"},
+	}
+	for _, test := range tests {
+		typeName, name := SpecMsgNames(test.msgType, test.msgSubType)
+		if typeName != test.typeName || name != test.name {
+			t.Errorf("%d/%d: got %s %s, expected %s %s", test.msgType, test.msgSubType, typeName, name, test.typeName, test.name)
+		}
+	}
+	info, ok := LookupSpecMsg(IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_UPDATE_SERVER_ARBITRATION_INFO)
+	if !ok || info.Name != "MPSETTINGS_FULLSET" || info.TypeName != "MPSETTINGS" || info.Direction != SpecMsgToClient || info.New == nil {
+		t.Errorf("unexpected registry entry: %+v", info)
+	}
+}
+
+func TestDecodeSpecMsgSeeds(t *testing.T) {
+	for _, name := range []string{"toggle char ready", "compressed full set", "version server"} {
+		seed := seedJMPackets(t)[name]
+		jmPacket, err := NewJMPacket(seed, len(seed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload := jmPacket.PacketData()
+		if jmPacket.IsCompressed() {
+			payload = make([]byte, jmPacket.DecompressedSize()) // The seed compresses zeros
+		}
+		msg, err := DecodeSpecMsg(jmPacket.SpecType(), jmPacket.SpecSubType(), payload)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		_ = msg.String()
+		encoded, err := msg.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, payload) {
+			t.Errorf("%s: round trip mismatch:\n%x\n%x", name, payload, encoded)
+		}
+	}
+}
+
+func TestNewSpecMsgPacket(t *testing.T) {
+	header := IEHeader{PlayerIDFrom: 0x1000000, PlayerIDTo: 0xad4f6f00}
+	version := &IEVersion{VersionString: "v1.3", IEVersionFooter: IEVersionFooter{TimerUpdatesPerSecond: 0x1e}}
+	packet, err := NewSpecMsgPacket(header, IE_SPEC_MSG_TYPE_VERSION, IE_SPEC_MSG_SUBTYPE_VERSION_SERVER, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := packet.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jmPacket, err := NewJMPacket(data, len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := DecodeSpecMsg(jmPacket.SpecType(), jmPacket.SpecSubType(), jmPacket.PacketData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, ok := msg.(*IEVersion); !ok || decoded.VersionString != "v1.3" || decoded.VersionStringLen != 4 || decoded.TimerUpdatesPerSecond != 0x1e {
+		t.Errorf("unexpected version: %s", msg)
+	}
+}
+
+func TestDecodeSpecMsgErrors(t *testing.T) {
+	if _, err := DecodeSpecMsg(IE_SPEC_MSG_TYPE_CMESSAGE, 90, nil); !errors.Is(err, ErrNoSpecDecoder) {
+		t.Errorf("expected no decoder, got %v", err)
+	}
+	if _, err := DecodeSpecMsg(IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_TOGGLE_CHAR_READY, []byte{2, 0, 0}); !errors.Is(err, ErrShortPacket) {
+		t.Errorf("expected a short packet, got %v", err)
+	}
+	if _, err := DecodeSpecMsg(IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_TOGGLE_CHAR_READY, []byte{2, 0, 0, 0, 1, 0}); !errors.Is(err, ErrLengthMismatch) {
+		t.Errorf("expected a length mismatch for trailing data, got %v", err)
+	}
+	if _, err := DecodeSpecMsg(IE_SPEC_MSG_TYPE_VERSION, IE_SPEC_MSG_SUBTYPE_VERSION_SERVER, []byte{3, 10, 'v'}); !errors.Is(err, ErrShortPacket) {
+		t.Errorf("expected VersionStringLen past the end to be short, got %v", err)
+	}
+}
+
+func FuzzDecodeSpecMsg(f *testing.F) {
+	f.Add(IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_TOGGLE_CHAR_READY, []byte{0x02, 0x00, 0x00, 0x00, 0x01})
+	f.Add(IE_SPEC_MSG_TYPE_MPSETTINGS, IE_SPEC_MSG_SUBTYPE_UPDATE_SERVER_ARBITRATION_INFO, make([]byte, IEMPSettingsFullSetSize))
+	f.Add(IE_SPEC_MSG_TYPE_VERSION, IE_SPEC_MSG_SUBTYPE_VERSION_SERVER, append([]byte{0x03, 0x04}, "v1.3\x00\x00\x00\x00\x1e"...))
+	f.Add(IE_SPEC_MSG_TYPE_CMESSAGE, uint8(13), []byte{0, 0, 0x12, 0x34, 0, 1, 'S', 'W', '1', 'H', '0', '1', 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1})
+	f.Add(IE_SPEC_MSG_TYPE_CMESSAGE, uint8(49), []byte{0, 0, 0x12, 0x34, 0, 1, 0, 0, 0, 100, 0, 0, 0, 200, 0xff})
+	f.Fuzz(func(t *testing.T, msgType, msgSubType uint8, data []byte) {
+		// Guessing falls back to the decoders, so this covers both
+		msg, err := GuessSpecMsg(msgType, msgSubType, data)
+		if err != nil {
+			return
+		}
+		_ = msg.String()
+		encoded, err := msg.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, data) {
+			t.Fatalf("round trip mismatch:\n%x\n%x", data, encoded)
+		}
+	})
+}
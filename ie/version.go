@@ -0,0 +1,70 @@
+package ie
+
+import "fmt"
+
+// ParseVersion decodes the payload of a VERSION_SERVER spec message, after decompression
+func ParseVersion(data []byte) (IEVersion, error) {
+	var ieVersion IEVersion
+	err := ieVersion.Unmarshal(data)
+	return ieVersion, err
+}
+
+// Mismatches lists the fields that differ between two versions. The game won't let a player join a host whose
+// version doesn't match its own.
+func (ieVersion IEVersion) Mismatches(other IEVersion) []string {
+	var mismatches []string
+	if ieVersion.VersionString != other.VersionString {
+		mismatches = append(mismatches, fmt.Sprintf("VersionString %q != %q", ieVersion.VersionString, other.VersionString))
+	}
+	if ieVersion.ExpansionPack != other.ExpansionPack {
+		mismatches = append(mismatches, fmt.Sprintf("ExpansionPack 0x%x != 0x%x", ieVersion.ExpansionPack, other.ExpansionPack))
+	}
+	if ieVersion.TimerUpdatesPerSecond != other.TimerUpdatesPerSecond {
+		mismatches = append(mismatches, fmt.Sprintf("TimerUpdatesPerSecond %d != %d", ieVersion.TimerUpdatesPerSecond, other.TimerUpdatesPerSecond))
+	}
+	return mismatches
+}
+
+// VersionRewrite replaces the fields of an IEVersion that are set and leaves the rest alone
+type VersionRewrite struct {
+	VersionString         *string
+	ExpansionPack         *uint8
+	TimerUpdatesPerSecond *uint32
+}
+
+// IsSet reports whether the rewrite changes anything
+func (rewrite VersionRewrite) IsSet() bool {
+	return rewrite.VersionString != nil || rewrite.ExpansionPack != nil || rewrite.TimerUpdatesPerSecond != nil
+}
+
+// Apply rewrites ieVersion and reports whether it changed
+func (rewrite VersionRewrite) Apply(ieVersion *IEVersion) bool {
+	before := *ieVersion
+	if rewrite.VersionString != nil {
+		ieVersion.VersionString = *rewrite.VersionString
+	}
+	if rewrite.ExpansionPack != nil {
+		ieVersion.ExpansionPack = *rewrite.ExpansionPack
+	}
+	if rewrite.TimerUpdatesPerSecond != nil {
+		ieVersion.TimerUpdatesPerSecond = *rewrite.TimerUpdatesPerSecond
+	}
+	return len(before.Mismatches(*ieVersion)) > 0
+}
+
+func (rewrite VersionRewrite) String() string {
+	ret := ""
+	if rewrite.VersionString != nil {
+		ret += fmt.Sprintf(" VersionString: %q", *rewrite.VersionString)
+	}
+	if rewrite.ExpansionPack != nil {
+		ret += fmt.Sprintf(" ExpansionPack: 0x%x", *rewrite.ExpansionPack)
+	}
+	if rewrite.TimerUpdatesPerSecond != nil {
+		ret += fmt.Sprintf(" TimerUpdatesPerSecond: %d", *rewrite.TimerUpdatesPerSecond)
+	}
+	if ret == "" {
+		return "Nothing"
+	}
+	return ret[1:]
+}
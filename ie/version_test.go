@@ -0,0 +1,97 @@
+package ie
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"testing"
+)
+
+var testVersionPayload = append([]byte{0x03, 0x04}, "v1.3\x00\x00\x00\x00\x1e"...)
+
+func TestParseVersion(t *testing.T) {
+	ieVersion, err := ParseVersion(testVersionPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ieVersion.NumFields != 3 || ieVersion.VersionString != "v1.3" || ieVersion.ExpansionPack != 0 || ieVersion.TimerUpdatesPerSecond != 0x1e {
+		t.Errorf("unexpected version: %s", ieVersion)
+	}
+	if data, _ := ieVersion.Marshal(); !bytes.Equal(data, testVersionPayload) {
+		t.Errorf("round trip mismatch:\n%x\n%x", testVersionPayload, data)
+	}
+	if _, err := ParseVersion(testVersionPayload[:5]); !errors.Is(err, ErrShortPacket) {
+		t.Errorf("expected a short packet, got %v", err)
+	}
+}
+
+func TestVersionRewrite(t *testing.T) {
+	ieVersion, _ := ParseVersion(testVersionPayload)
+	original := ieVersion
+	if (VersionRewrite{}).IsSet() || (VersionRewrite{}).Apply(&ieVersion) {
+		t.Error("an empty rewrite changed something")
+	}
+
+	versionString := "v1.1"
+	expansionPack := uint8(1)
+	rewrite := VersionRewrite{VersionString: &versionString, ExpansionPack: &expansionPack}
+	if !rewrite.IsSet() || !rewrite.Apply(&ieVersion) {
+		t.Fatal("rewrite didn't change anything")
+	}
+	if ieVersion.VersionString != "v1.1" || ieVersion.ExpansionPack != 1 || ieVersion.TimerUpdatesPerSecond != 0x1e {
+		t.Errorf("unexpected rewritten version: %s", ieVersion)
+	}
+	if mismatches := original.Mismatches(ieVersion); len(mismatches) != 2 {
+		t.Errorf("expected 2 mismatches, got %q", mismatches)
+	}
+	if rewrite.Apply(&ieVersion) {
+		t.Error("rewriting twice changed something")
+	}
+}
+
+func TestReplaceSpecMsg(t *testing.T) {
+	versionString := "v1.1"
+	for _, compressed := range []uint8{0, 1} {
+		header := IEHeader{PlayerIDFrom: 0x1000000, PlayerIDTo: 0xad4f6f00, FrameNum: 3, Compressed: compressed}
+		packet, err := NewJMMessage(header, true, IE_SPEC_MSG_TYPE_VERSION, IE_SPEC_MSG_SUBTYPE_VERSION_SERVER, testVersionPayload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ieVersion, _ := ParseVersion(testVersionPayload)
+		VersionRewrite{VersionString: &versionString}.Apply(&ieVersion)
+		replaced, err := ReplaceSpecMsg(packet, &ieVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := replaced.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		jmPacket, err := NewJMPacket(data, len(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if jmPacket.FrameNumber() != 3 || jmPacket.IsCompressed() != (compressed == 1) || jmPacket.SpecType() != IE_SPEC_MSG_TYPE_VERSION {
+			t.Errorf("headers weren't kept: %s", jmPacket)
+		}
+		payload := jmPacket.PacketData()
+		if compressed == 1 {
+			z, err := zlib.NewReader(bytes.NewReader(payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if payload, err = io.ReadAll(z); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if decoded, err := ParseVersion(payload); err != nil || decoded.VersionString != "v1.1" {
+			t.Errorf("unexpected replaced version: %s %v", decoded, err)
+		}
+	}
+
+	packet, _ := NewJMMessage(IEHeader{}, false, 0, 0, []byte("hi"))
+	if _, err := ReplaceSpecMsg(packet, &IEVersion{}); !errors.Is(err, ErrNotSpecMsg) {
+		t.Errorf("expected ErrNotSpecMsg, got %v", err)
+	}
+}
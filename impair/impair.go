@@ -0,0 +1,464 @@
+package impair
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An impairment profile makes one direction of the link behave like a bad connection. It's written as key=value
+// settings on one line, with any number of profiles one per line in a file and # starting a comment:
+//
+//	from=server port=2350 delay=150ms jitter=40ms loss=2% burst=3
+//	from=client rate=56kbit queue=500ms
+//	reorder=1% gap=30ms dup=0.5%
+//
+// from and port pick which packets it applies to and match anything when they're left out. Each packet gets the most
+// specific profile that matches it, and the last of those if there's a tie, so a file can override the command line.
+//
+// delay is added to every packet and jitter moves it up to that much either way. loss is the chance a packet starts
+// a loss burst, and burst is how many packets the bursts lose on average. reorder is the chance a packet is held
+// back gap longer than the rest, which lets the packets behind it overtake it. dup is the chance a packet is sent
+// twice. rate caps the throughput in bit, kbit, mbit, B, kB or MB per second, and queue is how long a packet can wait
+// for it before it's dropped instead.
+//
+// Streams, TCP for us, can't lose or reorder anything without breaking, so for them only delay, jitter and rate
+// apply, and jitter never lets one packet overtake another.
+
+var ErrBadProfile = errors.New("bad impairment profile")
+
+const DefaultGap = 20 * time.Millisecond
+
+type Profile struct {
+	From      string // client, server, or empty for both
+	Port      int    // 0 for every port
+	Delay     time.Duration
+	Jitter    time.Duration
+	Loss      float64 // Chance a packet starts a loss burst
+	Burst     float64 // Average packets lost in a burst, 1 if it's not set
+	Reorder   float64
+	Gap       time.Duration // How much longer reordered packets are held, DefaultGap if it's not set
+	Duplicate float64
+	Rate      float64       // Bytes per second, 0 for no cap
+	Queue     time.Duration // Longest a packet waits for the rate cap, 0 for no limit
+}
+
+// ParseProfile reads one profile written as key=value settings
+func ParseProfile(line string) (Profile, error) {
+	profile := Profile{Burst: 1, Gap: DefaultGap}
+	for _, setting := range strings.Fields(line) {
+		key, value, ok := strings.Cut(setting, "=")
+		if !ok {
+			return Profile{}, fmt.Errorf("%w: %q isn't key=value", ErrBadProfile, setting)
+		}
+		var err error
+		switch key {
+		case "from":
+			if value != "client" && value != "server" {
+				err = errors.New("want client or server")
+			}
+			profile.From = value
+		case "port":
+			profile.Port, err = strconv.Atoi(value)
+			if err == nil && (profile.Port <= 0 || profile.Port > 0xffff) {
+				err = errors.New("not a port")
+			}
+		case "delay":
+			profile.Delay, err = parseDuration(value)
+		case "jitter":
+			profile.Jitter, err = parseDuration(value)
+		case "gap":
+			profile.Gap, err = parseDuration(value)
+		case "queue":
+			profile.Queue, err = parseDuration(value)
+		case "loss":
+			profile.Loss, err = parseChance(value)
+		case "reorder":
+			profile.Reorder, err = parseChance(value)
+		case "dup":
+			profile.Duplicate, err = parseChance(value)
+		case "burst":
+			profile.Burst, err = strconv.ParseFloat(value, 64)
+			if err == nil && profile.Burst < 1 {
+				err = errors.New("bursts are at least 1 packet")
+			}
+		case "rate":
+			profile.Rate, err = parseRate(value)
+		default:
+			return Profile{}, fmt.Errorf("%w: unknown setting %q", ErrBadProfile, key)
+		}
+		if err != nil {
+			return Profile{}, fmt.Errorf("%w: %s: %v", ErrBadProfile, setting, err)
+		}
+	}
+	return profile, nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err == nil && duration < 0 {
+		err = errors.New("negative duration")
+	}
+	return duration, err
+}
+
+// parseChance reads a percentage like 5% or a fraction like 0.05
+func parseChance(value string) (float64, error) {
+	scale := 1.0
+	if strings.HasSuffix(value, "%") {
+		value = strings.TrimSuffix(value, "%")
+		scale = 100
+	}
+	chance, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	chance /= scale
+	if chance < 0 || chance > 1 {
+		return 0, errors.New("not between 0 and 100%")
+	}
+	return chance, nil
+}
+
+// The rate units, in bytes per second
+var rateUnits = []struct {
+	suffix string
+	scale  float64
+}{
+	// Longest first so kbit isn't taken for bit
+	{"kbit", 1000 / 8.0},
+	{"mbit", 1000 * 1000 / 8.0},
+	{"bit", 1 / 8.0},
+	{"kB", 1000},
+	{"MB", 1000 * 1000},
+	{"B", 1},
+}
+
+func parseRate(value string) (float64, error) {
+	for _, unit := range rateUnits {
+		if !strings.HasSuffix(value, unit.suffix) {
+			continue
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSuffix(value, unit.suffix), 64)
+		if err != nil {
+			return 0, err
+		}
+		if rate < 0 {
+			return 0, errors.New("negative rate")
+		}
+		return rate * unit.scale, nil
+	}
+	return 0, errors.New("want a unit: bit, kbit, mbit, B, kB or MB")
+}
+
+func formatChance(chance float64) string {
+	return strconv.FormatFloat(chance*100, 'f', -1, 64) + "%"
+}
+
+// String writes the profile the way ParseProfile reads it, leaving out what isn't set
+func (profile Profile) String() string {
+	var settings []string
+	add := func(key, value string) {
+		settings = append(settings, key+"="+value)
+	}
+	if profile.From != "" {
+		add("from", profile.From)
+	}
+	if profile.Port != 0 {
+		add("port", strconv.Itoa(profile.Port))
+	}
+	if profile.Delay > 0 {
+		add("delay", profile.Delay.String())
+	}
+	if profile.Jitter > 0 {
+		add("jitter", profile.Jitter.String())
+	}
+	if profile.Loss > 0 {
+		add("loss", formatChance(profile.Loss))
+		if profile.Burst > 1 {
+			add("burst", strconv.FormatFloat(profile.Burst, 'f', -1, 64))
+		}
+	}
+	if profile.Reorder > 0 {
+		add("reorder", formatChance(profile.Reorder))
+		if profile.Gap != DefaultGap {
+			add("gap", profile.Gap.String())
+		}
+	}
+	if profile.Duplicate > 0 {
+		add("dup", formatChance(profile.Duplicate))
+	}
+	if profile.Rate > 0 {
+		add("rate", strconv.FormatFloat(profile.Rate*8/1000, 'f', -1, 64)+"kbit")
+		if profile.Queue > 0 {
+			add("queue", profile.Queue.String())
+		}
+	}
+	if len(settings) == 0 {
+		return "no impairment"
+	}
+	return strings.Join(settings, " ")
+}
+
+// Parse reads a file of profiles, one per line
+func Parse(data []byte) ([]Profile, error) {
+	var profiles []Profile
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		profile, err := ParseProfile(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, scanner.Err()
+}
+
+func (profile Profile) matches(from string, port int) bool {
+	return (profile.From == "" || profile.From == from) && (profile.Port == 0 || profile.Port == port)
+}
+
+func (profile Profile) specificity() int {
+	specificity := 0
+	if profile.Port != 0 {
+		specificity += 2
+	}
+	if profile.From != "" {
+		specificity++
+	}
+	return specificity
+}
+
+type linkKey struct {
+	from string
+	port int
+}
+
+// What we remember about one direction of one port
+type link struct {
+	busyUntil time.Time // When the rate cap lets the next packet start
+	last      time.Time // The latest send time we've given out, so streams stay in order
+	inBurst   bool
+	dropped   int
+	sent      int
+}
+
+// Impairer decides what happens to each packet. Its profiles come from the command line and, if it has one, a file
+// that it reloads when it changes.
+type Impairer struct {
+	lock     sync.Mutex
+	base     []Profile
+	profiles []Profile
+	links    map[linkKey]*link
+	random   *rand.Rand
+	path     string
+	modTime  time.Time
+	size     int64
+}
+
+// New starts an impairer with profiles and, unless path is empty, the ones in a file. seed makes the random choices
+// repeatable.
+func New(profiles []Profile, path string, seed int64) (*Impairer, error) {
+	impairer := &Impairer{
+		base:     append([]Profile{}, profiles...),
+		profiles: append([]Profile{}, profiles...),
+		links:    make(map[linkKey]*link),
+		random:   rand.New(rand.NewSource(seed)),
+		path:     path,
+	}
+	if _, err := impairer.Reload(); err != nil {
+		return nil, err
+	}
+	return impairer, nil
+}
+
+// SetProfiles replaces the profiles that didn't come from the file
+func (impairer *Impairer) SetProfiles(profiles []Profile) {
+	impairer.lock.Lock()
+	defer impairer.lock.Unlock()
+	fileProfiles := impairer.profiles[len(impairer.base):]
+	impairer.base = append([]Profile{}, profiles...)
+	impairer.profiles = append(append([]Profile{}, profiles...), fileProfiles...)
+}
+
+// Reload rereads the file if it's changed since we last read it. A file with a bad profile leaves the old ones in
+// place.
+func (impairer *Impairer) Reload() (bool, error) {
+	if impairer.path == "" {
+		return false, nil
+	}
+	info, err := os.Stat(impairer.path)
+	if err != nil {
+		return false, err
+	}
+	impairer.lock.Lock()
+	unchanged := info.ModTime().Equal(impairer.modTime) && info.Size() == impairer.size
+	impairer.lock.Unlock()
+	if unchanged {
+		return false, nil
+	}
+	data, err := os.ReadFile(impairer.path)
+	if err != nil {
+		return false, err
+	}
+	impairer.lock.Lock()
+	defer impairer.lock.Unlock()
+	// Don't keep retrying a broken file until it changes again
+	impairer.modTime = info.ModTime()
+	impairer.size = info.Size()
+	profiles, err := Parse(data)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", impairer.path, err)
+	}
+	impairer.profiles = append(append([]Profile{}, impairer.base...), profiles...)
+	return true, nil
+}
+
+// Watch reloads the file whenever it changes, checking every interval. It doesn't return.
+func (impairer *Impairer) Watch(interval time.Duration, logf func(format string, args ...any)) {
+	for range time.Tick(interval) {
+		changed, err := impairer.Reload()
+		if err != nil {
+			logf("Impairment not reloaded: %v", err)
+		} else if changed {
+			logf("Impairment reloaded:\n%s", impairer)
+		}
+	}
+}
+
+func (impairer *Impairer) profile(from string, port int) (Profile, bool) {
+	var best Profile
+	found := false
+	for _, profile := range impairer.profiles {
+		if profile.matches(from, port) && (!found || profile.specificity() >= best.specificity()) {
+			best = profile
+			found = true
+		}
+	}
+	return best, found
+}
+
+// jitter picks a delay in [delay-jitter, delay+jitter], never below 0
+func (impairer *Impairer) jitter(profile Profile) time.Duration {
+	delay := profile.Delay
+	if profile.Jitter > 0 {
+		delay += time.Duration(impairer.random.Int63n(int64(2*profile.Jitter)+1)) - profile.Jitter
+	}
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+func (impairer *Impairer) lost(profile Profile, state *link) bool {
+	if state.inBurst {
+		// Bursts end with a chance of 1/burst each packet, so on average they're burst long
+		if impairer.random.Float64() < 1/profile.Burst {
+			state.inBurst = false
+			return false
+		}
+		return true
+	}
+	if profile.Loss > 0 && impairer.random.Float64() < profile.Loss {
+		state.inBurst = profile.Burst > 1
+		return true
+	}
+	return false
+}
+
+// Schedule decides what happens to a packet of size bytes that arrived at now from one side on a port. It returns
+// when to send each copy of it, none if it's dropped. stream packets are never dropped, duplicated or reordered.
+func (impairer *Impairer) Schedule(from string, port int, size int, stream bool, now time.Time) []time.Time {
+	impairer.lock.Lock()
+	defer impairer.lock.Unlock()
+	key := linkKey{from, port}
+	state, ok := impairer.links[key]
+	if !ok {
+		state = &link{}
+		impairer.links[key] = state
+	}
+	profile, ok := impairer.profile(from, port)
+	if !ok {
+		profile = Profile{Burst: 1}
+		state.inBurst = false
+	}
+
+	if !stream && impairer.lost(profile, state) {
+		state.dropped++
+		return nil
+	}
+	departs := now
+	if profile.Rate > 0 {
+		if state.busyUntil.After(departs) {
+			departs = state.busyUntil
+		}
+		if !stream && profile.Queue > 0 && departs.Sub(now) > profile.Queue {
+			state.dropped++
+			return nil
+		}
+		state.busyUntil = departs.Add(time.Duration(float64(size) / profile.Rate * float64(time.Second)))
+		departs = state.busyUntil
+	}
+
+	sendAt := departs.Add(impairer.jitter(profile))
+	if stream {
+		if sendAt.Before(state.last) {
+			sendAt = state.last
+		}
+	} else if profile.Reorder > 0 && impairer.random.Float64() < profile.Reorder {
+		sendAt = sendAt.Add(profile.Gap)
+	}
+	if sendAt.After(state.last) {
+		state.last = sendAt
+	}
+	state.sent++
+	times := []time.Time{sendAt}
+	if !stream && profile.Duplicate > 0 && impairer.random.Float64() < profile.Duplicate {
+		times = append(times, departs.Add(impairer.jitter(profile)))
+	}
+	return times
+}
+
+func (impairer *Impairer) String() string {
+	impairer.lock.Lock()
+	defer impairer.lock.Unlock()
+	if len(impairer.profiles) == 0 {
+		return "No impairment"
+	}
+	keys := make([]linkKey, 0, len(impairer.links))
+	for key := range impairer.links {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].port != keys[j].port {
+			return keys[i].port < keys[j].port
+		}
+		return keys[i].from < keys[j].from
+	})
+	ret := ""
+	for i, profile := range impairer.profiles {
+		ret += fmt.Sprintf("%d: %s", i+1, profile)
+		for _, key := range keys {
+			if best, ok := impairer.profile(key.from, key.port); ok && best == profile {
+				state := impairer.links[key]
+				ret += fmt.Sprintf("\n\t%s on %d: %d sent, %d dropped", key.from, key.port, state.sent, state.dropped)
+			}
+		}
+		if i < len(impairer.profiles)-1 {
+			ret += "\n"
+		}
+	}
+	return ret
+}
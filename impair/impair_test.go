@@ -0,0 +1,249 @@
+package impair
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func testImpairer(t *testing.T, lines ...string) *Impairer {
+	t.Helper()
+	var profiles []Profile
+	for _, line := range lines {
+		profile, err := ParseProfile(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		profiles = append(profiles, profile)
+	}
+	impairer, err := New(profiles, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return impairer
+}
+
+func TestParseProfile(t *testing.T) {
+	profile, err := ParseProfile("from=server port=2350 delay=150ms jitter=40ms loss=2% burst=3 reorder=0.01 dup=50% rate=56kbit queue=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Profile{From: "server", Port: 2350, Delay: 150 * time.Millisecond, Jitter: 40 * time.Millisecond, Loss: 0.02, Burst: 3,
+		Reorder: 0.01, Gap: DefaultGap, Duplicate: 0.5, Rate: 7000, Queue: time.Second}
+	if profile != want {
+		t.Errorf("got %+v, want %+v", profile, want)
+	}
+	if again, err := ParseProfile(profile.String()); err != nil || again != profile {
+		t.Errorf("%s didn't parse back: %+v %v", profile, again, err)
+	}
+
+	for _, bad := range []string{"delay", "from=nobody", "port=0", "delay=soon", "loss=120%", "burst=0.5", "rate=56", "speed=fast", "jitter=-1s"} {
+		if _, err := ParseProfile(bad); !errors.Is(err, ErrBadProfile) {
+			t.Errorf("%s: expected ErrBadProfile, got %v", bad, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	profiles, err := Parse([]byte("# The lab's bad DSL\nfrom=server delay=100ms\n\nrate=1MB # Everything\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 || profiles[0].Delay != 100*time.Millisecond || profiles[1].Rate != 1000*1000 {
+		t.Errorf("unexpected profiles: %+v", profiles)
+	}
+	if _, err := Parse([]byte("delay=1ms\nloss=lots\n")); !errors.Is(err, ErrBadProfile) {
+		t.Errorf("expected ErrBadProfile, got %v", err)
+	}
+}
+
+func TestMostSpecific(t *testing.T) {
+	impairer := testImpairer(t, "delay=1ms", "from=server delay=2ms", "port=2350 delay=3ms", "port=2350 from=server delay=4ms", "from=server delay=5ms")
+	for _, test := range []struct {
+		from  string
+		port  int
+		delay time.Duration
+	}{
+		{"client", 47624, time.Millisecond},
+		{"server", 47624, 5 * time.Millisecond}, // The later of the two ties
+		{"client", 2350, 3 * time.Millisecond},
+		{"server", 2350, 4 * time.Millisecond},
+	} {
+		times := impairer.Schedule(test.from, test.port, 100, false, testTime)
+		if len(times) != 1 || times[0].Sub(testTime) != test.delay {
+			t.Errorf("%s on %d: got %v, want %s", test.from, test.port, times, test.delay)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	impairer := testImpairer(t, "delay=100ms jitter=20ms")
+	var early, late bool
+	for i := 0; i < 1000; i++ {
+		delay := impairer.Schedule("client", 2350, 100, false, testTime)[0].Sub(testTime)
+		if delay < 80*time.Millisecond || delay > 120*time.Millisecond {
+			t.Fatalf("delay %s out of range", delay)
+		}
+		early = early || delay < 90*time.Millisecond
+		late = late || delay > 110*time.Millisecond
+	}
+	if !early || !late {
+		t.Error("jitter doesn't cover its range")
+	}
+
+	// Streams stay in order
+	last := testTime
+	for i := 0; i < 1000; i++ {
+		sendAt := impairer.Schedule("server", 2300, 100, true, testTime.Add(time.Duration(i)*time.Millisecond))[0]
+		if sendAt.Before(last) {
+			t.Fatalf("stream packet %d overtook the one before it", i)
+		}
+		last = sendAt
+	}
+}
+
+func TestLoss(t *testing.T) {
+	count := func(impairer *Impairer, stream bool) (lost, bursts int) {
+		wasLost := false
+		for i := 0; i < 100000; i++ {
+			isLost := len(impairer.Schedule("client", 2350, 100, stream, testTime)) == 0
+			if isLost {
+				lost++
+				if !wasLost {
+					bursts++
+				}
+			}
+			wasLost = isLost
+		}
+		return lost, bursts
+	}
+	lost, bursts := count(testImpairer(t, "loss=10%"), false)
+	if lost < 9000 || lost > 11000 || float64(lost)/float64(bursts) > 1.3 {
+		t.Errorf("loss=10%%: lost %d in %d bursts", lost, bursts)
+	}
+	lost, bursts = count(testImpairer(t, "loss=5% burst=4"), false)
+	if average := float64(lost) / float64(bursts); average < 3.5 || average > 4.5 {
+		t.Errorf("burst=4: lost %d in %d bursts", lost, bursts)
+	}
+	if lost, _ := count(testImpairer(t, "loss=50%"), true); lost != 0 {
+		t.Errorf("streams lost %d packets", lost)
+	}
+}
+
+func TestReorderAndDuplicate(t *testing.T) {
+	impairer := testImpairer(t, "reorder=100% gap=30ms dup=100%")
+	times := impairer.Schedule("client", 2350, 100, false, testTime)
+	if len(times) != 2 || times[0].Sub(testTime) != 30*time.Millisecond || !times[1].Equal(testTime) {
+		t.Errorf("unexpected times: %v", times)
+	}
+	if times := impairer.Schedule("client", 2300, 100, true, testTime); len(times) != 1 || !times[0].Equal(testTime) {
+		t.Errorf("stream was reordered or duplicated: %v", times)
+	}
+}
+
+func TestRate(t *testing.T) {
+	// 1000 bytes a second makes 100 bytes take 100ms to get through
+	impairer := testImpairer(t, "rate=1kB queue=250ms")
+	for i, want := range []time.Duration{100, 200, 300, -1, -1} {
+		times := impairer.Schedule("client", 2350, 100, false, testTime)
+		if want < 0 {
+			if len(times) != 0 {
+				t.Errorf("packet %d wasn't dropped by the queue: %v", i, times)
+			}
+		} else if len(times) != 1 || times[0].Sub(testTime) != want*time.Millisecond {
+			t.Errorf("packet %d: got %v, want %dms", i, times, want)
+		}
+	}
+	// Streams wait instead
+	if times := impairer.Schedule("client", 2350, 100, true, testTime); len(times) != 1 || times[0].Sub(testTime) != 400*time.Millisecond {
+		t.Errorf("stream packet: %v", times)
+	}
+	// The other direction has its own cap
+	if times := impairer.Schedule("server", 2350, 100, false, testTime); len(times) != 1 || times[0].Sub(testTime) != 100*time.Millisecond {
+		t.Errorf("other direction: %v", times)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "impair.txt")
+	write := func(profiles string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(profiles), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base, _ := ParseProfile("delay=1ms")
+	write("from=server delay=2ms\n", testTime)
+	impairer, err := New([]Profile{base}, path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delay := func(from string) time.Duration {
+		return impairer.Schedule(from, 2350, 100, false, testTime)[0].Sub(testTime)
+	}
+	if delay("client") != time.Millisecond || delay("server") != 2*time.Millisecond {
+		t.Errorf("unexpected delays: %s %s", delay("client"), delay("server"))
+	}
+	if changed, err := impairer.Reload(); changed || err != nil {
+		t.Errorf("unchanged file reloaded: %t %v", changed, err)
+	}
+
+	write("from=server delay=3ms\n", testTime.Add(time.Minute))
+	if changed, err := impairer.Reload(); !changed || err != nil {
+		t.Fatalf("changed file didn't reload: %t %v", changed, err)
+	}
+	if delay("server") != 3*time.Millisecond {
+		t.Errorf("reload didn't apply: %s", delay("server"))
+	}
+
+	// A broken file keeps the old profiles
+	write("from=server delay=never\n", testTime.Add(2*time.Minute))
+	if _, err := impairer.Reload(); !errors.Is(err, ErrBadProfile) {
+		t.Errorf("expected ErrBadProfile, got %v", err)
+	}
+	if delay("server") != 3*time.Millisecond {
+		t.Errorf("broken file replaced the profiles: %s", delay("server"))
+	}
+
+	// Changing the base profiles keeps the file's
+	changed, _ := ParseProfile("delay=5ms")
+	impairer.SetProfiles([]Profile{changed})
+	if delay("client") != 5*time.Millisecond || delay("server") != 3*time.Millisecond {
+		t.Errorf("unexpected delays after SetProfiles: %s %s", delay("client"), delay("server"))
+	}
+}
+
+func TestSender(t *testing.T) {
+	sender := NewSender()
+	var lock sync.Mutex
+	var order []int
+	now := time.Now()
+	for i, delay := range []time.Duration{30, 10, 20, 10, 0} {
+		i := i
+		sender.At(now.Add(delay*time.Millisecond), func() {
+			lock.Lock()
+			order = append(order, i)
+			lock.Unlock()
+		})
+	}
+	sender.Close()
+	want := []int{4, 1, 3, 2, 0}
+	if len(order) != len(want) {
+		t.Fatalf("got %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got %v, want %v", order, want)
+		}
+	}
+	if elapsed := time.Since(now); elapsed < 30*time.Millisecond {
+		t.Errorf("sends ran early, all done after %s", elapsed)
+	}
+}
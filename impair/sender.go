@@ -0,0 +1,111 @@
+package impair
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Sender runs sends at the times Schedule picked. They run one at a time in time order, and in the order they were
+// queued when the times are the same, which separate timers wouldn't promise.
+type Sender struct {
+	lock    sync.Mutex
+	pending sendHeap
+	seq     uint64
+	wake    chan struct{}
+	closed  bool
+	done    chan struct{}
+}
+
+type pendingSend struct {
+	at   time.Time
+	seq  uint64
+	send func()
+}
+
+type sendHeap []pendingSend
+
+func (h sendHeap) Len() int { return len(h) }
+func (h sendHeap) Less(i, j int) bool {
+	if !h[i].at.Equal(h[j].at) {
+		return h[i].at.Before(h[j].at)
+	}
+	return h[i].seq < h[j].seq
+}
+func (h sendHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sendHeap) Push(x interface{}) { *h = append(*h, x.(pendingSend)) }
+func (h *sendHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func NewSender() *Sender {
+	sender := &Sender{wake: make(chan struct{}, 1), done: make(chan struct{})}
+	go sender.run()
+	return sender
+}
+
+// At queues send to run at a time. Sends queued after Close never run.
+func (sender *Sender) At(at time.Time, send func()) {
+	sender.lock.Lock()
+	if sender.closed {
+		sender.lock.Unlock()
+		return
+	}
+	heap.Push(&sender.pending, pendingSend{at, sender.seq, send})
+	sender.seq++
+	sender.lock.Unlock()
+	sender.poke()
+}
+
+// Close stops the sender once everything already queued has been sent, and waits for that
+func (sender *Sender) Close() {
+	sender.lock.Lock()
+	sender.closed = true
+	sender.lock.Unlock()
+	sender.poke()
+	<-sender.done
+}
+
+func (sender *Sender) poke() {
+	select {
+	case sender.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (sender *Sender) run() {
+	defer close(sender.done)
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	for {
+		sender.lock.Lock()
+		if len(sender.pending) == 0 {
+			closed := sender.closed
+			sender.lock.Unlock()
+			if closed {
+				return
+			}
+			<-sender.wake
+			continue
+		}
+		next := sender.pending[0]
+		if wait := time.Until(next.at); wait > 0 {
+			sender.lock.Unlock()
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-sender.wake:
+				if !timer.Stop() {
+					<-timer.C
+				}
+			}
+			continue
+		}
+		heap.Pop(&sender.pending)
+		sender.lock.Unlock()
+		next.send()
+	}
+}
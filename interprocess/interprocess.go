@@ -4,6 +4,10 @@ type PacketData struct {
 	Source, Dest, Port string
 	Size               int
 	Data               []byte
+	// Profile is the game iemitm thinks this is, empty until it knows
+	Profile string
+	// BadCRC is set when the frame's CRC was wrong as it came in, so the game will drop it
+	BadCRC bool
 }
 
 type RespPacketData struct {
@@ -11,4 +15,6 @@ type RespPacketData struct {
 	Size    int
 	Forward bool
 	Data    []byte
+	// ReplaceData, if set, is forwarded instead of the packet we were sent
+	ReplaceData []byte
 }
@@ -0,0 +1,500 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jaywalker/iemitm/crc"
+	"github.com/Jaywalker/iemitm/dplay"
+	"github.com/Jaywalker/iemitm/ie"
+)
+
+// A rules file is JSON like this:
+//
+//	{"rules": [
+//		{"name": "no pausing from the client", "match": {"from": "client", "spec_type": 81}, "action": "drop", "for": "10s"},
+//		{"match": {"from": "server", "frame_kind": 0}, "action": "delay", "delay": "200ms"},
+//		{"match": {"player_from": "0xad4f6f00"}, "action": "modify", "set": [{"field": "frame_kind", "value": 2}]},
+//		{"match": {"dplay_command": 1}, "action": "log"}
+//	]}
+//
+// Every rule that matches a packet applies, in order, until one drops it. Numbers can be JSON numbers or strings,
+// so player IDs can be written in hex. A rule with "for" stops matching that long after it's loaded. Reloading the
+// file keeps the load time of rules that didn't change and haven't expired, so editing one rule doesn't restart the
+// others, while saving the file again re-arms the ones that have run out.
+//
+// The rules see the UDP packets and the TCP messages iemitm forwards, so port and dplay_command match either. On TCP
+// a delay holds up everything behind it as well, since the stream can't be reordered.
+
+var ErrBadRule = errors.New("bad rule")
+
+const (
+	ActionDrop      = "drop"
+	ActionDelay     = "delay"
+	ActionDuplicate = "duplicate"
+	ActionModify    = "modify"
+	ActionLog       = "log"
+)
+
+// Number is a JSON number, or a string strconv.ParseUint understands
+type Number uint64
+
+func (number *Number) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		str = string(data)
+	}
+	value, err := strconv.ParseUint(str, 0, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %s isn't a number", ErrBadRule, data)
+	}
+	*number = Number(value)
+	return nil
+}
+
+// Duration is a JSON string time.ParseDuration understands
+type Duration time.Duration
+
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("%w: %s isn't a duration string", ErrBadRule, data)
+	}
+	value, err := time.ParseDuration(str)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadRule, err)
+	}
+	*duration = Duration(value)
+	return nil
+}
+
+// Match says which packets a rule applies to. Fields that aren't set match anything. The IE fields only match IE
+// frames on the game port and dplay_command only matches DPlay messages.
+type Match struct {
+	From         string  `json:"from,omitempty"` // client or server
+	Port         *Number `json:"port,omitempty"`
+	DPlayCommand *Number `json:"dplay_command,omitempty"`
+	FrameKind    *Number `json:"frame_kind,omitempty"`
+	SpecType     *Number `json:"spec_type,omitempty"`
+	SpecSubType  *Number `json:"spec_subtype,omitempty"`
+	PlayerFrom   *Number `json:"player_from,omitempty"`
+	PlayerTo     *Number `json:"player_to,omitempty"`
+}
+
+// The furthest into a packet an edit can start, since a UDP packet carries at most this much
+const maxOffset Number = 0xffff
+
+// Set is one edit made by a modify rule: either an IEHeader field set to Value, or Bytes written at Offset
+type Set struct {
+	Field  string  `json:"field,omitempty"`
+	Value  Number  `json:"value,omitempty"`
+	Offset *Number `json:"offset,omitempty"`
+	Bytes  string  `json:"bytes,omitempty"` // Hex
+}
+
+type Rule struct {
+	Name   string   `json:"name,omitempty"`
+	Match  Match    `json:"match"`
+	Action string   `json:"action"`
+	Delay  Duration `json:"delay,omitempty"`
+	Count  int      `json:"count,omitempty"` // Extra copies to send for duplicate, 1 if it's not set
+	Set    []Set    `json:"set,omitempty"`
+	For    Duration `json:"for,omitempty"`
+}
+
+// The IEHeader fields modify rules can set, with their offset and size
+var headerFields = map[string]struct{ offset, size int }{
+	"player_from":    {0, 4},
+	"player_to":      {4, 4},
+	"frame_kind":     {8, 1},
+	"frame_num":      {9, 2},
+	"frame_expected": {11, 2},
+	"compressed":     {13, 1},
+}
+
+func (rule Rule) String() string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return rule.Action + " " + rule.Match.String()
+}
+
+func (match Match) String() string {
+	var fields []string
+	add := func(name string, number *Number) {
+		if number != nil {
+			fields = append(fields, fmt.Sprintf("%s=0x%x", name, uint64(*number)))
+		}
+	}
+	if match.From != "" {
+		fields = append(fields, "from="+match.From)
+	}
+	add("port", match.Port)
+	add("dplay_command", match.DPlayCommand)
+	add("frame_kind", match.FrameKind)
+	add("spec_type", match.SpecType)
+	add("spec_subtype", match.SpecSubType)
+	add("player_from", match.PlayerFrom)
+	add("player_to", match.PlayerTo)
+	if len(fields) == 0 {
+		return "everything"
+	}
+	return strings.Join(fields, " ")
+}
+
+func (rule *Rule) check() error {
+	if rule.Match.From != "" && rule.Match.From != "client" && rule.Match.From != "server" {
+		return fmt.Errorf("%w: from has to be client or server, not %q", ErrBadRule, rule.Match.From)
+	}
+	switch rule.Action {
+	case ActionDrop, ActionLog:
+	case ActionDelay:
+		if rule.Delay <= 0 {
+			return fmt.Errorf("%w: delay needs a delay", ErrBadRule)
+		}
+	case ActionDuplicate:
+		if rule.Count < 0 {
+			return fmt.Errorf("%w: count can't be negative", ErrBadRule)
+		}
+		if rule.Count == 0 {
+			rule.Count = 1
+		}
+	case ActionModify:
+		if len(rule.Set) == 0 {
+			return fmt.Errorf("%w: modify needs something to set", ErrBadRule)
+		}
+		for _, set := range rule.Set {
+			if (set.Field == "") == (set.Offset == nil) {
+				return fmt.Errorf("%w: set needs a field or an offset", ErrBadRule)
+			}
+			if set.Field != "" {
+				if _, ok := headerFields[set.Field]; !ok {
+					return fmt.Errorf("%w: can't set %q", ErrBadRule, set.Field)
+				}
+			} else if _, err := hex.DecodeString(set.Bytes); err != nil || set.Bytes == "" {
+				return fmt.Errorf("%w: bytes has to be hex, not %q", ErrBadRule, set.Bytes)
+			} else if *set.Offset > maxOffset {
+				return fmt.Errorf("%w: offset %d is past the end of any UDP packet", ErrBadRule, *set.Offset)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrBadRule, rule.Action)
+	}
+	return nil
+}
+
+// Parse reads and checks the rules in a rules file
+func Parse(data []byte) ([]Rule, error) {
+	var file struct {
+		Rules []Rule `json:"rules"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, err
+	}
+	for i := range file.Rules {
+		if err := file.Rules[i].check(); err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i+1, file.Rules[i], err)
+		}
+	}
+	return file.Rules, nil
+}
+
+// Packet is what the rules see of a packet going through the proxy
+type Packet struct {
+	From  string // client or server
+	Port  int
+	DPlay bool // A DPlay message rather than an IE frame
+	Data  []byte
+}
+
+// Verdict is what the matching rules want done with a packet
+type Verdict struct {
+	Drop     bool
+	Delay    time.Duration
+	Copies   int  // Extra copies to send
+	Modified bool // Data was changed, and the CRC fixed if it's an IE frame
+	Logs     []string
+}
+
+type activeRule struct {
+	Rule
+	key     string
+	loaded  time.Time
+	matched int
+}
+
+func (rule *activeRule) expired(now time.Time) bool {
+	return rule.For > 0 && now.Sub(rule.loaded) >= time.Duration(rule.For)
+}
+
+// Engine holds the rules from a file and reloads them when it changes
+type Engine struct {
+	lock    sync.RWMutex
+	path    string
+	modTime time.Time
+	size    int64
+	rules   []*activeRule
+}
+
+// NewEngine starts an engine with rules that don't come from a file
+func NewEngine(rules []Rule, now time.Time) (*Engine, error) {
+	rules = append([]Rule{}, rules...)
+	for i := range rules {
+		if err := rules[i].check(); err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i+1, rules[i], err)
+		}
+	}
+	engine := &Engine{}
+	engine.setRules(rules, now)
+	return engine, nil
+}
+
+// Load starts an engine with the rules in a file
+func Load(path string, now time.Time) (*Engine, error) {
+	engine := &Engine{path: path}
+	if _, err := engine.Reload(now); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+func (engine *Engine) setRules(rules []Rule, now time.Time) {
+	loaded := make(map[string][]time.Time)
+	for _, rule := range engine.rules {
+		loaded[rule.key] = append(loaded[rule.key], rule.loaded)
+	}
+	active := make([]*activeRule, 0, len(rules))
+	for _, rule := range rules {
+		key, _ := json.Marshal(rule)
+		activated := &activeRule{Rule: rule, key: string(key), loaded: now}
+		// Rules that were already there keep counting from when they first loaded, unless they've run out
+		if times := loaded[activated.key]; len(times) > 0 {
+			if previous := (activeRule{Rule: rule, loaded: times[0]}); !previous.expired(now) {
+				activated.loaded = times[0]
+			}
+			loaded[activated.key] = times[1:]
+		}
+		active = append(active, activated)
+	}
+	engine.rules = active
+}
+
+// Reload rereads the file if it's changed since we last read it. A file with a bad rule leaves the old rules in place.
+func (engine *Engine) Reload(now time.Time) (bool, error) {
+	if engine.path == "" {
+		return false, nil
+	}
+	info, err := os.Stat(engine.path)
+	if err != nil {
+		return false, err
+	}
+	engine.lock.RLock()
+	unchanged := info.ModTime().Equal(engine.modTime) && info.Size() == engine.size
+	engine.lock.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	data, err := os.ReadFile(engine.path)
+	if err != nil {
+		return false, err
+	}
+	engine.lock.Lock()
+	defer engine.lock.Unlock()
+	// Don't keep retrying a broken file until it changes again
+	engine.modTime = info.ModTime()
+	engine.size = info.Size()
+	rules, err := Parse(data)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", engine.path, err)
+	}
+	engine.setRules(rules, now)
+	return true, nil
+}
+
+// Watch reloads the file whenever it changes, checking every interval. It doesn't return.
+func (engine *Engine) Watch(interval time.Duration, logf func(format string, args ...any)) {
+	for range time.Tick(interval) {
+		changed, err := engine.Reload(time.Now())
+		if err != nil {
+			logf("Rules not reloaded: %v", err)
+		} else if changed {
+			logf("Rules reloaded:\n%s", engine)
+		}
+	}
+}
+
+// frameFields is what the IE part of a match looks at
+type frameFields struct {
+	ok                    bool
+	frameKind             uint8
+	playerFrom, playerTo  uint32
+	spec                  bool
+	specType, specSubType uint8
+}
+
+func readFrameFields(data []byte) frameFields {
+	if len(data) < ie.IEHeaderSize {
+		return frameFields{}
+	}
+	fields := frameFields{
+		ok:         true,
+		playerFrom: binary.BigEndian.Uint32(data[0:]),
+		playerTo:   binary.BigEndian.Uint32(data[4:]),
+		frameKind:  data[8],
+	}
+	if jmPacket, err := ie.NewJMPacket(data, len(data)); err == nil && jmPacket.IsSpecMsg() {
+		fields.spec = true
+		fields.specType = jmPacket.SpecType()
+		fields.specSubType = jmPacket.SpecSubType()
+	}
+	return fields
+}
+
+func matches(number *Number, value uint64) bool {
+	return number == nil || uint64(*number) == value
+}
+
+func (match Match) matches(packet Packet, fields func() frameFields) bool {
+	if match.From != "" && match.From != packet.From {
+		return false
+	}
+	if !matches(match.Port, uint64(packet.Port)) {
+		return false
+	}
+	if match.DPlayCommand != nil {
+		command, ok := dplay.PeekCommand(packet.Data)
+		if !packet.DPlay || !ok || uint64(command) != uint64(*match.DPlayCommand) {
+			return false
+		}
+	}
+	if match.FrameKind == nil && match.SpecType == nil && match.SpecSubType == nil && match.PlayerFrom == nil && match.PlayerTo == nil {
+		return true
+	}
+	if packet.DPlay {
+		return false
+	}
+	frame := fields()
+	if !frame.ok {
+		return false
+	}
+	if (match.SpecType != nil || match.SpecSubType != nil) && !frame.spec {
+		return false
+	}
+	return matches(match.FrameKind, uint64(frame.frameKind)) &&
+		matches(match.SpecType, uint64(frame.specType)) &&
+		matches(match.SpecSubType, uint64(frame.specSubType)) &&
+		matches(match.PlayerFrom, uint64(frame.playerFrom)) &&
+		matches(match.PlayerTo, uint64(frame.playerTo))
+}
+
+// modify makes a rule's edits to data and reports whether it changed anything
+func (rule Rule) modify(packet Packet) bool {
+	modified := false
+	for _, set := range rule.Set {
+		if set.Field != "" {
+			field := headerFields[set.Field]
+			if packet.DPlay || len(packet.Data) < ie.IEHeaderSize {
+				continue
+			}
+			var value [8]byte
+			binary.BigEndian.PutUint64(value[:], uint64(set.Value))
+			copy(packet.Data[field.offset:field.offset+field.size], value[8-field.size:])
+			modified = true
+			continue
+		}
+		edit, _ := hex.DecodeString(set.Bytes)
+		offset := int(*set.Offset)
+		if offset > len(packet.Data)-len(edit) {
+			continue
+		}
+		copy(packet.Data[offset:], edit)
+		modified = true
+	}
+	return modified
+}
+
+// Apply runs a packet through the rules. Modify rules change packet.Data in place.
+func (engine *Engine) Apply(packet Packet, now time.Time) Verdict {
+	engine.lock.Lock()
+	defer engine.lock.Unlock()
+
+	var verdict Verdict
+	var fields *frameFields
+	var goodCRC bool
+	readFields := func() frameFields {
+		if fields == nil {
+			read := readFrameFields(packet.Data)
+			fields = &read
+		}
+		return *fields
+	}
+	for _, rule := range engine.rules {
+		if rule.expired(now) || !rule.Match.matches(packet, readFields) {
+			continue
+		}
+		rule.matched++
+		switch rule.Action {
+		case ActionDrop:
+			verdict.Drop = true
+			verdict.Logs = append(verdict.Logs, "Dropped by "+rule.String())
+			return verdict
+		case ActionDelay:
+			verdict.Delay += time.Duration(rule.Delay)
+		case ActionDuplicate:
+			verdict.Copies += rule.Count
+		case ActionModify:
+			if !verdict.Modified {
+				goodCRC = packet.DPlay || crc.Verify(packet.Data)
+			}
+			if rule.modify(packet) {
+				verdict.Modified = true
+				// Later rules match on what we've made of it
+				fields = nil
+			}
+		case ActionLog:
+			verdict.Logs = append(verdict.Logs, fmt.Sprintf("%s: %s => port %d, %d bytes", rule.String(), packet.From, packet.Port, len(packet.Data)))
+		}
+	}
+	// A frame that came in with a bad CRC keeps it, the game would have dropped it anyway
+	if verdict.Modified && !packet.DPlay && goodCRC {
+		crc.Fix(packet.Data)
+	}
+	return verdict
+}
+
+func (engine *Engine) String() string {
+	engine.lock.RLock()
+	defer engine.lock.RUnlock()
+	if len(engine.rules) == 0 {
+		return "No rules"
+	}
+	now := time.Now()
+	ret := ""
+	for i, rule := range engine.rules {
+		ret += fmt.Sprintf("%d: %s %s", i+1, rule.Action, rule.Match.String())
+		if rule.Name != "" {
+			ret += " (" + rule.Name + ")"
+		}
+		ret += fmt.Sprintf(" matched %d", rule.matched)
+		if rule.expired(now) {
+			ret += " - expired"
+		} else if rule.For > 0 {
+			ret += fmt.Sprintf(" - %s left", (time.Duration(rule.For) - now.Sub(rule.loaded)).Round(time.Second))
+		}
+		if i < len(engine.rules)-1 {
+			ret += "\n"
+		}
+	}
+	return ret
+}
@@ -0,0 +1,233 @@
+package rules
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Jaywalker/iemitm/crc"
+	"github.com/Jaywalker/iemitm/dplay"
+	"github.com/Jaywalker/iemitm/ie"
+)
+
+const testHost, testClient uint32 = 0x1000000, 0xad4f6f00
+
+var testTime = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func testPausing(t *testing.T) []byte {
+	t.Helper()
+	packet, err := ie.NewJMMessage(ie.IEHeader{PlayerIDFrom: testClient, PlayerIDTo: testHost, FrameNum: 5}, true, ie.IE_SPEC_MSG_TYPE_PAUSING, 0x52, []byte{1, 2, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := packet.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func testEngine(t *testing.T, rules string) *Engine {
+	t.Helper()
+	parsed, err := Parse([]byte(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := NewEngine(parsed, testTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+func TestParse(t *testing.T) {
+	rules, err := Parse([]byte(`{"rules": [
+		{"match": {"from": "client", "player_from": "0xad4f6f00", "port": 2350}, "action": "drop", "for": "10s"},
+		{"match": {}, "action": "duplicate"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || *rules[0].Match.PlayerFrom != Number(testClient) || *rules[0].Match.Port != 2350 || time.Duration(rules[0].For) != 10*time.Second {
+		t.Errorf("unexpected rules: %+v", rules)
+	}
+	if rules[1].Count != 1 {
+		t.Errorf("duplicate count defaulted to %d", rules[1].Count)
+	}
+
+	for _, bad := range []string{
+		`{"rules": [{"action": "explode"}]}`,
+		`{"rules": [{"match": {"from": "nobody"}, "action": "drop"}]}`,
+		`{"rules": [{"action": "delay"}]}`,
+		`{"rules": [{"action": "delay", "delay": "soon"}]}`,
+		`{"rules": [{"action": "modify"}]}`,
+		`{"rules": [{"action": "modify", "set": [{"field": "crc", "value": 1}]}]}`,
+		`{"rules": [{"action": "modify", "set": [{"offset": 3, "bytes": "xyz"}]}]}`,
+		`{"rules": [{"action": "modify", "set": [{"offset": "0xffffffffffffffff", "bytes": "00"}]}]}`,
+		`{"rules": [{"match": {"port": "lots"}, "action": "drop"}]}`,
+	} {
+		if _, err := Parse([]byte(bad)); !errors.Is(err, ErrBadRule) {
+			t.Errorf("%s: expected ErrBadRule, got %v", bad, err)
+		}
+	}
+	if _, err := Parse([]byte(`{"rules": [{"action": "drop", "typo": 1}]}`)); err == nil {
+		t.Error("unknown field didn't return an error")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	frame := testPausing(t)
+	enum := make([]byte, 52)
+	copy(enum[20:], "play")
+	enum[24] = byte(dplay.DPSP_MSG_TYPE_ENUMSESSIONS)
+
+	for _, test := range []struct {
+		match string
+		hit   []bool // The pausing frame from the client, the same from the server, a DPlay enum from the client
+	}{
+		{`{}`, []bool{true, true, true}},
+		{`{"from": "client"}`, []bool{true, false, true}},
+		{`{"port": 2350}`, []bool{true, true, false}},
+		{`{"spec_type": 81, "spec_subtype": 82}`, []bool{true, true, false}},
+		{`{"spec_type": 77}`, []bool{false, false, false}},
+		{`{"frame_kind": 0, "player_from": "0xad4f6f00", "player_to": 16777216}`, []bool{true, true, false}},
+		{`{"player_from": 1}`, []bool{false, false, false}},
+		{`{"dplay_command": 2}`, []bool{false, false, true}},
+	} {
+		engine := testEngine(t, `{"rules": [{"match": `+test.match+`, "action": "log"}]}`)
+		packets := []Packet{
+			{From: "client", Port: 2350, Data: frame},
+			{From: "server", Port: 2350, Data: frame},
+			{From: "client", Port: 47624, DPlay: true, Data: enum},
+		}
+		for i, packet := range packets {
+			if hit := len(engine.Apply(packet, testTime).Logs) == 1; hit != test.hit[i] {
+				t.Errorf("%s: packet %d matched %t", test.match, i, hit)
+			}
+		}
+	}
+}
+
+func TestActions(t *testing.T) {
+	engine := testEngine(t, `{"rules": [
+		{"match": {"from": "server"}, "action": "delay", "delay": "100ms"},
+		{"match": {"from": "server"}, "action": "delay", "delay": "50ms"},
+		{"match": {"from": "server"}, "action": "duplicate", "count": 2},
+		{"match": {"from": "client"}, "action": "modify", "set": [{"field": "frame_kind", "value": 2}, {"offset": 24, "bytes": "ffff"}]},
+		{"match": {"from": "client", "frame_kind": 2}, "action": "drop"},
+		{"match": {}, "action": "log"}
+	]}`)
+
+	verdict := engine.Apply(Packet{From: "server", Port: 2350, Data: testPausing(t)}, testTime)
+	if verdict.Drop || verdict.Delay != 150*time.Millisecond || verdict.Copies != 2 || verdict.Modified || len(verdict.Logs) != 1 {
+		t.Errorf("unexpected server verdict: %+v", verdict)
+	}
+
+	// The modify makes the drop match, and the drop stops the log
+	frame := testPausing(t)
+	verdict = engine.Apply(Packet{From: "client", Port: 2350, Data: frame}, testTime)
+	if !verdict.Drop || !verdict.Modified || len(verdict.Logs) != 1 {
+		t.Errorf("unexpected client verdict: %+v", verdict)
+	}
+	if frame[8] != 2 || frame[24] != 0xff || frame[25] != 0xff {
+		t.Errorf("frame wasn't modified: %x", frame)
+	}
+}
+
+func TestModifyFixesCRC(t *testing.T) {
+	engine := testEngine(t, `{"rules": [{"match": {}, "action": "modify", "set": [{"field": "frame_num", "value": "0x1234"}]}]}`)
+	frame := testPausing(t)
+	if verdict := engine.Apply(Packet{From: "client", Port: 2350, Data: frame}, testTime); !verdict.Modified {
+		t.Fatal("frame wasn't modified")
+	}
+	if frame[9] != 0x12 || frame[10] != 0x34 || !crc.Verify(frame) {
+		t.Errorf("FrameNum or CRC wrong: %x", frame)
+	}
+	// Offsets past the end are skipped
+	engine = testEngine(t, `{"rules": [{"match": {}, "action": "modify", "set": [{"offset": 1000, "bytes": "00"}]}]}`)
+	if verdict := engine.Apply(Packet{From: "client", Port: 2350, Data: frame}, testTime); verdict.Modified {
+		t.Error("edit past the end modified the frame")
+	}
+	engine = testEngine(t, `{"rules": [{"match": {}, "action": "modify", "set": [{"offset": "0xffff", "bytes": "00"}]}]}`)
+	if verdict := engine.Apply(Packet{From: "client", Port: 2350, Data: frame}, testTime); verdict.Modified {
+		t.Error("edit at the largest offset modified the frame")
+	}
+
+	// A frame that came in with a bad CRC is edited but keeps it
+	engine = testEngine(t, `{"rules": [{"match": {}, "action": "modify", "set": [{"field": "frame_num", "value": "0x4321"}]}]}`)
+	frame[14] ^= 0xff
+	if verdict := engine.Apply(Packet{From: "client", Port: 2350, Data: frame}, testTime); !verdict.Modified {
+		t.Fatal("frame wasn't modified")
+	}
+	if frame[9] != 0x43 || frame[10] != 0x21 || crc.Verify(frame) {
+		t.Errorf("bad CRC was repaired: %x", frame)
+	}
+}
+
+func TestRuleExpires(t *testing.T) {
+	engine := testEngine(t, `{"rules": [{"match": {}, "action": "drop", "for": "10s"}]}`)
+	packet := Packet{From: "client", Port: 2350, Data: testPausing(t)}
+	if !engine.Apply(packet, testTime.Add(9*time.Second)).Drop {
+		t.Error("rule expired early")
+	}
+	if engine.Apply(packet, testTime.Add(10*time.Second)).Drop {
+		t.Error("rule didn't expire")
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	write := func(rules string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	drop := `{"match": {"from": "client"}, "action": "drop", "for": "10s"}`
+	write(`{"rules": [`+drop+`]}`, testTime)
+	engine, err := Load(path, testTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := engine.Reload(testTime.Add(time.Second)); changed || err != nil {
+		t.Errorf("unchanged file reloaded: %t %v", changed, err)
+	}
+
+	// The drop rule keeps its load time, the new one starts now
+	write(`{"rules": [`+drop+`, {"match": {"from": "server"}, "action": "drop", "for": "10s"}]}`, testTime.Add(time.Minute))
+	if changed, err := engine.Reload(testTime.Add(5 * time.Second)); !changed || err != nil {
+		t.Fatalf("changed file didn't reload: %t %v", changed, err)
+	}
+	at := testTime.Add(12 * time.Second)
+	if engine.Apply(Packet{From: "client", Data: testPausing(t)}, at).Drop {
+		t.Error("unchanged rule restarted on reload")
+	}
+	if !engine.Apply(Packet{From: "server", Data: testPausing(t)}, at).Drop {
+		t.Error("new rule didn't start on reload")
+	}
+
+	// Saving the file again re-arms the drop rule once it's run out, and leaves the running one alone
+	write(`{"rules": [`+drop+`, {"match": {"from": "server"}, "action": "drop", "for": "10s"}]}`, testTime.Add(90*time.Second))
+	if changed, err := engine.Reload(at); !changed || err != nil {
+		t.Fatalf("saved file didn't reload: %t %v", changed, err)
+	}
+	if !engine.Apply(Packet{From: "client", Data: testPausing(t)}, at.Add(time.Second)).Drop {
+		t.Error("expired rule wasn't re-armed")
+	}
+	if engine.Apply(Packet{From: "server", Data: testPausing(t)}, testTime.Add(15*time.Second)).Drop {
+		t.Error("running rule restarted on reload")
+	}
+
+	// A broken file keeps the old rules
+	write(`{"rules": [{"action": "explode"}]}`, testTime.Add(2*time.Minute))
+	if _, err := engine.Reload(at); !errors.Is(err, ErrBadRule) {
+		t.Errorf("expected ErrBadRule, got %v", err)
+	}
+	if !engine.Apply(Packet{From: "server", Data: testPausing(t)}, at).Drop {
+		t.Error("broken file replaced the rules")
+	}
+}
@@ -0,0 +1,168 @@
+package script
+
+import (
+	"fmt"
+	"reflect"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Decoded messages go to Lua as tables keyed by their Go field names. Byte arrays and slices, which is most of the
+// unknown fields and every ResRef, become Lua strings. Other arrays and slices become lists, counted from 1 the Lua
+// way. Embedded structs are flattened into their parent the way Go promotes their fields.
+
+func toLua(state *lua.LState, value reflect.Value) lua.LValue {
+	switch value.Kind() {
+	case reflect.Bool:
+		return lua.LBool(value.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return lua.LNumber(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return lua.LNumber(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return lua.LNumber(value.Float())
+	case reflect.String:
+		return lua.LString(value.String())
+	case reflect.Array, reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(data), value)
+			return lua.LString(data)
+		}
+		table := state.NewTable()
+		for i := 0; i < value.Len(); i++ {
+			table.RawSetInt(i+1, toLua(state, value.Index(i)))
+		}
+		return table
+	case reflect.Struct:
+		table := state.NewTable()
+		structToLua(state, value, table)
+		return table
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return lua.LNil
+		}
+		return toLua(state, value.Elem())
+	}
+	return lua.LNil
+}
+
+func structToLua(state *lua.LState, value reflect.Value, table *lua.LTable) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			structToLua(state, value.Field(i), table)
+			continue
+		}
+		table.RawSetString(field.Name, toLua(state, value.Field(i)))
+	}
+}
+
+// fromLua sets value from what the script left in a table made by toLua. Anything the script set to nil is left
+// alone.
+func fromLua(lv lua.LValue, value reflect.Value, path string) error {
+	if lv == lua.LNil {
+		return nil
+	}
+	mismatch := func(want string) error {
+		return fmt.Errorf("%s: want %s, got %s", path, want, lv.Type())
+	}
+	switch value.Kind() {
+	case reflect.Bool:
+		b, ok := lv.(lua.LBool)
+		if !ok {
+			return mismatch("a boolean")
+		}
+		value.SetBool(bool(b))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := lv.(lua.LNumber)
+		if !ok {
+			return mismatch("a number")
+		}
+		value.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := lv.(lua.LNumber)
+		if !ok || n < 0 {
+			return mismatch("a positive number")
+		}
+		value.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		n, ok := lv.(lua.LNumber)
+		if !ok {
+			return mismatch("a number")
+		}
+		value.SetFloat(float64(n))
+	case reflect.String:
+		s, ok := lv.(lua.LString)
+		if !ok {
+			return mismatch("a string")
+		}
+		value.SetString(string(s))
+	case reflect.Array, reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			s, ok := lv.(lua.LString)
+			if !ok {
+				return mismatch("a string")
+			}
+			if value.Kind() == reflect.Slice {
+				value.Set(reflect.MakeSlice(value.Type(), len(s), len(s)))
+			} else if len(s) > value.Len() {
+				return fmt.Errorf("%s: %d bytes don't fit in %d", path, len(s), value.Len())
+			} else {
+				// Shorter strings are padded with zeros, like a ResRef
+				value.Set(reflect.Zero(value.Type()))
+			}
+			reflect.Copy(value, reflect.ValueOf([]byte(s)))
+			return nil
+		}
+		table, ok := lv.(*lua.LTable)
+		if !ok {
+			return mismatch("a table")
+		}
+		length := table.Len()
+		if value.Kind() == reflect.Slice {
+			value.Set(reflect.MakeSlice(value.Type(), length, length))
+		} else if length > value.Len() {
+			return fmt.Errorf("%s: %d entries don't fit in %d", path, length, value.Len())
+		}
+		for i := 0; i < length; i++ {
+			if err := fromLua(table.RawGetInt(i+1), value.Index(i), fmt.Sprintf("%s[%d]", path, i+1)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		table, ok := lv.(*lua.LTable)
+		if !ok {
+			return mismatch("a table")
+		}
+		return structFromLua(table, value, path)
+	case reflect.Ptr:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return fromLua(lv, value.Elem(), path)
+	}
+	return nil
+}
+
+func structFromLua(table *lua.LTable, value reflect.Value, path string) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := structFromLua(table, value.Field(i), path); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fromLua(table.RawGetString(field.Name), value.Field(i), path+"."+field.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,630 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jaywalker/iemitm/crc"
+	"github.com/Jaywalker/iemitm/dplay"
+	"github.com/Jaywalker/iemitm/ie"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// A script is Lua that defines any of these globals:
+//
+//	function on_dplay(pkt) ... end -- DPlay packets on the UDP ports we forward
+//	function on_frame(pkt) ... end -- game port frames
+//
+// Every packet gets a table with from ("client" or "server"), port and data, the packet as a string. DPlay packets
+// also get dplay, the decoded DPlay header: command, command_name, size, token, version, port, signature, and
+// app_guid for the packets that name the game. Frames also get header, the IEHeader fields, and JM frames that
+// aren't fragments get jm:
+//
+//	jm.spec, jm.spec_type, jm.spec_subtype  -- whether it's a spec message, and which
+//	jm.type_name, jm.name                   -- the spec message's names, if we know them
+//	jm.payload                              -- the data, decompressed
+//	jm.msg                                  -- the payload decoded, for spec messages we have a decoder for
+//
+// Changing data sends that instead. Otherwise changes to jm.msg, jm.payload, jm.spec_type or jm.spec_subtype rebuild
+// the frame, compressed if it was, and changes to header are written into it. The CRC is fixed after any change to a
+// frame that had a good one. Changes to dplay's command, size, token, version, port and app_guid are written into the
+// packet, command_name and signature are only for reading. Returning false drops the packet.
+//
+// The script runs once when it's loaded and its globals last for as long as it's loaded, so hooks can keep state
+// across packets. Scripts only get the base, table, string and math libraries, without the base functions that load
+// files, and each hook is stopped if it runs for longer than hookTimeout. The iemitm table has the helpers:
+//
+//	iemitm.inject(to, data)                            -- send data to "client" or "server" on this packet's port
+//	iemitm.jm(header, spec_type, spec_subtype, payload) -- build a JM frame, spec_type nil for plain JM
+//	iemitm.encode(spec_type, spec_subtype, msg)         -- marshal a table like jm.msg to a payload
+//	iemitm.log(...)                                    -- log through iemitm
+//	iemitm.hex(s)                                      -- hex dump a string
+//
+// iemitm gives the data frames a script injects the next FrameNum and FrameExpected in their direction, whatever the
+// script put in them, and sends them again until they're acked.
+
+var ErrScript = errors.New("script error")
+
+// How long a hook can run before it's stopped. Every packet behind the one it's looking at waits for it.
+const hookTimeout = 100 * time.Millisecond
+
+// How long the script can take to run when it's loaded
+const loadTimeout = time.Second
+
+// The libraries scripts get. There's no io, os, package or debug, so a script can only get at the packets it's given.
+var scriptLibs = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+// The base library functions that load files
+var fileFuncs = []string{"dofile", "loadfile", "require", "module"}
+
+// Packet is what a hook gets to look at
+type Packet struct {
+	From    string // "client" or "server"
+	Port    int
+	DPlay   bool
+	Data    []byte
+	Profile *ie.GameProfile // Picks the spec message decoders, nil for the shared ones
+}
+
+// Injection is a packet a script wants sent
+type Injection struct {
+	To   string
+	Data []byte
+}
+
+// Result is what the hook decided. Data is what to send in place of the packet, and is only set if Modified.
+type Result struct {
+	Drop     bool
+	Modified bool
+	Data     []byte
+	Inject   []Injection
+	Logs     []string
+}
+
+// Engine runs one script. Hooks run one at a time, the Lua state isn't safe to share.
+type Engine struct {
+	lock    sync.Mutex
+	state   *lua.LState
+	name    string
+	profile *ie.GameProfile
+	result  *Result
+}
+
+// The IEHeader fields scripts see, with their offset and size
+var headerFields = []struct {
+	name         string
+	offset, size int
+}{
+	{"player_from", 0, 4},
+	{"player_to", 4, 4},
+	{"frame_kind", 8, 1},
+	{"frame_num", 9, 2},
+	{"frame_expected", 11, 2},
+	{"compressed", 13, 1},
+}
+
+// The DPlay header fields scripts can change, how to read them and the most they hold
+var dplayFields = []struct {
+	name string
+	get  func(dplay.DPlayPacket) int
+	max  int
+}{
+	{"command", dplay.DPlayPacket.Command, 0xffff},
+	{"size", dplay.DPlayPacket.Size, 0xfffff},
+	{"token", dplay.DPlayPacket.Token, 0xfff},
+	{"port", dplay.DPlayPacket.Port, 0xffff},
+	{"version", dplay.DPlayPacket.Version, 0xffff},
+}
+
+func newState() *lua.LState {
+	state := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range scriptLibs {
+		state.Push(state.NewFunction(lib.open))
+		state.Push(lua.LString(lib.name))
+		state.Call(1, 0)
+	}
+	for _, name := range fileFuncs {
+		state.SetGlobal(name, lua.LNil)
+	}
+	return state
+}
+
+// NewEngine loads a script from source. name is used in error messages.
+func NewEngine(source string, name string) (*Engine, error) {
+	engine := &Engine{state: newState(), name: name}
+	engine.state.SetGlobal("iemitm", engine.module())
+	fn, err := engine.state.Load(strings.NewReader(source), name)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+		engine.state.SetContext(ctx)
+		engine.state.Push(fn)
+		err = engine.state.PCall(0, lua.MultRet, nil)
+		engine.state.RemoveContext()
+		cancel()
+	}
+	if err != nil {
+		engine.state.Close()
+		return nil, fmt.Errorf("%w: %v", ErrScript, err)
+	}
+	return engine, nil
+}
+
+// Load reads a script from a file
+func Load(path string) (*Engine, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewEngine(string(source), path)
+}
+
+// Close frees the Lua state. Don't use the engine after.
+func (engine *Engine) Close() {
+	engine.lock.Lock()
+	defer engine.lock.Unlock()
+	engine.state.Close()
+}
+
+// HasHook reports whether the script defines a hook, on_dplay or on_frame
+func (engine *Engine) HasHook(name string) bool {
+	engine.lock.Lock()
+	defer engine.lock.Unlock()
+	_, ok := engine.state.GetGlobal(name).(*lua.LFunction)
+	return ok
+}
+
+func (engine *Engine) String() string {
+	var hooks []string
+	for _, hook := range []string{"on_dplay", "on_frame"} {
+		if engine.HasHook(hook) {
+			hooks = append(hooks, hook)
+		}
+	}
+	if len(hooks) == 0 {
+		return engine.name + ": no hooks"
+	}
+	return engine.name + ": " + strings.Join(hooks, ", ")
+}
+
+// frameDPlay is a DPlay packet as we gave it to the script, so we can tell what it changed
+type frameDPlay struct {
+	packet dplay.DPlayPacket
+	table  *lua.LTable
+}
+
+// frameJM is a JM frame as we gave it to the script, so we can tell what it changed
+type frameJM struct {
+	packet   ie.JMPacket
+	table    *lua.LTable
+	payload  []byte
+	msg      ie.SpecMsg
+	msgTable lua.LValue
+}
+
+// Hook runs the script's hook for a packet. Errors come from the script or from re-encoding what it changed, and
+// leave the packet as it was, though anything it injected or logged before the error is still in the Result.
+func (engine *Engine) Hook(packet Packet) (Result, error) {
+	hook := "on_frame"
+	if packet.DPlay {
+		hook = "on_dplay"
+	}
+	engine.lock.Lock()
+	defer engine.lock.Unlock()
+	state := engine.state
+	fn, ok := state.GetGlobal(hook).(*lua.LFunction)
+	if !ok {
+		return Result{}, nil
+	}
+
+	var result Result
+	engine.profile = packet.Profile
+	engine.result = &result
+	defer func() {
+		engine.profile = nil
+		engine.result = nil
+	}()
+
+	pkt := state.NewTable()
+	pkt.RawSetString("from", lua.LString(packet.From))
+	pkt.RawSetString("port", lua.LNumber(packet.Port))
+	pkt.RawSetString("data", lua.LString(packet.Data))
+	var header *lua.LTable
+	var jm *frameJM
+	var dp *frameDPlay
+	if packet.DPlay {
+		dp = engine.dplayTable(packet.Data)
+		if dp != nil {
+			pkt.RawSetString("dplay", dp.table)
+		}
+	} else if len(packet.Data) >= ie.IEHeaderSize {
+		header = state.NewTable()
+		for _, field := range headerFields {
+			header.RawSetString(field.name, lua.LNumber(readField(packet.Data, field.offset, field.size)))
+		}
+		pkt.RawSetString("header", header)
+		jm = engine.jmTable(packet.Data)
+		if jm != nil {
+			pkt.RawSetString("jm", jm.table)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	state.SetContext(ctx)
+	defer state.RemoveContext()
+	if err := state.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, pkt); err != nil {
+		return result, fmt.Errorf("%w: %s: %v", ErrScript, hook, err)
+	}
+	ret := state.Get(-1)
+	state.Pop(1)
+	if ret == lua.LFalse {
+		result.Drop = true
+		return result, nil
+	}
+
+	data, err := engine.changes(packet.Data, pkt, header, jm, dp)
+	if err != nil {
+		return result, fmt.Errorf("%w: %s: %v", ErrScript, hook, err)
+	}
+	if data != nil {
+		result.Modified = true
+		result.Data = data
+	}
+	return result, nil
+}
+
+func readField(data []byte, offset, size int) uint32 {
+	var value uint32
+	for _, b := range data[offset : offset+size] {
+		value = value<<8 | uint32(b)
+	}
+	return value
+}
+
+func writeField(data []byte, offset, size int, value uint32) {
+	for i := size - 1; i >= 0; i-- {
+		data[offset+i] = byte(value)
+		value >>= 8
+	}
+}
+
+func (engine *Engine) dplayTable(data []byte) *frameDPlay {
+	if _, ok := dplay.PeekCommand(data); !ok {
+		return nil
+	}
+	packet := dplay.NewDPlayPacket(data)
+	if packet == nil {
+		return nil
+	}
+	table := engine.state.NewTable()
+	for _, field := range dplayFields {
+		table.RawSetString(field.name, lua.LNumber(field.get(packet)))
+	}
+	table.RawSetString("command_name", lua.LString(packet.CommandString()))
+	table.RawSetString("signature", lua.LString(packet.Signature()))
+	if guidPacket, ok := packet.(dplay.AppGUIDPacket); ok {
+		table.RawSetString("app_guid", lua.LString(guidPacket.AppGUID().String()))
+	}
+	return &frameDPlay{packet: packet, table: table}
+}
+
+func (engine *Engine) jmTable(data []byte) *frameJM {
+	if ident, ok := ie.FrameIdent(data); !ok || ident != "JM" {
+		return nil
+	}
+	packet, err := ie.NewJMPacket(data, len(data))
+	if err != nil {
+		// Fragments and frames that don't parse only get the header
+		return nil
+	}
+	payload, err := ie.DecompressPayload(packet)
+	if err != nil {
+		return nil
+	}
+	jm := &frameJM{packet: packet, table: engine.state.NewTable(), payload: payload, msgTable: lua.LNil}
+	jm.table.RawSetString("spec", lua.LBool(packet.IsSpecMsg()))
+	jm.table.RawSetString("compressed", lua.LBool(packet.IsCompressed()))
+	jm.table.RawSetString("payload", lua.LString(payload))
+	if packet.IsSpecMsg() {
+		jm.table.RawSetString("spec_type", lua.LNumber(packet.SpecType()))
+		jm.table.RawSetString("spec_subtype", lua.LNumber(packet.SpecSubType()))
+		if info, ok := engine.profile.LookupSpecMsg(packet.SpecType(), packet.SpecSubType()); ok {
+			jm.table.RawSetString("type_name", lua.LString(info.TypeName))
+			jm.table.RawSetString("name", lua.LString(info.Name))
+		}
+		if msg, err := engine.profile.DecodeSpecMsg(packet.SpecType(), packet.SpecSubType(), payload); err == nil {
+			jm.msg = msg
+			jm.msgTable = toLua(engine.state, reflect.ValueOf(msg))
+			jm.table.RawSetString("msg", jm.msgTable)
+		}
+	}
+	return jm
+}
+
+// changes works out what the script did to a packet and returns the new packet, or nil if it didn't change it. A
+// frame that came in with a bad CRC keeps a bad one, the game would have dropped it anyway.
+func (engine *Engine) changes(original []byte, pkt, header *lua.LTable, jm *frameJM, dp *frameDPlay) ([]byte, error) {
+	data, ok := pkt.RawGetString("data").(lua.LString)
+	if !ok {
+		return nil, errors.New("pkt.data isn't a string")
+	}
+	goodCRC := header != nil && len(original) >= crc.MinFrameSize && crc.Verify(original)
+	if string(data) != string(original) {
+		out := []byte(data)
+		if goodCRC && len(out) >= crc.MinFrameSize {
+			crc.Fix(out)
+		}
+		return out, nil
+	}
+	if dp != nil {
+		return rebuildDPlay(original, dp)
+	}
+	if header == nil {
+		return nil, nil
+	}
+
+	var out []byte
+	if jm != nil {
+		rebuilt, err := engine.rebuildJM(original, jm)
+		if err != nil {
+			return nil, err
+		}
+		out = rebuilt
+	}
+	for _, field := range headerFields {
+		value, ok := header.RawGetString(field.name).(lua.LNumber)
+		if !ok {
+			return nil, fmt.Errorf("header.%s isn't a number", field.name)
+		}
+		if uint32(value) == readField(original, field.offset, field.size) {
+			continue
+		}
+		if out == nil {
+			out = append([]byte{}, original...)
+		}
+		writeField(out, field.offset, field.size, uint32(value))
+	}
+	if out == nil {
+		return nil, nil
+	}
+	if goodCRC {
+		crc.Fix(out)
+	}
+	return out, nil
+}
+
+// rebuildDPlay gives back the packet with the script's changes to the dplay table written in, or nil if it didn't
+// change it
+func rebuildDPlay(original []byte, dp *frameDPlay) ([]byte, error) {
+	var out []byte
+	// The GUID goes first, where it is depends on the command
+	if guidPacket, ok := dp.packet.(dplay.AppGUIDPacket); ok {
+		value, ok := dp.table.RawGetString("app_guid").(lua.LString)
+		if !ok {
+			return nil, errors.New("dplay.app_guid isn't a string")
+		}
+		guid, err := dplay.ParseGUID(string(value))
+		if err != nil {
+			return nil, fmt.Errorf("dplay.app_guid: %v", err)
+		}
+		if guid != guidPacket.AppGUID() {
+			out = append([]byte{}, original...)
+			dplay.SetAppGUID(out, guid)
+		}
+	}
+
+	values := make([]int, len(dplayFields))
+	changed := false
+	for i, field := range dplayFields {
+		value, ok := dp.table.RawGetString(field.name).(lua.LNumber)
+		if !ok || value < 0 || value > lua.LNumber(field.max) {
+			return nil, fmt.Errorf("dplay.%s isn't a number up to 0x%x", field.name, field.max)
+		}
+		values[i] = int(value)
+		if values[i] != field.get(dp.packet) {
+			changed = true
+		}
+	}
+	if changed {
+		if out == nil {
+			out = append([]byte{}, original...)
+		}
+		dplay.RewriteHeader(out, dplay.DPPacketType(values[0]), values[1], values[2], values[3], values[4])
+	}
+	return out, nil
+}
+
+// rebuildJM gives back the frame re-encoded if the script changed the message, the payload or the spec type, or nil
+func (engine *Engine) rebuildJM(original []byte, jm *frameJM) ([]byte, error) {
+	packet := jm.packet
+	specType, specSubType := packet.SpecType(), packet.SpecSubType()
+	if packet.IsSpecMsg() {
+		var err error
+		if specType, err = tableUint8(jm.table, "spec_type"); err != nil {
+			return nil, err
+		}
+		if specSubType, err = tableUint8(jm.table, "spec_subtype"); err != nil {
+			return nil, err
+		}
+	}
+	payload, ok := jm.table.RawGetString("payload").(lua.LString)
+	if !ok {
+		return nil, errors.New("jm.payload isn't a string")
+	}
+	newPayload := []byte(payload)
+	changed := specType != packet.SpecType() || specSubType != packet.SpecSubType() || !bytes.Equal(newPayload, jm.payload)
+
+	if msgTable := jm.table.RawGetString("msg"); jm.msg != nil && msgTable != lua.LNil {
+		if msgTable != jm.msgTable {
+			return nil, errors.New("replace jm.msg's fields, not jm.msg")
+		}
+		before, err := jm.msg.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		// Start from a fresh decode so fields the table can't hold keep what they had
+		msg, err := engine.profile.DecodeSpecMsg(packet.SpecType(), packet.SpecSubType(), jm.payload)
+		if err != nil {
+			return nil, err
+		}
+		if err := fromLua(msgTable, reflect.ValueOf(msg), "jm.msg"); err != nil {
+			return nil, err
+		}
+		after, err := msg.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(before, after) {
+			newPayload = after
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, nil
+	}
+
+	header := ie.IEHeader{
+		PlayerIDFrom:  packet.FromPlayerID(),
+		PlayerIDTo:    packet.ToPlayerID(),
+		FrameKind_:    packet.FrameKind(),
+		FrameNum:      packet.FrameNumber(),
+		FrameExpected: packet.FrameNumberExpected(),
+	}
+	if packet.IsCompressed() {
+		header.Compressed = 1
+	}
+	rebuilt, err := ie.NewJMMessage(header, packet.IsSpecMsg(), specType, specSubType, newPayload)
+	if err != nil {
+		return nil, err
+	}
+	frame, err := rebuilt.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	// Keep the fragment bytes the frame came with
+	copy(frame[ie.IEHeaderSize+2:ie.IEHeaderSize+4], original[ie.IEHeaderSize+2:])
+	return frame, nil
+}
+
+func tableUint8(table *lua.LTable, key string) (uint8, error) {
+	value, ok := table.RawGetString(key).(lua.LNumber)
+	if !ok || value < 0 || value > 0xff {
+		return 0, fmt.Errorf("jm.%s isn't a byte", key)
+	}
+	return uint8(value), nil
+}
+
+// module is the iemitm table of helpers
+func (engine *Engine) module() *lua.LTable {
+	return engine.state.SetFuncs(engine.state.NewTable(), map[string]lua.LGFunction{
+		"inject": engine.luaInject,
+		"jm":     engine.luaJM,
+		"encode": engine.luaEncode,
+		"log":    engine.luaLog,
+		"hex":    luaHex,
+	})
+}
+
+func (engine *Engine) luaInject(state *lua.LState) int {
+	to := state.CheckString(1)
+	data := state.CheckString(2)
+	if to != "client" && to != "server" {
+		state.ArgError(1, `want "client" or "server"`)
+	}
+	if engine.result == nil {
+		state.RaiseError("iemitm.inject only works in a hook")
+	}
+	engine.result.Inject = append(engine.result.Inject, Injection{to, []byte(data)})
+	return 0
+}
+
+func (engine *Engine) luaJM(state *lua.LState) int {
+	table := state.CheckTable(1)
+	spec := state.Get(2) != lua.LNil
+	specType := uint8(state.OptInt(2, 0))
+	specSubType := uint8(state.OptInt(3, 0))
+	payload := state.CheckString(4)
+	var header ie.IEHeader
+	values := make(map[string]uint32)
+	for _, field := range headerFields {
+		switch value := table.RawGetString(field.name).(type) {
+		case lua.LNumber:
+			values[field.name] = uint32(value)
+		case *lua.LNilType:
+		default:
+			state.ArgError(1, field.name+" isn't a number")
+		}
+	}
+	header.PlayerIDFrom = values["player_from"]
+	header.PlayerIDTo = values["player_to"]
+	header.FrameKind_ = uint8(values["frame_kind"])
+	header.FrameNum = uint16(values["frame_num"])
+	header.FrameExpected = uint16(values["frame_expected"])
+	header.Compressed = uint8(values["compressed"])
+	packet, err := ie.NewJMMessage(header, spec, specType, specSubType, []byte(payload))
+	if err != nil {
+		state.RaiseError("%v", err)
+	}
+	frame, err := packet.Marshal()
+	if err != nil {
+		state.RaiseError("%v", err)
+	}
+	state.Push(lua.LString(frame))
+	return 1
+}
+
+func (engine *Engine) luaEncode(state *lua.LState) int {
+	specType := uint8(state.CheckInt(1))
+	specSubType := uint8(state.CheckInt(2))
+	table := state.CheckTable(3)
+	info, ok := engine.profile.LookupSpecMsg(specType, specSubType)
+	if !ok || info.New == nil {
+		state.RaiseError("no decoder for spec message %d %d", specType, specSubType)
+	}
+	msg := info.New()
+	if err := fromLua(table, reflect.ValueOf(msg), "msg"); err != nil {
+		state.ArgError(3, err.Error())
+	}
+	payload, err := msg.Marshal()
+	if err != nil {
+		state.RaiseError("%v", err)
+	}
+	state.Push(lua.LString(payload))
+	return 1
+}
+
+func (engine *Engine) luaLog(state *lua.LState) int {
+	var parts []string
+	for i := 1; i <= state.GetTop(); i++ {
+		parts = append(parts, state.ToStringMeta(state.Get(i)).String())
+	}
+	line := strings.Join(parts, " ")
+	if engine.result != nil {
+		engine.result.Logs = append(engine.result.Logs, line)
+	} else {
+		// Logged while the script was loading
+		fmt.Println("Script:", line)
+	}
+	return 0
+}
+
+func luaHex(state *lua.LState) int {
+	state.Push(lua.LString(hex.EncodeToString([]byte(state.CheckString(1)))))
+	return 1
+}
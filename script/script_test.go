@@ -0,0 +1,250 @@
+package script
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Jaywalker/iemitm/crc"
+	"github.com/Jaywalker/iemitm/dplay"
+	"github.com/Jaywalker/iemitm/ie"
+)
+
+const testHost, testClient uint32 = 0x1000000, 0xad4f6f00
+
+func testCharReady(t *testing.T, compressed uint8, status uint32) []byte {
+	t.Helper()
+	header := ie.IEHeader{PlayerIDFrom: testClient, PlayerIDTo: testHost, FrameNum: 5, Compressed: compressed}
+	packet, err := ie.NewSpecMsgPacket(header, ie.IE_SPEC_MSG_TYPE_MPSETTINGS, ie.IE_SPEC_MSG_SUBTYPE_TOGGLE_CHAR_READY, &ie.IEMPSettingsToggleCharReady{CharacterNum: 2, ReadyStatus: status})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := packet.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func testEngine(t *testing.T, source string) *Engine {
+	t.Helper()
+	engine, err := NewEngine(source, "test.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(engine.Close)
+	return engine
+}
+
+func TestNoHook(t *testing.T) {
+	engine := testEngine(t, `function on_dplay(pkt) return false end`)
+	result, err := engine.Hook(Packet{From: "client", Port: 2350, Data: testCharReady(t, 0, 1)})
+	if err != nil || result.Drop || result.Modified {
+		t.Errorf("frame without on_frame: %+v %v", result, err)
+	}
+	if engine.String() != "test.lua: on_dplay" {
+		t.Errorf("unexpected String: %s", engine)
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	for _, source := range []string{`function on_frame(`, `error("broken")`, `while true do end`} {
+		if _, err := NewEngine(source, "test.lua"); !errors.Is(err, ErrScript) {
+			t.Errorf("%s: expected ErrScript, got %v", source, err)
+		}
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	engine := testEngine(t, `
+		assert(io == nil and os == nil and debug == nil and package == nil)
+		assert(dofile == nil and loadfile == nil and require == nil)
+		assert(string.format and table.insert and math.floor and iemitm.hex)
+		function on_frame(pkt)
+			if pkt.header.frame_num == 5 then
+				while true do end
+			end
+		end`)
+	start := time.Now()
+	if _, err := engine.Hook(Packet{From: "client", Port: 2350, Data: testCharReady(t, 0, 7)}); !errors.Is(err, ErrScript) {
+		t.Errorf("expected ErrScript for a hook that doesn't return, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*hookTimeout {
+		t.Errorf("hook ran for %s", elapsed)
+	}
+	// The engine still works after a hook was stopped
+	frame := testCharReady(t, 0, 7)
+	frame[10] = 6
+	if _, err := engine.Hook(Packet{From: "client", Port: 2350, Data: frame}); err != nil {
+		t.Errorf("hook after a timeout: %v", err)
+	}
+}
+
+func TestDecodedFrame(t *testing.T) {
+	engine := testEngine(t, `
+		function on_frame(pkt)
+			assert(pkt.from == "client" and pkt.port == 2350)
+			assert(pkt.header.player_from == 0xad4f6f00 and pkt.header.frame_num == 5)
+			assert(pkt.jm.spec and pkt.jm.spec_type == 77 and pkt.jm.spec_subtype == 114)
+			assert(pkt.jm.type_name == "MPSETTINGS", pkt.jm.type_name)
+			iemitm.log("ready", pkt.jm.msg.ReadyStatus)
+		end`)
+	for _, compressed := range []uint8{0, 1} {
+		result, err := engine.Hook(Packet{From: "client", Port: 2350, Data: testCharReady(t, compressed, 7)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Drop || result.Modified || len(result.Logs) != 1 || result.Logs[0] != "ready 7" {
+			t.Errorf("compressed %d: unexpected result %+v", compressed, result)
+		}
+	}
+}
+
+func TestModifyMsg(t *testing.T) {
+	engine := testEngine(t, `
+		function on_frame(pkt)
+			pkt.jm.msg.ReadyStatus = 0x1234
+			pkt.header.frame_num = 6
+		end`)
+	for _, compressed := range []uint8{0, 1} {
+		result, err := engine.Hook(Packet{From: "client", Port: 2350, Data: testCharReady(t, compressed, 7)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Modified {
+			t.Fatalf("compressed %d: frame wasn't modified", compressed)
+		}
+		packet, err := ie.NewJMPacket(result.Data, len(result.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload, err := ie.DecompressPayload(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var charReady ie.IEMPSettingsToggleCharReady
+		if err := charReady.Unmarshal(payload); err != nil {
+			t.Fatal(err)
+		}
+		if charReady.ReadyStatus != 0x1234 || packet.FrameNumber() != 6 || packet.IsCompressed() != (compressed == 1) || !crc.Verify(result.Data) {
+			t.Errorf("compressed %d: unexpected frame %s %s", compressed, packet, charReady)
+		}
+	}
+}
+
+func TestModifyData(t *testing.T) {
+	engine := testEngine(t, `
+		function on_frame(pkt)
+			pkt.data = pkt.data:sub(1, 8) .. "\2" .. pkt.data:sub(10)
+		end`)
+	result, err := engine.Hook(Packet{From: "client", Port: 2350, Data: testCharReady(t, 0, 7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Modified || result.Data[8] != 2 || !crc.Verify(result.Data) {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestBadCRCStaysBad(t *testing.T) {
+	engine := testEngine(t, `function on_frame(pkt) pkt.header.frame_num = 6 end`)
+	frame := testCharReady(t, 0, 7)
+	frame[14] ^= 0xff
+	result, err := engine.Hook(Packet{From: "client", Port: 2350, Data: frame})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Modified || result.Data[10] != 6 || crc.Verify(result.Data) {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestBadMsg(t *testing.T) {
+	engine := testEngine(t, `function on_frame(pkt) pkt.jm.msg.ReadyStatus = "nobody" end`)
+	frame := testCharReady(t, 0, 7)
+	if _, err := engine.Hook(Packet{From: "client", Port: 2350, Data: frame}); !errors.Is(err, ErrScript) {
+		t.Errorf("expected ErrScript, got %v", err)
+	}
+	engine = testEngine(t, `function on_frame(pkt) error("oops") end`)
+	if _, err := engine.Hook(Packet{From: "client", Port: 2350, Data: frame}); !errors.Is(err, ErrScript) {
+		t.Errorf("expected ErrScript, got %v", err)
+	}
+}
+
+func TestStateAndInject(t *testing.T) {
+	engine := testEngine(t, `
+		local seen = 0
+		function on_frame(pkt)
+			seen = seen + 1
+			if seen == 2 then
+				local payload = iemitm.encode(77, 114, {CharacterNum = 2, ReadyStatus = 0x99})
+				iemitm.inject("server", iemitm.jm(pkt.header, 77, 114, payload))
+				return false
+			end
+		end`)
+	frame := testCharReady(t, 0, 7)
+	if result, err := engine.Hook(Packet{From: "client", Port: 2350, Data: frame}); err != nil || result.Drop || len(result.Inject) != 0 {
+		t.Fatalf("first packet: %+v %v", result, err)
+	}
+	result, err := engine.Hook(Packet{From: "client", Port: 2350, Data: frame})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Drop || len(result.Inject) != 1 || result.Inject[0].To != "server" {
+		t.Fatalf("second packet: %+v", result)
+	}
+	if want := testCharReady(t, 0, 0x99); !bytes.Equal(result.Inject[0].Data, want) {
+		t.Errorf("injected %x, want %x", result.Inject[0].Data, want)
+	}
+}
+
+func TestDPlay(t *testing.T) {
+	engine := testEngine(t, `
+		function on_dplay(pkt)
+			assert(pkt.dplay.command == 2 and pkt.dplay.signature == "play")
+			if pkt.from == "server" then return false end
+		end`)
+	enum := make([]byte, 52)
+	copy(enum[20:], "play")
+	enum[24] = byte(dplay.DPSP_MSG_TYPE_ENUMSESSIONS)
+	if result, err := engine.Hook(Packet{From: "client", Port: 47624, DPlay: true, Data: enum}); err != nil || result.Drop {
+		t.Errorf("client packet: %+v %v", result, err)
+	}
+	if result, err := engine.Hook(Packet{From: "server", Port: 47624, DPlay: true, Data: enum}); err != nil || !result.Drop {
+		t.Errorf("server packet: %+v %v", result, err)
+	}
+}
+
+func TestModifyDPlay(t *testing.T) {
+	engine := testEngine(t, `
+		function on_dplay(pkt)
+			pkt.dplay.port = 2301
+			pkt.dplay.token = 0xabc
+			pkt.dplay.app_guid = "{12345678-9ABC-DEF0-1122-334455667788}"
+		end`)
+	enum := make([]byte, 52)
+	copy(enum[20:], "play")
+	enum[24] = byte(dplay.DPSP_MSG_TYPE_ENUMSESSIONS)
+	result, err := engine.Hook(Packet{From: "client", Port: 47624, DPlay: true, Data: enum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Modified {
+		t.Fatal("packet wasn't modified")
+	}
+	packet, ok := dplay.NewDPlayPacket(result.Data).(dplay.AppGUIDPacket)
+	if !ok || packet.Port() != 2301 || packet.Token() != 0xabc || packet.Command() != int(dplay.DPSP_MSG_TYPE_ENUMSESSIONS) || packet.AppGUID().String() != "{12345678-9ABC-DEF0-1122-334455667788}" {
+		t.Errorf("unexpected packet: %v", packet)
+	}
+
+	for _, source := range []string{
+		`function on_dplay(pkt) pkt.dplay.token = 0x1000 end`,
+		`function on_dplay(pkt) pkt.dplay.app_guid = "nobody" end`,
+	} {
+		engine = testEngine(t, source)
+		if _, err := engine.Hook(Packet{From: "client", Port: 47624, DPlay: true, Data: enum}); !errors.Is(err, ErrScript) {
+			t.Errorf("%s: expected ErrScript, got %v", source, err)
+		}
+	}
+}